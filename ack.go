@@ -1,14 +1,46 @@
 package gosocketio
 
 import (
+	"context"
 	"errors"
+	"sort"
 	"sync"
+	"time"
+)
+
+const (
+	//how often expired waiters are looked for, when new ones are added
+	ackSweepInterval = time.Second
 )
 
 var (
 	ErrorWaiterNotFound = errors.New("Waiter not found")
+	ErrorAckTimeout     = errors.New("Ack timeout")
 )
 
+/**
+Response to ack call, or error if there will be none
+*/
+type ackResult struct {
+	args string
+	err  error
+}
+
+type ackWaiter struct {
+	result   chan ackResult
+	deadline time.Time //zero if waiter has no timeout
+}
+
+/**
+Pass error to the caller, unless response is already there
+*/
+func (w *ackWaiter) fail(err error) {
+	select {
+	case w.result <- ackResult{err: err}:
+	default:
+	}
+}
+
 /**
 Processes functions that require answers, also known as acknowledge or ack
 */
@@ -16,8 +48,10 @@ type ackProcessor struct {
 	counter     int
 	counterLock sync.Mutex
 
-	resultWaiters     map[int](chan string)
+	resultWaiters     map[int]*ackWaiter
 	resultWaitersLock sync.RWMutex
+	nextSweep         time.Time
+	closeErr          error //set when channel is closed, new waiters fail with it
 }
 
 /**
@@ -33,12 +67,42 @@ func (a *ackProcessor) getNextId() int {
 
 /**
 Just before the ack function called, the waiter should be added
-to wait and receive response to ack call
+to wait and receive response to ack call. Waiter with deadline
+gets ErrorAckTimeout if it is still there after deadline
 */
-func (a *ackProcessor) addWaiter(id int, w chan string) {
+func (a *ackProcessor) addWaiter(id int, deadline, now time.Time) (chan ackResult, error) {
 	a.resultWaitersLock.Lock()
+	defer a.resultWaitersLock.Unlock()
+
+	if a.closeErr != nil {
+		return nil, a.closeErr
+	}
+	if a.resultWaiters == nil {
+		a.resultWaiters = make(map[int]*ackWaiter)
+	}
+	a.sweep(now)
+
+	//buffered, so response coming after timeout does not block
+	w := &ackWaiter{result: make(chan ackResult, 1), deadline: deadline}
 	a.resultWaiters[id] = w
-	a.resultWaitersLock.Unlock()
+	return w.result, nil
+}
+
+/**
+Remove waiters left after their deadline, must be called under lock
+*/
+func (a *ackProcessor) sweep(now time.Time) {
+	if now.Before(a.nextSweep) {
+		return
+	}
+	a.nextSweep = now.Add(ackSweepInterval)
+
+	for id, w := range a.resultWaiters {
+		if !w.deadline.IsZero() && now.After(w.deadline) {
+			w.fail(ErrorAckTimeout)
+			delete(a.resultWaiters, id)
+		}
+	}
 }
 
 /**
@@ -53,12 +117,65 @@ func (a *ackProcessor) removeWaiter(id int) {
 /**
 check if waiter with given ack id is exists, and returns it
 */
-func (a *ackProcessor) getWaiter(id int) (chan string, error) {
+func (a *ackProcessor) getWaiter(id int) (chan ackResult, error) {
 	a.resultWaitersLock.RLock()
 	defer a.resultWaitersLock.RUnlock()
 
 	if waiter, ok := a.resultWaiters[id]; ok {
-		return waiter, nil
+		return waiter.result, nil
 	}
 	return nil, ErrorWaiterNotFound
 }
+
+/**
+Fail all waiters with given error, called once channel is closed
+*/
+func (a *ackProcessor) closeWaiters(err error) {
+	a.resultWaitersLock.Lock()
+	defer a.resultWaitersLock.Unlock()
+
+	if a.closeErr != nil {
+		return
+	}
+	a.closeErr = err
+	for id, w := range a.resultWaiters {
+		w.fail(err)
+		delete(a.resultWaiters, id)
+	}
+}
+
+/**
+get ids of acks still waiting for response
+*/
+func (a *ackProcessor) pendingIds() []int {
+	a.resultWaitersLock.RLock()
+	defer a.resultWaitersLock.RUnlock()
+
+	ids := make([]int, 0, len(a.resultWaiters))
+	for id := range a.resultWaiters {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+/**
+Default timeout of acks of the channel, 0 if there is none
+*/
+func (c *Channel) ackTimeout() time.Duration {
+	if c.server != nil {
+		return c.server.Options.AckTimeout
+	}
+	return c.defaultAckTimeout
+}
+
+/**
+Timeout of ack waiting until ctx is done, the default one
+applies only if ctx has no deadline
+*/
+func (c *Channel) contextAckTimeout(ctx context.Context) time.Duration {
+	if _, ok := ctx.Deadline(); ok {
+		return 0
+	}
+	return c.ackTimeout()
+}
@@ -0,0 +1,168 @@
+package gosocketio
+
+/**
+Targets of adapter broadcast: channels joined to any of Rooms, all
+channels of namespace if Rooms is empty, except channels with ids
+or joined to rooms listed in Except, like socket ids are rooms in socket.io.
+Volatile messages are skipped by slow channels, see Channel.EmitVolatile
+*/
+type BroadcastOptions struct {
+	Rooms    []string
+	Except   []string
+	Volatile bool
+}
+
+/**
+Room membership and broadcasts of one namespace.
+Default adapter keeps everything in memory of this process, others
+may deliver broadcasts to channels connected to other instances.
+Adapters created by Server.NewAdapter get the in-memory adapter as local
+and should pass membership changes and local delivery to it
+*/
+type Adapter interface {
+	AddToRoom(c *Channel, room string) error
+	RemoveFromRoom(c *Channel, room string) error
+	Broadcast(opts *BroadcastOptions, method string, args interface{}) error
+	//ids of local channels joined to any of rooms, all if rooms is empty
+	Sockets(rooms []string) []string
+}
+
+/**
+Get adapter of the namespace, created on first use
+*/
+func (r *registry) adapter() Adapter {
+	r.adapterOnce.Do(func() {
+		r.roomAdapter = r
+		if r.server != nil && r.server.NewAdapter != nil {
+			r.roomAdapter = r.server.NewAdapter(r.namespace, r)
+		}
+	})
+	return r.roomAdapter
+}
+
+/**
+Add channel to room of in-memory adapter, closed channel can not join
+because its joins are already cleaned up
+*/
+func (r *registry) AddToRoom(c *Channel, room string) error {
+	r.channelsLock.Lock()
+	defer r.channelsLock.Unlock()
+
+	if !c.IsAlive() {
+		return ErrorSocketClosed
+	}
+
+	cn := r.channels
+	if _, ok := cn[room]; !ok {
+		cn[room] = make(map[*Channel]struct{})
+	}
+
+	byRoom := r.rooms
+	if _, ok := byRoom[c]; !ok {
+		byRoom[c] = make(map[string]struct{})
+	}
+
+	cn[room][c] = struct{}{}
+	byRoom[c][room] = struct{}{}
+
+	return nil
+}
+
+/**
+Remove channel from room of in-memory adapter
+*/
+func (r *registry) RemoveFromRoom(c *Channel, room string) error {
+	r.channelsLock.Lock()
+	defer r.channelsLock.Unlock()
+
+	cn := r.channels
+	if _, ok := cn[room]; ok {
+		delete(cn[room], c)
+		if len(cn[room]) == 0 {
+			delete(cn, room)
+		}
+	}
+
+	byRoom := r.rooms
+	if _, ok := byRoom[c]; ok {
+		delete(byRoom[c], room)
+		if len(byRoom[c]) == 0 {
+			delete(byRoom, c)
+		}
+	}
+
+	return nil
+}
+
+/**
+Emit message to target channels of this process
+*/
+func (r *registry) Broadcast(opts *BroadcastOptions, method string, args interface{}) error {
+	r.server.broadcast(r.recipients(opts), method, args, sendOptions{volatile: opts.Volatile})
+	r.server.recordMissed(r.namespace, opts, method, args)
+	return nil
+}
+
+/**
+Get ids of target channels of this process
+*/
+func (r *registry) Sockets(rooms []string) []string {
+	channels := r.recipients(&BroadcastOptions{Rooms: rooms})
+
+	ids := make([]string, len(channels))
+	for i, cn := range channels {
+		ids[i] = cn.Id()
+	}
+	return ids
+}
+
+/**
+Collect target channels, channel joined to several rooms is taken once
+*/
+func (r *registry) recipients(opts *BroadcastOptions) []*Channel {
+	except := make(map[string]struct{}, len(opts.Except))
+	for _, id := range opts.Except {
+		except[id] = struct{}{}
+	}
+
+	var result []*Channel
+
+	r.channelsLock.RLock()
+	//channels of excepted rooms are skipped as if they were sent already
+	seen := make(map[*Channel]struct{})
+	for _, room := range opts.Except {
+		for cn := range r.channels[room] {
+			seen[cn] = struct{}{}
+		}
+	}
+
+	if len(opts.Rooms) == 0 {
+		r.channelsLock.RUnlock()
+
+		r.sidsLock.RLock()
+		defer r.sidsLock.RUnlock()
+
+		for id, cn := range r.sids {
+			_, skip := except[id]
+			if _, excepted := seen[cn]; !skip && !excepted {
+				result = append(result, cn)
+			}
+		}
+		return result
+	}
+	defer r.channelsLock.RUnlock()
+
+	for _, room := range opts.Rooms {
+		for cn := range r.channels[room] {
+			if _, skip := except[cn.Id()]; skip {
+				continue
+			}
+			if _, ok := seen[cn]; ok {
+				continue
+			}
+			seen[cn] = struct{}{}
+			result = append(result, cn)
+		}
+	}
+	return result
+}
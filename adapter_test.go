@@ -0,0 +1,83 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"sync"
+	"testing"
+)
+
+/**
+Pub/sub shared by in-process nodes, passes every broadcast to the
+other nodes encoded, like redis or nats adapter would
+*/
+type fakeBus struct {
+	adapters []*fakeAdapter
+	lock     sync.Mutex
+}
+
+type fakeAdapter struct {
+	Adapter
+	bus       *fakeBus
+	namespace string
+}
+
+func (b *fakeBus) newAdapter(namespace string, local Adapter) Adapter {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	a := &fakeAdapter{Adapter: local, bus: b, namespace: namespace}
+	b.adapters = append(b.adapters, a)
+	return a
+}
+
+func (a *fakeAdapter) Broadcast(opts *BroadcastOptions, method string, args interface{}) error {
+	if err := a.Adapter.Broadcast(opts, method, args); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+
+	a.bus.lock.Lock()
+	remote := make([]*fakeAdapter, 0, len(a.bus.adapters))
+	for _, other := range a.bus.adapters {
+		if other != a && other.namespace == a.namespace {
+			remote = append(remote, other)
+		}
+	}
+	a.bus.lock.Unlock()
+
+	for _, other := range remote {
+		other.Adapter.Broadcast(opts, method, json.RawMessage(data))
+	}
+	return nil
+}
+
+func TestBroadcastToOtherNode(t *testing.T) {
+	bus := &fakeBus{}
+	tr1, tr2 := gosocketiotest.NewTransport(), gosocketiotest.NewTransport()
+	s1, s2 := NewServer(tr1), NewServer(tr2)
+	s1.NewAdapter = bus.newAdapter
+	s2.NewAdapter = bus.newAdapter
+
+	first := roomClients(t, s1, tr1, "room", 1)
+	second := roomClients(t, s2, tr2, "room", 2)
+
+	s1.BroadcastTo("room", "news", "from first")
+	first[0].expect(t, "from first")
+	for _, rc := range second {
+		rc.expect(t, "from first")
+	}
+
+	//sender is excluded, other node still gets it
+	second[0].server.BroadcastTo("room", "news", "from second")
+	first[0].expect(t, "from second")
+	second[1].expect(t, "from second")
+	second[0].expectNothing(t)
+
+	s2.BroadcastTo("elsewhere", "news", "nobody")
+	first[0].expectNothing(t)
+}
@@ -0,0 +1,291 @@
+/**
+Token authentication of socket.io connections. Client sends token
+in auth object of connect packet, server verifies it and keeps its
+claims on the channel until the token expires. Client sends new
+token with refresh event to stay connected:
+
+	authenticator := auth.New(auth.HS256(secret))
+	authenticator.Register(server)
+
+	server.On("send", func(c *gosocketio.Channel, msg Message) {
+		claims, _ := auth.ClaimsOf(c)
+		log.Println("message from", claims.Subject())
+	})
+
+	//client side
+	c, err := gosocketio.DialConfig(ctx, url, tr, gosocketio.ClientConfig{Auth: auth.Token(token)})
+	exp, err := auth.Refresh(&c.Channel, newToken, time.Second)
+*/
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio"
+	"sync"
+	"time"
+)
+
+const (
+	//field of auth object with token, like socket.io clients send it
+	DefaultTokenField = "token"
+	//event client sends new token with
+	DefaultRefreshEvent = "auth:refresh"
+
+	//channel value with session, see gosocketio.Channel.Set
+	sessionKey = "auth.session"
+)
+
+var (
+	ErrorNoToken        = errors.New("No token")
+	ErrorNotAuthorized  = errors.New("Not authorized")
+	ErrorSubjectChanged = errors.New("Token subject changed")
+)
+
+/**
+Connect and event handlers of namespace, both gosocketio.Server
+and *gosocketio.Namespace have them
+*/
+type Handlers interface {
+	UseConnect(f gosocketio.ConnectMiddleware)
+	On(method string, f interface{}) error
+}
+
+/**
+Verifies tokens of connecting sockets and refreshes them,
+channels are closed when their token expires
+*/
+type Authenticator struct {
+	Verify Verifier
+	//DefaultTokenField if empty
+	TokenField string
+	//DefaultRefreshEvent if empty
+	RefreshEvent string
+}
+
+/**
+Reply to refresh event, with new expiry or error
+*/
+type RefreshResult struct {
+	ExpiresAt int64  `json:"exp,omitempty"` //unix time, 0 if token does not expire
+	Error     string `json:"error,omitempty"`
+}
+
+/**
+Claims and expiry timer of authenticated channel
+*/
+type session struct {
+	claims Claims
+	timer  gosocketio.Timer
+	stop   chan struct{} //closed when timer is stopped
+	lock   sync.Mutex
+}
+
+/**
+Create authenticator with given verifier, like HS256
+*/
+func New(verify Verifier) *Authenticator {
+	return &Authenticator{Verify: verify}
+}
+
+func (a *Authenticator) tokenField() string {
+	if a.TokenField == "" {
+		return DefaultTokenField
+	}
+	return a.TokenField
+}
+
+func (a *Authenticator) refreshEvent() string {
+	if a.RefreshEvent == "" {
+		return DefaultRefreshEvent
+	}
+	return a.RefreshEvent
+}
+
+/**
+Require token on connect to server or namespace and handle refresh
+event there. Sockets of namespaces registered separately are not checked
+*/
+func (a *Authenticator) Register(h Handlers) error {
+	h.UseConnect(a.connect)
+	if err := h.On(gosocketio.OnDisconnection, a.disconnected); err != nil {
+		return err
+	}
+	return h.On(a.refreshEvent(), a.refresh)
+}
+
+/**
+Disconnection handler, stops expiry timer of the session
+*/
+func (a *Authenticator) disconnected(c *gosocketio.Channel) {
+	if s := getSession(c); s != nil {
+		s.lock.Lock()
+		s.stopTimer()
+		s.lock.Unlock()
+	}
+}
+
+/**
+Connect middleware, verifies token of auth object
+*/
+func (a *Authenticator) connect(c *gosocketio.Channel, auth json.RawMessage) error {
+	var fields map[string]interface{}
+	json.Unmarshal(auth, &fields)
+	token, _ := fields[a.tokenField()].(string)
+	if token == "" {
+		return ErrorNoToken
+	}
+
+	claims, err := a.Verify(token)
+	if err != nil {
+		return err
+	}
+
+	s := &session{claims: claims}
+	c.Set(sessionKey, s)
+	s.watch(c)
+	return nil
+}
+
+/**
+Handler of refresh event: new token of the same subject replaces
+claims and expiry, old ones stay if it is refused
+*/
+func (a *Authenticator) refresh(c *gosocketio.Channel, token string) RefreshResult {
+	s := getSession(c)
+	if s == nil {
+		return RefreshResult{Error: ErrorNotAuthorized.Error()}
+	}
+
+	claims, err := a.Verify(token)
+	if err != nil {
+		return RefreshResult{Error: err.Error()}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if claims.Subject() != s.claims.Subject() {
+		return RefreshResult{Error: ErrorSubjectChanged.Error()}
+	}
+	s.claims = claims
+	s.reset(c)
+
+	result := RefreshResult{}
+	if exp := claims.ExpiresAt(); !exp.IsZero() {
+		result.ExpiresAt = exp.Unix()
+	}
+	return result
+}
+
+/**
+Start expiry timer of new session
+*/
+func (s *session) watch(c *gosocketio.Channel) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.reset(c)
+}
+
+/**
+Set expiry timer to expiry of current claims, timer follows clock
+of the channel. Must be called under lock
+*/
+func (s *session) reset(c *gosocketio.Channel) {
+	s.stopTimer()
+
+	exp := s.claims.ExpiresAt()
+	if exp.IsZero() {
+		return
+	}
+	timer := c.Clock().NewTimer(exp.Sub(c.Clock().Now()))
+	stop := make(chan struct{})
+	s.timer, s.stop = timer, stop
+	go func() {
+		select {
+		case <-timer.C():
+			s.expire(c)
+		case <-stop:
+		}
+	}()
+}
+
+/**
+Stop expiry timer, must be called under lock
+*/
+func (s *session) stopTimer() {
+	if s.timer == nil {
+		return
+	}
+	s.timer.Stop()
+	close(s.stop)
+	s.timer, s.stop = nil, nil
+}
+
+/**
+Close channel whose token expired, unless it was refreshed already
+*/
+func (s *session) expire(c *gosocketio.Channel) {
+	s.lock.Lock()
+	exp := s.claims.ExpiresAt()
+	s.lock.Unlock()
+
+	//refused or closed sockets don't keep the session
+	if getSession(c) != s || !c.IsAlive() || c.Clock().Now().Before(exp) {
+		return
+	}
+	c.Close()
+}
+
+func getSession(c *gosocketio.Channel) *session {
+	value, _ := c.Get(sessionKey)
+	s, _ := value.(*session)
+	return s
+}
+
+/**
+Get claims of authenticated channel, ok is false if there are none
+*/
+func ClaimsOf(c *gosocketio.Channel) (claims Claims, ok bool) {
+	s := getSession(c)
+	if s == nil {
+		return nil, false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.claims, true
+}
+
+/**
+Get auth object with token for gosocketio.ClientConfig.Auth,
+in DefaultTokenField
+*/
+func Token(token string) map[string]interface{} {
+	return map[string]interface{}{DefaultTokenField: token}
+}
+
+/**
+Send new token to server with DefaultRefreshEvent, get new expiry
+of the session; zero time if token does not expire
+*/
+func Refresh(c *gosocketio.Channel, token string, timeout time.Duration) (time.Time, error) {
+	reply, err := c.Ack(DefaultRefreshEvent, token, timeout)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var result RefreshResult
+	if err := json.Unmarshal([]byte(reply), &result); err != nil {
+		return time.Time{}, err
+	}
+	if result.Error != "" {
+		return time.Time{}, errors.New(result.Error)
+	}
+	if result.ExpiresAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(result.ExpiresAt, 0), nil
+}
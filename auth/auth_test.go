@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"testing"
+	"time"
+)
+
+/**
+Serve server with authenticator and manual clock, channels of
+server side are sent to connected and disconnected
+*/
+func authServer(t *testing.T) (tr *gosocketiotest.Transport, mc *gosocketiotest.ManualClock,
+	connected, disconnected chan *gosocketio.Channel) {
+
+	tr = gosocketiotest.NewTransport()
+	s := gosocketio.NewServer(tr)
+	s.ProtocolVersions = []int{gosocketio.ProtocolVersion3, gosocketio.ProtocolVersion4}
+	mc = gosocketiotest.NewManualClock(time.Now())
+	s.Clock = mc
+	if err := New(HS256(testSecret)).Register(s); err != nil {
+		t.Fatal(err)
+	}
+
+	connected = make(chan *gosocketio.Channel, 1)
+	disconnected = make(chan *gosocketio.Channel, 1)
+	s.On(gosocketio.OnConnection, func(c *gosocketio.Channel) {
+		connected <- c
+	})
+	s.On(gosocketio.OnDisconnection, func(c *gosocketio.Channel) {
+		disconnected <- c
+	})
+	s.On("whoami", func(c *gosocketio.Channel) string {
+		claims, _ := ClaimsOf(c)
+		return claims.Subject()
+	})
+	tr.Attach(s)
+	return tr, mc, connected, disconnected
+}
+
+func dialAuth(tr *gosocketiotest.Transport, token string) (*gosocketio.Client, error) {
+	config := gosocketio.ClientConfig{}
+	if token != "" {
+		config.Auth = Token(token)
+	}
+	return gosocketio.DialConfig(context.Background(), gosocketiotest.UrlV4, tr, config)
+}
+
+func TestConnect(t *testing.T) {
+	tr, _, _, _ := authServer(t)
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"no token", "", ErrorNoToken},
+		{"malformed", "token", ErrorMalformedToken},
+		{"bad signature", makeJWT(map[string]interface{}{"alg": "HS256"},
+			map[string]interface{}{"sub": "alice"}, hsSign([]byte("other"))), ErrorWrongSignature},
+		{"expired", hsToken(map[string]interface{}{"sub": "alice", "exp": time.Now().Add(-time.Second).Unix()}), ErrorTokenExpired},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := dialAuth(tr, test.token)
+			if err == nil {
+				c.Close()
+				t.Fatal("connected")
+			}
+			var connectErr *gosocketio.ConnectError
+			if !errors.As(err, &connectErr) || connectErr.Data != `{"message":"`+test.err.Error()+`"}` {
+				t.Fatalf("got %v, want connect error %v", err, test.err)
+			}
+		})
+	}
+
+	c, err := dialAuth(tr, hsToken(map[string]interface{}{"sub": "alice"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if sub, err := c.Ack("whoami", nil, time.Second); err != nil || sub != `"alice"` {
+		t.Fatalf("got %s, %v", sub, err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	tr, _, _, _ := authServer(t)
+	c, err := dialAuth(tr, hsToken(map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Minute).Unix()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	later := time.Now().Add(time.Hour).Truncate(time.Second)
+	exp, err := Refresh(&c.Channel, hsToken(map[string]interface{}{"sub": "alice", "exp": later.Unix()}), time.Second)
+	if err != nil || !exp.Equal(later) {
+		t.Fatalf("got %v, %v, want %v", exp, err, later)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"other subject", hsToken(map[string]interface{}{"sub": "mallory"}), ErrorSubjectChanged},
+		{"expired", hsToken(map[string]interface{}{"sub": "alice", "exp": time.Now().Add(-time.Second).Unix()}), ErrorTokenExpired},
+		{"bad signature", makeJWT(map[string]interface{}{"alg": "HS256"},
+			map[string]interface{}{"sub": "alice"}, hsSign([]byte("other"))), ErrorWrongSignature},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Refresh(&c.Channel, test.token, time.Second)
+			if err == nil || err.Error() != test.err.Error() {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+
+	//refused tokens keep claims of the session
+	if sub, err := c.Ack("whoami", nil, time.Second); err != nil || sub != `"alice"` {
+		t.Fatalf("got %s, %v", sub, err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	tr, mc, connected, disconnected := authServer(t)
+	c, err := dialAuth(tr, hsToken(map[string]interface{}{"sub": "alice", "exp": mc.Now().Add(time.Hour).Unix()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	sc := <-connected
+
+	//pinger and expiry timer
+	if !mc.WaitWaiters(2, time.Second) {
+		t.Fatal("expiry timer does not wait")
+	}
+	mc.Advance(time.Hour - time.Second)
+	if !sc.IsAlive() {
+		t.Fatal("closed before token expired")
+	}
+
+	mc.Advance(time.Second)
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("channel with expired token is not closed")
+	}
+}
+
+func TestExpiryRefreshed(t *testing.T) {
+	tr, mc, connected, disconnected := authServer(t)
+	c, err := dialAuth(tr, hsToken(map[string]interface{}{"sub": "alice", "exp": mc.Now().Add(time.Minute).Unix()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	sc := <-connected
+
+	token := hsToken(map[string]interface{}{"sub": "alice", "exp": mc.Now().Add(time.Hour).Unix()})
+	if _, err := Refresh(&c.Channel, token, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !mc.WaitWaiters(2, time.Second) {
+		t.Fatal("expiry timer does not wait")
+	}
+	mc.Advance(2 * time.Minute)
+	select {
+	case <-disconnected:
+		t.Fatal("refreshed channel was closed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if !sc.IsAlive() {
+		t.Fatal("refreshed channel was closed")
+	}
+}
+
+func TestExpiryStoppedOnDisconnect(t *testing.T) {
+	tr, mc, connected, disconnected := authServer(t)
+	c, err := dialAuth(tr, hsToken(map[string]interface{}{"sub": "alice", "exp": mc.Now().Add(time.Hour).Unix()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-connected
+	if !mc.WaitWaiters(2, time.Second) {
+		t.Fatal("expiry timer does not wait")
+	}
+
+	c.Close()
+	<-disconnected
+	deadline := time.Now().Add(time.Second)
+	for mc.Waiters() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := mc.Waiters(); n != 0 {
+		t.Fatalf("%d timers left after disconnect", n)
+	}
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorMalformedToken   = errors.New("Malformed token")
+	ErrorWrongAlgorithm   = errors.New("Wrong token algorithm")
+	ErrorWrongSignature   = errors.New("Wrong token signature")
+	ErrorTokenExpired     = errors.New("Token expired")
+	ErrorTokenNotYetValid = errors.New("Token is not valid yet")
+)
+
+/**
+Claims of verified token, as decoded from json
+*/
+type Claims map[string]interface{}
+
+/**
+Get "sub" claim, empty if there is none
+*/
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+/**
+Get time of "exp" claim, zero if token does not expire
+*/
+func (c Claims) ExpiresAt() time.Time {
+	return c.time("exp")
+}
+
+func (c Claims) time(name string) time.Time {
+	seconds, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(int64(seconds), 0)
+}
+
+/**
+Check token and get its claims, expired tokens should be refused.
+Any token format works, HS256 and RS256 verify JWT
+*/
+type Verifier func(token string) (Claims, error)
+
+/**
+Get verifier of JWT signed with HMAC SHA-256 and given secret
+*/
+func HS256(secret []byte) Verifier {
+	return func(token string) (Claims, error) {
+		return parseJWT(token, "HS256", func(signed, signature []byte) bool {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(signed)
+			return hmac.Equal(mac.Sum(nil), signature)
+		})
+	}
+}
+
+/**
+Get verifier of JWT signed with RSA SHA-256, key is public one
+*/
+func RS256(key *rsa.PublicKey) Verifier {
+	return func(token string) (Claims, error) {
+		return parseJWT(token, "RS256", func(signed, signature []byte) bool {
+			sum := sha256.Sum256(signed)
+			return rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature) == nil
+		})
+	}
+}
+
+/**
+Decode JWT, check its algorithm, signature and validity time
+*/
+func parseJWT(token, algorithm string, verify func(signed, signature []byte) bool) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrorMalformedToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	//algorithm is never taken from token itself
+	if header.Alg != algorithm {
+		return nil, ErrorWrongAlgorithm
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrorMalformedToken
+	}
+	if !verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrorWrongSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if exp := claims.ExpiresAt(); !exp.IsZero() && !now.Before(exp) {
+		return nil, ErrorTokenExpired
+	}
+	if nbf := claims.time("nbf"); !nbf.IsZero() && now.Before(nbf) {
+		return nil, ErrorTokenNotYetValid
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrorMalformedToken
+	}
+	if json.Unmarshal(data, v) != nil {
+		return ErrorMalformedToken
+	}
+	return nil
+}
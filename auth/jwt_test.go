@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("secret")
+
+/**
+Build JWT with given header and claims, signed by sign
+*/
+func makeJWT(header, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hsSign(secret []byte) func(signed []byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func hsToken(claims map[string]interface{}) string {
+	return makeJWT(map[string]interface{}{"alg": "HS256", "typ": "JWT"}, claims, hsSign(testSecret))
+}
+
+func TestHS256(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", hsToken(map[string]interface{}{"sub": "alice"}), nil},
+		{"valid with times", hsToken(map[string]interface{}{
+			"sub": "alice",
+			"exp": now.Add(time.Hour).Unix(),
+			"nbf": now.Add(-time.Hour).Unix(),
+		}), nil},
+		{"expired", hsToken(map[string]interface{}{"sub": "alice", "exp": now.Add(-time.Second).Unix()}), ErrorTokenExpired},
+		{"not yet valid", hsToken(map[string]interface{}{"sub": "alice", "nbf": now.Add(time.Hour).Unix()}), ErrorTokenNotYetValid},
+		{"bad signature", makeJWT(map[string]interface{}{"alg": "HS256"},
+			map[string]interface{}{"sub": "alice"}, hsSign([]byte("other"))), ErrorWrongSignature},
+		{"alg none", makeJWT(map[string]interface{}{"alg": "none"},
+			map[string]interface{}{"sub": "alice"}, func([]byte) []byte { return nil }), ErrorWrongAlgorithm},
+		{"alg RS256", makeJWT(map[string]interface{}{"alg": "RS256"},
+			map[string]interface{}{"sub": "alice"}, hsSign(testSecret)), ErrorWrongAlgorithm},
+		{"two segments", "eyJhbGciOiJIUzI1NiJ9.e30", ErrorMalformedToken},
+		{"empty", "", ErrorMalformedToken},
+		{"header not base64", "!!.e30.sig", ErrorMalformedToken},
+		{"header not json", base64.RawURLEncoding.EncodeToString([]byte("alg")) + ".e30.sig", ErrorMalformedToken},
+		{"signature not base64", "eyJhbGciOiJIUzI1NiJ9.e30.!!", ErrorMalformedToken},
+		{"claims not json", signRaw("eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte("[1"))), ErrorMalformedToken},
+	}
+
+	verify := HS256(testSecret)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := verify(test.token)
+			if err != test.err {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if err == nil && claims.Subject() != "alice" {
+				t.Fatalf("got claims %v", claims)
+			}
+		})
+	}
+}
+
+/**
+Sign header and claims segments with test secret
+*/
+func signRaw(signed string) string {
+	return signed + "." + base64.RawURLEncoding.EncodeToString(hsSign(testSecret)([]byte(signed)))
+}
+
+func TestRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsSign := func(key *rsa.PrivateKey) func(signed []byte) []byte {
+		return func(signed []byte) []byte {
+			sum := sha256.Sum256(signed)
+			signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+			return signature
+		}
+	}
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", makeJWT(map[string]interface{}{"alg": "RS256"}, claims, rsSign(key)), nil},
+		{"other key", makeJWT(map[string]interface{}{"alg": "RS256"}, claims, rsSign(other)), ErrorWrongSignature},
+		//public key used as HMAC secret must not pass
+		{"alg HS256", makeJWT(map[string]interface{}{"alg": "HS256"}, claims, hsSign(key.PublicKey.N.Bytes())), ErrorWrongAlgorithm},
+		{"alg none", makeJWT(map[string]interface{}{"alg": "none"}, claims, func([]byte) []byte { return nil }), ErrorWrongAlgorithm},
+		{"expired", makeJWT(map[string]interface{}{"alg": "RS256"},
+			map[string]interface{}{"sub": "alice", "exp": time.Now().Add(-time.Second).Unix()}, rsSign(key)), ErrorTokenExpired},
+	}
+
+	verify := RS256(&key.PublicKey)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := verify(test.token); err != test.err {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestClaims(t *testing.T) {
+	var claims Claims
+	json.Unmarshal([]byte(`{"sub": "alice", "exp": 1700000000}`), &claims)
+
+	if claims.Subject() != "alice" {
+		t.Fatalf("subject %q", claims.Subject())
+	}
+	if exp := claims.ExpiresAt(); !exp.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("expires at %v", exp)
+	}
+	if exp := (Claims{"exp": "soon"}).ExpiresAt(); !exp.IsZero() {
+		t.Fatalf("non-numeric exp gave %v", exp)
+	}
+}
@@ -0,0 +1,94 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+	"github.com/graarh/golang-socketio/transport"
+)
+
+/**
+Get connection to write batch starting with given packet, ok is false
+if batching is off or the packet has to be written on its own
+*/
+func (c *Channel) batchConnection(first outPacket) (transport.BatchConnection, bool) {
+	if c.queue.BatchSize <= 1 || !c.batchable(first) {
+		return nil, false
+	}
+	bc, ok := c.conn.(transport.BatchConnection)
+	return bc, ok
+}
+
+/**
+Check if packet can be written in batch, uncompressed ones
+are written separately by compressing connections
+*/
+func (c *Channel) batchable(packet outPacket) bool {
+	if packet.command == protocol.CloseMessage {
+		return false
+	}
+	if _, ok := c.conn.(transport.CompressionConnection); ok && packet.uncompressed {
+		return false
+	}
+	return true
+}
+
+/**
+Take packets following the first one up to batch size, waiting flush
+interval for more of them. Packets which can't be batched are left
+in queue for outLoop
+*/
+func (c *Channel) nextBatch(first outPacket) []string {
+	c.batch = append(c.batch[:0], first.command)
+
+	var flush Timer
+	defer func() {
+		if flush != nil {
+			flush.Stop()
+		}
+	}()
+	for len(c.batch) < c.queue.BatchSize {
+		c.aliveLock.Lock()
+		if len(c.out) > 0 && c.batchable(c.out[0]) {
+			packet := c.out[0]
+			c.out[0] = outPacket{}
+			c.out = c.out[1:]
+			c.bufferedDropped(packet.command)
+			c.aliveLock.Unlock()
+
+			c.batch = append(c.batch, packet.command)
+			continue
+		}
+		empty := len(c.out) == 0
+		c.aliveLock.Unlock()
+
+		if !empty || c.queue.FlushInterval <= 0 {
+			return c.batch
+		}
+		if flush == nil {
+			flush = c.clock().NewTimer(c.queue.FlushInterval)
+		}
+		select {
+		case <-c.outSignal:
+		case <-flush.C():
+			return c.batch
+		}
+	}
+	return c.batch
+}
+
+/**
+Write packet together with the ones queued after it
+*/
+func (c *Channel) writeBatch(bc transport.BatchConnection, first outPacket) error {
+	batch := c.nextBatch(first)
+	err := bc.WriteMessages(batch)
+
+	for i, command := range batch {
+		if err == nil {
+			c.wrote()
+			c.packetOut(len(command))
+		}
+		//don't keep packets until the next batch
+		batch[i] = ""
+	}
+	return err
+}
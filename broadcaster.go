@@ -0,0 +1,99 @@
+package gosocketio
+
+/**
+Broadcast target, built by chained calls:
+
+	c.Broadcast().ToRoom("room").Emit("event", data)
+	server.To("room1", "room2").Except("room3").Emit("event", data)
+
+Broadcaster is immutable, every call returns new one, so partially
+built broadcasters can be reused
+*/
+type Broadcaster struct {
+	registry *registry
+	rooms    []string
+	except   []string
+	volatile bool
+	local    bool
+}
+
+/**
+Get broadcaster to channels of the namespace joined to any of
+given rooms, to all channels if there are none
+*/
+func (r *registry) To(rooms ...string) *Broadcaster {
+	return &Broadcaster{
+		registry: r,
+		rooms:    append([]string(nil), rooms...),
+	}
+}
+
+/**
+Get broadcaster to all channels of this channel namespace,
+except this one
+*/
+func (c *Channel) Broadcast() *Broadcaster {
+	b := &Broadcaster{except: []string{c.Id()}}
+	if c.server != nil {
+		b.registry = c.registry()
+	}
+	return b
+}
+
+/**
+Limit broadcast to channels joined to given room, several rooms
+can be chained, channel joined to more than one gets message once
+*/
+func (b *Broadcaster) ToRoom(room string) *Broadcaster {
+	result := *b
+	result.rooms = append(append([]string(nil), b.rooms...), room)
+	return &result
+}
+
+/**
+Skip channels with given ids and channels joined to given rooms
+*/
+func (b *Broadcaster) Except(roomsOrIds ...string) *Broadcaster {
+	result := *b
+	result.except = append(append([]string(nil), b.except...), roomsOrIds...)
+	return &result
+}
+
+/**
+Send to channels of this process only, adapter of the
+namespace does not pass message to other instances
+*/
+func (b *Broadcaster) Local() *Broadcaster {
+	result := *b
+	result.local = true
+	return &result
+}
+
+/**
+Skip channels which are too slow to take the message,
+see Channel.EmitVolatile
+*/
+func (b *Broadcaster) Volatile() *Broadcaster {
+	result := *b
+	result.volatile = true
+	return &result
+}
+
+/**
+Send message to all target channels
+*/
+func (b *Broadcaster) Emit(method string, args interface{}) error {
+	if b.registry == nil {
+		return ErrorServerNotSet
+	}
+
+	adapter := b.registry.adapter()
+	if b.local {
+		adapter = b.registry
+	}
+	return adapter.Broadcast(&BroadcastOptions{
+		Rooms:    b.rooms,
+		Except:   b.except,
+		Volatile: b.volatile,
+	}, method, args)
+}
@@ -0,0 +1,91 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"testing"
+	"time"
+)
+
+type roomClient struct {
+	client *Client
+	server *Channel
+	news   chan string
+}
+
+/**
+Connect n clients joined to room, each collects "news" events
+*/
+func roomClients(t *testing.T, s *Server, tr *gosocketiotest.Transport, room string, n int) []roomClient {
+	s.On(OnConnection, func(c *Channel) {
+		c.Join(room)
+	})
+
+	result := make([]roomClient, n)
+	for i := range result {
+		c, sc := dialTest(t, s, tr, gosocketiotest.Url)
+		news := make(chan string, 10)
+		c.On("news", func(c *Channel, text string) {
+			news <- text
+		})
+		result[i] = roomClient{c, sc, news}
+	}
+	return result
+}
+
+func (rc roomClient) expect(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-rc.news:
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%q not received", want)
+	}
+}
+
+func (rc roomClient) expectNothing(t *testing.T) {
+	t.Helper()
+	select {
+	case got := <-rc.news:
+		t.Fatalf("unexpected %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBroadcastFilter(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	clients := roomClients(t, s, tr, "room", 3)
+
+	skipped := clients[2].server
+	s.BroadcastFilter = func(c *Channel, event string, data interface{}) (interface{}, bool) {
+		if c == skipped {
+			return nil, false
+		}
+		return data.(string) + " for " + c.Id(), true
+	}
+
+	s.To("room").Emit("news", "hello")
+
+	clients[0].expect(t, "hello for "+clients[0].server.Id())
+	clients[1].expect(t, "hello for "+clients[1].server.Id())
+	clients[2].expectNothing(t)
+}
+
+func TestChannelBroadcastExcludesSender(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.On("say", func(c *Channel, text string) {
+		c.Broadcast().ToRoom("room").Emit("news", text)
+	})
+	clients := roomClients(t, s, tr, "room", 3)
+
+	if err := clients[0].client.Emit("say", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	clients[1].expect(t, "hi")
+	clients[2].expect(t, "hi")
+	clients[0].expectNothing(t)
+}
@@ -0,0 +1,144 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"sync/atomic"
+)
+
+var (
+	ErrorBufferBudget = errors.New("Server buffer budget exceeded")
+)
+
+/**
+What to do when bytes queued on all channels of the server exceed
+MaxTotalBufferedBytes
+*/
+type BufferBudgetPolicy int
+
+const (
+	/**
+	Emits return ErrorBufferBudget until queues drain under the budget,
+	control packets (ping, pong) are still queued.
+	Safe default, but every channel suffers, not only slow ones
+	*/
+	BudgetRejectEmits BufferBudgetPolicy = iota
+	/**
+	Channels with most queued bytes are closed with ErrorBufferBudget
+	until the total is under the budget again.
+	Keeps fast clients unaffected, slow clients have to reconnect
+	*/
+	BudgetShedChannels
+)
+
+/**
+Account packet entering outgoing queue, aliveLock should be held
+*/
+func (c *Channel) bufferedAdd(command string) {
+	if c.server == nil {
+		return
+	}
+
+	c.outBytes += len(command)
+	total := atomic.AddInt64(&c.server.stats.bufferedBytes, int64(len(command)))
+
+	s := c.server
+	if s.MaxTotalBufferedBytes > 0 && total > s.MaxTotalBufferedBytes &&
+		s.BufferBudgetPolicy == BudgetShedChannels {
+		go s.shedBuffered()
+	}
+}
+
+/**
+Account packet leaving outgoing queue, written or dropped
+*/
+func (c *Channel) bufferedDone(command string) {
+	if c.server == nil || command == protocol.CloseMessage {
+		return
+	}
+
+	c.aliveLock.Lock()
+	c.bufferedDropped(command)
+	c.aliveLock.Unlock()
+}
+
+/**
+Account packet removed from outgoing queue without writing,
+aliveLock should be held
+*/
+func (c *Channel) bufferedDropped(command string) {
+	if c.server == nil {
+		return
+	}
+
+	c.outBytes -= len(command)
+	atomic.AddInt64(&c.server.stats.bufferedBytes, -int64(len(command)))
+}
+
+/**
+Get amount of bytes waiting in outgoing queue of the channel
+*/
+func (c *Channel) bufferedBytes() int {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	return c.outBytes
+}
+
+/**
+Check that new emits are allowed by server buffer budget
+*/
+func (c *Channel) budgetAllows() bool {
+	if c.server == nil {
+		return true
+	}
+
+	s := c.server
+	if s.MaxTotalBufferedBytes <= 0 || s.BufferBudgetPolicy != BudgetRejectEmits {
+		return true
+	}
+
+	return atomic.LoadInt64(&s.stats.bufferedBytes) <= s.MaxTotalBufferedBytes
+}
+
+/**
+Close most backed-up channels until the total is under the budget,
+only one shedding runs at a time
+*/
+func (s *Server) shedBuffered() {
+	if !atomic.CompareAndSwapInt32(&s.shedding, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&s.shedding, 0)
+
+	//queues of closed channels are released in background,
+	//so count what is shed instead of rereading the total
+	over := atomic.LoadInt64(&s.stats.bufferedBytes) - s.MaxTotalBufferedBytes
+	for over > 0 {
+		c, amount := s.mostBuffered()
+		if c == nil {
+			return
+		}
+
+		closeChannel(c, &s.methods, ErrorBufferBudget)
+		over -= int64(amount)
+	}
+}
+
+/**
+Find channel with most bytes in outgoing queue
+*/
+func (s *Server) mostBuffered() (*Channel, int) {
+	s.sidsLock.RLock()
+	defer s.sidsLock.RUnlock()
+
+	var result *Channel
+	max := 0
+	for _, c := range s.sids {
+		if amount := c.bufferedBytes(); amount > max {
+			result, max = c, amount
+		}
+	}
+
+	return result, max
+}
@@ -0,0 +1,245 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"github.com/graarh/golang-socketio/transport"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/**
+Memory transport whose server connections can be stalled: writes
+block until released, or fail once connection is closed
+*/
+type stallTransport struct {
+	*gosocketiotest.Transport
+
+	conns []*stallConn
+	lock  sync.Mutex
+}
+
+type stallConn struct {
+	transport.Connection
+
+	open    chan struct{} //closed while writes pass
+	blocked chan struct{} //gets blocked writes
+	closed  bool
+	lock    sync.Mutex
+}
+
+func (t *stallTransport) HandleConnection(w http.ResponseWriter, r *http.Request) (transport.Connection, error) {
+	conn, err := t.Transport.HandleConnection(w, r)
+	if err != nil || conn == nil {
+		return conn, err
+	}
+
+	sc := &stallConn{Connection: conn, open: make(chan struct{}), blocked: make(chan struct{}, 100)}
+	close(sc.open)
+	t.lock.Lock()
+	t.conns = append(t.conns, sc)
+	t.lock.Unlock()
+	return sc, nil
+}
+
+func (t *stallTransport) conn(i int) *stallConn {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.conns[i]
+}
+
+func (sc *stallConn) stall() {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	sc.open = make(chan struct{})
+}
+
+func (sc *stallConn) release() {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	select {
+	case <-sc.open:
+	default:
+		close(sc.open)
+	}
+}
+
+/**
+Wait for outLoop to block on write
+*/
+func (sc *stallConn) waitBlocked(t *testing.T) {
+	t.Helper()
+	select {
+	case <-sc.blocked:
+	case <-time.After(time.Second):
+		t.Fatal("write is not blocked")
+	}
+}
+
+func (sc *stallConn) WriteMessage(message string) error {
+	sc.lock.Lock()
+	open := sc.open
+	sc.lock.Unlock()
+
+	select {
+	case <-open:
+	default:
+		sc.blocked <- struct{}{}
+		<-open
+	}
+
+	sc.lock.Lock()
+	closed := sc.closed
+	sc.lock.Unlock()
+	if closed {
+		return gosocketiotest.ErrorClosed
+	}
+	return sc.Connection.WriteMessage(message)
+}
+
+func (sc *stallConn) Close() {
+	sc.lock.Lock()
+	sc.closed = true
+	sc.lock.Unlock()
+
+	sc.release()
+	sc.Connection.Close()
+}
+
+func budgetServer(policy BufferBudgetPolicy, budget int64) (*Server, *stallTransport) {
+	tr := &stallTransport{Transport: gosocketiotest.NewTransport()}
+	s := NewServer(tr)
+	s.BufferBudgetPolicy = policy
+	s.MaxTotalBufferedBytes = budget
+	return s, tr
+}
+
+func waitBuffered(t *testing.T, s *Server, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for s.Stats().BufferedBytes != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d bytes buffered, want %d", s.Stats().BufferedBytes, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+/**
+Stall connection and queue events of 100 bytes until
+more than n bytes are buffered
+*/
+func fillQueue(t *testing.T, s *Server, sc *Channel, conn *stallConn, n int64) {
+	t.Helper()
+	conn.stall()
+	//the first one is taken by outLoop and is not buffered anymore
+	if err := sc.Emit("fill", strings.Repeat("x", 100)); err != nil {
+		t.Fatal(err)
+	}
+	conn.waitBlocked(t)
+	for s.Stats().BufferedBytes <= n {
+		if err := sc.Emit("fill", strings.Repeat("x", 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBufferBudgetReject(t *testing.T) {
+	s, tr := budgetServer(BudgetRejectEmits, 300)
+	_, sc := dialTest(t, s, tr.Transport, gosocketiotest.Url)
+	conn := tr.conn(0)
+
+	fillQueue(t, s, sc, conn, 300)
+	if sc.bufferedBytes() != int(s.Stats().BufferedBytes) {
+		t.Fatalf("channel has %d bytes, server %d", sc.bufferedBytes(), s.Stats().BufferedBytes)
+	}
+	if err := sc.Emit("over", nil); err != ErrorBufferBudget {
+		t.Fatalf("got %v, want %v", err, ErrorBufferBudget)
+	}
+	if _, err := sc.Ack("over", nil, time.Second); err != ErrorBufferBudget {
+		t.Fatalf("ack got %v, want %v", err, ErrorBufferBudget)
+	}
+
+	//written packets are released
+	conn.release()
+	waitBuffered(t, s, 0)
+	if err := sc.Emit("again", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tr.Last().Server.WaitWritten(`42["again"]`, time.Second); !ok {
+		t.Fatal("emit after queue drained is not written")
+	}
+	waitBuffered(t, s, 0)
+}
+
+func TestBufferBudgetShed(t *testing.T) {
+	s, tr := budgetServer(BudgetShedChannels, 500)
+	_, fast := dialTest(t, s, tr.Transport, gosocketiotest.Url)
+	_, slow := dialTest(t, s, tr.Transport, gosocketiotest.Url)
+
+	fillQueue(t, s, fast, tr.conn(0), 100)
+	fastBytes := s.Stats().BufferedBytes
+	//emits are not rejected, most backed-up channel is closed instead
+	fillQueue(t, s, slow, tr.conn(1), 500)
+
+	select {
+	case <-slow.done:
+	case <-time.After(time.Second):
+		t.Fatal("most backed-up channel is not closed")
+	}
+	if d := slow.Disconnection(); d.Err != ErrorBufferBudget {
+		t.Fatalf("closed with %+v", d)
+	}
+	if !fast.IsAlive() {
+		t.Fatal("channel with less buffered bytes is closed")
+	}
+	//queue of closed channel is released without writing
+	waitBuffered(t, s, fastBytes)
+
+	tr.conn(0).release()
+	waitBuffered(t, s, 0)
+}
+
+func TestBufferedBytesReleased(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue QueueConfig
+		done  func(t *testing.T, sc *Channel, conn *stallConn)
+	}{
+		{"dropped", QueueConfig{Size: 3, Overflow: OverflowDropOldest}, func(t *testing.T, sc *Channel, conn *stallConn) {
+			for i := 0; i < 5; i++ {
+				if err := sc.Emit("drop", strings.Repeat("x", 100)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			conn.release()
+		}},
+		//queued packets are left when write fails on close
+		{"closed", QueueConfig{}, func(t *testing.T, sc *Channel, conn *stallConn) {
+			sc.Close()
+			conn.Close()
+			select {
+			case <-sc.done:
+			case <-time.After(time.Second):
+				t.Fatal("channel is not closed")
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, tr := budgetServer(BudgetRejectEmits, 1<<20)
+			s.Queue = test.queue
+			_, sc := dialTest(t, s, tr.Transport, gosocketiotest.Url)
+			conn := tr.conn(0)
+
+			fillQueue(t, s, sc, conn, 150)
+			test.done(t, sc, conn)
+			waitBuffered(t, s, 0)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package gosocketio
 
 import (
+	"context"
 	"errors"
 	"reflect"
 )
@@ -10,8 +11,17 @@ type caller struct {
 	Args        reflect.Type
 	ArgsPresent bool
 	Out         bool
+	Once        bool         //removed after first call
+	Context     bool         //context.Context is the first argument
+	Typed       typedHandler //set instead of Func by OnTyped
 }
 
+var (
+	contextType       = reflect.TypeOf((*context.Context)(nil)).Elem()
+	disconnectionType = reflect.TypeOf(Disconnection{})
+	backpressureType  = reflect.TypeOf(Backpressure{})
+)
+
 var (
 	ErrorCallerNotFunc     = errors.New("f is not function")
 	ErrorCallerNot2Args    = errors.New("f should have 1 or 2 args")
@@ -20,7 +30,8 @@ var (
 
 /**
 Parses function passed by using reflection, and stores its representation
-for further call on message or ack
+for further call on message or ack. Function may take context.Context
+before channel, it carries trace span of received event
 */
 func newCaller(f interface{}) (*caller, error) {
 	fVal := reflect.ValueOf(f)
@@ -37,11 +48,16 @@ func newCaller(f interface{}) (*caller, error) {
 		Func: fVal,
 		Out:  fType.NumOut() == 1,
 	}
-	if fType.NumIn() == 1 {
+	in := fType.NumIn()
+	if in > 0 && fType.In(0) == contextType {
+		curCaller.Context = true
+		in--
+	}
+	if in == 1 {
 		curCaller.Args = nil
 		curCaller.ArgsPresent = false
-	} else if fType.NumIn() == 2 {
-		curCaller.Args = fType.In(1)
+	} else if in == 2 {
+		curCaller.Args = fType.In(fType.NumIn() - 1)
 		curCaller.ArgsPresent = true
 	} else {
 		return nil, ErrorCallerNot2Args
@@ -60,7 +76,7 @@ func (c *caller) getArgs() interface{} {
 /**
 calls function with given arguments from its representation using reflection
 */
-func (c *caller) callFunc(h *Channel, args interface{}) []reflect.Value {
+func (c *caller) callFunc(ctx context.Context, h *Channel, args interface{}) []reflect.Value {
 	//nil is untyped, so use the default empty value of correct type
 	if args == nil {
 		args = c.getArgs()
@@ -70,6 +86,9 @@ func (c *caller) callFunc(h *Channel, args interface{}) []reflect.Value {
 	if !c.ArgsPresent {
 		a = a[0:1]
 	}
+	if c.Context {
+		a = append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, a...)
+	}
 
 	return c.Func.Call(a)
 }
@@ -0,0 +1,202 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"sync/atomic"
+)
+
+/**
+Chunk packets of split binary emit, they don't reach event handlers.
+Every attachment goes in order in data packets, end packet has the
+socket.io packet of emit itself, with placeholders of attachments:
+
+	chunk:data {"id": 1, "seq": 0, "part": 0, "data": <binary>}
+	chunk:end  {"id": 1, "seq": <chunks sent>, "packet": "451-[\"upload\",{\"_placeholder\":true,\"num\":0}]"}
+*/
+const (
+	chunkDataEvent = "chunk:data"
+	chunkEndEvent  = "chunk:end"
+)
+
+var (
+	ErrorWrongChunk = errors.New("Wrong chunk packet")
+)
+
+/**
+Splitting of large binary emits, off by default. Emit or ack response
+with attachment longer than MaxChunkSize is sent as chunk packets,
+so pings and other packets are written between them. Peer needs it
+too to put chunks together, others get chunk:data and chunk:end
+events. Broadcasts are sent whole
+*/
+type ChunkConfig struct {
+	//bytes of binary data in chunk packet, 0 turns chunking off for both
+	//sent and received packets; keep it below max message size of the peer
+	MaxChunkSize int
+}
+
+/**
+Whether packet is sent in chunks
+*/
+func (cfg *ChunkConfig) splits(msg *protocol.Message) bool {
+	if cfg.MaxChunkSize <= 0 {
+		return false
+	}
+	for _, attachment := range msg.Attachments {
+		if len(attachment) > cfg.MaxChunkSize {
+			return true
+		}
+	}
+	return false
+}
+
+type chunkPacket struct {
+	Id     int64       `json:"id"`
+	Seq    int         `json:"seq"`
+	Part   int         `json:"part,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+	Packet string      `json:"packet,omitempty"`
+}
+
+/**
+Queue binary packet as chunk packets, header is the encoded packet
+without its attachments. Each chunk is queued by itself, so other
+packets may go between them
+*/
+func (c *Channel) enqueueChunks(opts sendOptions, msg *protocol.Message, header string) error {
+	id := atomic.AddInt64(&c.chunkId, 1)
+	size := c.chunkConfig.MaxChunkSize
+	seq := 0
+
+	for part, attachment := range msg.Attachments {
+		//empty attachment is one empty chunk
+		for start := 0; start == 0 || start < len(attachment); start += size {
+			end := start + size
+			if end > len(attachment) {
+				end = len(attachment)
+			}
+
+			args, err := json.Marshal(chunkPacket{
+				Id:   id,
+				Seq:  seq,
+				Part: part,
+				Data: &protocol.Placeholder{Placeholder: true},
+			})
+			if err != nil {
+				return err
+			}
+			chunk := &protocol.Message{
+				Type:        protocol.MessageTypeEmit,
+				Namespace:   msg.Namespace,
+				Method:      chunkDataEvent,
+				Args:        string(args),
+				Attachments: [][]byte{attachment[start:end]},
+			}
+			if err := c.enqueueChunk(opts, chunk); err != nil {
+				return err
+			}
+			seq++
+		}
+	}
+
+	args, err := json.Marshal(chunkPacket{Id: id, Seq: seq, Packet: header})
+	if err != nil {
+		return err
+	}
+	return c.enqueueChunk(opts, &protocol.Message{
+		Type:      protocol.MessageTypeEmit,
+		Namespace: msg.Namespace,
+		Method:    chunkEndEvent,
+		Args:      string(args),
+	})
+}
+
+func (c *Channel) enqueueChunk(opts sendOptions, msg *protocol.Message) error {
+	commands, err := c.packetParser().Encode(msg)
+	if err != nil {
+		return err
+	}
+	return c.enqueueWith(opts, commands...)
+}
+
+func isChunkPacket(msg *protocol.Message) bool {
+	return msg.Type == protocol.MessageTypeEmit &&
+		(msg.Method == chunkDataEvent || msg.Method == chunkEndEvent)
+}
+
+/**
+Binary packets being received in chunks, by id given by sender.
+Used by inLoop only
+*/
+type chunkSet struct {
+	packets map[int64]*chunkedPacket
+	size    int //bytes of all parts, limited by max message size
+}
+
+type chunkedPacket struct {
+	parts  [][]byte
+	next   int  //seq of expected chunk
+	broken bool //chunk was dropped by queue overflow of sender
+}
+
+/**
+Add received chunk packet, returns packet put together from chunks
+after end packet, nil before. Packet with chunks missing is dropped
+*/
+func (s *chunkSet) add(c *Channel, msg *protocol.Message) (*protocol.Message, error) {
+	var packet chunkPacket
+	if err := json.Unmarshal([]byte(msg.Args), &packet); err != nil {
+		return nil, ErrorWrongChunk
+	}
+
+	if msg.Method == chunkDataEvent {
+		if len(msg.Attachments) != 1 || packet.Part < 0 || packet.Part >= protocol.MaxAttachments {
+			return nil, ErrorWrongChunk
+		}
+		if s.packets == nil {
+			s.packets = make(map[int64]*chunkedPacket)
+		}
+		p := s.packets[packet.Id]
+		if p == nil {
+			p = &chunkedPacket{}
+			s.packets[packet.Id] = p
+		}
+
+		if packet.Seq != p.next || packet.Part < len(p.parts)-1 {
+			p.broken = true
+		}
+		p.next = packet.Seq + 1
+		for len(p.parts) <= packet.Part {
+			p.parts = append(p.parts, nil)
+		}
+		p.parts[packet.Part] = append(p.parts[packet.Part], msg.Attachments[0]...)
+		s.size += len(msg.Attachments[0])
+		return nil, nil
+	}
+
+	p := s.packets[packet.Id]
+	delete(s.packets, packet.Id)
+	if p == nil {
+		p = &chunkedPacket{broken: true}
+	}
+	for _, part := range p.parts {
+		s.size -= len(part)
+	}
+
+	result, err := c.packetParser().Decode(packet.Packet)
+	if err != nil {
+		return nil, err
+	}
+	if p.broken || packet.Seq != p.next || result.AttachmentCount != len(p.parts) {
+		c.log().Warn("chunks of packet are missing", "sid", c.Id(), "id", packet.Id)
+		return nil, nil
+	}
+	result.Attachments = p.parts
+	result.Args, err = protocol.ReconstructArgs(result.Args, result.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
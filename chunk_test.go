@@ -0,0 +1,144 @@
+package gosocketio
+
+import (
+	"bytes"
+	"context"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func countWritten(conn *gosocketiotest.Conn, prefix string) int {
+	n := 0
+	for _, message := range conn.Written() {
+		if strings.HasPrefix(message, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestChunkedEmit(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.Chunks = ChunkConfig{MaxChunkSize: 4}
+	data := []byte("0123456789")
+	small := []byte{1, 2}
+	s.On("download", func(c *Channel, name string) interface{} {
+		return map[string]interface{}{"name": name, "data": data}
+	})
+	got := make(chan []byte, 1)
+	s.On("upload", func(c *Channel, f struct {
+		Data  []byte `json:"data"`
+		Small []byte `json:"small"`
+	}) {
+		if !bytes.Equal(f.Small, small) {
+			t.Errorf("small attachment %v", f.Small)
+		}
+		got <- f.Data
+	})
+	c, _ := dialTestConfig(t, s, tr, gosocketiotest.Url, ClientConfig{Chunks: ChunkConfig{MaxChunkSize: 4}})
+
+	var file struct {
+		Name string `json:"name"`
+		Data []byte `json:"data"`
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.EmitAckInto(ctx, "download", "blob.bin", &file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Name != "blob.bin" || !bytes.Equal(file.Data, data) {
+		t.Fatalf("got %+v", file)
+	}
+	if n := countWritten(tr.Last().Server, `451-["chunk:data"`); n != 3 {
+		t.Fatalf("response was sent in %d chunks, written %q", n, tr.Last().Server.Written())
+	}
+
+	if err := c.Emit("upload", map[string]interface{}{"data": data, "small": small}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-got:
+		if !bytes.Equal(d, data) {
+			t.Fatalf("got %q", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("upload was not put together")
+	}
+	if n := countWritten(tr.Last().Client, `451-["chunk:data"`); n != 4 {
+		t.Fatalf("upload was sent in %d chunks, written %q", n, tr.Last().Client.Written())
+	}
+}
+
+func TestChunkedEmitSmall(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.Chunks = ChunkConfig{MaxChunkSize: 4}
+	got := make(chan []byte, 1)
+	s.On("upload", func(c *Channel, data []byte) {
+		got <- data
+	})
+	c, _ := dialTestConfig(t, s, tr, gosocketiotest.Url, ClientConfig{Chunks: ChunkConfig{MaxChunkSize: 4}})
+
+	if err := c.Emit("upload", []byte("0123")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-got:
+		if string(d) != "0123" {
+			t.Fatalf("got %q", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("upload was not received")
+	}
+	if n := countWritten(tr.Last().Client, `451-["chunk:`); n != 0 {
+		t.Fatalf("packet within chunk size was split, written %q", tr.Last().Client.Written())
+	}
+}
+
+func TestChunkedEmitTooBig(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.Chunks = ChunkConfig{MaxChunkSize: 4}
+	s.Options.MaxMessageSize = 100
+	s.On("upload", func(c *Channel, data []byte) {
+		t.Error("too big upload was handled")
+	})
+	c, sc := dialTestConfig(t, s, tr, gosocketiotest.Url, ClientConfig{Chunks: ChunkConfig{MaxChunkSize: 4}})
+
+	if err := c.Emit("upload", bytes.Repeat([]byte{1}, 101)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sc.done:
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed")
+	}
+	if reason := sc.Disconnection().Reason; reason != DisconnectMessageTooBig {
+		t.Fatalf("closed with %v", reason)
+	}
+}
+
+func TestChunkedEmitWithoutPeerConfig(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	got := make(chan string, 1)
+	s.On("upload", func(c *Channel, data []byte) {
+		t.Error("chunks were put together")
+	})
+	s.On(chunkEndEvent, func(c *Channel) {
+		got <- chunkEndEvent
+	})
+	c, _ := dialTestConfig(t, s, tr, gosocketiotest.Url, ClientConfig{Chunks: ChunkConfig{MaxChunkSize: 4}})
+
+	if err := c.Emit("upload", []byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("chunk packets were not received as events")
+	}
+}
@@ -1,26 +1,123 @@
 package gosocketio
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/graarh/golang-socketio/protocol"
 	"github.com/graarh/golang-socketio/transport"
+	neturl "net/url"
 	"strconv"
+	"sync"
+	"time"
 )
 
 const (
 	webSocketProtocol = "ws://"
 	webSocketSecureProtocol = "wss://"
 	socketioUrl       = "/socket.io/?EIO=3&transport=websocket"
+
+	openFrameSnippetSize = 64
+)
+
+var (
+	ErrorProtocolVersionMismatch = errors.New("Protocol version mismatch")
 )
 
+/**
+Server speaks another engine.io protocol version,
+ServerVersion is 0 if server did not tell which one
+*/
+type ProtocolVersionError struct {
+	ClientVersion int
+	ServerVersion int
+}
+
+func (e *ProtocolVersionError) Error() string {
+	server := "unknown"
+	if e.ServerVersion != 0 {
+		server = strconv.Itoa(e.ServerVersion)
+	}
+	return fmt.Sprintf("engine.io protocol version mismatch: client EIO=%d, server EIO=%s",
+		e.ClientVersion, server)
+}
+
+func (e *ProtocolVersionError) Unwrap() error {
+	return ErrorProtocolVersionMismatch
+}
+
+/**
+Check if handshake was refused because of protocol version
+*/
+func isUnsupportedProtocol(err error) bool {
+	var hsErr *transport.HandshakeError
+	if !errors.As(err, &hsErr) {
+		return false
+	}
+
+	var body struct {
+		Code int `json:"code"`
+	}
+	if json.Unmarshal([]byte(hsErr.Body), &body) != nil {
+		return false
+	}
+	return body.Code == unsupportedProtocolCode
+}
+
+/**
+First frame received by client is not a valid engine.io open packet,
+usually that means the url points to something that is not socket.io
+server, like proxy error page
+*/
+type OpenFrameError struct {
+	Received string
+}
+
+func (e *OpenFrameError) Error() string {
+	return fmt.Sprintf("socket.io open packet expected, received: %q", e.Received)
+}
+
+func (e *OpenFrameError) Unwrap() error {
+	return ErrorWrongHeader
+}
+
+/**
+Server refused socket.io connect packet or rejected connection,
+Data is refusal payload: json object with message for EIO=4,
+json string for EIO=3
+*/
+type ConnectError struct {
+	Data string
+}
+
+func (e *ConnectError) Error() string {
+	return "socket.io connect refused: " + e.Data
+}
+
+func newOpenFrameError(received string) *OpenFrameError {
+	if len(received) > openFrameSnippetSize {
+		received = received[:openFrameSnippetSize] + "..."
+	}
+	return &OpenFrameError{Received: received}
+}
+
 /**
 Socket.io client representation
 */
 type Client struct {
 	methods
 	Channel
+
+	//closed on connect reply of namespace socket, see Of
+	connected   chan struct{}
+	connectErr  error
+	connectOnce sync.Once
 }
 
 /**
-Get ws/wss url by host and port
+Get ws/wss url by host and port. Dial takes server urls
+as they are, see NormalizeUrl, this one is kept for old code
  */
 func GetUrl(host string, port int, secure bool) string {
 	var prefix string
@@ -35,32 +132,407 @@ func GetUrl(host string, port int, secure bool) string {
 /**
 connect to host and initialise socket.io protocol
 
-The correct ws protocol url example:
-ws://myserver.com/socket.io/?EIO=3&transport=websocket
+Url is standard one, like https://myserver.com or
+ws://myserver.com:3811/?token=secret; path, EIO and transport
+parameters are added if it has none, see NormalizeUrl.
+Custom transports get urls of other schemes as they are.
+Protocol version is taken from EIO parameter of the url,
+use DialNegotiate to pick the newest one server accepts
 
-You can use GetUrlByHost for generating correct url
+If the first received frame is not an engine.io open packet,
+*OpenFrameError with the beginning of that frame is returned.
+If server speaks another protocol version, *ProtocolVersionError.
+On any error the connection is closed and no goroutines are left
+running, loops are started only after successful handshake
 */
 func Dial(url string, tr transport.Transport) (*Client, error) {
+	return DialNamespace(url, protocol.DefaultNamespace, tr)
+}
+
+/**
+Same as Dial, but connects to given namespace instead of default one,
+emits and handlers of the client work in that namespace.
+If server has no such namespace, *ConnectError is returned
+*/
+func DialNamespace(url, namespace string, tr transport.Transport) (*Client, error) {
+	return DialConfig(context.Background(), url, tr, ClientConfig{Namespace: namespace})
+}
+
+/**
+Same as Dial, but connecting and handshake are stopped when ctx is done,
+ctx.Err() is returned then. Connection itself is not bound to ctx
+*/
+func DialContext(ctx context.Context, url string, tr transport.Transport) (*Client, error) {
+	return DialConfig(ctx, url, tr, ClientConfig{})
+}
+
+/**
+Client settings, which are needed before connecting
+*/
+type ClientConfig struct {
+	//namespace to connect, default one if empty
+	Namespace string
+	//outgoing queue and what to do when it is full
+	Queue QueueConfig
+	//chunk size and window of streams, see Channel.OpenStream
+	Streams StreamConfig
+	//splitting of large binary emits, off by default, see ChunkConfig
+	Chunks ChunkConfig
+	//how handlers of received packets are run, goroutine for each by default
+	Dispatch DispatchConfig
+	//trace spans of events
+	Trace TraceConfig
+	//encoding of socket.io packets, nil is default json parser
+	Parser protocol.Parser
+	//json encoding of event arguments, nil is JsonCodec
+	Codec Codec
+	//time of pings, timeouts and reconnects, real time if nil
+	Clock Clock
+	//logger of connection, nil disables logging
+	Logger Logger
+	//max size of incoming socket.io message with its attachments,
+	//transport limits only if 0
+	MaxMessageSize int64
+	//default timeout of acks, see ServerOptions.AckTimeout
+	AckTimeout time.Duration
+	//auth object sent with connect packets of EIO=4, like token,
+	//server gets it with Channel.Auth. Encoded as json object
+	Auth interface{}
+	//transports tried in order instead of the given one, the next is
+	//dialed when connecting fails, not when server refuses; polling
+	//transport with Upgrade starts on polling and upgrades to websocket
+	Transports []transport.Transport
+}
+
+/**
+Same as DialContext, with namespace, queue, tracing, parser and logger taken from config
+*/
+func DialConfig(ctx context.Context, url string, tr transport.Transport, config ClientConfig) (*Client, error) {
 	c := &Client{}
-	c.initChannel()
+	c.initChannel(config.Queue)
+	c.trace = config.Trace
+	c.parser = config.Parser
+	c.codec = config.Codec
+	c.clk = config.Clock
+	c.maxMessageSize = config.MaxMessageSize
+	c.defaultAckTimeout = config.AckTimeout
+	c.streamConfig = config.Streams
+	c.chunkConfig = config.Chunks
+	c.dispatchConfig = config.Dispatch
+	c.pool = config.Dispatch.newPool()
+	c.connectAuth = config.Auth
+	c.recovery = &recovery{}
+	c.logger.Store(loggerHolder{config.Logger})
 	c.initMethods()
+	if config.Namespace != protocol.DefaultNamespace {
+		c.namespace = config.Namespace
+	}
+
+	if err := dialTransports(ctx, &c.Channel, url, tr, config.Transports); err != nil {
+		return nil, err
+	}
+	startLoops(&c.Channel, &c.methods)
+
+	return c, nil
+}
+
+/**
+Do handshake with the first transport which connects, in order of
+transports, tr is the only one if there are none. Refusals of server
+and done ctx are returned at once, other errors try the next transport
+and the last one is returned
+*/
+func dialTransports(ctx context.Context, c *Channel, url string, tr transport.Transport,
+	transports []transport.Transport) error {
+
+	if len(transports) == 0 {
+		return handshake(ctx, c, url, tr)
+	}
 
 	var err error
-	c.conn, err = tr.Connect(url)
+	for i, t := range transports {
+		err = handshake(ctx, c, url, t)
+		if err == nil || ctx.Err() != nil || isRefusal(err) {
+			return err
+		}
+		if i < len(transports)-1 {
+			c.log().Debug("transport failed, trying next one", "transport", i, "error", err)
+		}
+	}
+	return err
+}
+
+/**
+Check if handshake error is answer of server, which other transport
+would get too
+*/
+func isRefusal(err error) bool {
+	var connectErr *ConnectError
+	var versionErr *ProtocolVersionError
+	return errors.As(err, &connectErr) || errors.As(err, &versionErr)
+}
+
+/**
+Connect channel and do engine.io and socket.io handshakes,
+connection is closed on error
+*/
+func handshake(ctx context.Context, c *Channel, url string, tr transport.Transport) error {
+	//addresses of custom transports, with other schemes, are kept
+	normalized, err := NormalizeUrl(url)
+	if err != nil && err != ErrorUrlScheme {
+		return err
+	}
+	if err == nil {
+		url = normalized
+	}
+	if u, err := neturl.Parse(url); err == nil {
+		if version, ok := queryVersion(u.Query()); ok {
+			c.version = version
+		}
+	}
+
+	c.conn, err = connect(ctx, tr, url)
+	if isUnsupportedProtocol(err) {
+		return &ProtocolVersionError{ClientVersion: c.version}
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	go inLoop(&c.Channel, &c.methods)
-	go outLoop(&c.Channel, &c.methods)
-	go pinger(&c.Channel)
+	//handshake reads are stopped by closing connection
+	if ctx.Done() != nil {
+		finished := make(chan struct{})
+		watched := make(chan struct{})
+		go func() {
+			defer close(watched)
+			select {
+			case <-ctx.Done():
+				c.conn.Close()
+			case <-finished:
+			}
+		}()
+		defer func() {
+			close(finished)
+			<-watched
+		}()
+	}
 
-	return c, nil
+	err = readOpenFrame(c)
+
+	//EIO=3 server connects default namespace by itself
+	if err == nil && (c.version == ProtocolVersion4 || c.namespace != "") {
+		err = sendConnect(c)
+	}
+
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		c.conn.Close()
+		return err
+	}
+
+	return nil
+}
+
+/**
+Get connection from transport, transports which are not
+transport.ContextTransport are left connecting in background
+*/
+func connect(ctx context.Context, tr transport.Transport, url string) (transport.Connection, error) {
+	if ctr, ok := tr.(transport.ContextTransport); ok {
+		return ctr.ConnectContext(ctx, url)
+	}
+	if ctx.Done() == nil {
+		return tr.Connect(url)
+	}
+
+	type connected struct {
+		conn transport.Connection
+		err  error
+	}
+	result := make(chan connected, 1)
+	go func() {
+		conn, err := tr.Connect(url)
+		result <- connected{conn, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.conn, r.err
+	case <-ctx.Done():
+		//connection made after ctx is done is not needed
+		go func() {
+			if r := <-result; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
 }
 
 /**
-Close client connection
+Start loops of connected client channel
+*/
+func startLoops(c *Channel, m *methods) {
+	c.log().Info("connected", "sid", c.Id(), "version", c.version)
+	go func() {
+		m.callLoopEvent(c, OnConnection)
+		inLoop(c, m)
+	}()
+	go outLoop(c, m)
+
+	//with EIO=4 server pings
+	if c.version == ProtocolVersion3 {
+		go pinger(c, m)
+	}
+}
+
+/**
+Connect with the newest protocol version server accepts,
+EIO=4 is tried first and EIO=3 if server refuses it
+*/
+func DialNegotiate(url string, tr transport.Transport) (*Client, error) {
+	c, err := Dial(withProtocolVersion(url, ProtocolVersion4), tr)
+	if errors.Is(err, ErrorProtocolVersionMismatch) {
+		return Dial(withProtocolVersion(url, ProtocolVersion3), tr)
+	}
+	return c, err
+}
+
+/**
+Get payload of connect packet: auth object merged with recovery
+session of the channel, empty if there are none
+*/
+func (c *Channel) connectPayload() string {
+	recovery := c.recoveryPayload()
+	if c.connectAuth == nil || c.version != ProtocolVersion4 {
+		return recovery
+	}
+
+	auth, err := json.Marshal(c.connectAuth)
+	if err != nil {
+		c.log().Warn("auth encoding failed", "error", err)
+		return recovery
+	}
+	if recovery == "" {
+		return string(auth)
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(auth, &fields) != nil || fields == nil {
+		return string(auth)
+	}
+	json.Unmarshal([]byte(recovery), &fields)
+	merged, _ := json.Marshal(fields)
+	return string(merged)
+}
+
+/**
+Send connect packet of channel namespace and wait for server answer,
+pings and packets of other namespaces that come first are skipped
+*/
+func sendConnect(c *Channel) error {
+	//rejected connection may be closed before connect packet is
+	//written, connect error sent before that is still read then
+	var writeErr error
+	for _, command := range c.mustEncode(&protocol.Message{
+		Type:      protocol.MessageTypeEmpty,
+		Namespace: c.namespace,
+		Args:      c.connectPayload(),
+	}) {
+		if writeErr = c.conn.WriteMessage(command); writeErr != nil {
+			break
+		}
+	}
+
+	for {
+		pkg, err := c.conn.GetMessage()
+		if writeErr != nil && err != nil {
+			return writeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		msg, err := c.packetParser().Decode(pkg)
+		if err != nil {
+			return newOpenFrameError(pkg)
+		}
+		if isNamespacePacket(msg) && msg.Namespace != c.namespace {
+			continue
+		}
+
+		switch msg.Type {
+		case protocol.MessageTypeConnectError:
+			return &ConnectError{Data: msg.Args}
+		case protocol.MessageTypePing:
+			if writeErr != nil {
+				continue
+			}
+			if err := c.conn.WriteMessage(protocol.PongMessage); err != nil {
+				return err
+			}
+		case protocol.MessageTypeEmpty:
+			if writeErr != nil {
+				return writeErr
+			}
+			c.acceptRecovery(msg.Args)
+			return nil
+		default:
+			return newOpenFrameError(pkg)
+		}
+	}
+}
+
+/**
+Read the engine.io open packet, it should be the very first one
+*/
+func readOpenFrame(c *Channel) error {
+	pkg, err := c.conn.GetMessage()
+	if err != nil {
+		return err
+	}
+
+	msg, err := protocol.Decode(pkg)
+	if err != nil || msg.Type != protocol.MessageTypeOpen {
+		return newOpenFrameError(pkg)
+	}
+
+	if err := json.Unmarshal([]byte(msg.Args), &c.header); err != nil {
+		return newOpenFrameError(pkg)
+	}
+
+	//maxPayload is advertised only since EIO=4, server ignored our version
+	var capabilities struct {
+		MaxPayload *int `json:"maxPayload"`
+	}
+	json.Unmarshal([]byte(msg.Args), &capabilities)
+	if capabilities.MaxPayload != nil && c.version == ProtocolVersion3 {
+		return &ProtocolVersionError{ClientVersion: c.version, ServerVersion: ProtocolVersion4}
+	}
+	if capabilities.MaxPayload == nil && c.version == ProtocolVersion4 {
+		return &ProtocolVersionError{ClientVersion: c.version, ServerVersion: ProtocolVersion3}
+	}
+
+	return nil
+}
+
+/**
+Emit message, wait until it is written, then disconnect,
+see Channel.EmitAndClose
+*/
+func (c *Client) EmitAndClose(method string, args interface{}, timeout time.Duration) error {
+	return emitAndClose(&c.Channel, &c.methods, method, args, timeout, sendOptions{})
+}
+
+/**
+Close client connection, namespace socket created with Of
+leaves its namespace and connection stays
 */
 func (c *Client) Close() {
+	if c.clientSocket != nil {
+		send(&protocol.Message{Type: protocol.MessageTypeDisconnect}, &c.Channel, nil)
+	}
 	closeChannel(&c.Channel, &c.methods)
 }
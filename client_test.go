@@ -0,0 +1,292 @@
+package gosocketio
+
+import (
+	"context"
+	"errors"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"github.com/graarh/golang-socketio/transport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/**
+Accept handshakes of memory transport and write given
+frames to connection, like server of other kind would
+*/
+func rawServer(tr *gosocketiotest.Transport, frames ...string) {
+	tr.Attach(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := tr.HandleConnection(w, r)
+		if err != nil {
+			return
+		}
+		for _, frame := range frames {
+			conn.WriteMessage(frame)
+		}
+	}))
+}
+
+func TestDialNotOpenFrame(t *testing.T) {
+	frames := []string{
+		"<html><body><h1>502 Bad Gateway</h1></body></html>",
+		`0{"sid":`,
+		`42["message","hi"]`,
+	}
+	for _, frame := range frames {
+		tr := gosocketiotest.NewTransport()
+		rawServer(tr, frame)
+
+		_, err := Dial(gosocketiotest.Url, tr)
+		var openErr *OpenFrameError
+		if !errors.As(err, &openErr) {
+			t.Fatalf("%q: got %v, want OpenFrameError", frame, err)
+		}
+		if !strings.HasPrefix(frame, strings.TrimSuffix(openErr.Received, "...")) {
+			t.Fatalf("%q: received %q", frame, openErr.Received)
+		}
+		if !errors.Is(err, ErrorWrongHeader) {
+			t.Fatalf("%q: %v does not match ErrorWrongHeader", frame, err)
+		}
+	}
+}
+
+func TestDialProtocolVersionMismatch(t *testing.T) {
+	v4Open := `0{"sid":"x","upgrades":[],"pingInterval":25000,"pingTimeout":20000,"maxPayload":1000000}`
+	v3Open := `0{"sid":"x","upgrades":[],"pingInterval":25000,"pingTimeout":20000}`
+
+	tests := []struct {
+		name   string
+		url    string
+		server func(tr *gosocketiotest.Transport)
+		want   ProtocolVersionError
+	}{
+		{"refused by server", gosocketiotest.UrlV4, func(tr *gosocketiotest.Transport) {
+			tr.Attach(NewServer(tr))
+		}, ProtocolVersionError{ClientVersion: ProtocolVersion4}},
+		{"EIO=4 server", gosocketiotest.Url, func(tr *gosocketiotest.Transport) {
+			rawServer(tr, v4Open)
+		}, ProtocolVersionError{ClientVersion: ProtocolVersion3, ServerVersion: ProtocolVersion4}},
+		{"EIO=3 server", gosocketiotest.UrlV4, func(tr *gosocketiotest.Transport) {
+			rawServer(tr, v3Open)
+		}, ProtocolVersionError{ClientVersion: ProtocolVersion4, ServerVersion: ProtocolVersion3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := gosocketiotest.NewTransport()
+			test.server(tr)
+
+			_, err := Dial(test.url, tr)
+			var versionErr *ProtocolVersionError
+			if !errors.As(err, &versionErr) {
+				t.Fatalf("got %v, want ProtocolVersionError", err)
+			}
+			if *versionErr != test.want {
+				t.Fatalf("got %+v, want %+v", *versionErr, test.want)
+			}
+			if !errors.Is(err, ErrorProtocolVersionMismatch) {
+				t.Fatalf("%v does not match ErrorProtocolVersionMismatch", err)
+			}
+		})
+	}
+}
+
+/**
+Memory transport whose client connections can't write, like ones
+server has closed right after rejecting them
+*/
+type writeClosedTransport struct {
+	*gosocketiotest.Transport
+}
+
+type writeClosedConn struct {
+	transport.Connection
+}
+
+func (writeClosedConn) WriteMessage(message string) error {
+	return gosocketiotest.ErrorClosed
+}
+
+func (t writeClosedTransport) Connect(url string) (transport.Connection, error) {
+	return t.ConnectContext(context.Background(), url)
+}
+
+func (t writeClosedTransport) ConnectContext(ctx context.Context, url string) (transport.Connection, error) {
+	conn, err := t.Transport.ConnectContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return writeClosedConn{conn}, nil
+}
+
+func TestDialRejectedBeforeConnectWritten(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.ProtocolVersions = []int{ProtocolVersion3, ProtocolVersion4}
+	s.Use(func(c *Channel, r *http.Request) error {
+		return errors.New("not authorized")
+	})
+	tr.Attach(s)
+
+	_, err := Dial(gosocketiotest.UrlV4, writeClosedTransport{tr})
+	var connectErr *ConnectError
+	if !errors.As(err, &connectErr) {
+		t.Fatalf("got %v, want ConnectError", err)
+	}
+	if connectErr.Data != `{"message":"not authorized"}` {
+		t.Fatalf("connect error data %s", connectErr.Data)
+	}
+}
+
+func TestDialWriteFailedWithoutAnswer(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	tr.ReceiveTimeout = 100 * time.Millisecond
+	rawServer(tr, `0{"sid":"x","upgrades":[],"pingInterval":25000,"pingTimeout":20000,"maxPayload":1000000}`)
+
+	_, err := Dial(gosocketiotest.UrlV4, writeClosedTransport{tr})
+	if err != gosocketiotest.ErrorClosed {
+		t.Fatalf("got %v, want write error", err)
+	}
+}
+
+/**
+Serve s over http, recording transport and sid of every request
+*/
+type recordingServer struct {
+	*httptest.Server
+	requests []string
+	lock     sync.Mutex
+}
+
+func newRecordingServer(s *Server) *recordingServer {
+	rs := &recordingServer{}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		rs.lock.Lock()
+		rs.requests = append(rs.requests, query.Get("transport")+" "+query.Get("sid"))
+		rs.lock.Unlock()
+		s.ServeHTTP(w, r)
+	}))
+	return rs
+}
+
+func (rs *recordingServer) has(request string) bool {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	for _, r := range rs.requests {
+		if r == request {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+Wait for server channel of client and check the connection answers
+server acks
+*/
+func checkAck(t *testing.T, c *Client, server chan *Channel) *Channel {
+	t.Helper()
+	c.On("ping", func(c *Channel) string {
+		return "pong"
+	})
+
+	var sc *Channel
+	select {
+	case sc = <-server:
+	case <-time.After(time.Second):
+		t.Fatal("not connected")
+	}
+	if reply, err := sc.Ack("ping", nil, time.Second); err != nil || reply != `"pong"` {
+		t.Fatalf("ack: %q, %v", reply, err)
+	}
+	return sc
+}
+
+func TestDialTransportsFallback(t *testing.T) {
+	serverTr := transport.GetDefaultPollingTransport()
+	//websocket is blocked
+	serverTr.Upgrade = nil
+	s := NewServer(serverTr)
+	connected := make(chan *Channel, 1)
+	s.On(OnConnection, func(c *Channel) {
+		connected <- c
+	})
+	rs := newRecordingServer(s)
+	defer rs.Close()
+
+	polling := transport.GetDefaultPollingTransport()
+	polling.Upgrade = nil
+	c, err := DialConfig(context.Background(), rs.URL, nil, ClientConfig{
+		Transports: []transport.Transport{transport.GetDefaultWebsocketTransport(), polling},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if !rs.has("websocket ") {
+		t.Fatal("websocket was not tried first")
+	}
+	if _, ok := c.conn.(*transport.PollingClientConnection); !ok {
+		t.Fatalf("connected with %T, want polling", c.conn)
+	}
+	checkAck(t, c, connected)
+}
+
+func TestDialTransportsPollingUpgrade(t *testing.T) {
+	s := NewServer(transport.GetDefaultPollingTransport())
+	connected := make(chan *Channel, 1)
+	s.On(OnConnection, func(c *Channel) {
+		connected <- c
+	})
+	rs := newRecordingServer(s)
+	defer rs.Close()
+
+	c, err := DialConfig(context.Background(), rs.URL, nil, ClientConfig{
+		Transports: []transport.Transport{transport.GetDefaultPollingTransport(), transport.GetDefaultWebsocketTransport()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	sc := checkAck(t, c, connected)
+
+	if rs.has("websocket ") {
+		t.Fatal("websocket was dialed without session")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !rs.has("websocket " + sc.Id()) {
+		if time.Now().After(deadline) {
+			t.Fatal("polling session is not upgraded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if reply, err := sc.Ack("ping", nil, time.Second); err != nil || reply != `"pong"` {
+		t.Fatalf("ack after upgrade: %q, %v", reply, err)
+	}
+}
+
+func TestDialTransportsRefused(t *testing.T) {
+	s := NewServer(transport.GetDefaultPollingTransport())
+	s.ProtocolVersions = []int{ProtocolVersion3, ProtocolVersion4}
+	s.Use(func(c *Channel, r *http.Request) error {
+		return errors.New("not authorized")
+	})
+	rs := newRecordingServer(s)
+	defer rs.Close()
+
+	_, err := DialConfig(context.Background(), withProtocolVersion(rs.URL, ProtocolVersion4), nil, ClientConfig{
+		Transports: []transport.Transport{transport.GetDefaultWebsocketTransport(), transport.GetDefaultPollingTransport()},
+	})
+	var connectErr *ConnectError
+	if !errors.As(err, &connectErr) {
+		t.Fatalf("got %v, want ConnectError", err)
+	}
+	if rs.has("polling ") {
+		t.Fatal("refused connection fell back to polling")
+	}
+}
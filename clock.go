@@ -0,0 +1,95 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/clock"
+	"time"
+)
+
+/**
+Source of time for pings, timeouts and activity tracking, set
+with Server.Clock and ClientConfig.Clock. Tests replace it with
+gosocketiotest.ManualClock to move time deterministically
+*/
+type Clock = clock.Clock
+
+/**
+Timer created by Clock
+*/
+type Timer = clock.Timer
+
+/**
+Ticker created by Clock
+*/
+type Ticker = clock.Ticker
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+func (t realTimer) Stop() {
+	t.Timer.Stop()
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+/**
+Get clock of connection, Server.Clock or ClientConfig.Clock;
+real time if none is set
+*/
+func (c *Channel) Clock() Clock {
+	return c.clock()
+}
+
+/**
+Get clock of connection, real time if none is set
+*/
+func (c *Channel) clock() Clock {
+	if c.clk == nil {
+		return realClock{}
+	}
+	return c.clk
+}
+
+/**
+Get clock of reconnecting client, real time if none is set
+*/
+func (rc *ReconnectingClient) clock() Clock {
+	if rc.config.Clock == nil {
+		return realClock{}
+	}
+	return rc.config.Clock
+}
+
+/**
+Get clock of server, real time if none is set
+*/
+func (s *Server) clock() Clock {
+	if s.Clock == nil {
+		return realClock{}
+	}
+	return s.Clock
+}
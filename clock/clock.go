@@ -0,0 +1,36 @@
+/**
+Source of time of socket.io connections. Interfaces are here,
+apart from the main package, so clocks of tests, like
+gosocketiotest.ManualClock, implement them without importing it
+*/
+package clock
+
+import (
+	"time"
+)
+
+/**
+Source of time for pings, timeouts and activity tracking
+*/
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+/**
+Timer created by Clock, fires once. Timer not needed anymore
+is stopped, so manual clocks don't keep waiting for it
+*/
+type Timer interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+/**
+Ticker created by Clock
+*/
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
@@ -0,0 +1,172 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"github.com/graarh/golang-socketio/protocol"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mc := gosocketiotest.NewManualClock(start)
+
+	timer := mc.NewTimer(time.Second)
+	ticker := mc.NewTicker(400 * time.Millisecond)
+	defer ticker.Stop()
+
+	mc.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+	if at := <-ticker.C(); !at.Equal(start.Add(400 * time.Millisecond)) {
+		t.Fatal(at)
+	}
+
+	mc.Advance(time.Millisecond)
+	if at := <-timer.C(); !at.Equal(start.Add(time.Second)) {
+		t.Fatal(at)
+	}
+	if mc.Waiters() != 1 || !mc.Now().Equal(start.Add(time.Second)) {
+		t.Fatal(mc.Waiters(), mc.Now())
+	}
+}
+
+func TestManualClockStoppedTimer(t *testing.T) {
+	mc := gosocketiotest.NewManualClock(time.Now())
+
+	timer := mc.NewTimer(time.Second)
+	mc.NewTimer(time.Minute)
+	timer.Stop()
+	if n := mc.Waiters(); n != 1 {
+		t.Fatalf("%d waiters after stop, want 1", n)
+	}
+
+	mc.Advance(time.Minute)
+	if n := mc.Waiters(); n != 0 {
+		t.Fatalf("%d waiters after timer fired", n)
+	}
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+}
+
+/**
+Serve EIO=4 connection with manual clock, server pings client
+*/
+func clockServer(t *testing.T) (*gosocketiotest.ManualClock, *gosocketiotest.Transport, *Client, *Channel) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	mc := gosocketiotest.NewManualClock(time.Now())
+	s.Clock = mc
+	s.ProtocolVersions = []int{ProtocolVersion3, ProtocolVersion4}
+
+	c, sc := dialTest(t, s, tr, gosocketiotest.UrlV4)
+	//pinger is about to sleep
+	if !mc.WaitWaiters(1, time.Second) {
+		t.Fatal("pinger does not wait")
+	}
+	return mc, tr, c, sc
+}
+
+func TestManualClockPing(t *testing.T) {
+	mc, tr, _, _ := clockServer(t)
+	server := tr.Last().Server
+
+	mc.Advance(gosocketiotest.DefaultPingInterval - time.Second)
+	for _, packet := range server.Written() {
+		if packet == protocol.PingMessage {
+			t.Fatal("ping before interval")
+		}
+	}
+
+	mc.Advance(time.Second)
+	if _, ok := server.WaitWritten(protocol.PingMessage, time.Second); !ok {
+		t.Fatal("no ping after interval")
+	}
+}
+
+func TestManualClockPingTimeout(t *testing.T) {
+	mc, tr, _, sc := clockServer(t)
+	//pings reach idle client too late to answer
+	tr.Last().Server.SetLatency(time.Hour)
+
+	mc.Advance(gosocketiotest.DefaultPingInterval)
+	if _, ok := tr.Last().Server.WaitWritten(protocol.PingMessage, time.Second); !ok {
+		t.Fatal("no ping")
+	}
+	if !mc.WaitWaiters(1, time.Second) {
+		t.Fatal("pinger does not wait for pong")
+	}
+	mc.Advance(gosocketiotest.DefaultPingTimeout - time.Second)
+	if !sc.IsAlive() {
+		t.Fatal("closed before ping timeout")
+	}
+
+	mc.Advance(time.Second)
+	select {
+	case <-sc.done:
+	case <-time.After(time.Second):
+		t.Fatal("idle channel is not closed")
+	}
+	sc.aliveLock.Lock()
+	err := sc.closeErr
+	sc.aliveLock.Unlock()
+	if !errors.Is(err, ErrorPingTimeout) {
+		t.Fatalf("closed with %v, want ErrorPingTimeout", err)
+	}
+}
+
+func TestManualClockAckTimeout(t *testing.T) {
+	mc, _, _, sc := clockServer(t)
+	waiters := mc.Waiters()
+
+	//client has no handler, so it never answers
+	result := make(chan error, 1)
+	go func() {
+		_, err := sc.Ack("question", "?", 5*time.Second)
+		result <- err
+	}()
+	if !mc.WaitWaiters(waiters+1, time.Second) {
+		t.Fatal("ack does not wait")
+	}
+
+	mc.Advance(5*time.Second - time.Millisecond)
+	select {
+	case err := <-result:
+		t.Fatalf("ack finished early with %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	mc.Advance(time.Millisecond)
+	select {
+	case err := <-result:
+		if err != ErrorAckTimeout {
+			t.Fatalf("got %v, want ErrorAckTimeout", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ack did not time out")
+	}
+}
+
+func TestManualClockAckAnswered(t *testing.T) {
+	mc, _, c, sc := clockServer(t)
+	c.On("question", func(c *Channel, q string) string {
+		return "!"
+	})
+	waiters := mc.Waiters()
+
+	for i := 0; i < 3; i++ {
+		if _, err := sc.Ack("question", "?", 5*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := mc.Waiters(); n != waiters {
+		t.Fatalf("%d waiters after answered acks, want %d", n, waiters)
+	}
+}
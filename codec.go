@@ -0,0 +1,68 @@
+package gosocketio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	ErrorTrailingData = errors.New("Data after json value")
+)
+
+/**
+Encoding of event arguments, ack results and Call responses. It has
+to produce json, packets embed it as is. Engine.io headers, auth and
+other protocol payloads are encoded with encoding/json anyway
+*/
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+/**
+Codec of encoding/json, default one. Options make decoding strict,
+they are applied to arguments of all handlers
+*/
+type JsonCodec struct {
+	//fail on object keys without matching struct field
+	DisallowUnknownFields bool
+	//decode numbers into interface{} as json.Number, not float64
+	UseNumber bool
+}
+
+func (jc JsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jc JsonCodec) Unmarshal(data []byte, v interface{}) error {
+	if !jc.DisallowUnknownFields && !jc.UseNumber {
+		return json.Unmarshal(data, v)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if jc.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if jc.UseNumber {
+		decoder.UseNumber()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	//decoder stops after first value, json.Unmarshal would fail
+	if decoder.More() {
+		return ErrorTrailingData
+	}
+	return nil
+}
+
+/**
+Get arguments codec of channel, JsonCodec if none is set
+*/
+func (c *Channel) argsCodec() Codec {
+	if c.codec == nil {
+		return JsonCodec{}
+	}
+	return c.codec
+}
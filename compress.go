@@ -0,0 +1,54 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/transport"
+)
+
+/**
+Channel emitting with chosen websocket compression, built by Channel.Compress
+*/
+type CompressedChannel struct {
+	c        *Channel
+	compress bool
+}
+
+/**
+Get channel emitting with compression set by compress. It matters
+only if permessage-deflate was negotiated, see
+WebsocketTransport.EnableCompression. Small frequent messages are
+cheaper uncompressed:
+
+	c.Compress(false).Emit("tick", position)
+*/
+func (c *Channel) Compress(compress bool) *CompressedChannel {
+	return &CompressedChannel{c: c, compress: compress}
+}
+
+/**
+Check if permessage-deflate was negotiated on connection of the
+channel, so Compress and CompressionThreshold have effect. False
+for transports without compression and peers which refused it
+*/
+func (c *Channel) CompressionEnabled() bool {
+	cc, ok := c.conn.(transport.CompressionStateConnection)
+	return ok && cc.CompressionEnabled()
+}
+
+/**
+Same as Channel.Emit
+*/
+func (cc *CompressedChannel) Emit(method string, args interface{}) error {
+	return cc.c.emit(context.Background(), method, args, cc.options())
+}
+
+/**
+Same as Channel.EmitWithAck
+*/
+func (cc *CompressedChannel) EmitWithAck(ctx context.Context, method string, args interface{}) (string, error) {
+	return cc.c.emitWithAck(ctx, method, args, cc.options(), cc.c.contextAckTimeout(ctx))
+}
+
+func (cc *CompressedChannel) options() sendOptions {
+	return sendOptions{uncompressed: !cc.compress}
+}
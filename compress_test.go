@@ -0,0 +1,64 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"github.com/graarh/golang-socketio/transport"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func compressingTransport(enabled bool) *transport.WebsocketTransport {
+	tr := transport.GetDefaultWebsocketTransport()
+	tr.EnableCompression = enabled
+	return tr
+}
+
+func TestCompressionEnabled(t *testing.T) {
+	tests := []struct {
+		name           string
+		server, client bool
+	}{
+		{"both", true, true},
+		{"server refuses", false, true},
+		{"client does not offer", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer(compressingTransport(test.server))
+			connected := make(chan *Channel, 1)
+			s.On(OnConnection, func(c *Channel) {
+				connected <- c
+			})
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			c, err := Dial("ws://"+srv.Listener.Addr().String(), compressingTransport(test.client))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			want := test.server && test.client
+			if got := c.CompressionEnabled(); got != want {
+				t.Fatalf("client: got %v, want %v", got, want)
+			}
+			select {
+			case sc := <-connected:
+				if got := sc.CompressionEnabled(); got != want {
+					t.Fatalf("server: got %v, want %v", got, want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("not connected")
+			}
+		})
+	}
+}
+
+func TestCompressionEnabledWithoutCompression(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	c, sc := dialTest(t, NewServer(tr), tr, gosocketiotest.Url)
+	if c.CompressionEnabled() || sc.CompressionEnabled() {
+		t.Fatal("memory transport reports compression")
+	}
+}
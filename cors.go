@@ -0,0 +1,130 @@
+package gosocketio
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderOrigin = "Origin"
+
+	corsAllowedMethods = "GET, POST"
+)
+
+/**
+Origins allowed to connect, checked for websocket upgrades and every
+polling request, and CORS headers sent to them. Requests without Origin
+header, like ones of non-browser clients, and same origin ones are
+always allowed. With no origins and no func set any origin is allowed
+and no CORS headers are sent
+*/
+type CORSConfig struct {
+	//exact origins like "https://example.com", "*" for any, or with
+	//wildcard like "https://*.example.com" for its subdomains
+	AllowedOrigins []string
+	//called for origins not in AllowedOrigins, allows them if true
+	AllowOriginFunc func(origin string) bool
+
+	//let browsers send cookies with cross-origin polling requests
+	AllowCredentials bool
+	//request headers allowed in addition to simple ones, like auth
+	AllowedHeaders []string
+	//how long browsers cache preflight response, not cached if 0
+	MaxAge time.Duration
+}
+
+/**
+Check if origin checks are on
+*/
+func (cfg *CORSConfig) enabled() bool {
+	return len(cfg.AllowedOrigins) > 0 || cfg.AllowOriginFunc != nil
+}
+
+/**
+Check if origin is allowed by the list or func
+*/
+func (cfg *CORSConfig) allowed(origin string) bool {
+	for _, pattern := range cfg.AllowedOrigins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return cfg.AllowOriginFunc != nil && cfg.AllowOriginFunc(origin)
+}
+
+/**
+Match origin to pattern case insensitive, wildcard matches
+at least one character of host
+*/
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	star := strings.Index(pattern, "*")
+	if star < 0 {
+		return pattern == origin
+	}
+
+	prefix, suffix := pattern[:star], pattern[star+1:]
+	if len(origin) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	return !strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:")
+}
+
+/**
+Check if origin is the host request was made to
+*/
+func sameOrigin(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+/**
+Check request origin and set CORS headers for allowed one.
+Preflight requests are answered here, false is returned when
+request is processed already
+*/
+func (s *Server) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	cfg := &s.CORS
+	if !cfg.enabled() {
+		return true
+	}
+
+	origin := r.Header.Get(HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	if !sameOrigin(origin, r) && !cfg.allowed(origin) {
+		loadLogger(&s.logger).Debug("origin not allowed", "origin", origin, "addr", r.RemoteAddr)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return false
+	}
+
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Add("Vary", HeaderOrigin)
+	if cfg.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if r.Method != "OPTIONS" {
+		return true
+	}
+
+	header.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+	if len(cfg.AllowedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+	}
+	if cfg.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return false
+}
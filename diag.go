@@ -0,0 +1,160 @@
+package gosocketio
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//buffer for stacks of all goroutines, grows if not enough
+	stackBufferSize = 1024 * 64
+)
+
+/**
+Get human readable report of channel state: liveness, queue,
+pending acks, last activity and rooms, for diagnosing stuck channels
+*/
+func (c *Channel) DumpState() string {
+	buf := bytes.NewBuffer(nil)
+	now := c.clock().Now()
+
+	c.aliveLock.Lock()
+	alive, outClosed, closeErr := c.alive, c.outClosed, c.closeErr
+	outBytes, queued := c.outBytes, len(c.out)
+	lastRead, lastWrite := c.lastRead, c.lastWrite
+	c.aliveLock.Unlock()
+
+	fmt.Fprintf(buf, "channel %s\n", c.Id())
+	fmt.Fprintf(buf, "  alive: %t, out closed: %t\n", alive, outClosed)
+	if closeErr != nil {
+		fmt.Fprintf(buf, "  closed with: %v\n", closeErr)
+	}
+	if c.ip != "" {
+		fmt.Fprintf(buf, "  remote: %s\n", c.Ip())
+	}
+	fmt.Fprintf(buf, "  out queue: %d/%d packets, %d bytes\n", queued, c.queue.size(), outBytes)
+	fmt.Fprintf(buf, "  pending acks: %v\n", c.ack.pendingIds())
+	fmt.Fprintf(buf, "  last read: %s\n", formatActivity(lastRead, now))
+	fmt.Fprintf(buf, "  last write: %s\n", formatActivity(lastWrite, now))
+
+	if c.server != nil {
+		r := c.registry()
+		r.channelsLock.RLock()
+		rooms := make([]string, 0, len(r.rooms[c]))
+		for room := range r.rooms[c] {
+			rooms = append(rooms, room)
+		}
+		r.channelsLock.RUnlock()
+
+		sort.Strings(rooms)
+		fmt.Fprintf(buf, "  rooms: %s\n", strings.Join(rooms, ", "))
+	}
+
+	return buf.String()
+}
+
+/**
+Same as DumpState, plus stacks of the channel loop goroutines that
+are still running. Collecting stacks briefly stops the world, so
+do not call it on hot path
+*/
+func (c *Channel) DumpStateWithStacks() string {
+	result := c.DumpState()
+
+	c.aliveLock.Lock()
+	loops := make(map[string]string, len(c.loops))
+	for name, id := range c.loops {
+		loops[strconv.FormatUint(id, 10)] = name
+	}
+	c.aliveLock.Unlock()
+
+	stacks := allStacks()
+	for _, stack := range strings.Split(stacks, "\n\n") {
+		id := strings.TrimPrefix(stack, "goroutine ")
+		if pos := strings.IndexByte(id, ' '); pos != -1 {
+			id = id[:pos]
+		}
+		if name, ok := loops[id]; ok {
+			result += "\n" + name + ": " + stack + "\n"
+		}
+	}
+
+	return result
+}
+
+/**
+Remember goroutine of given channel loop, for stack dumps
+and server stats; loopDone must be called when it exits
+*/
+func (c *Channel) registerLoop(name string) {
+	id := goroutineId()
+	if c.server != nil {
+		atomic.AddInt64(&c.server.stats.loops, 1)
+	}
+
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	if c.loops == nil {
+		c.loops = make(map[string]uint64)
+	}
+	c.loops[name] = id
+}
+
+func (c *Channel) loopDone(name string) {
+	if c.server != nil {
+		atomic.AddInt64(&c.server.stats.loops, -1)
+	}
+
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	delete(c.loops, name)
+}
+
+/**
+Remember time of last activity, one of lastRead or lastWrite
+*/
+func (c *Channel) touch(t *time.Time) {
+	c.aliveLock.Lock()
+	*t = c.clock().Now()
+	c.aliveLock.Unlock()
+}
+
+func formatActivity(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339Nano) + " (" + now.Sub(t).String() + " ago)"
+}
+
+/**
+Get id of current goroutine from its stack header, "goroutine N [..."
+*/
+func goroutineId() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if pos := bytes.IndexByte(buf, ' '); pos != -1 {
+		buf = buf[:pos]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
+
+func allStacks() string {
+	buf := make([]byte, stackBufferSize)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
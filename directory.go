@@ -0,0 +1,65 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Get all channels of the namespace connected to this process,
+Sockets gives their ids across instances of adapter
+*/
+func (r *registry) Channels() []*Channel {
+	r.sidsLock.RLock()
+	defer r.sidsLock.RUnlock()
+
+	channels := make([]*Channel, 0, len(r.sids))
+	for _, c := range r.sids {
+		channels = append(channels, c)
+	}
+	return channels
+}
+
+/**
+Get amount of channels joined to each room
+*/
+func (r *registry) RoomSizes() map[string]int {
+	r.channelsLock.RLock()
+	defer r.channelsLock.RUnlock()
+
+	sizes := make(map[string]int, len(r.channels))
+	for room, channels := range r.channels {
+		sizes[room] = len(channels)
+	}
+	return sizes
+}
+
+/**
+Disconnect channel with given sid, see Channel.Disconnect
+*/
+func (r *registry) Disconnect(sid string) error {
+	c, err := r.GetChannel(sid)
+	if err != nil {
+		return err
+	}
+	return c.Disconnect()
+}
+
+/**
+Send disconnect packet and close channel, so client knows it was
+disconnected by server and does not reconnect. Namespace socket
+leaves, connection stays for other namespaces
+*/
+func (c *Channel) Disconnect() error {
+	if c.server == nil {
+		return ErrorServerNotSet
+	}
+	if c.nsp != nil {
+		c.Close()
+		return nil
+	}
+
+	//queued packets and disconnect are written before connection is closed
+	err := send(&protocol.Message{Type: protocol.MessageTypeDisconnect}, c, nil)
+	closeChannel(c, c.namespaceMethods())
+	return err
+}
@@ -0,0 +1,119 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"github.com/graarh/golang-socketio/transport"
+)
+
+/**
+Disconnect reason keys, used by Server.DisconnectStats
+*/
+const (
+	//channel closed by this side, with Close
+	DisconnectServerClose = "server close"
+	//channel closed by Server.Shutdown
+	DisconnectServerShutdown = "server shutdown"
+	//channel closed by Server.Drain
+	DisconnectServerDrain = "server drain"
+	//namespace socket closed by server, connection stays
+	DisconnectServerNamespace = "server namespace disconnect"
+	//client left namespace, connection stays
+	DisconnectClientNamespace = "client namespace disconnect"
+	//peer sent disconnect packet or websocket close frame
+	DisconnectClientClose = "client close"
+	//outgoing queue of the channel is full
+	DisconnectOverflood = "overflood"
+	//channel shed by server buffer budget
+	DisconnectBufferBudget = "buffer budget"
+	//pong for ping sent by this side did not come in time
+	DisconnectPingTimeout = "ping timeout"
+	//peer sent packet that can't be decoded, broke heartbeat rules
+	//or put too many packets to polling payload
+	DisconnectProtocolError = "protocol error"
+	//connection failed while reading
+	DisconnectReadError = "read error"
+	//connection failed while writing
+	DisconnectWriteError = "write error"
+	//event handler panicked, with PanicClose policy
+	DisconnectHandlerPanic = "handler panic"
+	//incoming messages exceeded RateLimit, with RateDisconnect policy
+	DisconnectRateLimited = "rate limited"
+	//incoming message exceeded max message size
+	DisconnectMessageTooBig = "message too big"
+)
+
+/**
+Why channel was disconnected, OnDisconnection handlers
+taking it as argument get it:
+
+	server.On(gosocketio.OnDisconnection, func(c *gosocketio.Channel, d gosocketio.Disconnection) {
+		log.Println(c.Id(), d.Reason, d.Err)
+	})
+*/
+type Disconnection struct {
+	//one of Disconnect* constants
+	Reason string `json:"reason"`
+	//error channel was closed with, nil if it was closed on purpose
+	Err error `json:"-"`
+}
+
+/**
+Get why channel was disconnected, zero Disconnection while it is connected
+*/
+func (c *Channel) Disconnection() Disconnection {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	return c.disconnection
+}
+
+/**
+Error of writing to connection, to tell it from read errors
+*/
+type writeError struct {
+	error
+}
+
+func (e writeError) Unwrap() error {
+	return e.error
+}
+
+/**
+Get reason key for the error channel was closed with
+*/
+func disconnectReason(err error) string {
+	var closeErr *transport.CloseError
+	switch {
+	case err == nil:
+		return DisconnectServerClose
+	case errors.As(err, &closeErr), errors.Is(err, ErrorPeerDisconnect):
+		return DisconnectClientClose
+	case errors.Is(err, ErrorSocketOverflood):
+		return DisconnectOverflood
+	case errors.Is(err, ErrorBufferBudget):
+		return DisconnectBufferBudget
+	case errors.Is(err, ErrorPingTimeout):
+		return DisconnectPingTimeout
+	case errors.Is(err, transport.ErrorMessageTooBig):
+		return DisconnectMessageTooBig
+	case errors.Is(err, ErrorMessageRate), errors.Is(err, ErrorByteRate),
+		errors.Is(err, ErrorPayloadTooLarge):
+		return DisconnectRateLimited
+	case errors.Is(err, protocol.ErrorWrongPacket), errors.Is(err, ErrorWrongHeader),
+		errors.Is(err, ErrorUnexpectedPong), errors.Is(err, transport.ErrorTooManyPackets),
+		errors.Is(err, ErrorWrongChunk):
+		return DisconnectProtocolError
+	case errors.As(err, new(writeError)):
+		return DisconnectWriteError
+	}
+	return DisconnectReadError
+}
+
+/**
+Get amount of closed channels by disconnect reason, keys are
+Disconnect* constants, reasons with no disconnects are omitted
+*/
+func (s *Server) DisconnectStats() map[string]int64 {
+	return s.stats.disconnectsCopy()
+}
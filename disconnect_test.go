@@ -0,0 +1,101 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"github.com/graarh/golang-socketio/transport"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	//websocket close code of browser leaving the page
+	closeGoingAway = 1001
+)
+
+func TestPeerCloseCode(t *testing.T) {
+	s := NewServer(transport.GetDefaultWebsocketTransport())
+	closed := make(chan *Channel, 1)
+	s.On(OnDisconnection, func(c *Channel) {
+		closed <- c
+	})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c, err := Dial("ws://"+srv.Listener.Addr().String(), transport.GetDefaultWebsocketTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.conn.(transport.CodeCloseConnection).CloseWithCode(closeGoingAway, "navigated away")
+
+	select {
+	case sc := <-closed:
+		code, reason, ok := sc.PeerClose()
+		if !ok || code != closeGoingAway || reason != "navigated away" {
+			t.Fatalf("got %d %q %v", code, reason, ok)
+		}
+		if d := sc.Disconnection(); d.Reason != DisconnectClientClose {
+			t.Fatalf("reason %q, want %q", d.Reason, DisconnectClientClose)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not see close")
+	}
+}
+
+func TestPollingTooManyPackets(t *testing.T) {
+	tr := transport.GetDefaultPollingTransport()
+	tr.MaxPacketsPerPayload = 3
+	s := NewServer(tr)
+	s.ProtocolVersions = []int{ProtocolVersion3, ProtocolVersion4}
+	closed := make(chan Disconnection, 1)
+	s.On(OnDisconnection, func(c *Channel, d Disconnection) {
+		closed <- d
+	})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	url := srv.URL + "/socket.io/?EIO=4&transport=polling"
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	var hdr Header
+	if err := json.Unmarshal(open[1:], &hdr); err != nil {
+		t.Fatalf("open packet %q: %v", open, err)
+	}
+
+	post := func(payload string) int {
+		t.Helper()
+		resp, err := http.Post(url+"&sid="+hdr.Sid, "text/plain;charset=UTF-8", strings.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	tick := `42["tick"]`
+	if code := post("40\x1e" + tick + "\x1e" + tick); code != http.StatusOK {
+		t.Fatalf("payload within limit: status %d", code)
+	}
+	if code := post(strings.Repeat(tick+"\x1e", 3) + tick); code != http.StatusBadRequest {
+		t.Fatalf("payload over limit: status %d, want 400", code)
+	}
+
+	select {
+	case d := <-closed:
+		if d.Reason != DisconnectProtocolError {
+			t.Fatalf("reason %q, want %q", d.Reason, DisconnectProtocolError)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("session is not closed")
+	}
+	if n := s.Stats().RejectedPayloads; n != 1 {
+		t.Fatalf("%d rejected payloads counted, want 1", n)
+	}
+}
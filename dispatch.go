@@ -0,0 +1,167 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/protocol"
+	"time"
+)
+
+const (
+	DefaultDispatchWorkers = 256
+	DefaultDispatchQueue   = 100
+)
+
+/**
+How handlers of received packets are run
+*/
+type DispatchMode int
+
+const (
+	//goroutine for every packet, handlers run at once in any order
+	DispatchConcurrent DispatchMode = iota
+	//packets of connection are handled one by one, in received order
+	DispatchOrdered
+	//goroutine for every packet, limited to Workers for all connections
+	DispatchPool
+)
+
+/**
+Dispatch mode of handlers. In DispatchOrdered and DispatchPool modes
+reading of connection waits while queue or pool is full, handlers
+waiting there for acks of the same peer may time out then.
+Ack responses and stream packets are never queued
+*/
+type DispatchConfig struct {
+	Mode DispatchMode
+	//handlers running at once in DispatchPool mode, DefaultDispatchWorkers if 0
+	Workers int
+	//packets of connection waiting for handler in DispatchOrdered mode,
+	//DefaultDispatchQueue if 0
+	Queue int
+	//how long handler of DispatchOrdered mode holds the next packets, no
+	//limit if 0. Its context is done then, it is logged and left running,
+	//as Go can't stop it, and the next packet is handled. Real time
+	HandlerTimeout time.Duration
+}
+
+func (cfg *DispatchConfig) workers() int {
+	if cfg.Workers <= 0 {
+		return DefaultDispatchWorkers
+	}
+	return cfg.Workers
+}
+
+func (cfg *DispatchConfig) queue() int {
+	if cfg.Queue <= 0 {
+		return DefaultDispatchQueue
+	}
+	return cfg.Queue
+}
+
+/**
+Create slots of running handlers, nil unless mode is DispatchPool
+*/
+func (cfg *DispatchConfig) newPool() chan struct{} {
+	if cfg.Mode != DispatchPool {
+		return nil
+	}
+	return make(chan struct{}, cfg.workers())
+}
+
+/**
+Get handler slots shared by all connections of server,
+created with the first one
+*/
+func (s *Server) dispatchPool() chan struct{} {
+	s.poolOnce.Do(func() {
+		s.pool = s.Dispatch.newPool()
+	})
+	return s.pool
+}
+
+/**
+Run processing of received packet as dispatch mode says,
+it is called by inLoop only
+*/
+func (c *Channel) dispatch(msg *protocol.Message, process func(ctx context.Context)) {
+	if !c.addHandler() {
+		return
+	}
+	run := func(ctx context.Context) {
+		defer c.handlers.Done()
+		c.countHandler(1)
+		defer c.countHandler(-1)
+		process(ctx)
+	}
+
+	//queued handlers may wait for them
+	if msg.Type == protocol.MessageTypeAckResponse || isStreamPacket(msg) {
+		go run(context.Background())
+		return
+	}
+
+	switch c.dispatchConfig.Mode {
+	case DispatchOrdered:
+		if c.ordered == nil {
+			c.ordered = make(chan func(), c.dispatchConfig.queue())
+			go orderedLoop(c.ordered)
+		}
+		c.ordered <- func() {
+			c.runOrdered(msg, run)
+		}
+	case DispatchPool:
+		c.pool <- struct{}{}
+		go func() {
+			defer func() { <-c.pool }()
+			run(context.Background())
+		}()
+	default:
+		go run(context.Background())
+	}
+}
+
+/**
+Run handler of ordered packet, until it returns or HandlerTimeout
+is over. Handler which is late keeps running in its goroutine
+*/
+func (c *Channel) runOrdered(msg *protocol.Message, run func(ctx context.Context)) {
+	timeout := c.dispatchConfig.HandlerTimeout
+	if timeout <= 0 {
+		run(context.Background())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		run(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		select {
+		case <-done:
+		default:
+			c.log().Warn("handler timed out, next packet is handled", "sid", c.Id(),
+				"event", msg.Method, "timeout", timeout)
+		}
+	}
+}
+
+func orderedLoop(queue chan func()) {
+	for run := range queue {
+		run()
+	}
+}
+
+/**
+Stop ordered handler goroutine once queued packets are handled
+*/
+func (c *Channel) stopDispatch() {
+	if c.ordered != nil {
+		close(c.ordered)
+	}
+}
@@ -0,0 +1,84 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"testing"
+	"time"
+)
+
+func TestDispatchHandlerTimeout(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.Dispatch = DispatchConfig{Mode: DispatchOrdered, HandlerTimeout: 50 * time.Millisecond}
+
+	release := make(chan struct{})
+	slowDone := make(chan error, 1)
+	s.On("slow", func(ctx context.Context, c *Channel) {
+		if _, ok := ctx.Deadline(); !ok {
+			slowDone <- nil
+			return
+		}
+		<-release
+		slowDone <- ctx.Err()
+	})
+	fast := make(chan struct{}, 1)
+	s.On("fast", func(c *Channel) {
+		fast <- struct{}{}
+	})
+	c, _ := dialTest(t, s, tr, gosocketiotest.Url)
+
+	c.Emit("slow", nil)
+	c.Emit("fast", nil)
+	select {
+	case <-fast:
+	case <-time.After(time.Second):
+		t.Fatal("next event is held by timed out handler")
+	}
+
+	//timed out handler is not stopped
+	select {
+	case err := <-slowDone:
+		t.Fatalf("slow handler finished early with %v", err)
+	default:
+	}
+	close(release)
+	select {
+	case err := <-slowDone:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("handler context error %v, want deadline exceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("slow handler did not finish")
+	}
+}
+
+func TestDispatchOrderedWithoutTimeout(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.Dispatch = DispatchConfig{Mode: DispatchOrdered}
+
+	release := make(chan struct{})
+	s.On("slow", func(c *Channel) {
+		<-release
+	})
+	fast := make(chan struct{}, 1)
+	s.On("fast", func(c *Channel) {
+		fast <- struct{}{}
+	})
+	c, _ := dialTest(t, s, tr, gosocketiotest.Url)
+
+	c.Emit("slow", nil)
+	c.Emit("fast", nil)
+	select {
+	case <-fast:
+		t.Fatal("ordered event handled before previous one returned")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-fast:
+	case <-time.After(time.Second):
+		t.Fatal("next event is not handled")
+	}
+}
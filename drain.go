@@ -0,0 +1,115 @@
+package gosocketio
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultDrainEvent     = "server:drain"
+	DefaultDrainWindow    = 30 * time.Second
+	DefaultDrainBatchSize = 100
+)
+
+/**
+How Server.Drain moves channels to other instances: every channel
+gets the event first, then channels are closed in batches spread
+over the window, in random order
+*/
+type DrainConfig struct {
+	//event emitted to every channel, DefaultDrainEvent if empty
+	Event string
+	//argument of the event, like address of other instance
+	Data interface{}
+	//time to close all channels in, DefaultDrainWindow if 0; if ctx
+	//of Drain is done earlier, window ends before it, leaving time
+	//for the last connections to close
+	Window time.Duration
+	//channels closed at once, DefaultDrainBatchSize if 0
+	BatchSize int
+}
+
+func (cfg *DrainConfig) event() string {
+	if cfg.Event == "" {
+		return DefaultDrainEvent
+	}
+	return cfg.Event
+}
+
+func (cfg *DrainConfig) window(ctx context.Context, now time.Time) time.Duration {
+	window := cfg.Window
+	if window <= 0 {
+		window = DefaultDrainWindow
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := deadline.Sub(now) * 9 / 10; left < window {
+			window = left
+		}
+	}
+	return window
+}
+
+func (cfg *DrainConfig) batchSize() int {
+	if cfg.BatchSize <= 0 {
+		return DefaultDrainBatchSize
+	}
+	return cfg.BatchSize
+}
+
+/**
+Drain the server for deploy: stop accepting connections, emit drain
+event to every channel and close them in batches over the window, so
+reconnecting clients don't come to other instances all at once.
+Clients may leave by themselves after the event.
+
+Channels get engine.io close packet, like with Shutdown. When ctx
+is done first, remaining connections are dropped and ctx error
+is returned. Server is shut down after it
+*/
+func (s *Server) Drain(ctx context.Context) error {
+	s.StopAccepting()
+
+	cfg := &s.Draining
+	channels := s.connectionsList()
+	for _, c := range channels {
+		c.Emit(cfg.event(), cfg.Data)
+	}
+
+	rand.Shuffle(len(channels), func(i, j int) {
+		channels[i], channels[j] = channels[j], channels[i]
+	})
+
+	size := cfg.batchSize()
+	batches := (len(channels) + size - 1) / size
+	interval := time.Duration(0)
+	if batches > 0 {
+		interval = cfg.window(ctx, s.clock().Now()) / time.Duration(batches)
+	}
+
+	for start := 0; start < len(channels); start += size {
+		//first batch waits too, giving clients time to leave
+		timer := s.clock().NewTimer(interval)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			s.Shutdown(ctx)
+			return waitClosed(ctx, channels)
+		}
+
+		end := start + size
+		if end > len(channels) {
+			end = len(channels)
+		}
+		for _, c := range channels[start:end] {
+			s.closeGracefully(c, DisconnectServerDrain)
+		}
+	}
+
+	//connections accepted while the list was taken are closed too
+	if err := s.Shutdown(ctx); err != nil {
+		return err
+	}
+	return waitClosed(ctx, channels)
+}
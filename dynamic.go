@@ -0,0 +1,192 @@
+package gosocketio
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrorNamespaceTemplate = errors.New("Invalid namespace template")
+
+	templateParam = regexp.MustCompile(`\{(\w+)\}`)
+)
+
+/**
+Namespaces matching pattern are created on connect, sharing
+handlers of the parent returned by OfPattern
+*/
+type namespacePattern struct {
+	re     *regexp.Regexp
+	parent *Namespace
+}
+
+/**
+Get parent of dynamic namespaces, every namespace with name matching
+template is accepted. Parameter in braces matches one part of the path:
+
+	rooms := server.OfPattern("/room/{id}")
+	rooms.On(gosocketio.OnConnection, func(c *gosocketio.Channel) {
+		log.Println("joined room", c.NamespaceParam("id"))
+	})
+
+Namespaces like "/room/42" are created on first connection and removed
+when their last socket leaves; get them with Of to broadcast.
+Panics if template is not valid, parameter names are words
+*/
+func (s *Server) OfPattern(template string) *Namespace {
+	if strings.ContainsAny(templateParam.ReplaceAllString(template, ""), "{}") {
+		panic(ErrorNamespaceTemplate)
+	}
+
+	expr := ""
+	last := 0
+	for _, match := range templateParam.FindAllStringSubmatchIndex(template, -1) {
+		expr += regexp.QuoteMeta(template[last:match[0]]) +
+			"(?P<" + template[match[2]:match[3]] + ">[^/]+)"
+		last = match[1]
+	}
+	expr += regexp.QuoteMeta(template[last:])
+
+	return s.ofPattern(template, regexp.MustCompile(expr))
+}
+
+/**
+Same as OfPattern, with regexp matching the whole namespace name,
+its named groups are the parameters
+*/
+func (s *Server) OfRegexp(re *regexp.Regexp) *Namespace {
+	return s.ofPattern(re.String(), re)
+}
+
+func (s *Server) ofPattern(name string, re *regexp.Regexp) *Namespace {
+	anchored := regexp.MustCompile("^(?:" + re.String() + ")$")
+
+	s.namespacesLock.Lock()
+	defer s.namespacesLock.Unlock()
+
+	for _, p := range s.patterns {
+		if p.re.String() == anchored.String() {
+			return p.parent
+		}
+	}
+
+	parent := newNamespace(s, name)
+	s.patterns = append(s.patterns, namespacePattern{re: anchored, parent: parent})
+	return parent
+}
+
+/**
+Create namespace of given name if it matches one of patterns,
+nil if it does not. namespacesLock should be held
+*/
+func (s *Server) matchNamespace(name string) *Namespace {
+	for _, p := range s.patterns {
+		match := p.re.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+
+		params := make(map[string]string)
+		for i, param := range p.re.SubexpNames() {
+			if param != "" {
+				params[param] = match[i]
+			}
+		}
+
+		ns := &Namespace{
+			methods:  p.parent.methods,
+			registry: &registry{},
+			parent:   p.parent,
+			params:   params,
+		}
+		ns.initRegistry(s, name)
+		return ns
+	}
+	return nil
+}
+
+/**
+Find namespace for connecting socket, creating dynamic one.
+It is not removed until releaseNamespace
+*/
+func (s *Server) acquireNamespace(name string) *Namespace {
+	s.namespacesLock.Lock()
+	defer s.namespacesLock.Unlock()
+
+	ns, ok := s.namespaces[name]
+	if !ok {
+		if ns = s.matchNamespace(name); ns == nil {
+			return nil
+		}
+		s.namespaces[name] = ns
+	}
+	ns.connecting++
+	return ns
+}
+
+/**
+Socket connect to namespace is over, accepted or not
+*/
+func (s *Server) releaseNamespace(ns *Namespace) {
+	s.namespacesLock.Lock()
+	defer s.namespacesLock.Unlock()
+
+	ns.connecting--
+	s.removeEmptyNamespace(ns)
+}
+
+/**
+Remove dynamic namespace without sockets, namespacesLock should be held
+*/
+func (s *Server) removeEmptyNamespace(ns *Namespace) {
+	if ns.parent == nil || ns.connecting > 0 {
+		return
+	}
+
+	ns.sidsLock.RLock()
+	empty := len(ns.sids) == 0
+	ns.sidsLock.RUnlock()
+
+	if empty && s.namespaces[ns.namespace] == ns {
+		delete(s.namespaces, ns.namespace)
+	}
+}
+
+/**
+Namespace socket left, its namespace goes if it was the last one
+*/
+func (s *Server) namespaceLeft(ns *Namespace) {
+	if ns.parent == nil {
+		return
+	}
+
+	s.namespacesLock.Lock()
+	defer s.namespacesLock.Unlock()
+
+	s.removeEmptyNamespace(ns)
+}
+
+/**
+Get parameter of dynamic namespace matched by OfPattern,
+empty if there is no such parameter
+*/
+func (c *Channel) NamespaceParam(name string) string {
+	if c.nsp == nil {
+		return ""
+	}
+	return c.nsp.params[name]
+}
+
+/**
+Get copy of all parameters of dynamic namespace
+*/
+func (c *Channel) NamespaceParams() map[string]string {
+	params := make(map[string]string)
+	if c.nsp != nil {
+		for name, value := range c.nsp.params {
+			params[name] = value
+		}
+	}
+	return params
+}
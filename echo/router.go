@@ -0,0 +1,43 @@
+package echo
+
+import (
+	"github.com/graarh/golang-socketio"
+	"github.com/labstack/echo/v4"
+	"strings"
+)
+
+/**
+Echo instance or group
+*/
+type Router interface {
+	Any(path string, handler echo.HandlerFunc, middleware ...echo.MiddlewareFunc) []*echo.Route
+}
+
+/**
+Echo handler of socket.io server, it serves both websocket
+and polling requests
+*/
+func Handler(s *gosocketio.Server) echo.HandlerFunc {
+	return echo.WrapHandler(s)
+}
+
+/**
+Get echo route of server path, like "/socket.io/*"
+*/
+func Route(s *gosocketio.Server) string {
+	return strings.TrimSuffix(s.Path(), "/") + "/*"
+}
+
+/**
+Mount server to echo instance or group, next to REST routes:
+
+	e := echo.New()
+	e.GET("/api/users", listUsers)
+	secho.Mount(e, server)
+
+Group prefix is part of request path, so if server Options.Path
+is set, it has to include the prefix
+*/
+func Mount(r Router, s *gosocketio.Server, middleware ...echo.MiddlewareFunc) {
+	r.Any(Route(s), Handler(s), middleware...)
+}
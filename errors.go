@@ -0,0 +1,122 @@
+package gosocketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/graarh/golang-socketio/protocol"
+	"reflect"
+)
+
+var (
+	ErrorWrongArgs = errors.New("Wrong event arguments")
+)
+
+/**
+Where error of the channel comes from
+*/
+type ErrorKind string
+
+const (
+	//packet can't be decoded or its arguments don't fit the handler
+	KindProtocol ErrorKind = "protocol"
+	//connection failed while reading or writing
+	KindTransport ErrorKind = "transport"
+	//handler failed, panicked or its arguments are not valid
+	KindHandler ErrorKind = "handler"
+)
+
+/**
+Error delivered to OnError handlers. Handlers may take *ChannelError,
+ChannelError or error argument, typed ones get it as json:
+
+	server.On(gosocketio.OnError, func(c *gosocketio.Channel, err *gosocketio.ChannelError) {
+		log.Println(err.Kind, err.Packet, err)
+	})
+*/
+type ChannelError struct {
+	Kind ErrorKind `json:"kind"`
+	//incoming packet which caused the error, empty if there is none
+	Packet string `json:"packet,omitempty"`
+	//text of Err
+	Message string `json:"message"`
+
+	Err     error    `json:"-"`
+	Channel *Channel `json:"-"`
+}
+
+func (e *ChannelError) Error() string {
+	return fmt.Sprintf("%s error: %s", e.Kind, e.Message)
+}
+
+func (e *ChannelError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	channelErrorType    = reflect.TypeOf(ChannelError{})
+	channelErrorPtrType = reflect.TypeOf(&ChannelError{})
+)
+
+func newChannelError(c *Channel, kind ErrorKind, packet string, err error) *ChannelError {
+	return &ChannelError{
+		Kind:    kind,
+		Packet:  packet,
+		Message: err.Error(),
+		Err:     err,
+		Channel: c,
+	}
+}
+
+/**
+Wrap error of packet decoding, custom parsers may return any error
+*/
+func decodeError(packet string, err error) error {
+	var decodeErr *protocol.DecodeError
+	if errors.As(err, &decodeErr) {
+		return err
+	}
+	return &protocol.DecodeError{Packet: packet, Err: err}
+}
+
+/**
+Wrap error of event arguments unmarshalling
+*/
+func argsError(err error) error {
+	return fmt.Errorf("%w: %v", ErrorWrongArgs, err)
+}
+
+/**
+Fire OnError event with given error, it goes to the channel too
+*/
+func (m *methods) fireError(c *Channel, kind ErrorKind, packet string, err error) *ChannelError {
+	e := newChannelError(c, kind, packet, err)
+	m.callError(c, e)
+	return e
+}
+
+/**
+Call OnError handlers, the ones taking error or ChannelError get it
+*/
+func (m *methods) callError(c *Channel, e *ChannelError) {
+	defer m.recoverHandler(c, OnError, e.Packet)
+
+	for _, f := range m.findMethods(OnError) {
+		switch {
+		case f.Typed != nil:
+			args, _ := json.Marshal(e)
+			f.Typed(context.Background(), c, m, &protocol.Message{Method: OnError, Args: string(args)})
+		case !f.ArgsPresent:
+			f.callFunc(context.Background(), c, &struct{}{})
+		case channelErrorPtrType.AssignableTo(f.Args):
+			arg := reflect.New(f.Args)
+			arg.Elem().Set(reflect.ValueOf(e))
+			f.callFunc(context.Background(), c, arg.Interface())
+		case channelErrorType.AssignableTo(f.Args):
+			f.callFunc(context.Background(), c, e)
+		default:
+			f.callFunc(context.Background(), c, nil)
+		}
+	}
+}
@@ -32,7 +32,7 @@ func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	c, err := gosocketio.Dial(
-		gosocketio.GetUrl("localhost", 3811, false),
+		"ws://localhost:3811",
 		transport.GetDefaultWebsocketTransport())
 	if err != nil {
 		log.Fatal(err)
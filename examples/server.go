@@ -27,7 +27,7 @@ func main() {
 		c.Emit("/message", Message{10, "main", "using emit"})
 
 		c.Join("test")
-		c.BroadcastTo("test", "/message", Message{10, "main", "using broadcast"})
+		server.BroadcastTo("test", "/message", Message{10, "main", "using broadcast"})
 	})
 	server.On(gosocketio.OnDisconnection, func(c *gosocketio.Channel) {
 		log.Println("Disconnected")
@@ -0,0 +1,36 @@
+package gin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/graarh/golang-socketio"
+	"strings"
+)
+
+/**
+Gin handler of socket.io server, it serves both websocket
+and polling requests
+*/
+func Handler(s *gosocketio.Server) gin.HandlerFunc {
+	return gin.WrapH(s)
+}
+
+/**
+Get gin route of server path, like "/socket.io/*any"
+*/
+func Route(s *gosocketio.Server) string {
+	return strings.TrimSuffix(s.Path(), "/") + "/*any"
+}
+
+/**
+Mount server to gin engine or group, next to REST routes:
+
+	router := gin.Default()
+	router.GET("/api/users", listUsers)
+	sgin.Mount(router, server)
+
+Group prefix is part of request path, so if server Options.Path
+is set, it has to include the prefix
+*/
+func Mount(r gin.IRoutes, s *gosocketio.Server) {
+	r.Any(Route(s), Handler(s))
+}
@@ -0,0 +1,171 @@
+package gosocketiotest
+
+import (
+	"github.com/graarh/golang-socketio/clock"
+	"sync"
+	"time"
+)
+
+/**
+Clock moved by hand, for Server.Clock and ClientConfig.Clock in tests.
+Timers and tickers fire only when Advance passes their time, so pings,
+ack timeouts and rate limits happen exactly when test wants them
+*/
+type ManualClock struct {
+	now     time.Time
+	timers  []*manualTimer
+	changed chan struct{} //closed when timer is added
+	lock    sync.Mutex
+}
+
+type manualTimer struct {
+	clock  *ManualClock
+	at     time.Time
+	period time.Duration //of ticker, 0 for timer
+	c      chan time.Time
+}
+
+/**
+Create clock showing given time
+*/
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now, changed: make(chan struct{})}
+}
+
+func (mc *ManualClock) Now() time.Time {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	return mc.now
+}
+
+/**
+Create timer firing once Advance passes d, it stops waiting when
+it fires or is stopped
+*/
+func (mc *ManualClock) NewTimer(d time.Duration) clock.Timer {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	t := &manualTimer{clock: mc, at: mc.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- mc.now
+		return t
+	}
+	mc.add(t)
+	return t
+}
+
+func (mc *ManualClock) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	t := &manualTimer{clock: mc, at: mc.now.Add(d), period: d, c: make(chan time.Time, 1)}
+	mc.add(t)
+	return t
+}
+
+/**
+Move time forward, firing timers and tickers due by then in order of
+their time. Like time.Ticker, ticker drops ticks nobody takes
+*/
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	end := mc.now.Add(d)
+	for {
+		next := -1
+		for i, t := range mc.timers {
+			if !t.at.After(end) && (next == -1 || t.at.Before(mc.timers[next].at)) {
+				next = i
+			}
+		}
+		if next == -1 {
+			break
+		}
+
+		t := mc.timers[next]
+		mc.now = t.at
+		select {
+		case t.c <- t.at:
+		default:
+		}
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			mc.remove(t)
+		}
+	}
+	mc.now = end
+}
+
+/**
+Get amount of timers and tickers waiting to fire, fired and
+stopped timers are not counted
+*/
+func (mc *ManualClock) Waiters() int {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	return len(mc.timers)
+}
+
+/**
+Wait until at least n timers and tickers wait to fire, so Advance
+reaches goroutines about to sleep. Returns false after timeout
+*/
+func (mc *ManualClock) WaitWaiters(n int, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		mc.lock.Lock()
+		count := len(mc.timers)
+		changed := mc.changed
+		mc.lock.Unlock()
+
+		if count >= n {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+/**
+Add timer and wake WaitWaiters, must be called under lock
+*/
+func (mc *ManualClock) add(t *manualTimer) {
+	mc.timers = append(mc.timers, t)
+	close(mc.changed)
+	mc.changed = make(chan struct{})
+}
+
+/**
+Remove timer, must be called under lock
+*/
+func (mc *ManualClock) remove(t *manualTimer) {
+	for i := range mc.timers {
+		if mc.timers[i] == t {
+			mc.timers = append(mc.timers[:i], mc.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	t.clock.remove(t)
+}
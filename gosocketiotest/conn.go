@@ -0,0 +1,244 @@
+package gosocketiotest
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/transport"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//websocket close code of peer gone without close frame
+	closeAbnormal = 1006
+)
+
+var (
+	ErrorConnectionLost = errors.New("Connection lost")
+	ErrorClosed         = errors.New("Connection closed")
+)
+
+type delivery struct {
+	message string
+	at      time.Time
+}
+
+/**
+One end of in-memory connection. Messages written to it are delivered
+to its peer in order, after latency if it is set. Written messages are
+recorded, so tests can assert on them
+*/
+type Conn struct {
+	transport *Transport
+	peer      *Conn
+
+	lock      sync.Mutex
+	changed   chan struct{}
+	incoming  []delivery
+	written   []string
+	err       error //returned by GetMessage once incoming is drained
+	closed    bool
+	latency   time.Duration
+	readLimit int64
+}
+
+func newConn(t *Transport) *Conn {
+	return &Conn{
+		transport: t,
+		changed:   make(chan struct{}),
+		latency:   t.Latency,
+	}
+}
+
+/**
+Close channel to wake waiters and replace it, must be called under lock
+*/
+func (c *Conn) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *Conn) GetMessage() (message string, err error) {
+	deadline := time.After(c.transport.ReceiveTimeout)
+	for {
+		c.lock.Lock()
+		var wait <-chan time.Time
+		if len(c.incoming) > 0 {
+			next := c.incoming[0]
+			delay := time.Until(next.at)
+			if delay <= 0 {
+				c.incoming = c.incoming[1:]
+				c.lock.Unlock()
+				return next.message, nil
+			}
+			wait = time.After(delay)
+		} else if c.err != nil {
+			err = c.err
+			c.lock.Unlock()
+			return "", err
+		}
+		changed := c.changed
+		c.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-wait:
+		case <-deadline:
+			return "", transport.ErrorReceiveTimeout
+		}
+	}
+}
+
+func (c *Conn) WriteMessage(message string) error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return ErrorClosed
+	}
+	c.written = append(c.written, message)
+	latency := c.latency
+	c.notify()
+	c.lock.Unlock()
+
+	c.peer.deliver(message, latency)
+	return nil
+}
+
+/**
+Put message to incoming queue, peer is closed with
+code 1009 if message is bigger than read limit
+*/
+func (c *Conn) deliver(message string, latency time.Duration) {
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return
+	}
+	if c.readLimit > 0 && int64(len(message)) > c.readLimit {
+		c.lock.Unlock()
+		c.fail(transport.ErrorMessageTooBig,
+			&transport.CloseError{Code: transport.CloseMessageTooBig})
+		return
+	}
+	c.incoming = append(c.incoming, delivery{message, time.Now().Add(latency)})
+	c.notify()
+	c.lock.Unlock()
+}
+
+/**
+Close both ends, this one reads err and peer reads peerErr
+once their queues are drained
+*/
+func (c *Conn) fail(err, peerErr error) {
+	c.stop(err)
+	c.peer.stop(peerErr)
+}
+
+func (c *Conn) stop(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err == nil {
+		c.err = err
+	}
+	c.closed = true
+	c.notify()
+}
+
+/**
+Close connection, peer reads it as closed without close frame,
+like websocket with code 1006
+*/
+func (c *Conn) Close() {
+	c.fail(ErrorClosed, &transport.CloseError{Code: closeAbnormal})
+}
+
+/**
+Close connection with close frame of given code
+*/
+func (c *Conn) CloseWithCode(code int, text string) {
+	c.fail(ErrorClosed, &transport.CloseError{Code: code, Text: text})
+}
+
+/**
+Simulate network failure, both ends read ErrorConnectionLost,
+which is recovered by connection state recovery and ReconnectingClient
+*/
+func (c *Conn) Disconnect() {
+	c.fail(ErrorConnectionLost, ErrorConnectionLost)
+}
+
+func (c *Conn) PingParams() (interval, timeout time.Duration) {
+	return c.transport.PingInterval, c.transport.PingTimeout
+}
+
+func (c *Conn) SetReadLimit(limit int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.readLimit = limit
+}
+
+/**
+Set delay of messages written to this end, they are delivered
+to peer in order anyway
+*/
+func (c *Conn) SetLatency(latency time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.latency = latency
+}
+
+/**
+Get other end of the connection
+*/
+func (c *Conn) Peer() *Conn {
+	return c.peer
+}
+
+/**
+Deliver message to this end as if peer sent it,
+like malformed packets peer would never send
+*/
+func (c *Conn) Inject(message string) {
+	c.deliver(message, 0)
+}
+
+/**
+Get messages written to this end so far, in engine.io text form,
+like `42["message","hi"]`
+*/
+func (c *Conn) Written() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]string(nil), c.written...)
+}
+
+/**
+Wait for message written to this end which has given prefix,
+messages written before the call are checked too
+*/
+func (c *Conn) WaitWritten(prefix string, timeout time.Duration) (string, bool) {
+	deadline := time.After(timeout)
+	checked := 0
+	for {
+		c.lock.Lock()
+		for ; checked < len(c.written); checked++ {
+			if strings.HasPrefix(c.written[checked], prefix) {
+				message := c.written[checked]
+				c.lock.Unlock()
+				return message, true
+			}
+		}
+		changed := c.changed
+		c.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return "", false
+		}
+	}
+}
@@ -0,0 +1,201 @@
+/**
+In-memory transport for tests of socket.io servers and clients.
+Server and clients are connected by pipes without sockets, each
+connection records packets written to it:
+
+	tr := gosocketiotest.NewTransport()
+	server := gosocketio.NewServer(tr)
+	tr.Attach(server)
+
+	client, err := gosocketio.Dial(gosocketiotest.Url, tr)
+	client.Emit("send", msg)
+
+	pair := tr.Last()
+	packet, ok := pair.Server.WaitWritten(`42["message"`, time.Second)
+	pair.Client.Disconnect()
+*/
+package gosocketiotest
+
+import (
+	"context"
+	"errors"
+	"github.com/graarh/golang-socketio/transport"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	//address of the server, any host works
+	Url   = "ws://gosocketiotest/socket.io/?EIO=3&transport=websocket"
+	UrlV4 = "ws://gosocketiotest/socket.io/?EIO=4&transport=websocket"
+
+	DefaultPingInterval   = 30 * time.Second
+	DefaultPingTimeout    = 60 * time.Second
+	DefaultReceiveTimeout = 60 * time.Second
+
+	handshakeBodyLimit = 512
+)
+
+var (
+	ErrorNoServer       = errors.New("Server is not attached, see Transport.Attach")
+	ErrorUnknownRequest = errors.New("Request was not made by transport")
+)
+
+/**
+Both ends of connection made by transport
+*/
+type Pair struct {
+	Client *Conn
+	Server *Conn
+}
+
+/**
+Transport connecting clients to the server it serves through memory.
+The same transport is given to gosocketio.NewServer and Dial
+*/
+type Transport struct {
+	PingInterval   time.Duration
+	PingTimeout    time.Duration
+	ReceiveTimeout time.Duration
+
+	//delay of every message of new connections, see Conn.SetLatency
+	Latency time.Duration
+	//headers of handshake requests, like auth ones
+	RequestHeader http.Header
+
+	handler http.Handler
+	pending map[*http.Request]*Conn
+	pairs   []Pair
+	lastIp  int
+	lock    sync.Mutex
+}
+
+/**
+Get transport with default ping params
+*/
+func NewTransport() *Transport {
+	return &Transport{
+		PingInterval:   DefaultPingInterval,
+		PingTimeout:    DefaultPingTimeout,
+		ReceiveTimeout: DefaultReceiveTimeout,
+	}
+}
+
+/**
+Set handler of handshakes, usually the server
+*/
+func (t *Transport) Attach(h http.Handler) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.handler = h
+}
+
+/**
+Get all connections made so far
+*/
+func (t *Transport) Pairs() []Pair {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]Pair(nil), t.pairs...)
+}
+
+/**
+Get the latest connection, zero Pair if there is none
+*/
+func (t *Transport) Last() Pair {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if len(t.pairs) == 0 {
+		return Pair{}
+	}
+	return t.pairs[len(t.pairs)-1]
+}
+
+func (t *Transport) Connect(url string) (transport.Connection, error) {
+	return t.ConnectContext(context.Background(), url)
+}
+
+/**
+Make connection pair and pass handshake request to the handler,
+refused handshake is returned as *transport.HandshakeError
+*/
+func (t *Transport) ConnectContext(ctx context.Context, url string) (transport.Connection, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range t.RequestHeader {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	client, server := newConn(t), newConn(t)
+	client.peer, server.peer = server, client
+
+	t.lock.Lock()
+	handler := t.handler
+	if t.pending == nil {
+		t.pending = make(map[*http.Request]*Conn)
+	}
+	t.pending[req] = server
+	//each connection gets its own address, like real clients
+	t.lastIp++
+	req.RemoteAddr = "127.0.0.1:" + strconv.Itoa(t.lastIp)
+	t.lock.Unlock()
+
+	if handler == nil {
+		t.takePending(req)
+		return nil, ErrorNoServer
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	//handshake was refused before the connection was taken
+	if t.takePending(req) != nil {
+		body, _ := ioutil.ReadAll(io.LimitReader(rec.Body, handshakeBodyLimit))
+		return nil, &transport.HandshakeError{StatusCode: rec.Code, Body: string(body)}
+	}
+
+	t.lock.Lock()
+	t.pairs = append(t.pairs, Pair{Client: client, Server: server})
+	t.lock.Unlock()
+
+	return client, nil
+}
+
+func (t *Transport) takePending(r *http.Request) *Conn {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	conn := t.pending[r]
+	delete(t.pending, r)
+	return conn
+}
+
+/**
+Take server end of connection made by Connect
+*/
+func (t *Transport) HandleConnection(w http.ResponseWriter, r *http.Request) (transport.Connection, error) {
+	conn := t.takePending(r)
+	if conn == nil {
+		http.Error(w, ErrorUnknownRequest.Error(), http.StatusBadRequest)
+		return nil, ErrorUnknownRequest
+	}
+	return conn, nil
+}
+
+/**
+Connections need no additional processing
+*/
+func (t *Transport) Serve(w http.ResponseWriter, r *http.Request) {}
@@ -1,10 +1,11 @@
 package gosocketio
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/graarh/golang-socketio/protocol"
 	"sync"
-	"reflect"
+	"time"
 )
 
 const (
@@ -13,70 +14,332 @@ const (
 	OnError         = "error"
 )
 
+/**
+Handler argument types implementing it are checked after decoding,
+if ValidatePayloads is enabled
+*/
+type Validator interface {
+	Validate() error
+}
+
 /**
 System handler function for internal event processing
 */
 type systemHandler func(c *Channel)
 
+/**
+Catch-all handler, gets every received event with its
+name and arguments as received, nil if there are none
+*/
+type AnyHandler func(c *Channel, event string, args json.RawMessage)
+
 /**
 Contains maps of message processing functions
 */
 type methods struct {
-	messageHandlers     map[string]*caller
+	messageHandlers     map[string][]*caller //in registration order
+	responders          map[string]*caller   //chosen by Subscription.Respond
+	anyHandlers         []AnyHandler
+	rawHandlers         []RawPacketHandler
+	connectMiddlewares  []ConnectMiddleware
+	streamHandlers      map[string]StreamHandler
+	schemas             map[string]SchemaFunc
 	messageHandlersLock sync.RWMutex
 
 	onConnection    systemHandler
 	onDisconnection systemHandler
+
+	//what to do with pong received with no ping sent, see PongPolicy
+	UnexpectedPongPolicy PongPolicy
+	//unexpected pongs tolerated on a channel before PongClose closes it
+	MaxUnexpectedPongs int
+	//called on each unexpected pong, unless policy is PongIgnore
+	OnUnexpectedPong func(c *Channel)
+	//called on each pong answering ping, with its round trip time
+	OnPong func(c *Channel, rtt time.Duration)
+
+	/**
+	Call Validate on decoded handler arguments implementing Validator,
+	on error handler is not called and OnError event is fired instead
+	*/
+	ValidatePayloads bool
+
+	//what to do with channel whose handler panicked, see PanicPolicy
+	HandlerPanicPolicy PanicPolicy
+	//called with panic recovered from event handler, before channel is closed
+	OnPanic func(c *Channel, err *PanicError)
 }
 
 /**
 create messageHandlers map
 */
 func (m *methods) initMethods() {
-	m.messageHandlers = make(map[string]*caller)
+	m.messageHandlers = make(map[string][]*caller)
+	m.responders = make(map[string]*caller)
 }
 
 /**
-Add message processing function, and bind it to given method
+Add message processing function, and bind it to given method.
+Functions added before it stay, all of them are called
 */
 func (m *methods) On(method string, f interface{}) error {
+	_, err := m.Subscribe(method, f)
+	return err
+}
+
+/**
+Add message processing function, which is removed after
+it is called once
+*/
+func (m *methods) Once(method string, f interface{}) error {
 	c, err := newCaller(f)
 	if err != nil {
 		return err
 	}
+	c.Once = true
+
+	m.addCaller(method, c)
+	return nil
+}
 
+/**
+Remove all message processing functions of given method
+*/
+func (m *methods) Off(method string) {
 	m.messageHandlersLock.Lock()
 	defer m.messageHandlersLock.Unlock()
-	m.messageHandlers[method] = c
 
-	return nil
+	delete(m.messageHandlers, method)
+	delete(m.responders, method)
+}
+
+/**
+Remove all message processing functions, catch-all
+and raw packet handlers
+*/
+func (m *methods) OffAll() {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	m.messageHandlers = make(map[string][]*caller)
+	m.responders = make(map[string]*caller)
+	m.anyHandlers = nil
+	m.rawHandlers = nil
+}
+
+/**
+Add catch-all handler, called for every received event before
+its own handler, even if event has none
+*/
+func (m *methods) OnAny(f AnyHandler) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	m.anyHandlers = append(m.anyHandlers, f)
 }
 
 /**
-Find message processing function associated with given method
+Pass received event to catch-all handlers
 */
-func (m *methods) findMethod(method string) (*caller, bool) {
+func (m *methods) callAny(c *Channel, msg *protocol.Message) {
 	m.messageHandlersLock.RLock()
-	defer m.messageHandlersLock.RUnlock()
+	handlers := m.anyHandlers
+	m.messageHandlersLock.RUnlock()
 
-	f, ok := m.messageHandlers[method]
-	return f, ok
+	var args json.RawMessage
+	if msg.Args != "" {
+		args = json.RawMessage(msg.Args)
+	}
+	for _, f := range handlers {
+		f(c, msg.Method, args)
+	}
+}
+
+/**
+Find message processing functions associated with given method,
+in registration order. Once ones are removed by the caller finding them
+*/
+func (m *methods) findMethods(method string) []*caller {
+	m.messageHandlersLock.RLock()
+	list := m.messageHandlers[method]
+	m.messageHandlersLock.RUnlock()
+	if !hasOnce(list) {
+		return list
+	}
+
+	//once handlers are returned only to the one who removed them
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	list = m.messageHandlers[method]
+	kept := make([]*caller, 0, len(list))
+	for _, f := range list {
+		if !f.Once {
+			kept = append(kept, f)
+		} else if m.responders[method] == f {
+			delete(m.responders, method)
+		}
+	}
+	m.setCallers(method, kept)
+	return list
+}
+
+func hasOnce(list []*caller) bool {
+	for _, f := range list {
+		if f.Once {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+Get function, whose result answers ack request: the one chosen
+by Subscription.Respond, or the first one returning a value
+*/
+func (m *methods) responder(method string, list []*caller) *caller {
+	m.messageHandlersLock.RLock()
+	chosen := m.responders[method]
+	m.messageHandlersLock.RUnlock()
+
+	var first *caller
+	for _, f := range list {
+		if f == chosen {
+			return f
+		}
+		if first == nil && f.Out {
+			first = f
+		}
+	}
+	return first
+}
+
+/**
+Call message processing function with arguments of event,
+result is returned if function has one
+*/
+func (m *methods) callHandler(ctx context.Context, c *Channel, f *caller, msg *protocol.Message) (interface{}, bool) {
+	if f.Typed != nil {
+		return f.Typed(ctx, c, m, msg)
+	}
+
+	var data interface{} = &struct{}{}
+	if f.ArgsPresent {
+		//data type should be defined for unmarshall
+		data = f.getArgs()
+		if !m.unmarshalArgs(c, msg, data) {
+			return nil, false
+		}
+	}
+
+	result := f.callFunc(ctx, c, data)
+	if !f.Out {
+		return nil, false
+	}
+	return result[0].Interface(), true
 }
 
 func (m *methods) callLoopEvent(c *Channel, event string) {
+	defer m.recoverHandler(c, event, "")
+
 	if m.onConnection != nil && event == OnConnection {
 		m.onConnection(c)
 	}
-	if m.onDisconnection != nil && event == OnDisconnection {
+
+	for _, f := range m.findMethods(event) {
+		if f.Typed != nil {
+			f.Typed(context.Background(), c, m, &protocol.Message{Method: event})
+			continue
+		}
+		f.callFunc(context.Background(), c, &struct{}{})
+	}
+}
+
+/**
+Call OnDisconnection handlers, the ones taking Disconnection get it
+*/
+func (m *methods) callDisconnection(c *Channel, d Disconnection) {
+	defer m.recoverHandler(c, OnDisconnection, "")
+
+	if m.onDisconnection != nil {
 		m.onDisconnection(c)
 	}
 
-	f, ok := m.findMethod(event)
-	if !ok {
-		return
+	for _, f := range m.findMethods(OnDisconnection) {
+		switch {
+		case f.Typed != nil:
+			args, _ := json.Marshal(&d)
+			f.Typed(context.Background(), c, m, &protocol.Message{Method: OnDisconnection, Args: string(args)})
+		case f.ArgsPresent && disconnectionType.AssignableTo(f.Args):
+			dc := d
+			f.callFunc(context.Background(), c, &dc)
+		default:
+			f.callFunc(context.Background(), c, &struct{}{})
+		}
+	}
+}
+
+/**
+Call OnBackpressureStart or OnBackpressureEnd handlers,
+the ones taking Backpressure get it
+*/
+func (m *methods) callBackpressure(c *Channel, event string, b Backpressure) {
+	defer m.recoverHandler(c, event, "")
+
+	for _, f := range m.findMethods(event) {
+		switch {
+		case f.Typed != nil:
+			args, _ := json.Marshal(&b)
+			f.Typed(context.Background(), c, m, &protocol.Message{Method: event, Args: string(args)})
+		case f.ArgsPresent && backpressureType.AssignableTo(f.Args):
+			bc := b
+			f.callFunc(context.Background(), c, &bc)
+		default:
+			f.callFunc(context.Background(), c, &struct{}{})
+		}
+	}
+}
+
+/**
+Check decoded handler arguments, if validation is enabled and
+arguments implement Validator. On failure OnError event is fired
+*/
+func (m *methods) validArgs(c *Channel, msg *protocol.Message, data interface{}) bool {
+	validator, ok := data.(Validator)
+	if !ok || !m.ValidatePayloads {
+		return true
 	}
 
-	f.callFunc(c, &struct{}{})
+	if err := validator.Validate(); err != nil {
+		m.eventFailed(c, KindHandler, msg, err)
+		return false
+	}
+
+	return true
+}
+
+/**
+Decode json arguments of event into data with codec of channel,
+on failure OnError event is fired
+*/
+func (m *methods) unmarshalArgs(c *Channel, msg *protocol.Message, data interface{}) bool {
+	if err := c.argsCodec().Unmarshal([]byte(msg.Args), data); err != nil {
+		c.log().Warn("wrong event arguments", "sid", c.Id(), "event", msg.Method, "error", err)
+		m.eventFailed(c, KindProtocol, msg, argsError(err))
+		return false
+	}
+	return m.validArgs(c, msg, data)
+}
+
+/**
+Fire OnError event for failed processing of received event,
+failures of OnError handlers are not reported to them again
+*/
+func (m *methods) eventFailed(c *Channel, kind ErrorKind, msg *protocol.Message, err error) {
+	if msg.Method == OnError {
+		return
+	}
+	m.fireError(c, kind, msg.Source, err)
 }
 
 /**
@@ -86,56 +349,63 @@ On ack_req - look for processing function and send ack_resp
 On emit - look for processing function
 */
 func (m *methods) processIncomingMessage(c *Channel, msg *protocol.Message) {
-	switch msg.Type {
-	case protocol.MessageTypeEmit:
-		f, ok := m.findMethod(msg.Method)
-		if !ok {
-			return
-		}
+	m.processMessage(context.Background(), c, msg)
+}
 
-		if !f.ArgsPresent {
-			f.callFunc(c, &struct{}{})
-			return
-		}
+/**
+Same as processIncomingMessage, context handlers get ctx
+*/
+func (m *methods) processMessage(ctx context.Context, c *Channel, msg *protocol.Message) {
+	defer m.recoverHandler(c, msg.Method, msg.Source)
 
-		data := f.getArgs()
-		err := json.Unmarshal([]byte(msg.Args), &data)
-		if err != nil {
-			return
-		}
+	if m.processStream(c, msg) {
+		return
+	}
 
-		f.callFunc(c, data)
+	if msg.Type == protocol.MessageTypeEmit || msg.Type == protocol.MessageTypeAckRequest {
+		var end func()
+		ctx, end = c.startEvent(ctx, msg)
+		defer end()
 
-	case protocol.MessageTypeAckRequest:
-		f, ok := m.findMethod(msg.Method)
-		if !ok || !f.Out {
+		m.callAny(c, msg)
+		if !m.validSchema(c, msg) {
 			return
 		}
+	}
 
-		var result []reflect.Value
-		if f.ArgsPresent {
-			//data type should be defined for unmarshall
-			data := f.getArgs()
-			err := json.Unmarshal([]byte(msg.Args), &data)
-			if err != nil {
-				return
-			}
-
-			result = f.callFunc(c, data)
-		} else {
-			result = f.callFunc(c, &struct{}{})
+	switch msg.Type {
+	case protocol.MessageTypeEmit:
+		for _, f := range m.findMethods(msg.Method) {
+			m.callHandler(ctx, c, f, msg)
 		}
 
+	case protocol.MessageTypeAckRequest:
+		//handled only if some function can answer, all of them are called
+		list := m.findMethods(msg.Method)
+		responder := m.responder(msg.Method, list)
+		if responder == nil {
+			return
+		}
 		ack := &protocol.Message{
 			Type:  protocol.MessageTypeAckResponse,
 			AckId: msg.AckId,
 		}
-		send(ack, c, result[0].Interface())
+		for _, f := range list {
+			result, ok := m.callHandler(ctx, c, f, msg)
+			if f == responder && ok {
+				send(ack, c, result)
+			}
+		}
 
 	case protocol.MessageTypeAckResponse:
 		waiter, err := c.ack.getWaiter(msg.AckId)
-		if err == nil {
-			waiter <- msg.Args
+		if err != nil {
+			return
+		}
+		//repeated response to the same ack is dropped
+		select {
+		case waiter <- ackResult{args: msg.Args}:
+		default:
 		}
 	}
 }
@@ -0,0 +1,75 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"testing"
+	"time"
+)
+
+var errorNegative = errors.New("negative coordinate")
+
+type position struct {
+	X int `json:"x"`
+}
+
+func (m *position) Validate() error {
+	if m.X < 0 {
+		return errorNegative
+	}
+	return nil
+}
+
+func TestValidatePayloads(t *testing.T) {
+	for _, validate := range []bool{true, false} {
+		tr := gosocketiotest.NewTransport()
+		s := NewServer(tr)
+		s.ValidatePayloads = validate
+
+		moves := make(chan int, 2)
+		s.On("move", func(c *Channel, m position) {
+			moves <- m.X
+		})
+		failed := make(chan error, 2)
+		s.On(OnError, func(c *Channel, err error) {
+			failed <- err
+		})
+
+		c, _ := dialTest(t, s, tr, gosocketiotest.Url)
+		c.Emit("move", position{X: -1})
+		c.Emit("move", position{X: 1})
+
+		want := []int{-1, 1}
+		if validate {
+			want = want[1:]
+			select {
+			case err := <-failed:
+				if !errors.Is(err, errorNegative) {
+					t.Fatalf("got %v, want validation error", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("OnError not fired")
+			}
+		}
+		//handlers run concurrently, order is not kept
+		got := map[int]bool{}
+		for range want {
+			select {
+			case x := <-moves:
+				got[x] = true
+			case <-time.After(time.Second):
+				t.Fatalf("validate %v: handler called %d times, want %d", validate, len(got), len(want))
+			}
+		}
+		for _, x := range want {
+			if !got[x] {
+				t.Fatalf("validate %v: handler not called with %d", validate, x)
+			}
+		}
+		select {
+		case x := <-moves:
+			t.Fatalf("validate %v: handler called with invalid %d", validate, x)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
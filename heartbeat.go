@@ -0,0 +1,78 @@
+package gosocketio
+
+import (
+	"time"
+)
+
+const (
+	DefaultAppHeartbeatEvent = "heartbeat"
+)
+
+/**
+Periodically emit heartbeat event to every connected channel, with
+payload returned by payloadFn for that channel (nil payloadFn sends
+no data). It is an application level event, clients handle it with On,
+independent from engine.io ping/pong.
+
+Calling it again replaces previous heartbeat, zero interval disables it
+*/
+func (s *Server) EnableAppHeartbeat(interval time.Duration, payloadFn func(c *Channel) interface{}) {
+	s.heartbeatLock.Lock()
+	defer s.heartbeatLock.Unlock()
+
+	if s.heartbeatStop != nil {
+		close(s.heartbeatStop)
+		s.heartbeatStop = nil
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	s.heartbeatStop = stop
+	go s.appHeartbeat(interval, payloadFn, stop)
+}
+
+/**
+Heartbeat loop, closed channels are not in sids anymore,
+so they stop receiving heartbeats with no extra cleanup
+*/
+func (s *Server) appHeartbeat(interval time.Duration, payloadFn func(c *Channel) interface{},
+	stop chan struct{}) {
+
+	ticker := s.clock().NewTicker(interval)
+	defer ticker.Stop()
+
+	event := s.AppHeartbeatEvent
+	if event == "" {
+		event = DefaultAppHeartbeatEvent
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+		}
+
+		s.sidsLock.RLock()
+		channels := make([]*Channel, 0, len(s.sids))
+		for _, c := range s.sids {
+			channels = append(channels, c)
+		}
+		s.sidsLock.RUnlock()
+
+		for _, c := range channels {
+			if !c.IsAlive() {
+				continue
+			}
+
+			var payload interface{}
+			if payloadFn != nil {
+				payload = payloadFn(c)
+			}
+			c.Emit(event, payload)
+		}
+	}
+}
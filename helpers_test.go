@@ -0,0 +1,47 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"testing"
+	"time"
+)
+
+/**
+Serve s through memory transport and dial it, returns the client
+and its channel on server side. Client is closed by test cleanup
+*/
+func dialTest(t *testing.T, s *Server, tr *gosocketiotest.Transport, url string) (*Client, *Channel) {
+	t.Helper()
+	return dialTestConfig(t, s, tr, url, ClientConfig{})
+}
+
+/**
+Same as dialTest, with client config
+*/
+func dialTestConfig(t *testing.T, s *Server, tr *gosocketiotest.Transport, url string, config ClientConfig) (*Client, *Channel) {
+	t.Helper()
+
+	connected := make(chan *Channel, 1)
+	s.On(OnConnection, func(c *Channel) {
+		select {
+		case connected <- c:
+		default:
+		}
+	})
+	tr.Attach(s)
+
+	c, err := DialConfig(context.Background(), url, tr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+
+	select {
+	case sc := <-connected:
+		return c, sc
+	case <-time.After(time.Second):
+		t.Fatal("server got no connection")
+	}
+	return nil, nil
+}
@@ -0,0 +1,243 @@
+/**
+Messages of cluster adapters in socket.io-redis format, shared by
+redis and nats brokers: broadcasts are msgpack arrays of publishing
+instance, packet and options; server-side events are requests
+*/
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+const (
+	//socket.io packet types, which can be broadcasted
+	PacketEvent       = 2
+	PacketBinaryEvent = 5
+
+	//request type of server-side events, same as socket.io-redis
+	RequestServerSideEmit = 6
+)
+
+/**
+Local adapter handling server-side events, gosocketio in-memory one does
+*/
+type ServerSideReceiver interface {
+	ReceiveServerSide(method string, args interface{})
+}
+
+/**
+Broadcast of other instance
+*/
+type Broadcast struct {
+	Uid       string
+	Namespace string
+	Method    string
+	Args      interface{}
+	Opts      *gosocketio.BroadcastOptions
+}
+
+/**
+Server-side event of other instance
+*/
+type Request struct {
+	Uid       string
+	Namespace string //empty if request has none
+	Method    string
+	Args      interface{}
+}
+
+/**
+Id of publishing instance, its own messages are skipped
+*/
+func NewUid() string {
+	id := make([]byte, 6)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+/**
+Encode broadcast in socket.io-redis format
+*/
+func EncodeBroadcast(uid, namespace string, opts *gosocketio.BroadcastOptions,
+	method string, args interface{}) ([]byte, error) {
+
+	packetType := PacketEvent
+	if containsBinary(args) {
+		packetType = PacketBinaryEvent
+	}
+
+	return protocol.MarshalMsgpack([]interface{}{
+		uid,
+		map[string]interface{}{
+			"type": packetType,
+			"data": []interface{}{method, args},
+			"nsp":  namespace,
+		},
+		map[string]interface{}{
+			"rooms":  stringsToValues(opts.Rooms),
+			"except": stringsToValues(opts.Except),
+			"flags":  map[string]interface{}{"volatile": opts.Volatile},
+		},
+	})
+}
+
+/**
+Decode broadcast, ok is false for malformed messages
+and packets other than events
+*/
+func DecodeBroadcast(payload []byte) (b *Broadcast, ok bool) {
+	value, err := protocol.UnmarshalMsgpack(payload)
+	if err != nil {
+		return nil, false
+	}
+
+	msg, ok := value.([]interface{})
+	if !ok || len(msg) < 2 {
+		return nil, false
+	}
+	uid, _ := msg[0].(string)
+
+	packet, _ := msg[1].(map[string]interface{})
+	packetType, _ := toInt(packet["type"])
+	data, _ := packet["data"].([]interface{})
+	if packetType != PacketEvent && packetType != PacketBinaryEvent || len(data) == 0 {
+		return nil, false
+	}
+	method, ok := data[0].(string)
+	if !ok {
+		return nil, false
+	}
+	namespace, _ := packet["nsp"].(string)
+
+	opts := &gosocketio.BroadcastOptions{}
+	if len(msg) > 2 {
+		if o, ok := msg[2].(map[string]interface{}); ok {
+			opts.Rooms = valuesToStrings(o["rooms"])
+			opts.Except = valuesToStrings(o["except"])
+			if flags, ok := o["flags"].(map[string]interface{}); ok {
+				opts.Volatile, _ = flags["volatile"].(bool)
+			}
+		}
+	}
+
+	return &Broadcast{
+		Uid:       uid,
+		Namespace: namespace,
+		Method:    method,
+		Args:      eventArgs(data),
+		Opts:      opts,
+	}, true
+}
+
+/**
+Get request of server-side event, to be encoded with json or msgpack.
+Namespace is left out if empty
+*/
+func ServerSideRequest(uid, namespace, method string, args interface{}) map[string]interface{} {
+	req := map[string]interface{}{
+		"uid":  uid,
+		"type": RequestServerSideEmit,
+		"data": []interface{}{method, args},
+	}
+	if namespace != "" {
+		req["nsp"] = namespace
+	}
+	return req
+}
+
+/**
+Decode request decoded from json or msgpack, ok is false for
+malformed requests and ones other than server-side events
+*/
+func DecodeRequest(value interface{}) (r *Request, ok bool) {
+	req, _ := value.(map[string]interface{})
+	uid, _ := req["uid"].(string)
+	reqType, _ := toInt(req["type"])
+	data, _ := req["data"].([]interface{})
+	if reqType != RequestServerSideEmit || len(data) == 0 {
+		return nil, false
+	}
+	method, ok := data[0].(string)
+	if !ok {
+		return nil, false
+	}
+	namespace, _ := req["nsp"].(string)
+
+	return &Request{
+		Uid:       uid,
+		Namespace: namespace,
+		Method:    method,
+		Args:      eventArgs(data),
+	}, true
+}
+
+/**
+Get number decoded by msgpack or json
+*/
+func toInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case float64:
+		return int64(v), v == float64(int64(v))
+	}
+	return 0, false
+}
+
+/**
+Arguments of event data after its name, single one is passed as is
+*/
+func eventArgs(data []interface{}) interface{} {
+	switch len(data) {
+	case 1:
+		return nil
+	case 2:
+		return data[1]
+	default:
+		return data[1:]
+	}
+}
+
+func containsBinary(value interface{}) bool {
+	switch v := value.(type) {
+	case []byte:
+		return true
+	case []interface{}:
+		for _, item := range v {
+			if containsBinary(item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if containsBinary(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stringsToValues(list []string) []interface{} {
+	result := make([]interface{}, len(list))
+	for i, s := range list {
+		result[i] = s
+	}
+	return result
+}
+
+func valuesToStrings(value interface{}) []string {
+	list, _ := value.([]interface{})
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package envelope
+
+import (
+	"encoding/json"
+	"github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/protocol"
+	"reflect"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	opts := &gosocketio.BroadcastOptions{Rooms: []string{"a", "b"}, Except: []string{"sid"}, Volatile: true}
+	tests := []struct {
+		name string
+		args interface{}
+		want interface{}
+		typ  int64
+	}{
+		{"no args", nil, nil, PacketEvent},
+		{"single arg", "hello", "hello", PacketEvent},
+		{"binary", map[string]interface{}{"file": []byte{1, 2}}, map[string]interface{}{"file": []byte{1, 2}}, PacketBinaryEvent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload, err := EncodeBroadcast("uid", "/chat", opts, "message", test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, _ := protocol.UnmarshalMsgpack(payload)
+			if typ := value.([]interface{})[1].(map[string]interface{})["type"]; typ != test.typ {
+				t.Fatalf("packet type %v, want %d", typ, test.typ)
+			}
+
+			b, ok := DecodeBroadcast(payload)
+			if !ok {
+				t.Fatal("not decoded")
+			}
+			want := &Broadcast{Uid: "uid", Namespace: "/chat", Method: "message", Args: test.want, Opts: opts}
+			if !reflect.DeepEqual(b, want) {
+				t.Fatalf("got %+v, want %+v", b, want)
+			}
+		})
+	}
+}
+
+func TestDecodeBroadcastSkipped(t *testing.T) {
+	ack, _ := protocol.MarshalMsgpack([]interface{}{"uid", map[string]interface{}{"type": 3, "data": []interface{}{"x"}}})
+	noMethod, _ := protocol.MarshalMsgpack([]interface{}{"uid", map[string]interface{}{"type": 2, "data": []interface{}{1}}})
+	short, _ := protocol.MarshalMsgpack([]interface{}{"uid"})
+	for name, payload := range map[string][]byte{
+		"not msgpack":   {0xc1},
+		"not event":     ack,
+		"no method":     noMethod,
+		"no packet":     short,
+		"empty payload": nil,
+	} {
+		if b, ok := DecodeBroadcast(payload); ok {
+			t.Errorf("%s: decoded %+v", name, b)
+		}
+	}
+}
+
+func TestRequest(t *testing.T) {
+	//json decodes numbers as float64, msgpack as int64
+	encoded, _ := json.Marshal(ServerSideRequest("uid", "", "ping", []interface{}{1.0, "a"}))
+	var fromJSON interface{}
+	json.Unmarshal(encoded, &fromJSON)
+	encoded, _ = protocol.MarshalMsgpack(ServerSideRequest("uid", "/chat", "ping", nil))
+	fromMsgpack, _ := protocol.UnmarshalMsgpack(encoded)
+
+	r, ok := DecodeRequest(fromJSON)
+	if !ok || !reflect.DeepEqual(r, &Request{Uid: "uid", Method: "ping", Args: []interface{}{1.0, "a"}}) {
+		t.Fatalf("json request %+v", r)
+	}
+	r, ok = DecodeRequest(fromMsgpack)
+	if !ok || !reflect.DeepEqual(r, &Request{Uid: "uid", Namespace: "/chat", Method: "ping"}) {
+		t.Fatalf("msgpack request %+v", r)
+	}
+	if r, ok := DecodeRequest(map[string]interface{}{"uid": "uid", "type": 7.0, "data": []interface{}{"x"}}); ok {
+		t.Fatalf("other request decoded %+v", r)
+	}
+}
@@ -0,0 +1,445 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrorWrongSchema = errors.New("Wrong json schema")
+)
+
+/**
+Value does not match json schema, Path is json pointer
+to the wrong part of it, empty for the whole value
+*/
+type SchemaError struct {
+	Path    string
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+/**
+Compiled json schema, only validation keywords are supported:
+type, enum, const, properties, required, additionalProperties,
+items, minItems, maxItems, minimum, maximum, exclusiveMinimum,
+exclusiveMaximum, minLength, maxLength, pattern, allOf, anyOf,
+oneOf and not. Other keywords, $ref too, are ignored
+*/
+type JsonSchema struct {
+	always *bool //boolean schema, other keywords are not set
+
+	types    []string
+	enum     []interface{}
+	constant interface{}
+	hasConst bool
+
+	properties           map[string]*JsonSchema
+	required             []string
+	additionalProperties *JsonSchema
+
+	items    *JsonSchema
+	minItems *int
+	maxItems *int
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	allOf []*JsonSchema
+	anyOf []*JsonSchema
+	oneOf []*JsonSchema
+	not   *JsonSchema
+}
+
+/**
+Schema document as it is written, keywords taking
+schemas or several forms are decoded later
+*/
+type jsonSchemaDoc struct {
+	Type  json.RawMessage `json:"type"`
+	Enum  []interface{}   `json:"enum"`
+	Const json.RawMessage `json:"const"`
+
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+
+	Items    json.RawMessage `json:"items"`
+	MinItems *int            `json:"minItems"`
+	MaxItems *int            `json:"maxItems"`
+
+	Minimum          *float64 `json:"minimum"`
+	Maximum          *float64 `json:"maximum"`
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum"`
+
+	MinLength *int    `json:"minLength"`
+	MaxLength *int    `json:"maxLength"`
+	Pattern   *string `json:"pattern"`
+
+	AllOf []json.RawMessage `json:"allOf"`
+	AnyOf []json.RawMessage `json:"anyOf"`
+	OneOf []json.RawMessage `json:"oneOf"`
+	Not   json.RawMessage   `json:"not"`
+}
+
+/**
+Parse json schema document, errors of wrong keywords
+match ErrorWrongSchema with errors.Is
+*/
+func CompileJsonSchema(doc []byte) (*JsonSchema, error) {
+	schema, err := compileSchema(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrorWrongSchema, err)
+	}
+	return schema, nil
+}
+
+func compileSchema(doc []byte) (*JsonSchema, error) {
+	var always bool
+	if json.Unmarshal(doc, &always) == nil {
+		return &JsonSchema{always: &always}, nil
+	}
+
+	var d jsonSchemaDoc
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+
+	s := &JsonSchema{
+		enum:             d.Enum,
+		required:         d.Required,
+		minItems:         d.MinItems,
+		maxItems:         d.MaxItems,
+		minimum:          d.Minimum,
+		maximum:          d.Maximum,
+		exclusiveMinimum: d.ExclusiveMinimum,
+		exclusiveMaximum: d.ExclusiveMaximum,
+		minLength:        d.MinLength,
+		maxLength:        d.MaxLength,
+	}
+
+	var err error
+	if s.types, err = schemaTypes(d.Type); err != nil {
+		return nil, err
+	}
+	if len(d.Const) > 0 {
+		s.hasConst = true
+		if err := json.Unmarshal(d.Const, &s.constant); err != nil {
+			return nil, err
+		}
+	}
+	if d.Pattern != nil {
+		if s.pattern, err = regexp.Compile(*d.Pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(d.Properties) > 0 {
+		s.properties = make(map[string]*JsonSchema, len(d.Properties))
+		for name, doc := range d.Properties {
+			if s.properties[name], err = compileSchema(doc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.additionalProperties, err = optionalSchema(d.AdditionalProperties); err != nil {
+		return nil, err
+	}
+	if s.items, err = optionalSchema(d.Items); err != nil {
+		return nil, err
+	}
+	if s.not, err = optionalSchema(d.Not); err != nil {
+		return nil, err
+	}
+	if s.allOf, err = schemaList(d.AllOf); err != nil {
+		return nil, err
+	}
+	if s.anyOf, err = schemaList(d.AnyOf); err != nil {
+		return nil, err
+	}
+	if s.oneOf, err = schemaList(d.OneOf); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+/**
+Type keyword is a name or list of names
+*/
+func schemaTypes(doc json.RawMessage) ([]string, error) {
+	if len(doc) == 0 {
+		return nil, nil
+	}
+
+	var name string
+	if json.Unmarshal(doc, &name) == nil {
+		return []string{name}, nil
+	}
+	var names []string
+	if err := json.Unmarshal(doc, &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func optionalSchema(doc json.RawMessage) (*JsonSchema, error) {
+	if len(doc) == 0 {
+		return nil, nil
+	}
+	return compileSchema(doc)
+}
+
+func schemaList(docs []json.RawMessage) ([]*JsonSchema, error) {
+	var result []*JsonSchema
+	for _, doc := range docs {
+		s, err := compileSchema(doc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+/**
+Check value decoded from json, numbers may be float64 or json.Number.
+Returns *SchemaError of the first mismatch
+*/
+func (s *JsonSchema) Validate(value interface{}) error {
+	return s.validate("", normalizeJson(value))
+}
+
+func (s *JsonSchema) validate(path string, value interface{}) error {
+	if s.always != nil {
+		if !*s.always {
+			return &SchemaError{path, "no value allowed"}
+		}
+		return nil
+	}
+
+	if len(s.types) > 0 && !matchesType(s.types, value) {
+		return &SchemaError{path, "expected " + strings.Join(s.types, " or ") + ", got " + jsonType(value)}
+	}
+	if s.enum != nil && !containsJson(s.enum, value) {
+		return &SchemaError{path, "value is not one of enum"}
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constant, value) {
+		return &SchemaError{path, "value is not const"}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if err := s.validateObject(path, v); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := s.validateArray(path, v); err != nil {
+			return err
+		}
+	case float64:
+		if err := s.validateNumber(path, v); err != nil {
+			return err
+		}
+	case string:
+		if err := s.validateString(path, v); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.validate(path, value); err != nil {
+			return err
+		}
+	}
+	if len(s.anyOf) > 0 && countMatches(s.anyOf, path, value) == 0 {
+		return &SchemaError{path, "value matches none of anyOf"}
+	}
+	if len(s.oneOf) > 0 && countMatches(s.oneOf, path, value) != 1 {
+		return &SchemaError{path, "value must match exactly one of oneOf"}
+	}
+	if s.not != nil && s.not.validate(path, value) == nil {
+		return &SchemaError{path, "value matches not"}
+	}
+	return nil
+}
+
+func (s *JsonSchema) validateObject(path string, object map[string]interface{}) error {
+	for _, name := range s.required {
+		if _, ok := object[name]; !ok {
+			return &SchemaError{path, "missing required property " + strconv.Quote(name)}
+		}
+	}
+
+	//sorted, so the same value always gives the same error
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sub, ok := s.properties[name]
+		if !ok {
+			sub = s.additionalProperties
+		}
+		if sub == nil {
+			continue
+		}
+		if err := sub.validate(path+"/"+escapePointer(name), object[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *JsonSchema) validateArray(path string, array []interface{}) error {
+	if s.minItems != nil && len(array) < *s.minItems {
+		return &SchemaError{path, fmt.Sprintf("expected at least %d items", *s.minItems)}
+	}
+	if s.maxItems != nil && len(array) > *s.maxItems {
+		return &SchemaError{path, fmt.Sprintf("expected at most %d items", *s.maxItems)}
+	}
+	if s.items == nil {
+		return nil
+	}
+	for i, item := range array {
+		if err := s.items.validate(path+"/"+strconv.Itoa(i), item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *JsonSchema) validateNumber(path string, number float64) error {
+	switch {
+	case s.minimum != nil && number < *s.minimum:
+		return &SchemaError{path, fmt.Sprintf("expected at least %v", *s.minimum)}
+	case s.maximum != nil && number > *s.maximum:
+		return &SchemaError{path, fmt.Sprintf("expected at most %v", *s.maximum)}
+	case s.exclusiveMinimum != nil && number <= *s.exclusiveMinimum:
+		return &SchemaError{path, fmt.Sprintf("expected more than %v", *s.exclusiveMinimum)}
+	case s.exclusiveMaximum != nil && number >= *s.exclusiveMaximum:
+		return &SchemaError{path, fmt.Sprintf("expected less than %v", *s.exclusiveMaximum)}
+	}
+	return nil
+}
+
+func (s *JsonSchema) validateString(path string, str string) error {
+	length := utf8.RuneCountInString(str)
+	switch {
+	case s.minLength != nil && length < *s.minLength:
+		return &SchemaError{path, fmt.Sprintf("expected at least %d characters", *s.minLength)}
+	case s.maxLength != nil && length > *s.maxLength:
+		return &SchemaError{path, fmt.Sprintf("expected at most %d characters", *s.maxLength)}
+	case s.pattern != nil && !s.pattern.MatchString(str):
+		return &SchemaError{path, "value does not match pattern " + s.pattern.String()}
+	}
+	return nil
+}
+
+func countMatches(schemas []*JsonSchema, path string, value interface{}) int {
+	count := 0
+	for _, sub := range schemas {
+		if sub.validate(path, value) == nil {
+			count++
+		}
+	}
+	return count
+}
+
+/**
+Json type name of decoded value
+*/
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func matchesType(types []string, value interface{}) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if number, ok := value.(float64); ok && t == "integer" && number == math.Trunc(number) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsJson(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+Convert json.Number to float64, so values decoded
+with UseNumber compare like encoding/json ones
+*/
+func normalizeJson(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		number, _ := v.Float64()
+		return number
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i := range v {
+			result[i] = normalizeJson(v[i])
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key := range v {
+			result[key] = normalizeJson(v[key])
+		}
+		return result
+	}
+	return value
+}
+
+/**
+Escape property name for json pointer
+*/
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
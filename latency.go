@@ -0,0 +1,85 @@
+package gosocketio
+
+import (
+	"time"
+)
+
+const (
+	//weight of new sample in Latency.Average, same as of tcp srtt
+	latencyWeight = 0.125
+	//round trip time adaptive ping uses MinPingInterval from
+	adaptivePingSlowRtt = time.Second
+)
+
+/**
+Round trip times of pings of the connection. They are measured by the
+side sending pings: server of EIO=4 connection and client of EIO=3 one,
+the other side has no samples
+*/
+type Latency struct {
+	//round trip time of the last answered ping
+	Last time.Duration
+	//exponentially weighted moving average of round trip times
+	Average time.Duration
+	//pongs measured, Last and Average are 0 if there are none
+	Samples int
+}
+
+/**
+Get round trip times of the connection, namespace sockets share them
+*/
+func (c *Channel) Latency() Latency {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	return c.latency
+}
+
+/**
+Account round trip time of answered ping, aliveLock should be held
+*/
+func (c *Channel) addLatency(rtt time.Duration) {
+	l := &c.latency
+	l.Last = rtt
+	if l.Samples == 0 {
+		l.Average = rtt
+	} else {
+		l.Average += time.Duration(latencyWeight * float64(rtt-l.Average))
+	}
+	l.Samples++
+}
+
+/**
+Call OnPong with round trip time of answered ping
+*/
+func (m *methods) pong(c *Channel, rtt time.Duration) {
+	if m.OnPong != nil {
+		m.OnPong(c, rtt)
+	}
+}
+
+/**
+Get adaptive ping interval of connection with given latency, max is
+the advertised one. Worse of last and average round trip time is taken,
+so a sudden slow pong counts at once: 0 gives max interval,
+adaptivePingSlowRtt and more give MinPingInterval, ones between scale
+linearly. Connection without pongs yet is pinged at max interval
+*/
+func (o *ServerOptions) adaptivePingInterval(max time.Duration, l Latency) time.Duration {
+	min := o.MinPingInterval
+	if min <= 0 || min > max {
+		min = max
+	}
+	if l.Samples == 0 {
+		return max
+	}
+
+	rtt := l.Average
+	if l.Last > rtt {
+		rtt = l.Last
+	}
+	if rtt >= adaptivePingSlowRtt {
+		return min
+	}
+	return max - time.Duration(float64(max-min)*float64(rtt)/float64(adaptivePingSlowRtt))
+}
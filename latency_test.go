@@ -0,0 +1,113 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"github.com/graarh/golang-socketio/protocol"
+	"testing"
+	"time"
+)
+
+func TestAdaptivePingInterval(t *testing.T) {
+	o := ServerOptions{AdaptivePing: true, MinPingInterval: 5 * time.Second}
+	max := 25 * time.Second
+
+	tests := []struct {
+		name    string
+		latency Latency
+		want    time.Duration
+	}{
+		{"no pongs", Latency{}, max},
+		{"instant", Latency{Samples: 3}, max},
+		{"half of slow", Latency{Last: 500 * time.Millisecond, Average: 500 * time.Millisecond, Samples: 3}, 15 * time.Second},
+		{"slow last", Latency{Last: 2 * time.Second, Average: 100 * time.Millisecond, Samples: 3}, 5 * time.Second},
+		{"slow average", Latency{Last: 0, Average: time.Second, Samples: 3}, 5 * time.Second},
+	}
+	for _, test := range tests {
+		if got := o.adaptivePingInterval(max, test.latency); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	o.MinPingInterval = time.Minute
+	if got := o.adaptivePingInterval(max, Latency{Last: time.Second, Samples: 1}); got != max {
+		t.Errorf("min over max: got %v, want %v", got, max)
+	}
+}
+
+/**
+Count pings written to connection
+*/
+func pings(conn *gosocketiotest.Conn) int {
+	count := 0
+	for _, packet := range conn.Written() {
+		if packet == protocol.PingMessage {
+			count++
+		}
+	}
+	return count
+}
+
+/**
+Wait until n pings are written to connection
+*/
+func waitPings(t *testing.T, conn *gosocketiotest.Conn, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for pings(conn) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d pings are not written", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdaptivePing(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	mc := gosocketiotest.NewManualClock(time.Now())
+	s.Clock = mc
+	s.ProtocolVersions = []int{ProtocolVersion3, ProtocolVersion4}
+	s.Options.AdaptivePing = true
+	s.Options.MinPingInterval = 5 * time.Second
+	s.Options.MaxPingInterval = 40 * time.Second
+
+	c, sc := dialTest(t, s, tr, gosocketiotest.UrlV4)
+	if c.header.PingInterval != 40000 {
+		t.Fatalf("advertised ping interval %dms, want max one", c.header.PingInterval)
+	}
+	server := tr.Last().Server
+	//pongs arrive after manual clock is moved
+	tr.Last().Client.SetLatency(200 * time.Millisecond)
+
+	if !mc.WaitWaiters(1, time.Second) {
+		t.Fatal("pinger does not wait")
+	}
+	mc.Advance(40 * time.Second)
+	waitPings(t, server, 1)
+	if !mc.WaitWaiters(1, time.Second) {
+		t.Fatal("pinger does not wait for pong")
+	}
+	mc.Advance(2 * time.Second)
+	deadline := time.Now().Add(time.Second)
+	for sc.Latency().Samples == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if l := sc.Latency(); l.Last != 2*time.Second {
+		t.Fatalf("latency %+v, want 2s", l)
+	}
+
+	//second ping was scheduled before slow pong
+	mc.Advance(38 * time.Second)
+	waitPings(t, server, 2)
+	if !mc.WaitWaiters(1, time.Second) {
+		t.Fatal("pinger does not wait")
+	}
+
+	mc.Advance(5*time.Second - time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if n := pings(server); n != 2 {
+		t.Fatalf("%d pings before min interval", n)
+	}
+	mc.Advance(time.Millisecond)
+	waitPings(t, server, 3)
+}
@@ -0,0 +1,83 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"go.uber.org/goleak"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDialFailuresLeakNothing(t *testing.T) {
+	v3Open := `0{"sid":"x","upgrades":[],"pingInterval":25000,"pingTimeout":20000}`
+	v4Open := `0{"sid":"x","upgrades":[],"pingInterval":25000,"pingTimeout":20000,"maxPayload":1000000}`
+
+	tests := []struct {
+		name   string
+		server func(tr *gosocketiotest.Transport)
+		config ClientConfig
+	}{
+		{"no server", func(tr *gosocketiotest.Transport) {}, ClientConfig{}},
+		{"handshake refused", func(tr *gosocketiotest.Transport) {
+			tr.Attach(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+			}))
+		}, ClientConfig{}},
+		{"not open frame", func(tr *gosocketiotest.Transport) {
+			rawServer(tr, "<html>502 Bad Gateway</html>")
+		}, ClientConfig{}},
+		{"closed after open", func(tr *gosocketiotest.Transport) {
+			tr.Attach(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := tr.HandleConnection(w, r)
+				if err == nil {
+					conn.WriteMessage(v3Open)
+					conn.Close()
+				}
+			}))
+		}, ClientConfig{Namespace: "/chat"}},
+		{"protocol version", func(tr *gosocketiotest.Transport) {
+			rawServer(tr, v4Open)
+		}, ClientConfig{}},
+		{"namespace refused", func(tr *gosocketiotest.Transport) {
+			rawServer(tr, v3Open, `44/chat,"Invalid namespace"`)
+		}, ClientConfig{Namespace: "/chat"}},
+		{"no answer", func(tr *gosocketiotest.Transport) {
+			rawServer(tr)
+		}, ClientConfig{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+			tr := gosocketiotest.NewTransport()
+			test.server(tr)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			c, err := DialConfig(ctx, gosocketiotest.Url, tr, test.config)
+			if err == nil {
+				c.Close()
+				t.Fatal("dial succeeded")
+			}
+		})
+	}
+}
+
+func TestClosedClientLeaksNothing(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	tr.Attach(s)
+
+	c, err := Dial(gosocketiotest.Url, tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	//server side of connection goes away too
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,53 @@
+package gosocketio
+
+import (
+	"net"
+	"net/http"
+	"os"
+)
+
+/**
+Serve http with given server on listener and mark server as ready,
+blocks like http.Server.Serve. Listener can be any, like unix socket
+or one of systemd. If srv has no handler, server is mounted to its path.
+Timeouts and shutdown of srv are up to caller
+*/
+func (s *Server) ServeWith(srv *http.Server, l net.Listener) error {
+	if srv.Handler == nil {
+		serveMux := http.NewServeMux()
+		s.Mount(serveMux)
+		srv.Handler = serveMux
+	}
+
+	//listener is bound already, connections are queued from now on
+	s.readyOnce.Do(func() { close(s.ready) })
+
+	return srv.Serve(l)
+}
+
+/**
+Listen on unix socket at path and serve http there, like ServeAndReady.
+Socket left by previous process is removed, other files are not.
+For sidecar deployments behind local reverse proxy
+*/
+func (s *Server) ServeUnix(path string, h http.Handler) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	return s.ServeAndReady(l, h)
+}
+
+/**
+Check if request came over unix socket
+*/
+func isUnixRequest(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
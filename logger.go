@@ -0,0 +1,95 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/transport"
+	"net"
+	"sync/atomic"
+)
+
+/**
+Structured logger, keyvals are alternating keys and values,
+like "sid", c.Id(). Adapters for slog, zap, logrus and others
+are a few lines each
+*/
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+/**
+Logger discarding everything, used when none is set
+*/
+type NopLogger struct{}
+
+func (NopLogger) Debug(msg string, keyvals ...interface{}) {}
+func (NopLogger) Info(msg string, keyvals ...interface{})  {}
+func (NopLogger) Warn(msg string, keyvals ...interface{})  {}
+func (NopLogger) Error(msg string, keyvals ...interface{}) {}
+
+/**
+Logger stored in atomic.Value, which needs the same concrete type
+*/
+type loggerHolder struct {
+	Logger
+}
+
+func loadLogger(v *atomic.Value) Logger {
+	if h, ok := v.Load().(loggerHolder); ok && h.Logger != nil {
+		return h.Logger
+	}
+	return NopLogger{}
+}
+
+/**
+Set logger of server and all its channels, nil disables logging
+*/
+func (s *Server) SetLogger(l Logger) {
+	s.logger.Store(loggerHolder{l})
+}
+
+/**
+Set logger of client connection, nil disables logging.
+Use ClientConfig.Logger to log handshake too
+*/
+func (c *Client) SetLogger(l Logger) {
+	c.logger.Store(loggerHolder{l})
+}
+
+/**
+Get logger of channel server, or of client connection
+*/
+func (c *Channel) log() Logger {
+	if c.server != nil {
+		return loadLogger(&c.server.logger)
+	}
+	return loadLogger(&c.logger)
+}
+
+/**
+Check if connection was closed because nothing was received in time
+*/
+func isTimeout(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, transport.ErrorReceiveTimeout) || errors.Is(err, ErrorPingTimeout)
+}
+
+/**
+Log closed connection with matching level
+*/
+func (c *Channel) logClose(reason string, err error) {
+	switch {
+	case isTimeout(err):
+		c.log().Warn("ping timeout", "sid", c.Id(), "error", err)
+	case reason == DisconnectProtocolError || reason == DisconnectOverflood ||
+		reason == DisconnectBufferBudget || reason == DisconnectWriteError:
+		c.log().Warn("connection closed", "sid", c.Id(), "reason", reason, "error", err)
+	default:
+		c.log().Info("connection closed", "sid", c.Id(), "reason", reason, "error", err)
+	}
+}
@@ -1,21 +1,41 @@
 package gosocketio
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/graarh/golang-socketio/protocol"
 	"github.com/graarh/golang-socketio/transport"
 	"net/http"
+	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const (
-	queueBufferSize = 500
+var (
+	ErrorWrongHeader    = errors.New("Wrong header")
+	ErrorPeerDisconnect = errors.New("Peer disconnected")
+	ErrorUnexpectedPong = errors.New("Unexpected pong")
+	ErrorPingTimeout    = errors.New("Ping timeout")
 )
 
-var (
-	ErrorWrongHeader = errors.New("Wrong header")
+/**
+What to do with pong that does not answer ping sent by this side.
+Note that server sends pings only with EIO=4, so with EIO=3 clients
+every pong server receives is unexpected
+*/
+type PongPolicy int
+
+const (
+	//silently ignore, as before
+	PongIgnore PongPolicy = iota
+	//call OnUnexpectedPong and count in server stats
+	PongLog
+	//same as PongLog, and close channel when more than
+	//MaxUnexpectedPongs unexpected pongs received
+	PongClose
 )
 
 /**
@@ -26,6 +46,85 @@ type Header struct {
 	Upgrades     []string `json:"upgrades"`
 	PingInterval int      `json:"pingInterval"`
 	PingTimeout  int      `json:"pingTimeout"`
+	MaxPayload   int      `json:"maxPayload,omitempty"`
+}
+
+/**
+engine.io connection state: transport, queues and loops.
+Shared by the channel and its namespace sockets
+*/
+type link struct {
+	conn transport.Connection
+
+	out       []outPacket   //outgoing queue, guarded by aliveLock
+	outSignal chan struct{} //wakes outLoop up
+	batch     []string      //reused by outLoop
+	outBytes  int
+	queue     QueueConfig
+	trace     TraceConfig
+	parser    protocol.Parser //nil is json parser
+	codec     Codec           //nil is JsonCodec
+	clk       Clock           //nil is real time
+	logger    atomic.Value    //of client connection
+	header    Header
+
+	version   int
+	connected bool //EIO=4 connect packet received
+
+	alive       bool
+	outClosed   bool
+	closeErr    error
+	closePacket bool   //send engine.io close before closing connection
+	closeReason string //used instead of reason of closeErr, like on shutdown
+	aliveLock   sync.Mutex
+
+	lastRead  time.Time
+	lastWrite time.Time
+	lastPing  time.Time
+	pongDue   time.Time //zero if no ping waits for pong
+	latency   Latency   //round trip times of pings
+	loops     map[string]uint64
+
+	enqueuedCount uint64
+	writtenCount  uint64
+	writeSignal   chan struct{}
+
+	pingsSent        int
+	unexpectedPongs  int
+	overflowNotified bool
+	flood            int32       //overflood state, see setOverflooded
+	backpressure     bool        //OnBackpressureStart is fired, guarded by backpressureLock
+	backpressureLock sync.Mutex
+	limiter          rateLimiter //of incoming messages, used by inLoop
+	maxMessageSize   int64       //of incoming message with attachments, 0 is no limit
+
+	//of acks of client side channel, server ones use options
+	defaultAckTimeout time.Duration
+	//auth object sent by client with connect packets, see ClientConfig.Auth
+	connectAuth interface{}
+	//sizes of streams of all sockets of connection
+	streamConfig StreamConfig
+	//splitting of binary emits of all sockets of connection
+	chunkConfig ChunkConfig
+	chunkId     int64 //of last chunked packet, atomic
+
+	dispatchConfig DispatchConfig
+	ordered        chan func()   //of DispatchOrdered mode, created by inLoop
+	pool           chan struct{} //of DispatchPool mode, shared by server connections
+
+	handlers sync.WaitGroup
+	outDone  chan struct{}
+	done     chan struct{}
+
+	//sockets of other namespaces by name, server side
+	sockets map[string]*Channel
+	//client side ones, see Client.Of
+	clientSockets map[string]*Client
+
+	ip            string
+	unixPeer      bool //connected over unix socket, peer is local proxy
+	requestHeader http.Header
+	query         url.Values
 }
 
 /**
@@ -38,38 +137,75 @@ Close message means channel is closed
 ping is automatic
 */
 type Channel struct {
-	conn transport.Connection
+	*link
 
-	out    chan string
-	header Header
+	namespace     string        //empty for default one
+	nsp           *Namespace    //of server side socket, nil for default namespace
+	disconnected  bool          //namespace socket left, connection may stay
+	disconnection Disconnection //why channel was closed, guarded by aliveLock
+	clientSocket  *Client       //set on client namespace socket, see Client.Of
 
-	alive     bool
-	aliveLock sync.Mutex
+	ack     ackProcessor
+	streams streamSet
 
-	ack ackProcessor
+	seq     uint64
+	seqLock sync.Mutex
 
-	server        *Server
-	ip            string
-	requestHeader http.Header
+	session  sync.Map        //values stored with Set
+	recovery *recovery       //nil if connection state recovery is off
+	auth     json.RawMessage //of connect packet, server side
+
+	server *Server
 }
 
 /**
 create channel, map, and set active
 */
-func (c *Channel) initChannel() {
-	//TODO: queueBufferSize from constant to server or client variable
-	c.out = make(chan string, queueBufferSize)
-	c.ack.resultWaiters = make(map[int](chan string))
+func (c *Channel) initChannel(queue QueueConfig) {
+	c.link = &link{}
+	c.queue = queue
+	c.out = make([]outPacket, 0, c.queue.size())
+	c.outSignal = make(chan struct{}, 1)
+	c.outDone = make(chan struct{})
+	c.done = make(chan struct{})
 	c.alive = true
+	c.version = ProtocolVersion3
 }
 
 /**
-Get id of current socket connection
+Get id of current socket connection, namespace sockets
+have namespace prepended to it, like "/admin#sid"
 */
 func (c *Channel) Id() string {
+	if id := c.recoveredId(); id != "" {
+		return id
+	}
+	if c.namespace != "" && c.nsp != nil {
+		return c.namespace + "#" + c.header.Sid
+	}
 	return c.header.Sid
 }
 
+/**
+Get namespace of the channel, "/" for default one
+*/
+func (c *Channel) Namespace() string {
+	if c.namespace == "" {
+		return protocol.DefaultNamespace
+	}
+	return c.namespace
+}
+
+/**
+Get copy of engine.io header negotiated on connect:
+sid, upgrades offered by server and ping timings
+*/
+func (c *Channel) HandshakeHeader() Header {
+	hdr := c.header
+	hdr.Upgrades = append([]string(nil), c.header.Upgrades...)
+	return hdr
+}
+
 /**
 Checks that Channel is still alive
 */
@@ -77,120 +213,561 @@ func (c *Channel) IsAlive() bool {
 	c.aliveLock.Lock()
 	defer c.aliveLock.Unlock()
 
-	return c.alive
+	return c.alive && !c.disconnected
 }
 
 /**
-Close channel
+Get close code and reason sent by peer on disconnect, ok is false
+if channel is alive or was closed for any other reason
 */
-func closeChannel(c *Channel, m *methods, args ...interface{}) error {
+func (c *Channel) PeerClose() (code int, reason string, ok bool) {
 	c.aliveLock.Lock()
 	defer c.aliveLock.Unlock()
 
+	var closeErr *transport.CloseError
+	if !errors.As(c.closeErr, &closeErr) {
+		return 0, "", false
+	}
+	return closeErr.Code, closeErr.Text, true
+}
+
+/**
+Close channel
+
+Close sequence is:
+1. stop reading: channel is marked as not alive and inLoop stops
+dispatching incoming messages, on transport error the connection
+is dropped right away, because nothing more can be sent to it
+2. call OnDisconnection handlers
+3. wait for in-flight handlers, their emits are still queued
+4. stop outLoop after it flushes the queue, from now on emits
+return ErrorSocketClosed, then close the connection
+
+steps 3 and 4 are done in background, so it is safe to close
+the channel from inside of a handler
+*/
+func closeChannel(c *Channel, m *methods, args ...interface{}) error {
+	//namespace socket leaves, connection stays
+	if c.nsp != nil {
+		c.leaveNamespace(Disconnection{Reason: DisconnectServerNamespace})
+		return nil
+	}
+	if c.clientSocket != nil {
+		c.clientSocket.leave(Disconnection{Reason: DisconnectClientNamespace})
+		return nil
+	}
+
+	c.aliveLock.Lock()
 	if !c.alive {
 		//already closed
+		c.aliveLock.Unlock()
 		return nil
 	}
-
-	c.conn.Close()
 	c.alive = false
+	if len(args) > 0 {
+		c.closeErr, _ = args[0].(error)
+	}
+	closeErr := c.closeErr
+	reason := c.closeReason
+	if reason == "" {
+		reason = disconnectReason(closeErr)
+	}
+	d := Disconnection{Reason: reason, Err: closeErr}
+	c.disconnection = d
+	//EIO=4 socket refused or never connected got no OnConnection
+	connected := c.connected || c.server == nil || c.version != ProtocolVersion4
+	c.aliveLock.Unlock()
 
-	//clean outloop
-	for len(c.out) > 0 {
-		<-c.out
+	if c.server != nil {
+		c.server.stats.addDisconnect(reason)
+		c.server.removeConnection(c)
+		c.server.sessionEnded(c)
+		c.statsHook().Disconnected(c, reason)
 	}
-	c.out <- protocol.CloseMessage
+	c.logClose(reason, closeErr)
+	c.ack.closeWaiters(ErrorSocketClosed)
+	c.closeStreams(ErrorSocketClosed)
 
-	m.callLoopEvent(c, OnDisconnection)
+	if len(args) > 0 {
+		c.conn.Close()
+	}
+
+	c.closeSockets(d)
+	c.saveLost()
+	if connected {
+		m.callDisconnection(c, d)
+	}
+	c.clearSession()
+
+	c.clearOverflooded()
 
-	overfloodedLock.Lock()
-	delete(overflooded, c)
-	overfloodedLock.Unlock()
+	go c.finishClose()
 
 	return nil
 }
 
+/**
+Wait for in-flight handlers, then stop outLoop and close connection
+*/
+func (c *Channel) finishClose() {
+	c.handlers.Wait()
+
+	c.aliveLock.Lock()
+	c.outClosed = true
+	c.aliveLock.Unlock()
+
+	c.closeOut()
+	<-c.outDone
+
+	//outLoop is gone, release what was not written
+	c.aliveLock.Lock()
+	rest := c.out
+	c.out = nil
+	closePacket := c.closePacket
+	c.aliveLock.Unlock()
+	for _, packet := range rest {
+		c.bufferedDone(packet.command)
+	}
+
+	if closePacket {
+		c.conn.WriteMessage(protocol.CloseMessage)
+	}
+	c.conn.Close()
+	close(c.done)
+}
+
+/**
+Register one more in-flight handler, fails if channel is closing
+*/
+func (c *Channel) addHandler() bool {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	if !c.alive {
+		return false
+	}
+
+	c.handlers.Add(1)
+	return true
+}
+
 //incoming messages loop, puts incoming messages to In channel
 func inLoop(c *Channel, m *methods) error {
+	c.registerLoop("inLoop")
+	defer c.loopDone("inLoop")
+	defer c.stopDispatch()
+
+	//binary packet waiting for its attachments
+	var binary *protocol.Message
+	//size of current message with its attachments
+	size := 0
+	//binary packets received in chunks
+	var chunks chunkSet
+
 	for {
 		pkg, err := c.conn.GetMessage()
 		if err != nil {
+			if errors.Is(err, transport.ErrorTooManyPackets) {
+				c.payloadRejected()
+			}
+			if disconnectReason(err) == DisconnectReadError {
+				err = m.fireError(c, KindTransport, "", err)
+			}
 			return closeChannel(c, m, err)
 		}
-		msg, err := protocol.Decode(pkg)
-		if err != nil {
-			closeChannel(c, m, protocol.ErrorWrongPacket)
-			return err
+		c.touch(&c.lastRead)
+		c.packetIn(len(pkg))
+		size += len(pkg)
+		if c.maxMessageSize > 0 && int64(size) > c.maxMessageSize {
+			return c.closeTooBig(m, size)
+		}
+
+		var msg *protocol.Message
+		if binary != nil {
+			msg, err = addAttachment(binary, pkg)
+			if err != nil {
+				c.decodeError()
+				c.log().Warn("wrong attachment", "sid", c.Id(), "error", err)
+				return closeChannel(c, m, m.fireError(c, KindProtocol, pkg, decodeError(pkg, err)))
+			}
+			if msg == nil {
+				continue
+			}
+			binary = nil
+		} else {
+			msg, err = c.packetParser().Decode(pkg)
+			if err != nil && m.callRaw(c, &protocol.Message{Type: protocol.MessageTypeRaw, Source: pkg}) {
+				size = 0
+				continue
+			}
+			if err != nil {
+				c.decodeError()
+				c.log().Warn("wrong packet", "sid", c.Id(), "error", err)
+				return closeChannel(c, m, m.fireError(c, KindProtocol, pkg, decodeError(pkg, err)))
+			}
+			if msg.AttachmentCount > 0 {
+				binary = msg
+				continue
+			}
+		}
+
+		messageSize := size
+		size = 0
+		if c.chunkConfig.MaxChunkSize > 0 && isChunkPacket(msg) {
+			msg, err = chunks.add(c, msg)
+			if err != nil {
+				c.decodeError()
+				c.log().Warn("wrong chunk", "sid", c.Id(), "error", err)
+				return closeChannel(c, m, m.fireError(c, KindProtocol, pkg, decodeError(pkg, err)))
+			}
+			if c.maxMessageSize > 0 && int64(chunks.size) > c.maxMessageSize {
+				return c.closeTooBig(m, chunks.size)
+			}
+			if msg == nil {
+				continue
+			}
+			messageSize = len(msg.Source)
+			for _, attachment := range msg.Attachments {
+				messageSize += len(attachment)
+			}
+		}
+		if m.callRaw(c, msg) {
+			continue
+		}
+		if isEventPacket(msg) {
+			ok, limitErr := c.allowMessage(messageSize)
+			if limitErr != nil {
+				return closeChannel(c, m, limitErr)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		//socket.io packets of other namespaces
+		if isNamespacePacket(msg) && msg.Namespace != c.namespace {
+			if c.server != nil {
+				c.server.namespacePacket(c, msg)
+			} else {
+				c.clientNamespacePacket(msg)
+			}
+			continue
 		}
 
 		switch msg.Type {
 		case protocol.MessageTypeOpen:
 			if err := json.Unmarshal([]byte(msg.Source[1:]), &c.header); err != nil {
-				closeChannel(c, m, ErrorWrongHeader)
+				err = fmt.Errorf("%w: %v", ErrorWrongHeader, err)
+				return closeChannel(c, m, m.fireError(c, KindProtocol, pkg, err))
 			}
 			m.callLoopEvent(c, OnConnection)
+		case protocol.MessageTypeEmpty:
+			if c.server != nil && c.version == ProtocolVersion4 {
+				c.acceptConnect(m, msg.Args)
+			}
 		case protocol.MessageTypePing:
-			c.out <- protocol.PongMessage
+			c.enqueueControl(protocol.PongMessage)
 		case protocol.MessageTypePong:
+			if rtt, ok := c.pongExpected(); ok {
+				m.pong(c, rtt)
+			} else if !m.unexpectedPong(c) {
+				return closeChannel(c, m, ErrorUnexpectedPong)
+			}
+		case protocol.MessageTypeDisconnect:
+			return closeChannel(c, m, ErrorPeerDisconnect)
+		case protocol.MessageTypeConnectError:
+			//EIO=3 clients of default namespace don't wait for connect
+			if c.server == nil {
+				return closeChannel(c, m, &ConnectError{Data: msg.Args})
+			}
 		default:
-			go m.processIncomingMessage(c, msg)
+			if c.server == nil {
+				c.trackOffset(msg)
+			}
+			//EIO=4 socket is not there until connect is accepted
+			if c.server != nil && c.version == ProtocolVersion4 && !c.connected {
+				continue
+			}
+			c.dispatch(msg, func(ctx context.Context) {
+				m.processMessage(ctx, c, msg)
+			})
 		}
 	}
-	return nil
 }
 
-var overflooded map[*Channel]struct{} = make(map[*Channel]struct{})
-var overfloodedLock sync.Mutex
+/**
+Close connection which got too big message, websocket peer
+gets close frame with CloseMessageTooBig code
+*/
+func (c *Channel) closeTooBig(m *methods, size int) error {
+	c.log().Warn("message too big", "sid", c.Id(), "size", size, "limit", c.maxMessageSize)
+	err := m.fireError(c, KindProtocol, "", transport.ErrorMessageTooBig)
+	if cc, ok := c.conn.(transport.CodeCloseConnection); ok {
+		cc.CloseWithCode(transport.CloseMessageTooBig, transport.ErrorMessageTooBig.Error())
+	}
+	return closeChannel(c, m, err)
+}
+
+/**
+Add received attachment to binary packet, returns the packet
+with placeholders filled once all attachments are received
+*/
+func addAttachment(msg *protocol.Message, pkg string) (*protocol.Message, error) {
+	data, err := protocol.DecodeAttachment(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Attachments = append(msg.Attachments, data)
+	if len(msg.Attachments) < msg.AttachmentCount {
+		return nil, nil
+	}
+
+	msg.Args, err = protocol.ReconstructArgs(msg.Args, msg.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+/**
+Count written packet and wake up waitWritten
+*/
+func (c *Channel) wrote() {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	c.lastWrite = c.clock().Now()
+	c.writtenCount++
+	if c.writeSignal != nil {
+		close(c.writeSignal)
+		c.writeSignal = nil
+	}
+}
+
+/**
+Wait until all packets queued so far are written to connection
+*/
+func (c *Channel) waitWritten(deadline <-chan time.Time) error {
+	c.aliveLock.Lock()
+	target := c.enqueuedCount
+	c.aliveLock.Unlock()
 
-func AmountOfOverflooded() int64 {
-	overfloodedLock.Lock()
-	defer overfloodedLock.Unlock()
+	for {
+		c.aliveLock.Lock()
+		if c.writtenCount >= target {
+			c.aliveLock.Unlock()
+			return nil
+		}
+		if c.writeSignal == nil {
+			c.writeSignal = make(chan struct{})
+		}
+		signal := c.writeSignal
+		c.aliveLock.Unlock()
 
-	return int64(len(overflooded))
+		select {
+		case <-signal:
+		case <-c.outDone:
+			c.aliveLock.Lock()
+			written := c.writtenCount >= target
+			c.aliveLock.Unlock()
+			if written {
+				return nil
+			}
+			return ErrorSocketClosed
+		case <-deadline:
+			return ErrorSendTimeout
+		}
+	}
+}
+
+/**
+Wait until one more packet is written to connection
+*/
+func (c *Channel) waitWrite(ctx context.Context, deadline <-chan time.Time) error {
+	c.aliveLock.Lock()
+	if c.writeSignal == nil {
+		c.writeSignal = make(chan struct{})
+	}
+	signal := c.writeSignal
+	c.aliveLock.Unlock()
+
+	select {
+	case <-signal:
+		return nil
+	case <-c.outDone:
+		return ErrorSocketClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-deadline:
+		return ErrorSendTimeout
+	}
 }
 
 /**
 outgoing messages loop, sends messages from channel to socket
 */
 func outLoop(c *Channel, m *methods) error {
+	defer close(c.outDone)
+	c.registerLoop("outLoop")
+	defer c.loopDone("outLoop")
+
 	for {
-		outBufferLen := len(c.out)
-		if outBufferLen >= queueBufferSize-1 {
+		packet, queued := c.nextOut()
+		msg := packet.command
+
+		size := c.queue.size()
+		if queued >= size-1 && c.queue.Overflow == OverflowClose {
+			c.bufferedDone(msg)
+			c.overflow()
 			return closeChannel(c, m, ErrorSocketOverflood)
-		} else if outBufferLen > int(queueBufferSize/2) {
-			overfloodedLock.Lock()
-			overflooded[c] = struct{}{}
-			overfloodedLock.Unlock()
-		} else {
-			overfloodedLock.Lock()
-			delete(overflooded, c)
-			overfloodedLock.Unlock()
 		}
+		c.setOverflooded(m, queued > size/2)
 
-		msg := <-c.out
 		if msg == protocol.CloseMessage {
 			return nil
 		}
+		c.bufferedDone(msg)
 
-		err := c.conn.WriteMessage(msg)
+		if bc, ok := c.batchConnection(packet); ok {
+			if err := c.writeBatch(bc, packet); err != nil {
+				return closeChannel(c, m, m.fireError(c, KindTransport, "", writeError{err}))
+			}
+			continue
+		}
+
+		err := c.write(packet)
 		if err != nil {
-			return closeChannel(c, m, err)
+			return closeChannel(c, m, m.fireError(c, KindTransport, "", writeError{err}))
 		}
+		c.wrote()
+		c.packetOut(len(msg))
 	}
-	return nil
 }
 
 /**
-Pinger sends ping messages for keeping connection alive
+Write packet to connection, without compression if it was
+queued so and connection can do that
 */
-func pinger(c *Channel) {
+func (c *Channel) write(packet outPacket) error {
+	if packet.uncompressed {
+		if cc, ok := c.conn.(transport.CompressionConnection); ok {
+			return cc.WriteMessageUncompressed(packet.command)
+		}
+	}
+	return c.conn.WriteMessage(packet.command)
+}
+
+/**
+Pinger sends ping messages for keeping connection alive, and closes
+channel when pong does not come within ping timeout.
+Exits as soon as channel is closed
+*/
+func pinger(c *Channel, m *methods) {
+	c.registerLoop("pinger")
+	defer c.loopDone("pinger")
+
+	next := c.clock().Now().Add(c.pingInterval())
 	for {
-		interval, _ := c.conn.PingParams()
-		time.Sleep(interval)
+		wait := next
+		c.aliveLock.Lock()
+		if !c.pongDue.IsZero() && c.pongDue.Before(next) {
+			wait = c.pongDue
+		}
+		c.aliveLock.Unlock()
+
+		timer := c.clock().NewTimer(wait.Sub(c.clock().Now()))
+		select {
+		case <-timer.C():
+		case <-c.done:
+			timer.Stop()
+			return
+		}
+
 		if !c.IsAlive() {
 			return
 		}
 
-		c.out <- protocol.PingMessage
+		now := c.clock().Now()
+		if c.pongMissed(now) {
+			closeChannel(c, m, ErrorPingTimeout)
+			return
+		}
+		if now.Before(next) {
+			continue
+		}
+		next = now.Add(c.pingInterval())
+
+		//ping which does not fit is sent on the next interval
+		if c.enqueueControl(protocol.PingMessage) == nil {
+			c.aliveLock.Lock()
+			c.pingsSent++
+			c.lastPing = now
+			if c.pongDue.IsZero() {
+				c.pongDue = now.Add(c.pingTimeout())
+			}
+			c.aliveLock.Unlock()
+		}
+	}
+}
+
+/**
+Check if pong for ping sent is not received in time
+*/
+func (c *Channel) pongMissed(now time.Time) bool {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	return !c.pongDue.IsZero() && !now.Before(c.pongDue)
+}
+
+/**
+Check if pong answers ping sent before, count it and get its round trip time
+*/
+func (c *Channel) pongExpected() (time.Duration, bool) {
+	c.aliveLock.Lock()
+	if c.pingsSent == 0 {
+		c.unexpectedPongs++
+		c.aliveLock.Unlock()
+		return 0, false
 	}
+	c.pingsSent--
+	now := c.clock().Now()
+	rtt := now.Sub(c.lastPing)
+	c.addLatency(rtt)
+	//peer is alive, pings still unanswered get full timeout
+	c.pongDue = time.Time{}
+	if c.pingsSent > 0 {
+		c.pongDue = now.Add(c.pingTimeout())
+	}
+	c.aliveLock.Unlock()
+
+	c.statsHook().PingRTT(c, rtt)
+	return rtt, true
+}
+
+/**
+Apply unexpected pong policy, returns false if channel should be closed
+*/
+func (m *methods) unexpectedPong(c *Channel) bool {
+	if m.UnexpectedPongPolicy == PongIgnore {
+		return true
+	}
+
+	if c.server != nil {
+		c.server.stats.addUnexpectedPong()
+	}
+	c.log().Warn("unexpected pong", "sid", c.Id())
+	if m.OnUnexpectedPong != nil {
+		m.OnUnexpectedPong(c)
+	}
+
+	if m.UnexpectedPongPolicy != PongClose {
+		return true
+	}
+
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	return c.unexpectedPongs <= m.MaxUnexpectedPongs
 }
@@ -0,0 +1,50 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"testing"
+	"time"
+)
+
+func TestHandlersEmitWhileClosing(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		tr := gosocketiotest.NewTransport()
+		s := NewServer(tr)
+
+		failed := make(chan error, 1)
+		started := make(chan struct{}, 10)
+		s.On("ev", func(c *Channel) {
+			started <- struct{}{}
+			for j := 0; j < 20; j++ {
+				//emits of late handlers succeed or see closed socket
+				if err := c.Emit("x", j); err != nil && err != ErrorSocketClosed {
+					select {
+					case failed <- err:
+					default:
+					}
+				}
+			}
+		})
+
+		c, sc := dialTest(t, s, tr, gosocketiotest.Url)
+		for j := 0; j < 10; j++ {
+			c.Emit("ev", nil)
+		}
+		<-started
+		sc.Close()
+
+		select {
+		case <-sc.done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("close hangs")
+		}
+		select {
+		case err := <-failed:
+			t.Fatalf("emit of handler failed with %v", err)
+		default:
+		}
+		if err := sc.Emit("late", 1); err != ErrorSocketClosed {
+			t.Fatalf("emit after close: got %v, want ErrorSocketClosed", err)
+		}
+	}
+}
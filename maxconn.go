@@ -0,0 +1,44 @@
+package gosocketio
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+var (
+	ErrorMaxConnections = errors.New("Too many connections")
+)
+
+/**
+Check handshake against Options.MaxConnections, handshakes in progress
+count as connections. Refused one gets 503, or the response of
+ConnectionLimitHandler; handshakeDone must be called if it is allowed
+*/
+func (s *Server) allowConnection(w http.ResponseWriter, r *http.Request) bool {
+	pending := atomic.AddInt32(&s.handshakes, 1)
+
+	limit := s.Options.MaxConnections
+	if limit <= 0 || s.AmountOfConnections()+int64(pending) <= int64(limit) {
+		return true
+	}
+
+	if s.ConnectionLimitHandler != nil && s.ConnectionLimitHandler(w, r) {
+		return true
+	}
+	s.handshakeDone()
+
+	s.stats.addRefusedHandshake()
+	if s.OnConnectionRefused != nil {
+		s.OnConnectionRefused(r, ErrorMaxConnections)
+	}
+	if s.ConnectionLimitHandler == nil {
+		w.Header().Set("Retry-After", notAcceptingRetryAfter)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	}
+	return false
+}
+
+func (s *Server) handshakeDone() {
+	atomic.AddInt32(&s.handshakes, -1)
+}
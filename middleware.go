@@ -0,0 +1,192 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"github.com/graarh/golang-socketio/protocol"
+	"net/http"
+)
+
+/**
+Function called for every new connection before OnConnection,
+returned error rejects it and its text is sent to client.
+r is nil for connections set up with SetupEventLoop
+*/
+type Middleware func(c *Channel, r *http.Request) error
+
+/**
+Function called when socket connects to namespace, before OnConnection,
+with auth object of connect packet. Returned error refuses connect and
+its text is sent to client. EIO=3 clients connect default namespace
+with handshake, auth is nil then and the connection is refused
+*/
+type ConnectMiddleware func(c *Channel, auth json.RawMessage) error
+
+/**
+Event, ack request or ack response about to be sent to server channel.
+Outgoing middlewares may replace Args, they are encoded after them
+*/
+type Packet struct {
+	//protocol.MessageTypeEmit, MessageTypeAckRequest or MessageTypeAckResponse
+	Type      int
+	Namespace string
+	//event name, empty for ack responses
+	Method string
+	AckId  int
+	Args   interface{}
+}
+
+/**
+Function called for every packet sent to clients before it is queued,
+returned error drops the packet and is returned to the sender
+*/
+type OutgoingMiddleware func(c *Channel, p *Packet) error
+
+/**
+Add middleware to handshake chain, they are called in order
+they were added, until the first error
+*/
+func (s *Server) Use(m Middleware) {
+	s.middlewaresLock.Lock()
+	defer s.middlewaresLock.Unlock()
+
+	s.middlewares = append(s.middlewares, m)
+}
+
+func (s *Server) runMiddlewares(c *Channel, r *http.Request) error {
+	s.middlewaresLock.RLock()
+	middlewares := s.middlewares
+	s.middlewaresLock.RUnlock()
+
+	for _, m := range middlewares {
+		if err := m(c, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+Add middleware to outgoing chain, applied to events and acks
+of all namespaces in order they were added, until the first error.
+Broadcasts run it for every recipient
+*/
+func (s *Server) UseOutgoing(m OutgoingMiddleware) {
+	s.middlewaresLock.Lock()
+	defer s.middlewaresLock.Unlock()
+
+	s.outgoing = append(s.outgoing, m)
+}
+
+/**
+Run outgoing middlewares on packet of channel, returns arguments
+to encode. Connection packets and client channels skip them
+*/
+func (c *Channel) runOutgoing(msg *protocol.Message, args interface{}) (interface{}, error) {
+	s := c.server
+	if s == nil || msg.Type != protocol.MessageTypeEmit &&
+		msg.Type != protocol.MessageTypeAckRequest && msg.Type != protocol.MessageTypeAckResponse {
+		return args, nil
+	}
+
+	s.middlewaresLock.RLock()
+	middlewares := s.outgoing
+	s.middlewaresLock.RUnlock()
+	if len(middlewares) == 0 {
+		return args, nil
+	}
+
+	p := &Packet{
+		Type:      msg.Type,
+		Namespace: msg.Namespace,
+		Method:    msg.Method,
+		AckId:     msg.AckId,
+		Args:      args,
+	}
+	for _, m := range middlewares {
+		if err := m(c, p); err != nil {
+			return nil, err
+		}
+	}
+	return p.Args, nil
+}
+
+/**
+Add middleware to connect chain of namespace, they are called
+in order they were added, until the first error
+*/
+func (m *methods) UseConnect(f ConnectMiddleware) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	m.connectMiddlewares = append(m.connectMiddlewares, f)
+}
+
+/**
+Add middleware to connect chain of namespace, like UseConnect, so
+"/admin" may check what "/chat" doesn't. Refused socket gets connect
+error of its namespace, other namespaces of the connection stay.
+Handshake chain of the connection is Server.Use
+*/
+func (ns *Namespace) Use(f ConnectMiddleware) {
+	ns.UseConnect(f)
+}
+
+func (m *methods) runConnectMiddlewares(c *Channel, auth json.RawMessage) error {
+	m.messageHandlersLock.RLock()
+	middlewares := m.connectMiddlewares
+	m.messageHandlersLock.RUnlock()
+
+	for _, f := range middlewares {
+		if err := f(c, auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+Get auth of connect packet payload, nil if it is empty
+*/
+func connectAuth(payload string) json.RawMessage {
+	if payload == "" {
+		return nil
+	}
+	return json.RawMessage(payload)
+}
+
+/**
+Send socket.io connect error of given namespace
+*/
+func (c *Channel) sendConnectError(namespace string, err error) {
+	//EIO=3 clients expect json string, EIO=4 object with message
+	reason, _ := json.Marshal(err.Error())
+	if c.version == ProtocolVersion4 {
+		reason, _ = json.Marshal(&struct {
+			Message string `json:"message"`
+		}{err.Error()})
+	}
+
+	c.enqueue(c.mustEncode(&protocol.Message{
+		Type:      protocol.MessageTypeConnectError,
+		Namespace: namespace,
+		Args:      string(reason),
+	})...)
+}
+
+/**
+Refuse new connection: send open packet and connect error, then
+close after they are written. Connection handlers are not called
+*/
+func (s *Server) rejectConnection(c *Channel, err error) {
+	c.log().Info("connection rejected", "sid", c.Id(), "ip", c.Ip(), "error", err)
+	s.sendOpen(c)
+	c.sendConnectError(c.namespace, err)
+
+	c.aliveLock.Lock()
+	c.alive = false
+	c.closeErr = err
+	c.aliveLock.Unlock()
+
+	go outLoop(c, &s.methods)
+	go c.finishClose()
+}
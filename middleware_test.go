@@ -0,0 +1,50 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"testing"
+	"time"
+)
+
+func TestNamespaceMiddleware(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.ProtocolVersions = []int{ProtocolVersion3, ProtocolVersion4}
+
+	chat := s.Of("/chat")
+	chat.Use(func(c *Channel, auth json.RawMessage) error {
+		return nil
+	})
+	chat.On("echo", func(c *Channel, msg string) string {
+		return msg
+	})
+	s.Of("/admin").Use(func(c *Channel, auth json.RawMessage) error {
+		return errors.New("not an operator")
+	})
+
+	c, _ := dialTest(t, s, tr, gosocketiotest.UrlV4)
+
+	chatSock, err := c.Of("/chat")
+	if err != nil {
+		t.Fatalf("chat refused: %v", err)
+	}
+
+	_, err = c.Of("/admin")
+	var connectErr *ConnectError
+	if !errors.As(err, &connectErr) {
+		t.Fatalf("admin: got %v, want ConnectError", err)
+	}
+	if connectErr.Data != `{"message":"not an operator"}` {
+		t.Fatalf("admin connect error data %s", connectErr.Data)
+	}
+
+	reply, err := chatSock.Ack("echo", "hi", time.Second)
+	if err != nil || reply != `"hi"` {
+		t.Fatalf("chat after admin refused: %q, %v", reply, err)
+	}
+	if !c.IsAlive() {
+		t.Fatal("connection closed by namespace refusal")
+	}
+}
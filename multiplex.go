@@ -0,0 +1,185 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Get socket of given namespace over connection of this client, connecting
+it on first call. Socket has its own handlers and acks, it is closed
+with the connection, Close of the socket leaves only its namespace:
+
+	chat, err := client.Of("/chat")
+	chat.On("message", func(c *gosocketio.Channel, msg Message) {})
+	chat.Emit("send", msg)
+
+If server has no such namespace, *ConnectError is returned
+*/
+func (c *Client) Of(namespace string) (*Client, error) {
+	return c.OfContext(context.Background(), namespace)
+}
+
+/**
+Same as Of, waiting for connect reply is stopped when ctx is done
+*/
+func (c *Client) OfContext(ctx context.Context, namespace string) (*Client, error) {
+	if namespace == protocol.DefaultNamespace {
+		namespace = ""
+	}
+
+	c.aliveLock.Lock()
+	if c.namespace == namespace && c.clientSocket == nil {
+		c.aliveLock.Unlock()
+		return c, nil
+	}
+	if !c.alive {
+		c.aliveLock.Unlock()
+		return nil, ErrorSocketClosed
+	}
+	if sock, ok := c.clientSockets[namespace]; ok {
+		c.aliveLock.Unlock()
+		return sock, sock.waitConnected(ctx)
+	}
+
+	sock := &Client{connected: make(chan struct{})}
+	sock.initMethods()
+	sock.link = c.link
+	sock.namespace = namespace
+	sock.recovery = &recovery{}
+	sock.clientSocket = sock
+
+	if c.clientSockets == nil {
+		c.clientSockets = make(map[string]*Client)
+	}
+	c.clientSockets[namespace] = sock
+	c.aliveLock.Unlock()
+
+	err := send(&protocol.Message{Type: protocol.MessageTypeEmpty, Args: sock.connectPayload()}, &sock.Channel, nil)
+	if err == nil {
+		err = sock.waitConnected(ctx)
+	}
+	if err != nil {
+		sock.removeSocket()
+		if ctx.Err() != nil {
+			//server may connect it later
+			send(&protocol.Message{Type: protocol.MessageTypeDisconnect}, &sock.Channel, nil)
+		}
+		return nil, err
+	}
+
+	c.log().Debug("namespace connected", "sid", c.Id(), "namespace", sock.Namespace())
+	return sock, nil
+}
+
+/**
+Wait for connect reply of namespace socket, result is kept
+for other callers of Of
+*/
+func (c *Client) waitConnected(ctx context.Context) error {
+	select {
+	case <-c.connected:
+		return c.connectErr
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrorSocketClosed
+	}
+}
+
+/**
+Set connect result of namespace socket, false if it is set already
+*/
+func (c *Client) connect(err error) bool {
+	set := false
+	c.connectOnce.Do(func() {
+		c.connectErr = err
+		close(c.connected)
+		set = true
+	})
+	return set
+}
+
+/**
+Remove namespace socket from connection
+*/
+func (c *Client) removeSocket() {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	if c.clientSockets[c.namespace] == c {
+		delete(c.clientSockets, c.namespace)
+	}
+}
+
+/**
+Handle packet of other namespace, received by client connection
+*/
+func (c *Channel) clientNamespacePacket(msg *protocol.Message) {
+	c.aliveLock.Lock()
+	sock := c.clientSockets[msg.Namespace]
+	c.aliveLock.Unlock()
+	if sock == nil {
+		return
+	}
+
+	switch msg.Type {
+	case protocol.MessageTypeEmpty:
+		sock.acceptRecovery(msg.Args)
+		if sock.connect(nil) {
+			sock.callLoopEvent(&sock.Channel, OnConnection)
+		}
+
+	case protocol.MessageTypeConnectError:
+		sock.removeSocket()
+		sock.connect(&ConnectError{Data: msg.Args})
+
+	case protocol.MessageTypeDisconnect:
+		sock.leave(Disconnection{Reason: DisconnectServerNamespace, Err: ErrorPeerDisconnect})
+
+	case protocol.MessageTypeEmit, protocol.MessageTypeAckRequest,
+		protocol.MessageTypeAckResponse:
+		sock.trackOffset(msg)
+		c.dispatch(msg, func(ctx context.Context) {
+			sock.processMessage(ctx, &sock.Channel, msg)
+		})
+	}
+}
+
+/**
+Remove namespace socket from connection and fire OnDisconnection
+*/
+func (c *Client) leave(d Disconnection) {
+	c.aliveLock.Lock()
+	if c.disconnected {
+		c.aliveLock.Unlock()
+		return
+	}
+	c.disconnected = true
+	c.disconnection = d
+	if c.clientSockets[c.namespace] == c {
+		delete(c.clientSockets, c.namespace)
+	}
+	c.aliveLock.Unlock()
+
+	c.ack.closeWaiters(ErrorSocketClosed)
+	c.closeStreams(ErrorSocketClosed)
+	c.callDisconnection(&c.Channel, d)
+	c.clearSession()
+}
+
+/**
+Disconnect all client namespace sockets of closed connection
+*/
+func (c *Channel) closeClientSockets(d Disconnection) {
+	c.aliveLock.Lock()
+	sockets := make([]*Client, 0, len(c.clientSockets))
+	for _, sock := range c.clientSockets {
+		sockets = append(sockets, sock)
+	}
+	c.aliveLock.Unlock()
+
+	for _, sock := range sockets {
+		sock.leave(d)
+	}
+}
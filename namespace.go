@@ -0,0 +1,281 @@
+package gosocketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"sync"
+)
+
+var (
+	ErrorInvalidNamespace = errors.New("Invalid namespace")
+)
+
+/**
+Channels of one namespace: sids and room joins
+*/
+type registry struct {
+	server    *Server
+	namespace string
+
+	roomAdapter Adapter
+	adapterOnce sync.Once
+
+	channels     map[string]map[*Channel]struct{}
+	rooms        map[*Channel]map[string]struct{}
+	presence     map[*Channel]interface{} //metadata given to SetPresence
+	channelsLock sync.RWMutex
+
+	sids     map[string]*Channel
+	sidsLock sync.RWMutex
+}
+
+func (r *registry) initRegistry(s *Server, namespace string) {
+	r.server = s
+	r.namespace = namespace
+	r.channels = make(map[string]map[*Channel]struct{})
+	r.rooms = make(map[*Channel]map[string]struct{})
+	r.sids = make(map[string]*Channel)
+}
+
+/**
+socket.io namespace, with its own handlers, rooms and channels.
+Clients connect to it over the same connection as to default one
+*/
+type Namespace struct {
+	*methods
+	*registry
+
+	//dynamic namespace: OfPattern one it was matched by, and parameters
+	parent     *Namespace
+	params     map[string]string
+	connecting int //sockets being connected, guarded by namespacesLock
+}
+
+/**
+Get name of the namespace
+*/
+func (ns *Namespace) Name() string {
+	return ns.namespace
+}
+
+/**
+Get namespace with given name, creating it on first call.
+Of("/") is the server itself
+*/
+func (s *Server) Of(name string) *Namespace {
+	if name == "" {
+		name = protocol.DefaultNamespace
+	}
+
+	s.namespacesLock.Lock()
+	defer s.namespacesLock.Unlock()
+
+	if ns, ok := s.namespaces[name]; ok {
+		return ns
+	}
+
+	ns := s.matchNamespace(name)
+	if ns == nil {
+		ns = newNamespace(s, name)
+	}
+	s.namespaces[name] = ns
+	return ns
+}
+
+func newNamespace(s *Server, name string) *Namespace {
+	ns := &Namespace{
+		methods:  &methods{},
+		registry: &registry{},
+	}
+	ns.initMethods()
+	ns.initRegistry(s, name)
+	ns.onConnection = onConnectStore
+	ns.onDisconnection = onDisconnectCleanup
+	return ns
+}
+
+/**
+Get registry of channel namespace, server must be set
+*/
+func (c *Channel) registry() *registry {
+	if c.nsp != nil {
+		return c.nsp.registry
+	}
+	return &c.server.registry
+}
+
+/**
+Get handlers of channel namespace, server must be set
+*/
+func (c *Channel) namespaceMethods() *methods {
+	if c.nsp != nil {
+		return c.nsp.methods
+	}
+	return &c.server.methods
+}
+
+/**
+Check if packet belongs to socket.io namespace, engine.io
+packets like ping do not
+*/
+func isNamespacePacket(msg *protocol.Message) bool {
+	switch msg.Type {
+	case protocol.MessageTypeEmpty, protocol.MessageTypeEmit,
+		protocol.MessageTypeAckRequest, protocol.MessageTypeAckResponse,
+		protocol.MessageTypeDisconnect, protocol.MessageTypeConnectError:
+		return true
+	}
+	return false
+}
+
+/**
+Get socket of given namespace on this connection
+*/
+func (c *Channel) socket(namespace string) *Channel {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	return c.sockets[namespace]
+}
+
+/**
+Handle packet of other namespace, received by default channel
+*/
+func (s *Server) namespacePacket(c *Channel, msg *protocol.Message) {
+	switch msg.Type {
+	case protocol.MessageTypeEmpty:
+		s.connectNamespace(c, msg.Namespace, msg.Args)
+
+	case protocol.MessageTypeDisconnect:
+		if sock := c.socket(msg.Namespace); sock != nil {
+			sock.leaveNamespace(Disconnection{Reason: DisconnectClientNamespace, Err: ErrorPeerDisconnect})
+		}
+
+	case protocol.MessageTypeEmit, protocol.MessageTypeAckRequest,
+		protocol.MessageTypeAckResponse:
+		sock := c.socket(msg.Namespace)
+		if sock == nil {
+			return
+		}
+		c.dispatch(msg, func(ctx context.Context) {
+			sock.nsp.processMessage(ctx, sock, msg)
+		})
+	}
+}
+
+/**
+Create socket of given namespace on this connection, or refuse
+with connect error if there is no such namespace
+*/
+func (s *Server) connectNamespace(c *Channel, name, payload string) {
+	//repeated connect packets are ignored
+	if c.socket(name) != nil {
+		return
+	}
+
+	ns := s.acquireNamespace(name)
+	if ns == nil {
+		c.log().Warn("unknown namespace", "sid", c.Id(), "namespace", name)
+		c.sendConnectError(name, ErrorInvalidNamespace)
+		return
+	}
+	defer s.releaseNamespace(ns)
+
+	sock := &Channel{
+		link:      c.link,
+		namespace: name,
+		nsp:       ns,
+		server:    s,
+		recovery:  s.newRecovery(c.version),
+		auth:      connectAuth(payload),
+	}
+	if err := ns.runConnectMiddlewares(sock, sock.auth); err != nil {
+		c.log().Info("namespace connect rejected", "sid", c.Id(), "namespace", name, "error", err)
+		c.sendConnectError(name, err)
+
+		//middleware may keep the socket, it is not connected
+		c.aliveLock.Lock()
+		sock.disconnected = true
+		c.aliveLock.Unlock()
+		return
+	}
+
+	c.aliveLock.Lock()
+	if _, ok := c.sockets[name]; ok || !c.alive {
+		c.aliveLock.Unlock()
+		return
+	}
+	if c.sockets == nil {
+		c.sockets = make(map[string]*Channel)
+	}
+	c.sockets[name] = sock
+	c.aliveLock.Unlock()
+
+	replay := sock.startRecovery(payload)
+	sock.sendConnected()
+	replay()
+	c.log().Debug("namespace connected", "sid", c.Id(), "namespace", name)
+	ns.callLoopEvent(sock, OnConnection)
+}
+
+/**
+Confirm connect to client, EIO=4 clients get socket id
+*/
+func (c *Channel) sendConnected() {
+	msg := &protocol.Message{
+		Type:      protocol.MessageTypeEmpty,
+		Namespace: c.namespace,
+	}
+	if c.version == ProtocolVersion4 {
+		reply, _ := json.Marshal(&struct {
+			Sid string `json:"sid"`
+			Pid string `json:"pid,omitempty"`
+		}{c.Id(), c.recoveryPid()})
+		msg.Args = string(reply)
+	}
+
+	c.enqueue(c.mustEncode(msg)...)
+}
+
+/**
+Remove namespace socket from connection and fire OnDisconnection,
+connection itself and other namespaces stay
+*/
+func (c *Channel) leaveNamespace(d Disconnection) {
+	c.aliveLock.Lock()
+	if c.disconnected {
+		c.aliveLock.Unlock()
+		return
+	}
+	c.disconnected = true
+	c.disconnection = d
+	delete(c.sockets, c.namespace)
+	c.aliveLock.Unlock()
+
+	c.ack.closeWaiters(ErrorSocketClosed)
+	c.closeStreams(ErrorSocketClosed)
+	c.saveLost()
+	c.nsp.callDisconnection(c, d)
+	c.clearSession()
+	c.server.namespaceLeft(c.nsp)
+}
+
+/**
+Disconnect all namespace sockets of closed connection,
+they get disconnection of the connection
+*/
+func (c *Channel) closeSockets(d Disconnection) {
+	c.aliveLock.Lock()
+	sockets := make([]*Channel, 0, len(c.sockets))
+	for _, sock := range c.sockets {
+		sockets = append(sockets, sock)
+	}
+	c.aliveLock.Unlock()
+
+	for _, sock := range sockets {
+		sock.leaveNamespace(d)
+	}
+	c.closeClientSockets(d)
+}
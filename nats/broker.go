@@ -0,0 +1,337 @@
+package nats
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/internal/envelope"
+	"github.com/graarh/golang-socketio/protocol"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPrefix  = "socket.io"
+	DefaultTimeout = 5 * time.Second
+
+	//delay before connection is established again
+	reconnectDelay = time.Second
+
+	//subscription ids
+	sidBroadcast = 1
+	sidRequest   = 2
+)
+
+var (
+	ErrorBrokerClosed = errors.New("Broker closed")
+)
+
+/**
+Connection of server instance to nats, creates adapters
+for namespaces of the server. Broadcasts and server-side events
+are passed to other instances through nats pub/sub in socket.io-redis
+format, one subject for all namespaces:
+
+	broker := nats.NewBroker("localhost:4222")
+	server.NewAdapter = broker.NewAdapter
+
+Instance not connected at the moment misses messages, like with redis.
+Recovery backlog is kept in memory of every instance, so recovering
+clients still need sticky sessions. Backlog is not kept in JetStream:
+the client speaks core nats protocol only
+*/
+type Broker struct {
+	Addr string
+	//credentials, user and password or token
+	User     string
+	Password string
+	Token    string
+	//first part of subjects, DefaultPrefix if empty
+	Prefix string
+	//dial and publish timeout, DefaultTimeout if 0
+	Timeout time.Duration
+
+	uid string
+
+	adapters map[string]*adapter //by namespace
+	conn     *natsConn
+	started  bool
+	closed   bool
+	done     chan struct{}
+	lock     sync.Mutex
+	dialLock sync.Mutex
+}
+
+/**
+Adapter of one namespace, keeps rooms locally
+and publishes broadcasts for other instances
+*/
+type adapter struct {
+	gosocketio.Adapter
+
+	broker    *Broker
+	namespace string
+}
+
+/**
+Create broker for nats at given address, connection
+is established when first adapter is created
+*/
+func NewBroker(addr string) *Broker {
+	return &Broker{
+		Addr:     addr,
+		uid:      envelope.NewUid(),
+		adapters: make(map[string]*adapter),
+		done:     make(chan struct{}),
+	}
+}
+
+func (b *Broker) timeout() time.Duration {
+	if b.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return b.Timeout
+}
+
+func (b *Broker) prefix() string {
+	if b.Prefix == "" {
+		return DefaultPrefix
+	}
+	return b.Prefix
+}
+
+/**
+Subject of broadcasts of all namespaces
+*/
+func (b *Broker) broadcastSubject() string {
+	return b.prefix() + ".broadcast"
+}
+
+/**
+Subject of requests to all instances, like server-side events
+*/
+func (b *Broker) requestSubject() string {
+	return b.prefix() + ".request"
+}
+
+/**
+Create adapter for namespace, to be used as Server.NewAdapter
+*/
+func (b *Broker) NewAdapter(namespace string, local gosocketio.Adapter) gosocketio.Adapter {
+	a := &adapter{
+		Adapter:   local,
+		broker:    b,
+		namespace: namespace,
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.adapters[namespace] = a
+	if !b.started && !b.closed {
+		b.started = true
+		go b.connectLoop()
+	}
+
+	return a
+}
+
+/**
+Stop receiving broadcasts of other instances and close connection
+*/
+func (b *Broker) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+	return nil
+}
+
+/**
+Get current connection, dial and subscribe if there is none.
+Read loop of new connection is started here
+*/
+func (b *Broker) connection() (*natsConn, error) {
+	//dial outside of lock, adapters are looked up meanwhile
+	b.dialLock.Lock()
+	defer b.dialLock.Unlock()
+
+	b.lock.Lock()
+	conn, closed := b.conn, b.closed
+	b.lock.Unlock()
+	if closed {
+		return nil, ErrorBrokerClosed
+	}
+	if conn != nil {
+		return conn, nil
+	}
+
+	conn, err := dialNats(b.Addr, connectOptions{
+		User:     b.User,
+		Password: b.Password,
+		Token:    b.Token,
+		Name:     "socket.io-" + b.uid,
+	}, b.timeout())
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.subscribe(b.broadcastSubject(), sidBroadcast); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.subscribe(b.requestSubject(), sidRequest); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		conn.Close()
+		return nil, ErrorBrokerClosed
+	}
+	b.conn = conn
+	b.lock.Unlock()
+
+	go func() {
+		conn.readLoop(b.receive)
+		conn.Close()
+
+		b.lock.Lock()
+		if b.conn == conn {
+			b.conn = nil
+		}
+		b.lock.Unlock()
+	}()
+
+	return conn, nil
+}
+
+/**
+Keep connection, reconnecting until broker is closed,
+so broadcasts are received without publishing
+*/
+func (b *Broker) connectLoop() {
+	for {
+		if conn, err := b.connection(); err == nil {
+			select {
+			case <-b.done:
+				return
+			case <-conn.done:
+			}
+		}
+
+		select {
+		case <-b.done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+/**
+Publish on current connection, it is dropped on failure
+and next publish dials again
+*/
+func (b *Broker) publish(subject string, payload []byte) error {
+	conn, err := b.connection()
+	if err != nil {
+		return err
+	}
+	if err := conn.publish(subject, payload); err != nil {
+		if err != ErrorPayloadTooBig {
+			conn.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+/**
+Pass received message to adapter of its namespace
+*/
+func (b *Broker) receive(subject string, payload []byte) {
+	switch subject {
+	case b.broadcastSubject():
+		b.deliver(payload)
+	case b.requestSubject():
+		b.request(payload)
+	}
+}
+
+func (b *Broker) adapter(namespace string) *adapter {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.adapters[namespace]
+}
+
+/**
+Broadcast to local channels and publish it for other instances
+*/
+func (a *adapter) Broadcast(opts *gosocketio.BroadcastOptions, method string, args interface{}) error {
+	if err := a.Adapter.Broadcast(opts, method, args); err != nil {
+		return err
+	}
+
+	payload, err := envelope.EncodeBroadcast(a.broker.uid, a.namespace, opts, method, args)
+	if err != nil {
+		return err
+	}
+	return a.broker.publish(a.broker.broadcastSubject(), payload)
+}
+
+/**
+Publish server-side event for other instances, handled
+by serverSideEmit handlers of the namespace
+*/
+func (a *adapter) ServerSideEmit(method string, args interface{}) error {
+	payload, err := protocol.MarshalMsgpack(envelope.ServerSideRequest(a.broker.uid, a.namespace, method, args))
+	if err != nil {
+		return err
+	}
+	return a.broker.publish(a.broker.requestSubject(), payload)
+}
+
+/**
+Broadcast message of other instance to local channels of its namespace,
+own messages and packets other than events are skipped
+*/
+func (b *Broker) deliver(payload []byte) {
+	msg, ok := envelope.DecodeBroadcast(payload)
+	if !ok || msg.Uid == b.uid {
+		return
+	}
+	if a := b.adapter(msg.Namespace); a != nil {
+		a.Adapter.Broadcast(msg.Opts, msg.Method, msg.Args)
+	}
+}
+
+/**
+Handle request of other instance, only server-side events are
+supported; they are given to the local adapter of namespace
+*/
+func (b *Broker) request(payload []byte) {
+	value, err := protocol.UnmarshalMsgpack(payload)
+	if err != nil {
+		return
+	}
+	r, ok := envelope.DecodeRequest(value)
+	if !ok || r.Uid == b.uid {
+		return
+	}
+	a := b.adapter(r.Namespace)
+	if a == nil {
+		return
+	}
+	if receiver, ok := a.Adapter.(envelope.ServerSideReceiver); ok {
+		receiver.ReceiveServerSide(r.Method, r.Args)
+	}
+}
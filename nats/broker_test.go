@@ -0,0 +1,141 @@
+package nats
+
+import (
+	"github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/internal/envelope"
+	"github.com/graarh/golang-socketio/protocol"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type broadcast struct {
+	opts   gosocketio.BroadcastOptions
+	method string
+	args   interface{}
+}
+
+/**
+Local adapter recording broadcasts and server-side events
+*/
+type fakeLocal struct {
+	broadcasts chan broadcast
+	serverSide chan broadcast
+}
+
+func newFakeLocal() *fakeLocal {
+	return &fakeLocal{
+		broadcasts: make(chan broadcast, 4),
+		serverSide: make(chan broadcast, 4),
+	}
+}
+
+func (l *fakeLocal) AddToRoom(c *gosocketio.Channel, room string) error      { return nil }
+func (l *fakeLocal) RemoveFromRoom(c *gosocketio.Channel, room string) error { return nil }
+func (l *fakeLocal) Sockets(rooms []string) []string                         { return nil }
+
+func (l *fakeLocal) Broadcast(opts *gosocketio.BroadcastOptions, method string, args interface{}) error {
+	l.broadcasts <- broadcast{*opts, method, args}
+	return nil
+}
+
+func (l *fakeLocal) ReceiveServerSide(method string, args interface{}) {
+	l.serverSide <- broadcast{method: method, args: args}
+}
+
+func (l *fakeLocal) next(t *testing.T, ch chan broadcast) broadcast {
+	select {
+	case b := <-ch:
+		return b
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing delivered")
+		return broadcast{}
+	}
+}
+
+/**
+Answer handshake and subscriptions of broker connection
+*/
+func (fc *fakeConn) acceptBroker() {
+	fc.handshake(`{}`)
+	fc.expect("SUB socket.io.broadcast 1")
+	fc.expect("SUB socket.io.request 2")
+}
+
+func (fc *fakeConn) sendMsg(subject string, payload []byte) {
+	fc.send("MSG " + subject + " 1 " + strconv.Itoa(len(payload)) + "\r\n" + string(payload) + "\r\n")
+}
+
+func TestBrokerDeliver(t *testing.T) {
+	s := newFakeServer(t)
+	broker := NewBroker(s.addr())
+	defer broker.Close()
+	local := newFakeLocal()
+	a := broker.NewAdapter("/chat", local)
+	fc := s.accept()
+	fc.acceptBroker()
+
+	opts := &gosocketio.BroadcastOptions{Rooms: []string{"room"}, Except: []string{"sid"}}
+	payload, _ := envelope.EncodeBroadcast("other", "/chat", opts, "message", "hello")
+	fc.sendMsg("socket.io.broadcast", payload)
+	b := local.next(t, local.broadcasts)
+	if !reflect.DeepEqual(b, broadcast{*opts, "message", "hello"}) {
+		t.Fatalf("delivered %+v", b)
+	}
+
+	//own broadcasts and ones of other namespaces are skipped
+	own, _ := envelope.EncodeBroadcast(broker.uid, "/chat", opts, "own", nil)
+	fc.sendMsg("socket.io.broadcast", own)
+	other, _ := envelope.EncodeBroadcast("other", "/", opts, "other namespace", nil)
+	fc.sendMsg("socket.io.broadcast", other)
+
+	request, _ := protocol.MarshalMsgpack(envelope.ServerSideRequest("other", "/chat", "ping", "data"))
+	fc.sendMsg("socket.io.request", request)
+	if b := local.next(t, local.serverSide); b.method != "ping" || b.args != "data" {
+		t.Fatalf("server-side event %+v", b)
+	}
+	if len(local.broadcasts) != 0 {
+		t.Fatalf("delivered %+v", <-local.broadcasts)
+	}
+
+	if err := a.Broadcast(opts, "message", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	local.next(t, local.broadcasts)
+	published, ok := envelope.DecodeBroadcast(fc.expectPub("socket.io.broadcast"))
+	if !ok || published.Uid != broker.uid || published.Namespace != "/chat" || published.Method != "message" ||
+		!reflect.DeepEqual(published.Opts, opts) {
+		t.Fatalf("published %+v", published)
+	}
+}
+
+func TestBrokerReconnect(t *testing.T) {
+	s := newFakeServer(t)
+	broker := NewBroker(s.addr())
+	defer broker.Close()
+	local := newFakeLocal()
+	broker.NewAdapter("/", local)
+
+	opts := &gosocketio.BroadcastOptions{}
+	payload, _ := envelope.EncodeBroadcast("other", "/", opts, "message", nil)
+
+	fc := s.accept()
+	fc.acceptBroker()
+	fc.sendMsg("socket.io.broadcast", payload)
+	local.next(t, local.broadcasts)
+
+	//broker dials again after reconnect delay and subscribes again
+	fc.conn.Close()
+	fc = s.accept()
+	fc.acceptBroker()
+	fc.sendMsg("socket.io.broadcast", payload)
+	if b := local.next(t, local.broadcasts); b.method != "message" {
+		t.Fatalf("delivered %+v", b)
+	}
+
+	broker.Close()
+	if _, err := broker.connection(); err != ErrorBrokerClosed {
+		t.Fatalf("got %v, want %v", err, ErrorBrokerClosed)
+	}
+}
@@ -0,0 +1,210 @@
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorWrongReply    = errors.New("Wrong nats reply")
+	ErrorTLSRequired   = errors.New("Nats server requires tls")
+	ErrorPayloadTooBig = errors.New("Payload exceeds nats max_payload")
+)
+
+/**
+Error sent by nats server with -ERR
+*/
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return "nats: " + e.Message
+}
+
+/**
+Credentials and name sent with CONNECT
+*/
+type connectOptions struct {
+	User     string `json:"user,omitempty"`
+	Password string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+	Name     string `json:"name,omitempty"`
+
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+}
+
+/**
+Connection speaking nats client protocol, just enough of it
+for publish and subscribe
+*/
+type natsConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	timeout    time.Duration
+	maxPayload int
+
+	writeLock sync.Mutex
+	done      chan struct{} //closed when read loop is over
+}
+
+func dialNats(addr string, opts connectOptions, timeout time.Duration) (*natsConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &natsConn{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: timeout,
+		done:    make(chan struct{}),
+	}
+	if err := c.handshake(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+/**
+Read INFO, send CONNECT and wait for PONG of the following PING,
+server answers with -ERR if it refuses credentials
+*/
+func (c *natsConn) handshake(opts connectOptions) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	line, err := c.line()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return ErrorWrongReply
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+		MaxPayload  int  `json:"max_payload"`
+	}
+	if err := json.Unmarshal([]byte(line[5:]), &info); err != nil {
+		return ErrorWrongReply
+	}
+	if info.TLSRequired {
+		return ErrorTLSRequired
+	}
+	c.maxPayload = info.MaxPayload
+
+	opts.Lang = "go"
+	opts.Version = "1.0"
+	opts.Protocol = 1
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	if err := c.write("CONNECT " + string(data) + "\r\nPING\r\n"); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.line()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return serverError(line)
+		}
+	}
+}
+
+func (c *natsConn) write(data string) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := io.WriteString(c.conn, data)
+	return err
+}
+
+func (c *natsConn) subscribe(subject string, sid int) error {
+	return c.write("SUB " + subject + " " + strconv.Itoa(sid) + "\r\n")
+}
+
+func (c *natsConn) publish(subject string, payload []byte) error {
+	if c.maxPayload > 0 && len(payload) > c.maxPayload {
+		return ErrorPayloadTooBig
+	}
+	return c.write("PUB " + subject + " " + strconv.Itoa(len(payload)) + "\r\n" + string(payload) + "\r\n")
+}
+
+/**
+Read messages and pass them to deliver until connection breaks,
+pings of server are answered
+*/
+func (c *natsConn) readLoop(deliver func(subject string, payload []byte)) error {
+	defer close(c.done)
+
+	for {
+		line, err := c.line()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			//MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				return ErrorWrongReply
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || size < 0 {
+				return ErrorWrongReply
+			}
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(c.reader, buf); err != nil {
+				return err
+			}
+			deliver(fields[1], buf[:size])
+		case line == "PING":
+			if err := c.write("PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return serverError(line)
+		}
+	}
+}
+
+/**
+Read line without trailing crlf
+*/
+func (c *natsConn) line() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *natsConn) Close() error {
+	return c.conn.Close()
+}
+
+func serverError(line string) error {
+	message := strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))
+	return &ServerError{Message: strings.Trim(message, "'")}
+}
@@ -0,0 +1,272 @@
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+Nats server accepting connections, test drives
+the protocol of every accepted connection
+*/
+type fakeServer struct {
+	listener net.Listener
+	conns    chan *fakeConn
+}
+
+type fakeConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	t      *testing.T
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: listener, conns: make(chan *fakeConn, 4)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			s.conns <- &fakeConn{conn: conn, reader: bufio.NewReader(conn), t: t}
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) accept() *fakeConn {
+	select {
+	case fc := <-s.conns:
+		return fc
+	case <-time.After(5 * time.Second):
+		panic("no connection accepted")
+	}
+}
+
+func (fc *fakeConn) send(data string) {
+	if _, err := io.WriteString(fc.conn, data); err != nil {
+		fc.t.Error(err)
+	}
+}
+
+/**
+Read line, it must start with prefix. Server side may run
+in its own goroutine, so failures are reported with Errorf
+*/
+func (fc *fakeConn) expect(prefix string) string {
+	line, err := fc.reader.ReadString('\n')
+	if err != nil {
+		fc.t.Errorf("reading %q: %v", prefix, err)
+		return ""
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, prefix) {
+		fc.t.Errorf("got %q, want %q", line, prefix)
+		return ""
+	}
+	return line
+}
+
+/**
+Read PUB command with its payload
+*/
+func (fc *fakeConn) expectPub(subject string) []byte {
+	fields := strings.Fields(fc.expect("PUB " + subject + " "))
+	if len(fields) == 0 {
+		return nil
+	}
+	size, _ := strconv.Atoi(fields[len(fields)-1])
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(fc.reader, payload); err != nil {
+		fc.t.Error(err)
+		return nil
+	}
+	return payload[:size]
+}
+
+/**
+Answer handshake of client, CONNECT options are returned
+*/
+func (fc *fakeConn) handshake(info string) connectOptions {
+	fc.send("INFO " + info + "\r\n")
+	line := strings.TrimPrefix(fc.expect("CONNECT "), "CONNECT ")
+	var opts connectOptions
+	if err := json.Unmarshal([]byte(line), &opts); err != nil {
+		fc.t.Error(err)
+	}
+	fc.expect("PING")
+	fc.send("PONG\r\n")
+	return opts
+}
+
+/**
+Dial fake server, server side of handshake is passed to serve
+*/
+func dialFake(t *testing.T, s *fakeServer, opts connectOptions, serve func(fc *fakeConn)) (*natsConn, *fakeConn, error) {
+	served := make(chan *fakeConn, 1)
+	go func() {
+		fc := s.accept()
+		serve(fc)
+		served <- fc
+	}()
+	c, err := dialNats(s.addr(), opts, time.Second)
+	fc := <-served
+	if c != nil {
+		t.Cleanup(func() { c.Close() })
+	}
+	return c, fc, err
+}
+
+func TestHandshake(t *testing.T) {
+	s := newFakeServer(t)
+	var got connectOptions
+	c, _, err := dialFake(t, s, connectOptions{User: "user", Password: "pass", Name: "test"}, func(fc *fakeConn) {
+		got = fc.handshake(`{"server_id":"test","max_payload":1024}`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.User != "user" || got.Password != "pass" || got.Name != "test" || got.Protocol != 1 || got.Verbose {
+		t.Fatalf("connect options %+v", got)
+	}
+	if c.maxPayload != 1024 {
+		t.Fatalf("max payload %d", c.maxPayload)
+	}
+}
+
+func TestHandshakeRefused(t *testing.T) {
+	tests := []struct {
+		name  string
+		serve func(fc *fakeConn)
+		err   string
+	}{
+		{"tls required", func(fc *fakeConn) {
+			fc.send(`INFO {"tls_required":true}` + "\r\n")
+		}, ErrorTLSRequired.Error()},
+		{"not info", func(fc *fakeConn) {
+			fc.send("+OK\r\n")
+		}, ErrorWrongReply.Error()},
+		{"wrong info", func(fc *fakeConn) {
+			fc.send("INFO {\r\n")
+		}, ErrorWrongReply.Error()},
+		{"credentials", func(fc *fakeConn) {
+			fc.send("INFO {}\r\n")
+			fc.expect("CONNECT ")
+			fc.expect("PING")
+			fc.send("-ERR 'Authorization Violation'\r\n")
+		}, "nats: Authorization Violation"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newFakeServer(t)
+			_, _, err := dialFake(t, s, connectOptions{}, test.serve)
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	s := newFakeServer(t)
+	c, fc, err := dialFake(t, s, connectOptions{}, func(fc *fakeConn) {
+		fc.handshake(`{"max_payload":8}`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.subscribe("test.subject", 3); err != nil {
+		t.Fatal(err)
+	}
+	fc.expect("SUB test.subject 3")
+
+	if err := c.publish("test.subject", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if payload := fc.expectPub("test.subject"); string(payload) != "hello" {
+		t.Fatalf("published %q", payload)
+	}
+	if err := c.publish("test.subject", []byte("too long payload")); err != ErrorPayloadTooBig {
+		t.Fatalf("got %v, want %v", err, ErrorPayloadTooBig)
+	}
+}
+
+func TestReadLoop(t *testing.T) {
+	s := newFakeServer(t)
+	c, fc, err := dialFake(t, s, connectOptions{}, func(fc *fakeConn) {
+		fc.handshake(`{}`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type message struct {
+		subject, payload string
+	}
+	got := make(chan message, 4)
+	result := make(chan error, 1)
+	go func() {
+		result <- c.readLoop(func(subject string, payload []byte) {
+			got <- message{subject, string(payload)}
+		})
+	}()
+
+	fc.send("MSG a.b 1 5\r\nhello\r\n")
+	fc.send("MSG a.c 2 reply.to 4\r\nx\r\ny\r\n")
+	fc.send("MSG a.d 1 0\r\n\r\n")
+	for _, want := range []message{{"a.b", "hello"}, {"a.c", "x\r\ny"}, {"a.d", ""}} {
+		if m := <-got; m != want {
+			t.Fatalf("got %+v, want %+v", m, want)
+		}
+	}
+
+	fc.send("PING\r\n")
+	fc.expect("PONG")
+
+	fc.send("-ERR 'Stale Connection'\r\n")
+	select {
+	case err := <-result:
+		if err == nil || err.Error() != "nats: Stale Connection" {
+			t.Fatalf("read loop ended with %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read loop was not ended by -ERR")
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("done is not closed")
+	}
+}
+
+func TestReadLoopWrongMessage(t *testing.T) {
+	s := newFakeServer(t)
+	c, fc, err := dialFake(t, s, connectOptions{}, func(fc *fakeConn) {
+		fc.handshake(`{}`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc.send("MSG a.b 1 -1\r\n")
+	if err := c.readLoop(func(string, []byte) {}); err != ErrorWrongReply {
+		t.Fatalf("got %v, want %v", err, ErrorWrongReply)
+	}
+}
@@ -0,0 +1,138 @@
+package gosocketio
+
+import (
+	"time"
+)
+
+/**
+Emits of ReconnectingClient kept while it is reconnecting, sent in
+the same order once it is connected again, before OnReconnect
+*/
+type OfflineConfig struct {
+	//emits kept, 0 disables buffering
+	Size int
+	//OverflowDropOldest drops the oldest buffered emit for new one,
+	//with any other policy new emit fails with ErrorSocketOverflood
+	Overflow OverflowPolicy
+	//emits buffered longer are dropped instead of sent, 0 keeps them
+	MaxAge time.Duration
+}
+
+type offlineEmit struct {
+	method string
+	args   interface{}
+	at     time.Time
+}
+
+/**
+Check if emit has to be buffered, true while reconnecting and until
+buffer is flushed. Must be called under lock
+*/
+func (rc *ReconnectingClient) buffering() bool {
+	if rc.config.Offline.Size <= 0 || rc.closed || rc.failed {
+		return false
+	}
+	return rc.flushing || len(rc.offline) > 0 || !rc.channel.IsAlive()
+}
+
+/**
+Add emit to offline buffer, must be called under lock
+*/
+func (rc *ReconnectingClient) buffer(method string, args interface{}) error {
+	cfg := &rc.config.Offline
+	if len(rc.offline) >= cfg.Size {
+		if cfg.Overflow != OverflowDropOldest {
+			return ErrorSocketOverflood
+		}
+		rc.offline = rc.offline[1:]
+	}
+	rc.offline = append(rc.offline, offlineEmit{method: method, args: args, at: rc.clock().Now()})
+	return nil
+}
+
+/**
+Emit, or buffer it if client is reconnecting
+*/
+func (rc *ReconnectingClient) emitOrBuffer(method string, args interface{}) error {
+	rc.lock.Lock()
+	if rc.buffering() {
+		defer rc.lock.Unlock()
+		return rc.buffer(method, args)
+	}
+	c := rc.channel
+	rc.lock.Unlock()
+
+	err := c.Emit(method, args)
+	if err != ErrorSocketClosed {
+		return err
+	}
+
+	//connection is lost right now
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if !rc.buffering() {
+		return err
+	}
+	return rc.buffer(method, args)
+}
+
+/**
+Send buffered emits with new connection, in order. Emits made
+meanwhile are buffered after them, so order is kept
+*/
+func (rc *ReconnectingClient) flush(c *Channel) {
+	rc.lock.Lock()
+	rc.flushing = true
+	rc.lock.Unlock()
+
+	maxAge := rc.config.Offline.MaxAge
+	for {
+		rc.lock.Lock()
+		if len(rc.offline) == 0 || rc.channel != c {
+			rc.flushing = false
+			rc.lock.Unlock()
+			return
+		}
+		e := rc.offline[0]
+		rc.offline = rc.offline[1:]
+		rc.lock.Unlock()
+
+		if maxAge > 0 && rc.clock().Now().Sub(e.at) > maxAge {
+			continue
+		}
+
+		err := c.Emit(e.method, e.args)
+		if err == ErrorSocketClosed {
+			//lost again, next connection sends it
+			rc.lock.Lock()
+			rc.offline = append([]offlineEmit{e}, rc.offline...)
+			rc.flushing = false
+			rc.lock.Unlock()
+			return
+		}
+		if err != nil {
+			c.log().Warn("buffered emit failed", "event", e.method, "error", err)
+		}
+	}
+}
+
+/**
+Drop buffered emits of client which is not going to reconnect
+*/
+func (rc *ReconnectingClient) dropOffline() {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	rc.failed = true
+	rc.offline = nil
+}
+
+/**
+Get amount of emits waiting for reconnect
+*/
+func (rc *ReconnectingClient) Buffered() int {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	return len(rc.offline)
+}
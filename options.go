@@ -0,0 +1,178 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/transport"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//path of socket.io endpoint, used by clients by default
+	DefaultPath = "/socket.io/"
+)
+
+/**
+engine.io parameters of server connections, they are advertised
+to clients in open packet and used by server itself.
+Start from GetDefaultServerOptions, zero value disables upgrades
+*/
+type ServerOptions struct {
+	//how often server pings EIO=4 clients and EIO=3 clients ping server,
+	//transport PingParams if 0
+	PingInterval time.Duration
+	//how long to wait for pong, transport PingParams if 0
+	PingTimeout time.Duration
+	//max size of incoming message or polling payload in bytes,
+	//enforced by connections which support it; transport limits if 0
+	MaxHttpBufferSize int64
+	//max size of socket.io message with its attachments, checked while
+	//they arrive; MaxHttpBufferSize if 0
+	MaxMessageSize int64
+	//offer upgrade of polling sessions to websocket and accept it
+	AllowUpgrades bool
+	//path server is mounted to by Mount and router adapters, requests
+	//to other paths get 404. Empty serves any path, DefaultPath is mounted
+	Path string
+	//how long Ack with timeout 0 and EmitWithAck with ctx without
+	//deadline wait for response, no limit if 0
+	AckTimeout time.Duration
+	//limit of open connections, handshakes over it are refused
+	//with 503 or by Server.ConnectionLimitHandler; no limit if 0
+	MaxConnections int
+	//vary ping interval of EIO=4 connections by their latency, between
+	//MinPingInterval and MaxPingInterval, see adaptivePingInterval
+	AdaptivePing bool
+	//shortest adaptive ping interval, used on slow links; ping interval
+	//if 0 or bigger than MaxPingInterval
+	MinPingInterval time.Duration
+	//longest adaptive ping interval, used on fast links and advertised
+	//to clients so they wait that long for pings; ping interval if 0
+	MaxPingInterval time.Duration
+}
+
+/**
+Options with upgrades allowed, ping params and limits of transport
+*/
+func GetDefaultServerOptions() ServerOptions {
+	return ServerOptions{
+		AllowUpgrades: true,
+	}
+}
+
+/**
+Ping params of connection, options override transport ones
+*/
+func (o *ServerOptions) pingParams(conn transport.Connection) (interval, timeout time.Duration) {
+	interval, timeout = conn.PingParams()
+	if o.PingInterval > 0 {
+		interval = o.PingInterval
+	}
+	if o.AdaptivePing && o.MaxPingInterval > 0 {
+		interval = o.MaxPingInterval
+	}
+	if o.PingTimeout > 0 {
+		timeout = o.PingTimeout
+	}
+	return interval, timeout
+}
+
+/**
+Build engine.io header of new connection and apply read limit to it
+*/
+func (s *Server) newHeader(conn transport.Connection, version int, remoteAddr string) Header {
+	interval, timeout := s.Options.pingParams(conn)
+	hdr := Header{
+		Sid:          generateNewId(remoteAddr),
+		Upgrades:     []string{},
+		PingInterval: int(interval / time.Millisecond),
+		PingTimeout:  int(timeout / time.Millisecond),
+	}
+	if sc, ok := conn.(transport.SessionConnection); ok {
+		hdr.Sid = sc.Sid()
+		if s.Options.AllowUpgrades {
+			hdr.Upgrades = sc.Upgrades()
+		}
+	}
+
+	limit := s.Options.MaxHttpBufferSize
+	if lc, ok := conn.(transport.LimitConnection); ok && limit > 0 {
+		lc.SetReadLimit(limit)
+	}
+	if version == ProtocolVersion4 {
+		hdr.MaxPayload = defaultMaxPayload
+		if limit > 0 {
+			hdr.MaxPayload = int(limit)
+		}
+	}
+	return hdr
+}
+
+/**
+Get path server is mounted to
+*/
+func (o *ServerOptions) path() string {
+	if o.Path == "" {
+		return DefaultPath
+	}
+	if !strings.HasSuffix(o.Path, "/") {
+		return o.Path + "/"
+	}
+	return o.Path
+}
+
+/**
+Check if request path is served, any path is if Path is not set
+*/
+func (o *ServerOptions) servesPath(r *http.Request) bool {
+	if o.Path == "" {
+		return true
+	}
+	path := o.path()
+	return strings.HasPrefix(r.URL.Path, path) || r.URL.Path == strings.TrimSuffix(path, "/")
+}
+
+/**
+Get max size of incoming socket.io message, 0 if there is no limit
+*/
+func (o *ServerOptions) messageLimit() int64 {
+	if o.MaxMessageSize > 0 {
+		return o.MaxMessageSize
+	}
+	return o.MaxHttpBufferSize
+}
+
+/**
+Check if request is websocket upgrade of polling session
+*/
+func isUpgradeRequest(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Get("sid") != "" && query.Get("transport") == "websocket"
+}
+
+/**
+Ping interval of the channel, server one is negotiated in header
+and shortened by latency with adaptive ping
+*/
+func (c *Channel) pingInterval() time.Duration {
+	if c.server != nil && c.header.PingInterval > 0 {
+		interval := time.Duration(c.header.PingInterval) * time.Millisecond
+		if c.server.Options.AdaptivePing {
+			return c.server.Options.adaptivePingInterval(interval, c.Latency())
+		}
+		return interval
+	}
+	interval, _ := c.conn.PingParams()
+	return interval
+}
+
+/**
+How long to wait for pong, server one is negotiated in header
+*/
+func (c *Channel) pingTimeout() time.Duration {
+	if c.server != nil && c.header.PingTimeout > 0 {
+		return time.Duration(c.header.PingTimeout) * time.Millisecond
+	}
+	_, timeout := c.conn.PingParams()
+	return timeout
+}
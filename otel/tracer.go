@@ -0,0 +1,81 @@
+package otel
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	//instrumentation name of created tracer
+	TracerName = "github.com/graarh/golang-socketio"
+)
+
+/**
+OpenTelemetry tracer of socket.io events, to be set as TraceConfig.Tracer:
+
+	server.Trace = gosocketio.TraceConfig{
+		Tracer:    otel.NewTracer(provider),
+		Propagate: true,
+	}
+
+Received events are consumer spans, sent ones are producer spans,
+trace context is passed in W3C trace context format
+*/
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+/**
+Create tracer with spans of given provider
+*/
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	return &Tracer{
+		tracer:     provider.Tracer(TracerName),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+func attributes(c *gosocketio.Channel, event string) trace.SpanStartEventOption {
+	return trace.WithAttributes(
+		attribute.String("socketio.event", event),
+		attribute.String("socketio.sid", c.Id()),
+		attribute.String("socketio.namespace", c.Namespace()),
+	)
+}
+
+/**
+Implements gosocketio.Tracer
+*/
+func (t *Tracer) StartEvent(ctx context.Context, c *gosocketio.Channel, event string,
+	carrier map[string]string) (context.Context, func()) {
+
+	ctx = t.propagator.Extract(ctx, propagation.MapCarrier(carrier))
+	ctx, span := t.tracer.Start(ctx, event,
+		trace.WithSpanKind(trace.SpanKindConsumer), attributes(c, event))
+
+	return ctx, func() { span.End() }
+}
+
+/**
+Implements gosocketio.Tracer
+*/
+func (t *Tracer) StartEmit(ctx context.Context, c *gosocketio.Channel, event string,
+	carrier map[string]string) func(err error) {
+
+	ctx, span := t.tracer.Start(ctx, "emit "+event,
+		trace.WithSpanKind(trace.SpanKindProducer), attributes(c, event))
+	t.propagator.Inject(ctx, propagation.MapCarrier(carrier))
+
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,87 @@
+package gosocketio
+
+import (
+	"fmt"
+	"github.com/graarh/golang-socketio/protocol"
+	"runtime/debug"
+)
+
+/**
+What to do with channel whose event handler panicked
+*/
+type PanicPolicy int
+
+const (
+	//send disconnect and close the channel, namespace socket leaves
+	PanicClose PanicPolicy = iota
+	//keep channel alive, only failed handler call is lost
+	PanicKeep
+)
+
+/**
+Panic recovered from event handler, with the stack of it
+*/
+type PanicError struct {
+	Event string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %q handler: %v", e.Event, e.Value)
+}
+
+/**
+Get panic value if it is error, like runtime errors
+*/
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+/**
+Recover from panic of event handler, must be deferred by caller
+of the handler. Panic is logged, given to OnPanic and OnError
+handlers, then channel is closed depending on PanicPolicy
+*/
+func (m *methods) recoverHandler(c *Channel, event, packet string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	err := &PanicError{Event: event, Value: r, Stack: debug.Stack()}
+	c.log().Error("handler panic", "sid", c.Id(), "event", event, "panic", r,
+		"stack", string(err.Stack))
+
+	if m.OnPanic != nil {
+		m.OnPanic(c, err)
+	}
+	//panic of error handler itself is not reported to it again
+	if event != OnError {
+		m.fireError(c, KindHandler, packet, err)
+	}
+
+	//channel is closed already when disconnection handlers are called
+	if m.HandlerPanicPolicy == PanicClose && event != OnDisconnection {
+		c.closeOnPanic(m, err)
+	}
+}
+
+/**
+Close channel after handler panic, peer gets disconnect packet
+*/
+func (c *Channel) closeOnPanic(m *methods, err *PanicError) {
+	if c.nsp == nil && c.clientSocket == nil {
+		c.aliveLock.Lock()
+		if c.alive {
+			c.closeErr = err
+			c.closeReason = DisconnectHandlerPanic
+		}
+		c.aliveLock.Unlock()
+	}
+
+	//queued packets and disconnect are written before connection is closed
+	send(&protocol.Message{Type: protocol.MessageTypeDisconnect}, c, nil)
+	closeChannel(c, m)
+}
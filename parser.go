@@ -0,0 +1,66 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Get socket.io packet parser of channel, json one if none is set
+*/
+func (c *Channel) packetParser() protocol.Parser {
+	if c.parser == nil {
+		return protocol.JsonParser{}
+	}
+	return c.parser
+}
+
+/**
+Encode packet made here, it can't fail with valid arguments
+*/
+func (c *Channel) mustEncode(msg *protocol.Message) []string {
+	commands, err := c.packetParser().Encode(msg)
+	if err != nil {
+		panic(err)
+	}
+	return commands
+}
+
+/**
+Check if sent arguments go to parser as values, without json. Only
+with default codec, custom one is used to encode them otherwise
+*/
+func (c *Channel) encodesValues() bool {
+	parser, ok := c.packetParser().(protocol.ValuesParser)
+	return ok && c.codec == nil && parser.EncodesValues()
+}
+
+/**
+Add argument to the end of packet arguments, to its values if it has them
+*/
+func appendArg(msg *protocol.Message, value interface{}) {
+	if msg.Values != nil {
+		msg.Values = append(msg.Values, value)
+		return
+	}
+
+	arg, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	if msg.Args == "" {
+		msg.Args = string(arg)
+	} else {
+		msg.Args += "," + string(arg)
+	}
+}
+
+/**
+Remove last argument from values of received packet, after
+it was removed from json arguments
+*/
+func dropLastValue(msg *protocol.Message) {
+	if len(msg.Values) > 0 {
+		msg.Values = msg.Values[:len(msg.Values)-1]
+	}
+}
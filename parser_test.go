@@ -0,0 +1,64 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"github.com/graarh/golang-socketio/protocol"
+	"strings"
+	"testing"
+	"time"
+)
+
+type upload struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+	Size int64  `json:"size"`
+}
+
+func TestMsgpackEmitValues(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.Parser = protocol.MsgpackParser{}
+
+	got := make(chan upload, 1)
+	s.On("upload", func(c *Channel, u upload) {
+		got <- u
+	})
+
+	c, _ := dialTestConfig(t, s, tr, gosocketiotest.Url, ClientConfig{Parser: protocol.MsgpackParser{}})
+	sent := map[string]interface{}{"name": "a.bin", "data": []byte{1, 2, 3}, "size": int64(1) << 40}
+	if err := c.Emit("upload", sent); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case u := <-got:
+		if u.Name != "a.bin" || string(u.Data) != "\x01\x02\x03" || u.Size != 1<<40 {
+			t.Fatalf("got %+v", u)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+
+	//bin value is inside the packet, no attachments follow
+	for _, packet := range tr.Last().Client.Written() {
+		if !strings.HasPrefix(packet, "b4") && packet != protocol.PongMessage && packet != protocol.PingMessage {
+			t.Fatalf("unexpected packet %q", packet)
+		}
+	}
+}
+
+func TestMsgpackEmitMarshalFailed(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.Parser = protocol.MsgpackParser{}
+
+	c, _ := dialTestConfig(t, s, tr, gosocketiotest.Url, ClientConfig{Parser: protocol.MsgpackParser{}})
+	err := c.Emit("bad", map[string]interface{}{"ch": make(chan int)})
+	if !errors.Is(err, ErrorMarshalFailed) {
+		t.Fatalf("got %v, want ErrorMarshalFailed", err)
+	}
+	if !c.IsAlive() {
+		t.Fatal("channel closed after marshal failure")
+	}
+}
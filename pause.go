@@ -0,0 +1,126 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+const (
+	DefaultPauseBufferSize = 1000
+)
+
+var (
+	ErrorPaused          = errors.New("Broadcasts paused")
+	ErrorPauseBufferFull = errors.New("Pause buffer is full")
+)
+
+/**
+What happens to messages sent while broadcasts are paused
+*/
+type PausePolicy int
+
+const (
+	/**
+	Messages are dropped, direct emits return ErrorPaused
+	*/
+	PauseDrop PausePolicy = iota
+	/**
+	Messages are kept, up to PauseBufferSize, and sent in original
+	order on resume. Messages over the limit are dropped, direct
+	emits return ErrorPauseBufferFull then
+	*/
+	PauseBuffer
+)
+
+/**
+Stop all broadcasts until ResumeBroadcasts, connections stay alive.
+With PauseDirectEmits, emits to single channels are paused too
+*/
+func (s *Server) PauseBroadcasts() {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+
+	s.paused = true
+	//replay in progress stops after its current part
+	s.resuming = false
+}
+
+/**
+Resume broadcasts, messages buffered while paused are sent first.
+Messages sent meanwhile are buffered after them, so nothing overtakes
+the replay; pause is over when the buffer is empty
+*/
+func (s *Server) ResumeBroadcasts() {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+
+	if !s.paused || s.resuming {
+		return
+	}
+	s.resuming = true
+	for s.resuming && len(s.pausedMessages) > 0 {
+		held := s.pausedMessages
+		s.pausedMessages = nil
+		s.pauseLock.Unlock()
+
+		for _, f := range held {
+			f()
+		}
+		s.pauseLock.Lock()
+	}
+	if s.resuming {
+		s.paused = false
+		s.resuming = false
+	}
+}
+
+/**
+Check if broadcasts are paused
+*/
+func (s *Server) BroadcastsPaused() bool {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+
+	return s.paused
+}
+
+/**
+If broadcasts are paused, drop or buffer given send function
+according to PausePolicy, and return true
+*/
+func (s *Server) holdMessage(send func()) (bool, error) {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+
+	if !s.paused {
+		return false, nil
+	}
+
+	if s.PausePolicy != PauseBuffer {
+		return true, ErrorPaused
+	}
+
+	size := s.PauseBufferSize
+	if size <= 0 {
+		size = DefaultPauseBufferSize
+	}
+	if len(s.pausedMessages) >= size {
+		return true, ErrorPauseBufferFull
+	}
+
+	s.pausedMessages = append(s.pausedMessages, send)
+	return true, nil
+}
+
+/**
+Hold packet sent to single channel, if server pauses direct emits.
+Disconnect packets are not held, their channel is closed anyway.
+Replayed packets are marked resumed and pass
+*/
+func (c *Channel) holdDirect(msg *protocol.Message, opts sendOptions, send func()) (bool, error) {
+	if c.server == nil || !c.server.PauseDirectEmits || opts.resumed ||
+		msg.Type == protocol.MessageTypeDisconnect {
+		return false, nil
+	}
+	return c.server.holdMessage(send)
+}
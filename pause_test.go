@@ -0,0 +1,180 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+Event packets written by server end of the last connection
+*/
+func writtenEvents(tr *gosocketiotest.Transport) []string {
+	var events []string
+	for _, packet := range tr.Last().Server.Written() {
+		if strings.HasPrefix(packet, "42") {
+			events = append(events, packet)
+		}
+	}
+	return events
+}
+
+func waitHeld(t *testing.T, s *Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.pauseLock.Lock()
+		held := len(s.pausedMessages)
+		s.pauseLock.Unlock()
+		if held == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d messages held, want %d", held, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPauseDirectEmits(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.PausePolicy = PauseBuffer
+	s.PauseDirectEmits = true
+	c, sc := dialTest(t, s, tr, gosocketiotest.Url)
+	c.On("third", func(c *Channel, n int) int {
+		return n
+	})
+
+	s.PauseBroadcasts()
+	if err := sc.Emit("first", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.EmitSeq("second", 2); err != nil {
+		t.Fatal(err)
+	}
+	acked := make(chan string, 1)
+	go func() {
+		result, err := sc.Ack("third", 3, time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		acked <- result
+	}()
+	waitHeld(t, s, 3)
+	if events := writtenEvents(tr); len(events) != 0 {
+		t.Fatalf("written while paused %q", events)
+	}
+
+	s.ResumeBroadcasts()
+	if result := <-acked; result != "3" {
+		t.Fatalf("ack result %q", result)
+	}
+	events := writtenEvents(tr)
+	if len(events) != 3 || !strings.HasPrefix(events[0], `42["first"`) ||
+		!strings.HasPrefix(events[1], `42["second",{"seq":1`) || !strings.HasPrefix(events[2], `421["third"`) {
+		t.Fatalf("written after resume %q", events)
+	}
+	if s.BroadcastsPaused() {
+		t.Fatal("still paused")
+	}
+}
+
+func TestPauseDropDirectEmits(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.PauseDirectEmits = true
+	_, sc := dialTest(t, s, tr, gosocketiotest.Url)
+
+	s.PauseBroadcasts()
+	if err := sc.Emit("first", nil); err != ErrorPaused {
+		t.Fatalf("emit got %v", err)
+	}
+	if err := sc.EmitSeq("second", nil); err != ErrorPaused || sc.Seq() != 0 {
+		t.Fatalf("seq emit got %v, seq %d", err, sc.Seq())
+	}
+	if _, err := sc.Ack("third", nil, time.Second); err != ErrorPaused {
+		t.Fatalf("ack got %v", err)
+	}
+	if err := sc.EmitAndClose("bye", nil, time.Second); err != ErrorPaused || !sc.IsAlive() {
+		t.Fatalf("emit and close got %v, alive %v", err, sc.IsAlive())
+	}
+	s.ResumeBroadcasts()
+	if events := writtenEvents(tr); len(events) != 0 {
+		t.Fatalf("dropped messages written %q", events)
+	}
+}
+
+/**
+EmitAndClose is held as a whole, channel is closed after replay
+*/
+func TestPauseEmitAndClose(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.PausePolicy = PauseBuffer
+	s.PauseDirectEmits = true
+	_, sc := dialTest(t, s, tr, gosocketiotest.Url)
+
+	s.PauseBroadcasts()
+	if err := sc.EmitAndClose("bye", nil, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !sc.IsAlive() {
+		t.Fatal("closed while paused")
+	}
+
+	s.ResumeBroadcasts()
+	if _, ok := tr.Last().Server.WaitWritten(`42["bye"]`, time.Second); !ok {
+		t.Fatalf("written %q", tr.Last().Server.Written())
+	}
+	select {
+	case <-sc.done:
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed after replay")
+	}
+}
+
+/**
+Messages sent while buffered ones are replayed are sent after them
+*/
+func TestResumeOrder(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.PausePolicy = PauseBuffer
+	s.PauseDirectEmits = true
+	_, sc := dialTest(t, s, tr, gosocketiotest.Url)
+
+	//filter runs when the broadcast is replayed
+	s.BroadcastFilter = func(c *Channel, event string, data interface{}) (interface{}, bool) {
+		if event == "old" {
+			if err := c.Emit("new", nil); err != nil {
+				t.Error(err)
+			}
+		}
+		return data, true
+	}
+
+	s.PauseBroadcasts()
+	s.BroadcastToAll("old", 1)
+	sc.Emit("old", 2)
+	for i := 3; i <= 5; i++ {
+		s.BroadcastToAll("old", i)
+	}
+	waitHeld(t, s, 5)
+
+	s.ResumeBroadcasts()
+	if s.BroadcastsPaused() {
+		t.Fatal("still paused")
+	}
+	want := []string{`42["old",1]`, `42["old",2]`, `42["old",3]`, `42["old",4]`, `42["old",5]`,
+		`42["new"]`, `42["new"]`, `42["new"]`, `42["new"]`}
+	deadline := time.Now().Add(time.Second)
+	for len(writtenEvents(tr)) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	events := writtenEvents(tr)
+	if strings.Join(events, " ") != strings.Join(want, " ") {
+		t.Fatalf("written %q, want %q", events, want)
+	}
+}
@@ -0,0 +1,146 @@
+package gosocketio
+
+const (
+	//events broadcast to room when present channel joins or leaves it,
+	//with PresenceMember as argument
+	PresenceJoinEvent  = "presence:join"
+	PresenceLeaveEvent = "presence:leave"
+)
+
+/**
+Channel present in room, with metadata given to SetPresence
+*/
+type PresenceMember struct {
+	Id   string      `json:"id"`
+	Meta interface{} `json:"meta,omitempty"`
+}
+
+/**
+Adapter keeping presence of all instances, so Presence returns members
+connected to any of them. Without it presence is known only locally
+*/
+type PresenceAdapter interface {
+	AddPresence(c *Channel, room string, meta interface{}) error
+	RemovePresence(c *Channel, room string) error
+	Presence(room string) ([]PresenceMember, error)
+}
+
+/**
+Mark channel as present in its rooms with given metadata, like user
+name. Rooms get PresenceJoinEvent now and for every room joined later,
+until channel leaves or ClearPresence is called. Calling it again
+updates metadata, join event is sent again with it
+*/
+func (c *Channel) SetPresence(meta interface{}) error {
+	if c.server == nil {
+		return ErrorServerNotSet
+	}
+
+	r := c.registry()
+	r.channelsLock.Lock()
+	if !c.IsAlive() {
+		r.channelsLock.Unlock()
+		return ErrorSocketClosed
+	}
+	if r.presence == nil {
+		r.presence = make(map[*Channel]interface{})
+	}
+	r.presence[c] = meta
+	r.channelsLock.Unlock()
+
+	for _, room := range c.Rooms() {
+		r.presenceJoined(c, room, meta)
+	}
+	return nil
+}
+
+/**
+Remove presence of channel, rooms get PresenceLeaveEvent
+*/
+func (c *Channel) ClearPresence() error {
+	if c.server == nil {
+		return ErrorServerNotSet
+	}
+
+	r := c.registry()
+	if _, ok := r.channelPresence(c); !ok {
+		return nil
+	}
+	for _, room := range c.Rooms() {
+		r.presenceLeft(c, room)
+	}
+
+	r.channelsLock.Lock()
+	delete(r.presence, c)
+	r.channelsLock.Unlock()
+	return nil
+}
+
+/**
+Get members of room which set presence, of all instances if adapter
+is PresenceAdapter, otherwise of this one
+*/
+func (r *registry) Presence(room string) ([]PresenceMember, error) {
+	if pa, ok := r.adapter().(PresenceAdapter); ok {
+		return pa.Presence(room)
+	}
+
+	r.channelsLock.RLock()
+	defer r.channelsLock.RUnlock()
+
+	members := make([]PresenceMember, 0, len(r.channels[room]))
+	for c := range r.channels[room] {
+		if meta, ok := r.presence[c]; ok {
+			members = append(members, PresenceMember{Id: c.Id(), Meta: meta})
+		}
+	}
+	return members, nil
+}
+
+func (r *registry) channelPresence(c *Channel) (meta interface{}, ok bool) {
+	r.channelsLock.RLock()
+	defer r.channelsLock.RUnlock()
+
+	meta, ok = r.presence[c]
+	return meta, ok
+}
+
+/**
+Get presence metadata of channel and whether it is joined to room
+*/
+func (r *registry) presenceInRoom(c *Channel, room string) (meta interface{}, present, joined bool) {
+	r.channelsLock.RLock()
+	defer r.channelsLock.RUnlock()
+
+	meta, present = r.presence[c]
+	_, joined = r.rooms[c][room]
+	return meta, present, joined
+}
+
+/**
+Tell room and adapter that present channel joined it
+*/
+func (r *registry) presenceJoined(c *Channel, room string, meta interface{}) {
+	a := r.adapter()
+	if pa, ok := a.(PresenceAdapter); ok {
+		if err := pa.AddPresence(c, room, meta); err != nil {
+			c.log().Warn("presence not stored", "sid", c.Id(), "room", room, "error", err)
+		}
+	}
+	a.Broadcast(&BroadcastOptions{Rooms: []string{room}, Except: []string{c.Id()}},
+		PresenceJoinEvent, PresenceMember{Id: c.Id(), Meta: meta})
+}
+
+/**
+Tell room and adapter that present channel left it
+*/
+func (r *registry) presenceLeft(c *Channel, room string) {
+	a := r.adapter()
+	if pa, ok := a.(PresenceAdapter); ok {
+		if err := pa.RemovePresence(c, room); err != nil {
+			c.log().Warn("presence not removed", "sid", c.Id(), "room", room, "error", err)
+		}
+	}
+	a.Broadcast(&BroadcastOptions{Rooms: []string{room}, Except: []string{c.Id()}},
+		PresenceLeaveEvent, PresenceMember{Id: c.Id()})
+}
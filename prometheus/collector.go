@@ -0,0 +1,179 @@
+package prometheus
+
+import (
+	"github.com/graarh/golang-socketio"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+const (
+	//first part of metric names
+	metricPrefix = "socketio_"
+)
+
+/**
+Prometheus metrics of socket.io server. It is both prometheus.Collector
+and gosocketio.StatsHook, so it should be set as hook of the server
+and registered:
+
+	collector := prometheus.NewCollector(server)
+	server.StatsHook = collector
+	registry.MustRegister(collector)
+*/
+type Collector struct {
+	server *gosocketio.Server
+
+	connects     prometheus.Counter
+	disconnects  *prometheus.CounterVec
+	packetsIn    prometheus.Counter
+	packetsOut   prometheus.Counter
+	bytesIn      prometheus.Counter
+	bytesOut     prometheus.Counter
+	ackLatency   prometheus.Histogram
+	pingRTT      prometheus.Histogram
+	decodeErrors prometheus.Counter
+	overflows    prometheus.Counter
+
+	//read from server on each scrape
+	connections     *prometheus.Desc
+	overflooded     *prometheus.Desc
+	bufferedBytes   *prometheus.Desc
+	throttled       *prometheus.Desc
+	notAccepted     *prometheus.Desc
+	rejected        *prometheus.Desc
+	refused         *prometheus.Desc
+	unexpectedPongs *prometheus.Desc
+}
+
+/**
+Create collector of given server metrics
+*/
+func NewCollector(s *gosocketio.Server) *Collector {
+	counter := func(name, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{
+			Name: metricPrefix + name,
+			Help: help,
+		})
+	}
+	histogram := func(name, help string) prometheus.Histogram {
+		return prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    metricPrefix + name,
+			Help:    help,
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		})
+	}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(metricPrefix+name, help, nil, nil)
+	}
+
+	return &Collector{
+		server: s,
+
+		connects: counter("connects_total", "Accepted connections."),
+		disconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: metricPrefix + "disconnects_total",
+			Help: "Closed connections by reason.",
+		}, []string{"reason"}),
+		packetsIn:    counter("packets_received_total", "Packets received from connections."),
+		packetsOut:   counter("packets_sent_total", "Packets written to connections."),
+		bytesIn:      counter("received_bytes_total", "Bytes of packets received from connections."),
+		bytesOut:     counter("sent_bytes_total", "Bytes of packets written to connections."),
+		ackLatency:   histogram("ack_latency_seconds", "Time from ack request to response."),
+		pingRTT:      histogram("ping_rtt_seconds", "Time from ping to pong."),
+		decodeErrors: counter("decode_errors_total", "Received packets which can't be decoded."),
+		overflows:    counter("queue_overflows_total", "Packets not fitting into outgoing queue."),
+
+		connections:     desc("connections", "Open connections."),
+		overflooded:     desc("overflooded_channels", "Channels with outgoing queue more than half full."),
+		bufferedBytes:   desc("buffered_bytes", "Bytes queued for sending on all channels."),
+		throttled:       desc("throttled_handshakes_total", "Handshakes rejected by per ip rate limit."),
+		notAccepted:     desc("not_accepted_handshakes_total", "Handshakes rejected while server is not accepting."),
+		rejected:        desc("rejected_handshakes_total", "Handshakes rejected by middleware."),
+		refused:         desc("refused_handshakes_total", "Handshakes refused by connections limit."),
+		unexpectedPongs: desc("unexpected_pongs_total", "Pongs received without ping."),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.connects, c.disconnects, c.packetsIn, c.packetsOut, c.bytesIn, c.bytesOut,
+		c.ackLatency, c.pingRTT, c.decodeErrors, c.overflows,
+	}
+}
+
+/**
+Implements prometheus.Collector
+*/
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+	ch <- c.connections
+	ch <- c.overflooded
+	ch <- c.bufferedBytes
+	ch <- c.throttled
+	ch <- c.notAccepted
+	ch <- c.rejected
+	ch <- c.refused
+	ch <- c.unexpectedPongs
+}
+
+/**
+Implements prometheus.Collector
+*/
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+
+	stats := c.server.Stats()
+	gauge := func(desc *prometheus.Desc, value int64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(value))
+	}
+	counter := func(desc *prometheus.Desc, value int64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value))
+	}
+
+	gauge(c.connections, c.server.AmountOfConnections())
+	gauge(c.overflooded, gosocketio.AmountOfOverflooded())
+	gauge(c.bufferedBytes, stats.BufferedBytes)
+	counter(c.throttled, stats.ThrottledHandshakes)
+	counter(c.notAccepted, stats.NotAcceptedHandshakes)
+	counter(c.rejected, stats.RejectedHandshakes)
+	counter(c.refused, stats.RefusedHandshakes)
+	counter(c.unexpectedPongs, stats.UnexpectedPongs)
+}
+
+func (c *Collector) Connected(ch *gosocketio.Channel) {
+	c.connects.Inc()
+}
+
+func (c *Collector) Disconnected(ch *gosocketio.Channel, reason string) {
+	c.disconnects.WithLabelValues(reason).Inc()
+}
+
+func (c *Collector) PacketIn(ch *gosocketio.Channel, size int) {
+	c.packetsIn.Inc()
+	c.bytesIn.Add(float64(size))
+}
+
+func (c *Collector) PacketOut(ch *gosocketio.Channel, size int) {
+	c.packetsOut.Inc()
+	c.bytesOut.Add(float64(size))
+}
+
+func (c *Collector) AckLatency(ch *gosocketio.Channel, d time.Duration) {
+	c.ackLatency.Observe(d.Seconds())
+}
+
+func (c *Collector) PingRTT(ch *gosocketio.Channel, d time.Duration) {
+	c.pingRTT.Observe(d.Seconds())
+}
+
+func (c *Collector) DecodeError(ch *gosocketio.Channel) {
+	c.decodeErrors.Inc()
+}
+
+func (c *Collector) Overflow(ch *gosocketio.Channel) {
+	c.overflows.Inc()
+}
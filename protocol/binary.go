@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+/**
+Stands in json arguments for binary attachment with given index
+*/
+type Placeholder struct {
+	Placeholder bool `json:"_placeholder"`
+	Num         int  `json:"num"`
+}
+
+/**
+Replace attachment placeholders in json arguments with attachments
+encoded as json strings, so they can be unmarshalled to []byte
+*/
+func ReconstructArgs(args string, attachments [][]byte) (string, error) {
+	//arguments are comma separated list, parse them as array
+	decoder := json.NewDecoder(bytes.NewBufferString("[" + args + "]"))
+	decoder.UseNumber()
+
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return "", ErrorWrongPacket
+	}
+
+	var err error
+	for i := range values {
+		values[i], err = fillPlaceholders(values[i], attachments)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	result, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(result[1 : len(result)-1]), nil
+}
+
+func fillPlaceholders(value interface{}, attachments [][]byte) (interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		for i := range v {
+			filled, err := fillPlaceholders(v[i], attachments)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = filled
+		}
+
+	case map[string]interface{}:
+		if placeholder, _ := v["_placeholder"].(bool); placeholder {
+			num, ok := v["num"].(json.Number)
+			if !ok {
+				return nil, ErrorWrongPacket
+			}
+			index, err := num.Int64()
+			if err != nil || index < 0 || index >= int64(len(attachments)) {
+				return nil, ErrorWrongPacket
+			}
+			return attachments[index], nil
+		}
+
+		for key := range v {
+			filled, err := fillPlaceholders(v[key], attachments)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = filled
+		}
+	}
+
+	return value, nil
+}
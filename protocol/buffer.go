@@ -0,0 +1,100 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+)
+
+const (
+	//initial capacity of pooled buffers, fits most event packets
+	bufferSize = 512
+	//bigger buffers are not put back, so rare large packets don't pin memory
+	maxPooledBufferSize = 64 * 1024
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, bufferSize)
+		return &buf
+	},
+}
+
+/**
+Get empty buffer from the pool, give it back with putBuffer
+*/
+func getBuffer() *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+func putBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+/**
+Run append function on pooled buffer and get the result as string,
+the only allocation is the string itself
+*/
+func encodeString(encode func(dst []byte) ([]byte, error)) (string, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	result, err := encode(*buf)
+	*buf = result
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+/**
+Check if string is json encoded as is, like most of event names.
+json.Marshal escapes html characters too, so the same is done here
+*/
+func plainJsonString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x80 || c == '"' || c == '\\' ||
+			c == '<' || c == '>' || c == '&' {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+Append string as json string, same as json.Marshal would encode it
+*/
+func appendJsonString(dst []byte, s string) []byte {
+	if plainJsonString(s) {
+		dst = append(dst, '"')
+		dst = append(dst, s...)
+		return append(dst, '"')
+	}
+
+	encoded, _ := json.Marshal(s)
+	return append(dst, encoded...)
+}
+
+/**
+Append binary attachment in text form, attachmentPrefix and base64 data
+*/
+func AppendAttachment(dst []byte, data []byte) []byte {
+	start := len(dst) + len(attachmentPrefix)
+	size := start + base64.StdEncoding.EncodedLen(len(data))
+	if cap(dst) < size {
+		grown := make([]byte, len(dst), size)
+		copy(grown, dst)
+		dst = grown
+	}
+
+	dst = append(dst, attachmentPrefix...)
+	dst = dst[:size]
+	base64.StdEncoding.Encode(dst[start:], data)
+	return dst
+}
@@ -33,6 +33,19 @@ const (
 	ack response
 	*/
 	MessageTypeAckResponse = iota
+	/**
+	Disconnect, sent before closing connection
+	*/
+	MessageTypeDisconnect = iota
+	/**
+	Connect refused, EIO=4 only
+	*/
+	MessageTypeConnectError = iota
+	/**
+	Packet parser does not know, like engine.io noop,
+	Source has it. Only raw packet handlers get it
+	*/
+	MessageTypeRaw = iota
 )
 
 type Message struct {
@@ -41,5 +54,17 @@ type Message struct {
 	Method string
 	Args   string
 	Source string
+
+	//socket.io namespace, empty for default one
+	Namespace string
+
+	//arguments as values, for parsers encoding them without json;
+	//encoded instead of Args if set. Bin values are []byte in them
+	Values []interface{}
+
+	//binary attachments, placeholders in Args refer to them by index
+	Attachments [][]byte
+	//attachments announced by received binary packet
+	AttachmentCount int
 }
 
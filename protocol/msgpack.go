@@ -0,0 +1,357 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	//nesting of arrays and maps allowed in decoded data
+	maxMsgpackDepth = 1000
+)
+
+var (
+	ErrorWrongMsgpack       = errors.New("Wrong msgpack data")
+	ErrorMsgpackUnsupported = errors.New("Unsupported msgpack type")
+)
+
+/**
+Encode value to msgpack. Supported are nil, bool, numbers, strings,
+[]byte as bin, []interface{} and map[string]interface{}, other values are
+converted through json as if they were received from the wire
+*/
+func MarshalMsgpack(value interface{}) ([]byte, error) {
+	return appendMsgpack(nil, value)
+}
+
+func appendMsgpack(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if v {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case int:
+		return appendMsgpackInt(buf, int64(v)), nil
+	case int32:
+		return appendMsgpackInt(buf, int64(v)), nil
+	case int64:
+		return appendMsgpackInt(buf, v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			buf = append(buf, 0xcf)
+			return binary.BigEndian.AppendUint64(buf, v), nil
+		}
+		return appendMsgpackInt(buf, int64(v)), nil
+	case float32:
+		return appendMsgpackFloat(buf, float64(v)), nil
+	case float64:
+		return appendMsgpackFloat(buf, v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(buf, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpackFloat(buf, f), nil
+	case string:
+		return appendMsgpackString(buf, v), nil
+	case []byte:
+		buf = appendMsgpackHeader(buf, len(v), 0xc4, 0xc5, 0xc6, 0, 0)
+		return append(buf, v...), nil
+	case []interface{}:
+		buf = appendMsgpackHeader(buf, len(v), 0, 0xdc, 0xdd, 0x90, 15)
+		for _, item := range v {
+			var err error
+			if buf, err = appendMsgpack(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		buf = appendMsgpackHeader(buf, len(v), 0, 0xde, 0xdf, 0x80, 15)
+		for key, item := range v {
+			buf = appendMsgpackString(buf, key)
+			var err error
+			if buf, err = appendMsgpack(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+
+	//structs and typed containers, as plain json values
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var plain interface{}
+	if err := unmarshalNumbers(data, &plain); err != nil {
+		return nil, err
+	}
+	return appendMsgpack(buf, plain)
+}
+
+func unmarshalNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+/**
+Append integer in the shortest form, unsigned one for positive
+values like notepack.io of javascript clients does
+*/
+func appendMsgpackInt(buf []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= 0x7f:
+		return append(buf, byte(v))
+	case v > 0 && v <= math.MaxUint8:
+		return append(buf, 0xcc, byte(v))
+	case v > 0 && v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(v))
+	case v > 0 && v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(v))
+	case v > 0:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), uint64(v))
+	case v >= -32:
+		return append(buf, byte(v))
+	case v >= math.MinInt8:
+		return append(buf, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(v))
+}
+
+func appendMsgpackFloat(buf []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(v))
+}
+
+func appendMsgpackString(buf []byte, v string) []byte {
+	buf = appendMsgpackHeader(buf, len(v), 0xd9, 0xda, 0xdb, 0xa0, 31)
+	return append(buf, v...)
+}
+
+/**
+Append length header: fixed type if length fits into fixMax,
+8, 16 or 32 bit length otherwise, zero codes are not available
+*/
+func appendMsgpackHeader(buf []byte, length int, code8, code16, code32, fix byte, fixMax int) []byte {
+	switch {
+	case fix != 0 && length <= fixMax:
+		return append(buf, fix|byte(length))
+	case code8 != 0 && length <= math.MaxUint8:
+		return append(buf, code8, byte(length))
+	case length <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, code16), uint16(length))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, code32), uint32(length))
+}
+
+/**
+Decode msgpack value: maps are map[string]interface{}, arrays
+are []interface{}, bin is []byte, integers are int64 or uint64
+and floats are float64. Extension types are not supported
+*/
+func UnmarshalMsgpack(data []byte) (interface{}, error) {
+	d := &msgpackDecoder{data: data}
+	value, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, ErrorWrongMsgpack
+	}
+	return value, nil
+}
+
+type msgpackDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, ErrorWrongMsgpack
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) length(size int) (int, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
+
+func (d *msgpackDecoder) value() (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	code := b[0]
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80:
+		return d.mapValue(int(code & 0x0f))
+	case code&0xf0 == 0x90:
+		return d.arrayValue(int(code & 0x0f))
+	case code&0xe0 == 0xa0:
+		return d.stringValue(int(code & 0x1f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		bin, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), bin...), nil
+	case 0xca:
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 0xcb:
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		b, err := d.next(1 << (code - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		v := uint64(0)
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		if v > math.MaxInt64 {
+			return v, nil
+		}
+		return int64(v), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		b, err := d.next(size)
+		if err != nil {
+			return nil, err
+		}
+		v := uint64(0)
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		//sign extension of shorter integers
+		shift := uint(64 - 8*size)
+		return int64(v<<shift) >> shift, nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.stringValue(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayValue(n)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(n)
+	}
+
+	return nil, ErrorMsgpackUnsupported
+}
+
+func (d *msgpackDecoder) stringValue(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) arrayValue(n int) (interface{}, error) {
+	//every item takes at least one byte
+	if n > len(d.data)-d.pos || d.depth >= maxMsgpackDepth {
+		return nil, ErrorWrongMsgpack
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	result := make([]interface{}, n)
+	for i := range result {
+		var err error
+		if result[i], err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (d *msgpackDecoder) mapValue(n int) (interface{}, error) {
+	if n > len(d.data)-d.pos || d.depth >= maxMsgpackDepth {
+		return nil, ErrorWrongMsgpack
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	result := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		//json has string keys only
+		if s, ok := key.(string); ok {
+			result[s] = value
+		} else {
+			result[fmt.Sprint(key)] = value
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,260 @@
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	//packet types of socket.io-msgpack-parser
+	msgpackConnect      = 0
+	msgpackDisconnect   = 1
+	msgpackEvent        = 2
+	msgpackAck          = 3
+	msgpackConnectError = 4
+)
+
+/**
+Encoder and decoder of socket.io packets. Packets are engine.io
+messages in text form, binary ones are attachmentPrefix followed
+by base64 data. Engine.io packets, like ping, are the same for all parsers
+*/
+type Parser interface {
+	/**
+	Encode packet, its binary attachments are placeholders in Args;
+	returns packets to send one after another
+	*/
+	Encode(msg *Message) ([]string, error)
+
+	/**
+	Decode packet, AttachmentCount of result is amount of
+	binary attachment packets following it
+	*/
+	Decode(data string) (*Message, error)
+}
+
+/**
+Parser encoding Message.Values itself, senders may give arguments
+as values instead of json Args
+*/
+type ValuesParser interface {
+	Parser
+	EncodesValues() bool
+}
+
+/**
+Default socket.io parser, json packets with attachments
+sent as separate binary packets
+*/
+type JsonParser struct{}
+
+func (JsonParser) Encode(msg *Message) ([]string, error) {
+	command, err := Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	//attachments go right after the packet
+	commands := []string{command}
+	for _, attachment := range msg.Attachments {
+		commands = append(commands, EncodeAttachment(attachment))
+	}
+	return commands, nil
+}
+
+func (JsonParser) Decode(data string) (*Message, error) {
+	return Decode(data)
+}
+
+/**
+Parser compatible with socket.io-msgpack-parser: every socket.io
+packet is one binary msgpack map, attachments are bin values inside it.
+Peer has to use the same parser
+*/
+type MsgpackParser struct{}
+
+func (MsgpackParser) EncodesValues() bool {
+	return true
+}
+
+func (MsgpackParser) Encode(msg *Message) ([]string, error) {
+	switch msg.Type {
+	case MessageTypeOpen, MessageTypeClose, MessageTypePing, MessageTypePong:
+		command, err := Encode(msg)
+		if err != nil {
+			return nil, err
+		}
+		return []string{command}, nil
+	}
+
+	namespace := msg.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	packet := map[string]interface{}{"nsp": namespace}
+
+	args, err := msgpackArgs(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch msg.Type {
+	case MessageTypeEmpty, MessageTypeConnectError:
+		packet["type"] = msgpackConnect
+		if msg.Type == MessageTypeConnectError {
+			packet["type"] = msgpackConnectError
+		}
+		if len(args) > 0 {
+			packet["data"] = args[0]
+		}
+	case MessageTypeDisconnect:
+		packet["type"] = msgpackDisconnect
+	case MessageTypeEmit, MessageTypeAckRequest:
+		packet["type"] = msgpackEvent
+		packet["data"] = append([]interface{}{msg.Method}, args...)
+		if msg.Type == MessageTypeAckRequest {
+			packet["id"] = msg.AckId
+		}
+	case MessageTypeAckResponse:
+		packet["type"] = msgpackAck
+		packet["data"] = args
+		packet["id"] = msg.AckId
+	default:
+		return nil, ErrorWrongMessageType
+	}
+
+	data, err := MarshalMsgpack(packet)
+	if err != nil {
+		return nil, err
+	}
+	return []string{EncodeAttachment(data)}, nil
+}
+
+/**
+Get arguments of packet: its values, or parsed json arguments
+with attachments put in place of their placeholders
+*/
+func msgpackArgs(msg *Message) ([]interface{}, error) {
+	if msg.Values != nil {
+		return msg.Values, nil
+	}
+	if msg.Args == "" {
+		return []interface{}{}, nil
+	}
+
+	var values []interface{}
+	if err := unmarshalNumbers([]byte("["+msg.Args+"]"), &values); err != nil {
+		return nil, ErrorWrongPacket
+	}
+	for i := range values {
+		var err error
+		if values[i], err = fillPlaceholders(values[i], msg.Attachments); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (MsgpackParser) Decode(data string) (*Message, error) {
+	msg, err := decodeMsgpack(data)
+	if err != nil {
+		return nil, decodeFailed(data, err)
+	}
+	return msg, nil
+}
+
+func decodeMsgpack(data string) (*Message, error) {
+	if !strings.HasPrefix(data, attachmentPrefix) {
+		//text socket.io packets are not used by this parser
+		if strings.HasPrefix(data, msg) {
+			return nil, ErrorWrongPacket
+		}
+		return Decode(data)
+	}
+
+	raw, err := DecodeAttachment(data)
+	if err != nil {
+		return nil, ErrorWrongPacket
+	}
+	value, err := UnmarshalMsgpack(raw)
+	if err != nil {
+		return nil, err
+	}
+	packet, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, ErrorWrongPacket
+	}
+	packetType, ok := packet["type"].(int64)
+	if !ok {
+		return nil, ErrorWrongPacket
+	}
+
+	result := &Message{Source: data}
+	if namespace, ok := packet["nsp"].(string); ok && namespace != DefaultNamespace {
+		result.Namespace = namespace
+	}
+	id, hasId := packet["id"].(int64)
+	result.AckId = int(id)
+
+	switch packetType {
+	case msgpackConnect, msgpackConnectError:
+		result.Type = MessageTypeEmpty
+		if packetType == msgpackConnectError {
+			result.Type = MessageTypeConnectError
+		}
+		if payload, ok := packet["data"]; ok {
+			result.Values = []interface{}{payload}
+			if result.Args, err = jsonArgs(result.Values); err != nil {
+				return nil, err
+			}
+		}
+	case msgpackDisconnect:
+		result.Type = MessageTypeDisconnect
+	case msgpackEvent:
+		result.Type = MessageTypeEmit
+		if hasId {
+			result.Type = MessageTypeAckRequest
+		}
+		items, _ := packet["data"].([]interface{})
+		if len(items) == 0 {
+			return nil, ErrorWrongPacket
+		}
+		if result.Method, ok = items[0].(string); !ok {
+			return nil, ErrorWrongPacket
+		}
+		result.Values = items[1:]
+		if result.Args, err = jsonArgs(result.Values); err != nil {
+			return nil, err
+		}
+	case msgpackAck:
+		items, ok := packet["data"].([]interface{})
+		if !ok || !hasId {
+			return nil, ErrorWrongPacket
+		}
+		result.Type = MessageTypeAckResponse
+		result.Values = items
+		if result.Args, err = jsonArgs(items); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrorWrongMessageType
+	}
+
+	return result, nil
+}
+
+/**
+Encode decoded values as comma separated json arguments for codecs,
+bin values become base64 strings, so they can be unmarshalled to []byte
+*/
+func jsonArgs(values []interface{}) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	result, err := json.Marshal(values)
+	if err != nil {
+		return "", ErrorWrongPacket
+	}
+	return string(result[1 : len(result)-1]), nil
+}
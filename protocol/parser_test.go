@@ -0,0 +1,158 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/**
+Packets of socket.io-client with socket.io-msgpack-parser. They are
+encoded by hand following notepack.io rules, the encoder of the parser:
+keys go in order the client sets them, integers take the shortest
+form, other numbers are float64 and Buffer is bin. They were not
+produced by running the javascript parser
+*/
+var msgpackFixtures = []struct {
+	name string
+	//socket.emit("hello", "world", 42, {a: true})
+	hex  string
+	want Message
+}{
+	{
+		name: "event",
+		hex: "84" +
+			"a474797065" + "02" +
+			"a464617461" + "94" + "a568656c6c6f" + "a5776f726c64" + "2a" + "81" + "a161" + "c3" +
+			"a76f7074696f6e73" + "81" + "a8636f6d7072657373" + "c3" +
+			"a36e7370" + "a12f",
+		want: Message{
+			Type:   MessageTypeEmit,
+			Method: "hello",
+			Values: []interface{}{"world", int64(42), map[string]interface{}{"a": true}},
+			Args:   `"world",42,{"a":true}`,
+		},
+	},
+	{
+		//socket.of("/chat").emit("upload", Buffer.from([1, 2, 3]), 1.5, -200, 70000, ack)
+		name: "binary event with ack",
+		hex: "85" +
+			"a474797065" + "02" +
+			"a464617461" + "95" + "a675706c6f6164" + "c403010203" + "cb3ff8000000000000" + "d1ff38" + "ce00011170" +
+			"a76f7074696f6e73" + "81" + "a8636f6d7072657373" + "c3" +
+			"a26964" + "07" +
+			"a36e7370" + "a52f63686174",
+		want: Message{
+			Type:      MessageTypeAckRequest,
+			Method:    "upload",
+			AckId:     7,
+			Namespace: "/chat",
+			Values:    []interface{}{[]byte{1, 2, 3}, 1.5, int64(-200), int64(70000)},
+			Args:      `"AQID",1.5,-200,70000`,
+		},
+	},
+	{
+		//ack callback called with ("ok", 5)
+		name: "ack",
+		hex: "84" +
+			"a474797065" + "03" +
+			"a26964" + "00" +
+			"a464617461" + "92" + "a26f6b" + "05" +
+			"a36e7370" + "a12f",
+		want: Message{
+			Type:   MessageTypeAckResponse,
+			Values: []interface{}{"ok", int64(5)},
+			Args:   `"ok",5`,
+		},
+	},
+	{
+		//io(url, {auth: {token: "abc"}})
+		name: "connect",
+		hex: "83" +
+			"a474797065" + "00" +
+			"a464617461" + "81" + "a5746f6b656e" + "a3616263" +
+			"a36e7370" + "a12f",
+		want: Message{
+			Type:   MessageTypeEmpty,
+			Values: []interface{}{map[string]interface{}{"token": "abc"}},
+			Args:   `{"token":"abc"}`,
+		},
+	},
+}
+
+func fixturePacket(t *testing.T, hexData string) string {
+	data, err := hex.DecodeString(hexData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return EncodeAttachment(data)
+}
+
+func TestMsgpackParserDecodesClientPackets(t *testing.T) {
+	for _, fixture := range msgpackFixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			packet := fixturePacket(t, fixture.hex)
+			msg, err := MsgpackParser{}.Decode(packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := fixture.want
+			want.Source = packet
+			if !reflect.DeepEqual(*msg, want) {
+				t.Fatalf("got %+v\nwant %+v", *msg, want)
+			}
+		})
+	}
+}
+
+func TestMsgpackParserEncodesValues(t *testing.T) {
+	msg := &Message{
+		Type:      MessageTypeAckRequest,
+		Method:    "upload",
+		AckId:     7,
+		Namespace: "/chat",
+		Values:    []interface{}{[]byte{1, 2, 3}, 1.5, -200, 70000},
+	}
+	commands, err := MsgpackParser{}.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 1 {
+		t.Fatal(commands)
+	}
+
+	raw, err := DecodeAttachment(commands[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	//map key order differs, items of data array do not
+	data, _ := hex.DecodeString("95" + "a675706c6f6164" + "c403010203" + "cb3ff8000000000000" + "d1ff38" + "ce00011170")
+	if !bytes.Contains(raw, data) {
+		t.Fatalf("data array %x not in %x", data, raw)
+	}
+
+	decoded, err := MsgpackParser{}.Decode(commands[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != msg.Type || decoded.Method != msg.Method ||
+		decoded.AckId != msg.AckId || decoded.Namespace != msg.Namespace {
+		t.Fatalf("got %+v", decoded)
+	}
+}
+
+func TestMsgpackParserEncodesJsonArgs(t *testing.T) {
+	//packets made as json, like connect replies, are converted
+	msg := &Message{Type: MessageTypeEmit, Method: "hello", Args: `"world",42`}
+	commands, err := MsgpackParser{}.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := DecodeAttachment(commands[0])
+	if !strings.Contains(hex.EncodeToString(raw), "93"+"a568656c6c6f"+"a5776f726c64"+"2a") {
+		t.Fatalf("%x", raw)
+	}
+}
@@ -1,18 +1,27 @@
 package protocol
 
 import (
-	"encoding/json"
+	"encoding/base64"
 	"errors"
 	"strconv"
 	"strings"
 )
 
 const (
-	open          = "0"
-	msg           = "4"
-	emptyMessage  = "40"
-	commonMessage = "42"
-	ackMessage    = "43"
+	open              = "0"
+	msg               = "4"
+	emptyMessage      = "40"
+	disconnectMessage = "41"
+	commonMessage     = "42"
+	ackMessage        = "43"
+	connectError      = "44"
+	binaryEvent       = "45"
+	binaryAck         = "46"
+
+	//text form of binary engine.io message, followed by base64 data
+	attachmentPrefix = "b4"
+
+	DefaultNamespace = "/"
 
 	CloseMessage = "1"
 	PingMessage = "2"
@@ -24,6 +33,56 @@ var (
 	ErrorWrongPacket      = errors.New("Wrong packet")
 )
 
+var (
+	//attachments allowed in one binary packet, packets with more are
+	//wrong; same default as maxAttachments of socket.io-parser
+	MaxAttachments = 10
+)
+
+const (
+	//part of packet shown in DecodeError text
+	decodeErrorPacketLimit = 64
+)
+
+/**
+Packet can't be decoded, Err tells why. It matches ErrorWrongPacket
+with errors.Is, whatever the cause is
+*/
+type DecodeError struct {
+	Packet string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	result := ErrorWrongPacket.Error()
+	if e.Err != nil && e.Err != ErrorWrongPacket {
+		result += ": " + e.Err.Error()
+	}
+	packet := e.Packet
+	if len(packet) > decodeErrorPacketLimit {
+		packet = packet[:decodeErrorPacketLimit] + "..."
+	}
+	return result + " " + strconv.Quote(packet)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrorWrongPacket
+}
+
+/**
+Wrap decoding error of packet to DecodeError, if it is not one already
+*/
+func decodeFailed(data string, err error) error {
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	return &DecodeError{Packet: data, Err: err}
+}
+
 func typeToText(msgType int) (string, error) {
 	switch msgType {
 	case MessageTypeOpen:
@@ -40,39 +99,85 @@ func typeToText(msgType int) (string, error) {
 		return commonMessage, nil
 	case MessageTypeAckResponse:
 		return ackMessage, nil
+	case MessageTypeDisconnect:
+		return disconnectMessage, nil
+	case MessageTypeConnectError:
+		return connectError, nil
 	}
 	return "", ErrorWrongMessageType
 }
 
+/**
+Encode packet to text form
+*/
 func Encode(msg *Message) (string, error) {
-	result, err := typeToText(msg.Type)
+	return encodeString(func(dst []byte) ([]byte, error) {
+		return AppendEncode(dst, msg)
+	})
+}
+
+/**
+Append text form of packet to dst, so packets can be encoded
+to reused buffers. On error dst is returned as is
+*/
+func AppendEncode(dst []byte, msg *Message) ([]byte, error) {
+	prefix, err := typeToText(msg.Type)
 	if err != nil {
-		return "", err
+		return dst, err
 	}
 
-	if msg.Type == MessageTypeEmpty || msg.Type == MessageTypePing ||
-		msg.Type == MessageTypePong {
-		return result, nil
+	if msg.Type == MessageTypePing || msg.Type == MessageTypePong {
+		return append(dst, prefix...), nil
 	}
 
-	if msg.Type == MessageTypeAckRequest || msg.Type == MessageTypeAckResponse {
-		result += strconv.Itoa(msg.AckId)
+	if msg.Type == MessageTypeOpen || msg.Type == MessageTypeClose {
+		return append(append(dst, prefix...), msg.Args...), nil
 	}
 
-	if msg.Type == MessageTypeOpen || msg.Type == MessageTypeClose {
-		return result + msg.Args, nil
+	result := dst
+	if len(msg.Attachments) > 0 {
+		switch msg.Type {
+		case MessageTypeEmit, MessageTypeAckRequest:
+			prefix = binaryEvent
+		case MessageTypeAckResponse:
+			prefix = binaryAck
+		}
+		result = append(result, prefix...)
+		result = strconv.AppendInt(result, int64(len(msg.Attachments)), 10)
+		result = append(result, '-')
+	} else {
+		result = append(result, prefix...)
 	}
 
-	if msg.Type == MessageTypeAckResponse {
-		return result + "[" + msg.Args + "]", nil
+	if msg.Namespace != "" && msg.Namespace != DefaultNamespace {
+		result = append(result, msg.Namespace...)
+		result = append(result, ',')
 	}
 
-	jsonMethod, err := json.Marshal(&msg.Method)
-	if err != nil {
-		return "", err
+	if msg.Type == MessageTypeDisconnect {
+		return result, nil
+	}
+
+	//EIO=4 connect packets may carry json payload
+	if msg.Type == MessageTypeEmpty || msg.Type == MessageTypeConnectError {
+		return append(result, msg.Args...), nil
+	}
+
+	if msg.Type == MessageTypeAckRequest || msg.Type == MessageTypeAckResponse {
+		result = strconv.AppendInt(result, int64(msg.AckId), 10)
 	}
 
-	return result + "[" + string(jsonMethod) + "," + msg.Args + "]", nil
+	result = append(result, '[')
+	if msg.Type != MessageTypeAckResponse {
+		result = appendJsonString(result, msg.Method)
+		//no arguments
+		if msg.Args == "" {
+			return append(result, ']'), nil
+		}
+		result = append(result, ',')
+	}
+	result = append(result, msg.Args...)
+	return append(result, ']'), nil
 }
 
 func MustEncode(msg *Message) string {
@@ -104,35 +209,86 @@ func getMessageType(data string) (int, error) {
 		switch data[0:2] {
 		case emptyMessage:
 			return MessageTypeEmpty, nil
+		case disconnectMessage:
+			return MessageTypeDisconnect, nil
 		case commonMessage:
 			return MessageTypeAckRequest, nil
 		case ackMessage:
 			return MessageTypeAckResponse, nil
+		case connectError:
+			return MessageTypeConnectError, nil
+		case binaryEvent:
+			return MessageTypeAckRequest, nil
+		case binaryAck:
+			return MessageTypeAckResponse, nil
 		}
 	}
 	return 0, ErrorWrongMessageType
 }
 
 /**
-Get ack id of current packet, if present
+Get ack id of current packet, if present. Body is packet
+without its type, attachment count and namespace
 */
-func getAck(text string) (ackId int, restText string, err error) {
-	if len(text) < 4 {
+func getAck(body string) (ackId int, restText string, err error) {
+	if len(body) < 2 {
 		return 0, "", ErrorWrongPacket
 	}
-	text = text[2:]
 
-	pos := strings.IndexByte(text, '[')
+	pos := strings.IndexByte(body, '[')
 	if pos == -1 {
 		return 0, "", ErrorWrongPacket
 	}
 
-	ack, err := strconv.Atoi(text[0:pos])
+	ack, err := strconv.Atoi(body[0:pos])
 	if err != nil {
 		return 0, "", err
 	}
 
-	return ack, text[pos:], nil
+	return ack, body[pos:], nil
+}
+
+/**
+Get attachments count of binary packet body, and the body without it
+*/
+func getAttachmentCount(body string) (restText string, count int, err error) {
+	pos := strings.IndexByte(body, '-')
+	if pos == -1 {
+		return "", 0, ErrorWrongPacket
+	}
+
+	count, err = strconv.Atoi(body[:pos])
+	if err != nil || count <= 0 || count > MaxAttachments {
+		return "", 0, ErrorWrongPacket
+	}
+
+	return body[pos+1:], count, nil
+}
+
+/**
+Get namespace of socket.io packet body, empty for default one,
+and the body without it
+*/
+func getNamespace(body string) (restText, namespace string) {
+	if len(body) < 1 || body[0] != '/' {
+		return body, ""
+	}
+
+	end := strings.IndexByte(body, ',')
+	if end == -1 {
+		namespace, restText = body, ""
+	} else {
+		namespace, restText = body[:end], body[end+1:]
+	}
+
+	//EIO=3 clients may append query to namespace of connect packet
+	if query := strings.IndexByte(namespace, '?'); query != -1 {
+		namespace = namespace[:query]
+	}
+	if namespace == DefaultNamespace {
+		namespace = ""
+	}
+	return restText, namespace
 }
 
 /**
@@ -170,7 +326,18 @@ func getMethod(text string) (method, restText string, err error) {
 	return text[start:end], text[rest : len(text)-1], nil
 }
 
+/**
+Decode text packet, on failure *DecodeError is returned
+*/
 func Decode(data string) (*Message, error) {
+	msg, err := decode(data)
+	if err != nil {
+		return nil, decodeFailed(data, err)
+	}
+	return msg, nil
+}
+
+func decode(data string) (*Message, error) {
 	var err error
 	msg := &Message{}
 	msg.Source = data
@@ -186,23 +353,46 @@ func Decode(data string) (*Message, error) {
 	}
 
 	if msg.Type == MessageTypeClose || msg.Type == MessageTypePing ||
-		msg.Type == MessageTypePong || msg.Type == MessageTypeEmpty {
+		msg.Type == MessageTypePong {
+		return msg, nil
+	}
+
+	//packet parts are sliced from data, without copying
+	body := data[2:]
+	if strings.HasPrefix(data, binaryEvent) || strings.HasPrefix(data, binaryAck) {
+		body, msg.AttachmentCount, err = getAttachmentCount(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	body, msg.Namespace = getNamespace(body)
+
+	if msg.Type == MessageTypeEmpty || msg.Type == MessageTypeConnectError {
+		msg.Args = body
+		return msg, nil
+	}
+
+	if msg.Type == MessageTypeDisconnect {
 		return msg, nil
 	}
 
-	ack, rest, err := getAck(data)
+	ack, rest, err := getAck(body)
 	msg.AckId = ack
 	if msg.Type == MessageTypeAckResponse {
 		if err != nil {
 			return nil, err
 		}
+		if len(rest) < 2 || rest[0] != '[' || rest[len(rest)-1] != ']' {
+			return nil, ErrorWrongPacket
+		}
 		msg.Args = rest[1 : len(rest)-1]
 		return msg, nil
 	}
 
 	if err != nil {
 		msg.Type = MessageTypeEmit
-		rest = data[2:]
+		rest = body
 	}
 
 	msg.Method, msg.Args, err = getMethod(rest)
@@ -212,3 +402,23 @@ func Decode(data string) (*Message, error) {
 
 	return msg, nil
 }
+
+/**
+Encode binary attachment, it is sent right after its packet
+*/
+func EncodeAttachment(data []byte) string {
+	result, _ := encodeString(func(dst []byte) ([]byte, error) {
+		return AppendAttachment(dst, data), nil
+	})
+	return result
+}
+
+/**
+Decode binary attachment packet
+*/
+func DecodeAttachment(data string) ([]byte, error) {
+	if !strings.HasPrefix(data, attachmentPrefix) {
+		return nil, ErrorWrongPacket
+	}
+	return base64.StdEncoding.DecodeString(data[len(attachmentPrefix):])
+}
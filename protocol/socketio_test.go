@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestDecodeMaxAttachments(t *testing.T) {
+	packet := func(count int) string {
+		return binaryEvent + strconv.Itoa(count) + `-["upload",{"_placeholder":true,"num":0}]`
+	}
+
+	msg, err := Decode(packet(MaxAttachments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.AttachmentCount != MaxAttachments {
+		t.Fatal(msg.AttachmentCount)
+	}
+
+	_, err = Decode(packet(MaxAttachments + 1))
+	if !errors.Is(err, ErrorWrongPacket) {
+		t.Fatalf("got %v, want ErrorWrongPacket", err)
+	}
+
+	defer func(max int) { MaxAttachments = max }(MaxAttachments)
+	MaxAttachments = 100
+	if _, err = Decode(packet(100)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var benchMessages = map[string]*Message{
+	"emit": {
+		Type:   MessageTypeEmit,
+		Method: "move",
+		Args:   `{"x":3,"y":4,"unit":"knight","path":[[0,0],[1,2],[3,4]]}`,
+	},
+	"ack": {
+		Type:      MessageTypeAckRequest,
+		Namespace: "/game",
+		AckId:     1234,
+		Method:    "move",
+		Args:      `{"x":3,"y":4,"unit":"knight"}`,
+	},
+	"response": {
+		Type:  MessageTypeAckResponse,
+		AckId: 1234,
+		Args:  `{"ok":true}`,
+	},
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, name := range []string{"emit", "ack", "response"} {
+		msg := benchMessages[name]
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Encode(msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, name := range []string{"emit", "ack", "response"} {
+		packet, err := Encode(benchMessages[name])
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Decode(packet); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
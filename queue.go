@@ -0,0 +1,378 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/protocol"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultQueueSize       = 500
+	DefaultOverflowTimeout = 5 * time.Second
+
+	//fired when outgoing queue gets more than half full
+	OnBackpressureStart = "backpressure_start"
+	//fired when queue is drained below half after OnBackpressureStart
+	OnBackpressureEnd = "backpressure_end"
+)
+
+/**
+What to do with packet which does not fit into outgoing queue
+*/
+type OverflowPolicy int
+
+const (
+	//emit fails with ErrorSocketOverflood and channel is closed, as before
+	OverflowClose OverflowPolicy = iota
+	//oldest queued events are dropped to make room, other packets are kept
+	OverflowDropOldest
+	//emit fails with ErrorSocketOverflood, channel stays
+	OverflowDropNewest
+	//emit waits for free space up to Timeout, then fails with ErrorSendTimeout
+	OverflowBlock
+)
+
+/**
+Outgoing queue of the channel
+*/
+type QueueConfig struct {
+	//packets in queue, DefaultQueueSize if 0
+	Size int
+	//what to do when queue is full
+	Overflow OverflowPolicy
+	//how long OverflowBlock waits, DefaultOverflowTimeout if 0
+	Timeout time.Duration
+	//volatile emits are dropped while this many packets are queued,
+	//half of Size if 0
+	VolatileThreshold int
+	//packets written at once to connections which can batch them, like
+	//websocket frames with one write to the socket; 0 or 1 writes one by one
+	BatchSize int
+	//how long to wait for more packets to fill the batch,
+	//queued ones are written right away if 0
+	FlushInterval time.Duration
+
+	//called on every packet not fitting into queue,
+	//with OverflowClose only once, before channel is closed
+	OnOverflow func(c *Channel)
+	//called by outLoop when queue gets more than half full, and with
+	//false when it is drained below that; not called on close
+	OnBackpressure func(c *Channel, overflooded bool)
+}
+
+func (q *QueueConfig) size() int {
+	if q.Size <= 0 {
+		return DefaultQueueSize
+	}
+	return q.Size
+}
+
+func (q *QueueConfig) volatileThreshold() int {
+	if q.VolatileThreshold <= 0 {
+		return q.size() / 2
+	}
+	return q.VolatileThreshold
+}
+
+func (q *QueueConfig) timeout() time.Duration {
+	if q.Timeout <= 0 {
+		return DefaultOverflowTimeout
+	}
+	return q.Timeout
+}
+
+/**
+Packet in outgoing queue
+*/
+type outPacket struct {
+	command      string
+	uncompressed bool //written without websocket compression
+	//packets of event starting with this one, its attachments
+	//included; 0 if packet is not first packet of event
+	event int
+}
+
+/**
+Put encoded packets to outgoing queue, blocks only with OverflowBlock.
+Packets are queued one after another, or none of them
+*/
+func (c *Channel) enqueue(commands ...string) error {
+	return c.enqueueWith(sendOptions{}, commands...)
+}
+
+/**
+Queue control packet, like ping or pong, without waiting for stalled
+connection. Packet which does not fit is skipped with ErrorWouldBlock
+*/
+func (c *Channel) enqueueControl(command string) error {
+	return c.enqueueWith(sendOptions{nonBlocking: true}, command)
+}
+
+/**
+Same as enqueue, with compression and volatility of send options
+*/
+func (c *Channel) enqueueWith(opts sendOptions, commands ...string) error {
+	var deadline Timer
+	defer func() {
+		if deadline != nil {
+			deadline.Stop()
+		}
+	}()
+
+	for {
+		full, dropped, err := c.tryEnqueue(commands, opts)
+		if dropped {
+			c.overflow()
+		}
+		if !full {
+			return err
+		}
+		if opts.nonBlocking {
+			return ErrorWouldBlock
+		}
+
+		if c.queue.Overflow == OverflowBlock && len(commands) <= c.queue.size() {
+			if deadline == nil {
+				deadline = c.clock().NewTimer(c.queue.timeout())
+			}
+			err := c.waitWrite(context.Background(), deadline.C())
+			if err == nil {
+				continue
+			}
+			if err == ErrorSendTimeout {
+				c.overflow()
+			}
+			return err
+		}
+
+		c.overflow()
+		return ErrorSocketOverflood
+	}
+}
+
+/**
+Queue packets if there is space for them, full is true if there is not,
+dropped if queued events were dropped to make space.
+Volatile packets are silently skipped if queue is above threshold
+*/
+func (c *Channel) tryEnqueue(commands []string, opts sendOptions) (full, dropped bool, err error) {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	if c.outClosed {
+		return false, false, ErrorSocketClosed
+	}
+	if opts.volatile && len(c.out)+len(commands) > c.queue.volatileThreshold() {
+		return false, false, nil
+	}
+
+	//queue is only drained by outLoop, so free space can't shrink here
+	if c.queue.size()-len(c.out) < len(commands) {
+		if opts.nonBlocking || c.queue.Overflow != OverflowDropOldest ||
+			!c.dropOldest(len(commands)) {
+			return true, false, ErrorSocketOverflood
+		}
+		dropped = true
+	}
+
+	for i, command := range commands {
+		packet := outPacket{command: command, uncompressed: opts.uncompressed}
+		if opts.event && i == 0 {
+			packet.event = len(commands)
+		}
+		c.out = append(c.out, packet)
+		c.enqueuedCount++
+		c.bufferedAdd(command)
+	}
+	c.signalOut()
+	return false, dropped, nil
+}
+
+/**
+Drop oldest queued events until n packets fit, aliveLock should be held.
+Binary events are dropped with their attachments, packets other than
+events are never dropped
+*/
+func (c *Channel) dropOldest(n int) bool {
+	size := c.queue.size()
+
+	i := 0
+	for size-len(c.out) < n && i < len(c.out) {
+		packets := c.out[i].event
+		if packets == 0 || i+packets > len(c.out) {
+			i++
+			continue
+		}
+
+		//dropped packets count as written for waitWritten
+		for _, dropped := range c.out[i : i+packets] {
+			c.bufferedDropped(dropped.command)
+			c.writtenCount++
+		}
+		c.out = append(c.out[:i], c.out[i+packets:]...)
+		if c.writeSignal != nil {
+			close(c.writeSignal)
+			c.writeSignal = nil
+		}
+	}
+
+	return size-len(c.out) >= n
+}
+
+/**
+Count overflow and call OnOverflow, with OverflowClose only once
+*/
+func (c *Channel) overflow() {
+	c.statsHook().Overflow(c)
+	c.log().Warn("outgoing queue overflow", "sid", c.Id(), "size", c.queue.size(),
+		"policy", int(c.queue.Overflow))
+
+	if c.queue.OnOverflow == nil {
+		return
+	}
+
+	if c.queue.Overflow == OverflowClose {
+		c.aliveLock.Lock()
+		notified := c.overflowNotified
+		c.overflowNotified = true
+		c.aliveLock.Unlock()
+		if notified {
+			return
+		}
+	}
+
+	c.queue.OnOverflow(c)
+}
+
+/**
+Overflood state of channel queue
+*/
+const (
+	floodNone int32 = iota
+	floodOn
+	floodClosed
+)
+
+//channels with queue more than half full, see AmountOfOverflooded
+var overfloodedCount int64
+
+/**
+Get amount of channels with outgoing queue more than half full
+*/
+func AmountOfOverflooded() int64 {
+	return atomic.LoadInt64(&overfloodedCount)
+}
+
+/**
+Outgoing queue state, handlers of OnBackpressureStart
+and OnBackpressureEnd taking it get it
+*/
+type Backpressure struct {
+	//packets in queue when event is fired
+	Queued int
+	//queue size, see QueueConfig.Size
+	Size int
+}
+
+/**
+Get amount of packets in outgoing queue, not written yet
+*/
+func (c *Channel) QueueLen() int {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	return len(c.out)
+}
+
+/**
+Track queue crossing half of its size, called by outLoop only
+*/
+func (c *Channel) setOverflooded(m *methods, on bool) {
+	from, to, delta := floodNone, floodOn, int64(1)
+	if !on {
+		from, to, delta = floodOn, floodNone, -1
+	}
+	if !atomic.CompareAndSwapInt32(&c.flood, from, to) {
+		return
+	}
+	atomic.AddInt64(&overfloodedCount, delta)
+
+	if c.queue.OnBackpressure != nil {
+		c.queue.OnBackpressure(c, on)
+	}
+	go c.fireBackpressure(m)
+}
+
+/**
+Fire backpressure event for current queue state, unless it is fired
+already. Handlers run out of outLoop, so they may emit; they are called
+one by one and start and end events always alternate
+*/
+func (c *Channel) fireBackpressure(m *methods) {
+	c.backpressureLock.Lock()
+	defer c.backpressureLock.Unlock()
+
+	state := atomic.LoadInt32(&c.flood)
+	if state == floodClosed || (state == floodOn) == c.backpressure {
+		return
+	}
+	c.backpressure = state == floodOn
+
+	event := OnBackpressureEnd
+	if c.backpressure {
+		event = OnBackpressureStart
+	}
+	m.callBackpressure(c, event, Backpressure{Queued: c.QueueLen(), Size: c.queue.size()})
+}
+
+/**
+Stop tracking closed channel, it is not counted anymore
+*/
+func (c *Channel) clearOverflooded() {
+	if atomic.SwapInt32(&c.flood, floodClosed) == floodOn {
+		atomic.AddInt64(&overfloodedCount, -1)
+	}
+}
+
+/**
+Wake up outLoop, aliveLock should be held
+*/
+func (c *Channel) signalOut() {
+	select {
+	case c.outSignal <- struct{}{}:
+	default:
+	}
+}
+
+/**
+Take next packet for outLoop, waiting for it if queue is empty.
+Returns amount of packets queued before taking this one
+*/
+func (c *Channel) nextOut() (outPacket, int) {
+	for {
+		c.aliveLock.Lock()
+		queued := len(c.out)
+		if queued > 0 {
+			msg := c.out[0]
+			c.out[0] = outPacket{}
+			c.out = c.out[1:]
+			c.aliveLock.Unlock()
+			return msg, queued
+		}
+		c.aliveLock.Unlock()
+
+		<-c.outSignal
+	}
+}
+
+/**
+Queue close message for outLoop, it is put even into full queue
+*/
+func (c *Channel) closeOut() {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	c.out = append(c.out, outPacket{command: protocol.CloseMessage})
+	c.signalOut()
+}
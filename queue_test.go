@@ -0,0 +1,69 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+	"testing"
+)
+
+/**
+Oldest events are dropped whatever parser encoded them, binary
+ones with attachments; ack responses and control packets stay
+*/
+func TestOverflowDropOldest(t *testing.T) {
+	parsers := []struct {
+		name   string
+		parser protocol.Parser
+	}{
+		{"json", protocol.JsonParser{}},
+		{"msgpack", protocol.MsgpackParser{}},
+	}
+	for _, test := range parsers {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Channel{}
+			c.initChannel(QueueConfig{Size: 4, Overflow: OverflowDropOldest})
+			c.parser = test.parser
+			emit := func(method string, args interface{}) error {
+				return send(&protocol.Message{Type: protocol.MessageTypeEmit, Method: method}, c, args)
+			}
+
+			c.enqueue(protocol.PingMessage)
+			if err := send(&protocol.Message{Type: protocol.MessageTypeAckResponse, AckId: 1}, c, "ok"); err != nil {
+				t.Fatal(err)
+			}
+			if err := emit("old", map[string]interface{}{"data": []byte{1}}); err != nil {
+				t.Fatal(err)
+			}
+			old := map[string]bool{}
+			for _, packet := range c.out[2:] {
+				old[packet.command] = true
+			}
+			for len(c.out) < c.queue.size() {
+				if err := emit("fill", nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := emit("new", nil); err != nil {
+				t.Fatal(err)
+			}
+			if c.out[0].command != protocol.PingMessage || c.out[1].event != 0 {
+				t.Fatalf("control packets dropped, queued %+v", c.out)
+			}
+			for _, packet := range c.out[2:] {
+				if old[packet.command] || packet.event != 1 {
+					t.Fatalf("oldest event is not dropped, queued %+v", c.out)
+				}
+			}
+			if c.writtenCount != uint64(len(old)) {
+				t.Fatalf("%d dropped packets counted as written, want %d", c.writtenCount, len(old))
+			}
+
+			//nothing to drop if there are no events
+			c.out = c.out[:2]
+			c.enqueue(protocol.PingMessage, protocol.PingMessage)
+			if err := emit("last", nil); err != ErrorSocketOverflood {
+				t.Fatalf("got %v, want %v", err, ErrorSocketOverflood)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"math"
+	"time"
+)
+
+var (
+	ErrorMessageRate     = errors.New("Message rate exceeded")
+	ErrorByteRate        = errors.New("Byte rate exceeded")
+	ErrorPayloadTooLarge = errors.New("Payload too large")
+)
+
+/**
+What to do with incoming message which exceeds RateLimit
+*/
+type RateLimitPolicy int
+
+const (
+	//skip the message, handlers don't get it
+	RateDrop RateLimitPolicy = iota
+	//stop reading until rate allows the message, too large ones are dropped
+	RateDelay
+	//close the connection
+	RateDisconnect
+)
+
+/**
+Limits of incoming socket.io messages of one connection, namespaces
+of the connection share them. Zero values mean no limit
+*/
+type RateLimit struct {
+	MessagesPerSecond float64
+	//messages allowed at once, defaults to the rate
+	MessageBurst int
+	//bytes of messages with attachments
+	BytesPerSecond float64
+	//bytes allowed at once, defaults to the rate
+	ByteBurst int
+	//max size of one message with attachments
+	MaxPayload int
+
+	Policy RateLimitPolicy
+}
+
+/**
+Token buckets of the connection, used only by inLoop
+*/
+type rateLimiter struct {
+	messages float64
+	bytes    float64
+	last     time.Time
+}
+
+/**
+Get burst of the rate, at least one
+*/
+func rateBurst(rate float64, burst int) float64 {
+	if burst < 1 {
+		return math.Max(1, math.Ceil(rate))
+	}
+	return float64(burst)
+}
+
+/**
+Take tokens for message of given size, if there are not enough
+returns time left until there are and the limit exceeded
+*/
+func (l *rateLimiter) take(r *RateLimit, size int, now time.Time) (time.Duration, error) {
+	if r.MaxPayload > 0 && size > r.MaxPayload {
+		return 0, ErrorPayloadTooLarge
+	}
+
+	messageBurst := rateBurst(r.MessagesPerSecond, r.MessageBurst)
+	byteBurst := rateBurst(r.BytesPerSecond, r.ByteBurst)
+	if l.last.IsZero() {
+		l.messages, l.bytes = messageBurst, byteBurst
+	} else {
+		elapsed := now.Sub(l.last).Seconds()
+		l.messages = math.Min(messageBurst, l.messages+elapsed*r.MessagesPerSecond)
+		l.bytes = math.Min(byteBurst, l.bytes+elapsed*r.BytesPerSecond)
+	}
+	l.last = now
+
+	if r.MessagesPerSecond > 0 && l.messages < 1 {
+		return time.Duration((1 - l.messages) / r.MessagesPerSecond * float64(time.Second)), ErrorMessageRate
+	}
+	//messages bigger than burst pass with full bucket, leaving debt
+	need := math.Min(float64(size), byteBurst)
+	if r.BytesPerSecond > 0 && l.bytes < need {
+		return time.Duration((need - l.bytes) / r.BytesPerSecond * float64(time.Second)), ErrorByteRate
+	}
+
+	if r.MessagesPerSecond > 0 {
+		l.messages--
+	}
+	if r.BytesPerSecond > 0 {
+		l.bytes -= float64(size)
+	}
+	return 0, nil
+}
+
+/**
+Check if packet is event or ack, connect and disconnect ones are not limited
+*/
+func isEventPacket(msg *protocol.Message) bool {
+	switch msg.Type {
+	case protocol.MessageTypeEmit, protocol.MessageTypeAckRequest,
+		protocol.MessageTypeAckResponse:
+		return true
+	}
+	return false
+}
+
+func (r *RateLimit) enabled() bool {
+	return r.MessagesPerSecond > 0 || r.BytesPerSecond > 0 || r.MaxPayload > 0
+}
+
+/**
+Check incoming message of the connection against server RateLimit,
+returns false if message has to be skipped, closeErr is set
+if connection has to be closed
+*/
+func (c *Channel) allowMessage(size int) (ok bool, closeErr error) {
+	if c.server == nil || !c.server.RateLimit.enabled() {
+		return true, nil
+	}
+	limit := &c.server.RateLimit
+
+	for {
+		wait, err := c.limiter.take(limit, size, c.clock().Now())
+		if err == nil {
+			return true, nil
+		}
+
+		c.server.stats.addRateLimited()
+		c.log().Warn("rate limited", "sid", c.Id(), "size", size, "error", err)
+		if c.server.OnRateLimited != nil {
+			c.server.OnRateLimited(c, err)
+		}
+
+		switch {
+		case limit.Policy == RateDisconnect:
+			return false, err
+		case limit.Policy == RateDelay && err != ErrorPayloadTooLarge:
+			timer := c.clock().NewTimer(wait)
+			select {
+			case <-timer.C():
+			case <-c.done:
+				timer.Stop()
+				return false, nil
+			}
+		default:
+			return false, nil
+		}
+	}
+}
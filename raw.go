@@ -0,0 +1,59 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"strconv"
+)
+
+var (
+	ErrorWrongPacketType = errors.New("Wrong engine.io packet type")
+)
+
+/**
+Low level handler of received packets, called in inLoop before packet
+is processed, so it must not block. Binary packets come with their
+attachments. Packets parser can't decode, like engine.io noop or
+custom types, have MessageTypeRaw type and Source only. Returns true
+if packet is handled, it is dropped then
+*/
+type RawPacketHandler func(c *Channel, msg protocol.Message) bool
+
+/**
+Add handler of raw packets of the connection, for server or client.
+Namespaces don't get them, packets of all namespaces go to the server
+*/
+func (m *methods) OnRawPacket(f RawPacketHandler) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	m.rawHandlers = append(m.rawHandlers, f)
+}
+
+/**
+Pass packet to raw packet handlers, true if one of them took it
+*/
+func (m *methods) callRaw(c *Channel, msg *protocol.Message) bool {
+	m.messageHandlersLock.RLock()
+	handlers := m.rawHandlers
+	m.messageHandlersLock.RUnlock()
+
+	for _, f := range handlers {
+		if f(c, *msg) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+Send engine.io packet of given type as is, payload follows type
+digit, like "6" noop with empty payload. It goes through outgoing
+queue after packets queued before; peer must know custom types
+*/
+func (c *Channel) SendRaw(msgType int, payload string) error {
+	if msgType < 0 || msgType > 9 {
+		return ErrorWrongPacketType
+	}
+	return c.enqueue(strconv.Itoa(msgType) + payload)
+}
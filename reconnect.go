@@ -0,0 +1,268 @@
+package gosocketio
+
+import (
+	"context"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"github.com/graarh/golang-socketio/transport"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	//fired with lost channel before each reconnect attempt
+	OnReconnecting = "reconnecting"
+	//fired with new channel after successful reconnect
+	OnReconnect = "reconnect"
+	//fired with lost channel when MaxAttempts attempts failed
+	OnReconnectFailed = "reconnect_failed"
+
+	DefaultReconnectDelay    = time.Second
+	DefaultReconnectMaxDelay = 5 * time.Second
+)
+
+/**
+Reconnect timings of ReconnectingClient: delay before each attempt
+starts from Delay and doubles up to MaxDelay
+*/
+type ReconnectConfig struct {
+	//namespace, queue, tracing and logger of every connection
+	ClientConfig
+
+	//delay before first attempt, DefaultReconnectDelay if 0
+	Delay time.Duration
+	//upper bound of delay, DefaultReconnectMaxDelay if 0
+	MaxDelay time.Duration
+	//each delay is randomly changed by up to this fraction of it, 0..1
+	Jitter float64
+	//attempts after connection is lost, 0 means no limit
+	MaxAttempts int
+	//emits kept while reconnecting, none by default
+	Offline OfflineConfig
+}
+
+/**
+Client which connects again when connection is lost.
+Handlers are kept and work with every new connection,
+OnConnection and OnDisconnection are fired for each of them.
+Disconnect by Close or by server disconnect packet is final
+*/
+type ReconnectingClient struct {
+	methods
+
+	url    string
+	tr     transport.Transport
+	config ReconnectConfig
+
+	channel *Channel
+	closed  bool
+	failed  bool //connection is lost for good, see connectionLost
+	stop    chan struct{}
+	lock    sync.Mutex
+
+	offline  []offlineEmit //buffered while reconnecting, see OfflineConfig
+	flushing bool
+}
+
+/**
+Connect like DialConfig and keep reconnecting when connection
+is lost. The first connect is not retried, its error is returned
+*/
+func DialReconnecting(url string, tr transport.Transport, config ReconnectConfig) (*ReconnectingClient, error) {
+	rc := &ReconnectingClient{
+		url:    url,
+		tr:     tr,
+		config: config,
+		stop:   make(chan struct{}),
+	}
+	rc.initMethods()
+	rc.onDisconnection = rc.connectionLost
+
+	c, err := rc.handshake()
+	if err != nil {
+		return nil, err
+	}
+	rc.channel = c
+	startLoops(c, &rc.methods)
+
+	return rc, nil
+}
+
+func (rc *ReconnectingClient) handshake() (*Channel, error) {
+	c := &Channel{}
+	c.initChannel(rc.config.Queue)
+	c.trace = rc.config.Trace
+	c.parser = rc.config.Parser
+	c.codec = rc.config.Codec
+	c.clk = rc.config.Clock
+	c.streamConfig = rc.config.Streams
+	c.chunkConfig = rc.config.Chunks
+	c.dispatchConfig = rc.config.Dispatch
+	c.pool = rc.config.Dispatch.newPool()
+	c.recovery = rc.Channel().nextRecovery()
+	c.logger.Store(loggerHolder{rc.config.Logger})
+	if rc.config.Namespace != protocol.DefaultNamespace {
+		c.namespace = rc.config.Namespace
+	}
+
+	if err := dialTransports(context.Background(), c, rc.url, rc.tr, rc.config.Transports); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+/**
+Get channel of current connection, it is not alive
+while client is reconnecting
+*/
+func (rc *ReconnectingClient) Channel() *Channel {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	return rc.channel
+}
+
+/**
+Checks that client is connected now
+*/
+func (rc *ReconnectingClient) IsAlive() bool {
+	return rc.Channel().IsAlive()
+}
+
+/**
+Emit with current connection, see Channel.Emit. While reconnecting
+emit is buffered if Offline.Size is set, otherwise ErrorSocketClosed
+is returned
+*/
+func (rc *ReconnectingClient) Emit(method string, args interface{}) error {
+	return rc.emitOrBuffer(method, args)
+}
+
+/**
+Emit which is never buffered, for data soon outdated. While
+reconnecting ErrorSocketClosed is returned, see Channel.EmitVolatile
+*/
+func (rc *ReconnectingClient) EmitVolatile(method string, args interface{}) error {
+	return rc.Channel().EmitVolatile(method, args)
+}
+
+/**
+TryEmit with current connection, see Channel.TryEmit
+*/
+func (rc *ReconnectingClient) TryEmit(method string, args interface{}) error {
+	return rc.Channel().TryEmit(method, args)
+}
+
+/**
+Ack with current connection, see Channel.Ack
+*/
+func (rc *ReconnectingClient) Ack(method string, args interface{}, timeout time.Duration) (string, error) {
+	return rc.Channel().Ack(method, args, timeout)
+}
+
+/**
+Close connection and stop reconnecting
+*/
+func (rc *ReconnectingClient) Close() {
+	rc.lock.Lock()
+	if rc.closed {
+		rc.lock.Unlock()
+		return
+	}
+	rc.closed = true
+	rc.offline = nil
+	close(rc.stop)
+	c := rc.channel
+	rc.lock.Unlock()
+
+	closeChannel(c, &rc.methods)
+}
+
+/**
+Disconnection system handler, starts reconnecting if current
+connection failed. Channel closed by this side, by server
+disconnect packet or refused by server is not reconnected
+*/
+func (rc *ReconnectingClient) connectionLost(c *Channel) {
+	c.aliveLock.Lock()
+	closeErr := c.closeErr
+	c.aliveLock.Unlock()
+
+	var connectErr *ConnectError
+	if closeErr == nil || errors.Is(closeErr, ErrorPeerDisconnect) || errors.As(closeErr, &connectErr) {
+		rc.dropOffline()
+		return
+	}
+
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if rc.closed || rc.channel != c {
+		return
+	}
+
+	go rc.reconnect(c)
+}
+
+func (rc *ReconnectingClient) reconnect(lost *Channel) {
+	delay := rc.config.Delay
+	if delay == 0 {
+		delay = DefaultReconnectDelay
+	}
+	maxDelay := rc.config.MaxDelay
+	if maxDelay == 0 {
+		maxDelay = DefaultReconnectMaxDelay
+	}
+
+	for attempt := 1; rc.config.MaxAttempts == 0 || attempt <= rc.config.MaxAttempts; attempt++ {
+		rc.callLoopEvent(lost, OnReconnecting)
+
+		timer := rc.clock().NewTimer(jitter(delay, rc.config.Jitter))
+		select {
+		case <-timer.C():
+		case <-rc.stop:
+			timer.Stop()
+			return
+		}
+
+		c, err := rc.handshake()
+		if err == nil {
+			rc.lock.Lock()
+			if rc.closed {
+				rc.lock.Unlock()
+				c.conn.Close()
+				return
+			}
+			rc.channel = c
+			rc.lock.Unlock()
+
+			startLoops(c, &rc.methods)
+			rc.flush(c)
+			rc.callLoopEvent(c, OnReconnect)
+			return
+		}
+
+		lost.log().Warn("reconnect failed", "attempt", attempt, "error", err)
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+
+	lost.log().Error("reconnect attempts exhausted", "attempts", rc.config.MaxAttempts)
+	rc.dropOffline()
+	rc.callLoopEvent(lost, OnReconnectFailed)
+}
+
+/**
+Randomize delay by up to given fraction of it
+*/
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	return d + time.Duration((rand.Float64()*2-1)*fraction*float64(d))
+}
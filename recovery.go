@@ -0,0 +1,475 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"github.com/graarh/golang-socketio/transport"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRecoveryBacklog = 500
+)
+
+/**
+Connection state recovery, EIO=4 only. Server tells every socket
+a private session id and numbers its events; client which lost
+connection sends them back on reconnect, and gets the same socket id,
+rooms and stored values, and events it missed
+*/
+type RecoveryConfig struct {
+	//how long state of lost channel is kept, 0 disables recovery
+	MaxDisconnectionDuration time.Duration
+	//events kept for replay per channel, DefaultRecoveryBacklog if 0
+	Backlog int
+}
+
+func (rc *RecoveryConfig) backlog() int {
+	if rc.Backlog <= 0 {
+		return DefaultRecoveryBacklog
+	}
+	return rc.Backlog
+}
+
+/**
+Event sent to channel, with its offset
+*/
+type backlogEvent struct {
+	offset   uint64
+	commands []string
+}
+
+/**
+Broadcast which came while channel was lost
+*/
+type missedEvent struct {
+	method string
+	args   interface{}
+}
+
+/**
+Recovery state of channel. Server side numbers sent events and
+keeps latest of them, client side tracks offset of the last received
+one. Both know session id (pid) given by server
+*/
+type recovery struct {
+	lock      sync.Mutex
+	pid       string
+	id        string //socket id taken from lost channel
+	recovered bool
+
+	offset  uint64 //of last sent event
+	backlog []backlogEvent
+
+	last string //client: offset of last received event
+}
+
+/**
+State of lost channel waiting for reconnect
+*/
+type lostChannel struct {
+	id, namespace string
+	rooms         []string
+	session       map[interface{}]interface{}
+
+	offset     uint64
+	backlog    []backlogEvent
+	missed     []missedEvent
+	incomplete bool //more broadcasts missed than backlog holds
+
+	expires time.Time
+}
+
+/**
+Recovery of new server channel, nil if it is disabled
+*/
+func (s *Server) newRecovery(version int) *recovery {
+	if s.Recovery.MaxDisconnectionDuration <= 0 || version != ProtocolVersion4 {
+		return nil
+	}
+	return &recovery{}
+}
+
+/**
+Check if connection closed with err may be recovered:
+transport failures are, disconnects by either side are not
+*/
+func recoverable(err error) bool {
+	var closeErr *transport.CloseError
+	if errors.As(err, &closeErr) {
+		return !errors.Is(err, ErrorPeerDisconnect)
+	}
+
+	reason := disconnectReason(err)
+	return reason == DisconnectReadError || reason == DisconnectWriteError ||
+		reason == DisconnectPingTimeout
+}
+
+/**
+Check if channel state was recovered on connect
+*/
+func (c *Channel) Recovered() bool {
+	if c.recovery == nil {
+		return false
+	}
+
+	c.recovery.lock.Lock()
+	defer c.recovery.lock.Unlock()
+
+	return c.recovery.recovered
+}
+
+/**
+Socket id kept from lost channel, empty if there is none
+*/
+func (c *Channel) recoveredId() string {
+	if c.recovery == nil {
+		return ""
+	}
+
+	c.recovery.lock.Lock()
+	defer c.recovery.lock.Unlock()
+
+	return c.recovery.id
+}
+
+/**
+Session id of channel recovery, empty if there is none
+*/
+func (c *Channel) recoveryPid() string {
+	if c.recovery == nil {
+		return ""
+	}
+
+	c.recovery.lock.Lock()
+	defer c.recovery.lock.Unlock()
+
+	return c.recovery.pid
+}
+
+/**
+Encode event sent by server, numbering it and keeping it for replay
+if recovery is active
+*/
+func (c *Channel) encodeEvent(msg *protocol.Message) ([]string, error) {
+	r := c.recovery
+	if c.server == nil || r == nil || msg.Type != protocol.MessageTypeEmit {
+		return c.packetParser().Encode(msg)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.pid == "" {
+		return c.packetParser().Encode(msg)
+	}
+
+	offset := r.offset + 1
+	appendArg(msg, strconv.FormatUint(offset, 10))
+
+	commands, err := c.packetParser().Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	r.offset = offset
+	r.backlog = append(r.backlog, backlogEvent{offset, commands})
+	if size := c.server.Recovery.backlog(); len(r.backlog) > size {
+		r.backlog = append([]backlogEvent(nil), r.backlog[len(r.backlog)-size:]...)
+	}
+	return commands, nil
+}
+
+/**
+Start recovery session of connected server channel: restore lost
+channel given by connect payload, or give new session id.
+Returns events to replay after connect reply
+*/
+func (c *Channel) startRecovery(payload string) func() {
+	if c.recovery == nil {
+		return func() {}
+	}
+
+	var auth struct {
+		Pid    string `json:"pid"`
+		Offset string `json:"offset"`
+	}
+	json.Unmarshal([]byte(payload), &auth)
+
+	lost, offset := c.server.takeLost(auth.Pid, c.Namespace(), auth.Offset)
+	if lost == nil {
+		pid := generateNewId(c.Id())
+		c.recovery.lock.Lock()
+		c.recovery.pid = pid
+		c.recovery.lock.Unlock()
+		return func() {}
+	}
+
+	c.recovery.lock.Lock()
+	c.recovery.pid = auth.Pid
+	c.recovery.id = lost.id
+	c.recovery.recovered = true
+	c.recovery.offset = lost.offset
+	c.recovery.backlog = lost.backlog
+	c.recovery.lock.Unlock()
+
+	for _, room := range lost.rooms {
+		c.Join(room)
+	}
+	for key, value := range lost.session {
+		c.session.Store(key, value)
+	}
+	c.log().Info("channel recovered", "sid", c.Id(), "pid", auth.Pid)
+
+	return func() {
+		for _, event := range lost.backlog {
+			if event.offset > offset {
+				c.enqueueWith(sendOptions{event: true}, event.commands...)
+			}
+		}
+		for _, event := range lost.missed {
+			args := event.args
+			if c.server.BroadcastFilter != nil {
+				var ok bool
+				if args, ok = c.server.BroadcastFilter(c, event.method, event.args); !ok {
+					continue
+				}
+			}
+			c.Emit(event.method, args)
+		}
+	}
+}
+
+/**
+Keep state of channel lost because of connection failure,
+before its rooms and values are cleaned up
+*/
+func (c *Channel) saveLost() {
+	if c.server == nil || c.recovery == nil {
+		return
+	}
+
+	c.aliveLock.Lock()
+	alive, closeErr := c.alive, c.closeErr
+	c.aliveLock.Unlock()
+	if alive || !recoverable(closeErr) {
+		return
+	}
+
+	lost := &lostChannel{
+		id:        c.Id(),
+		namespace: c.Namespace(),
+		rooms:     c.Rooms(),
+		session:   make(map[interface{}]interface{}),
+		expires:   c.clock().Now().Add(c.server.Recovery.MaxDisconnectionDuration),
+	}
+
+	c.recovery.lock.Lock()
+	pid := c.recovery.pid
+	lost.offset = c.recovery.offset
+	lost.backlog = c.recovery.backlog
+	c.recovery.lock.Unlock()
+	if pid == "" {
+		return
+	}
+
+	c.session.Range(func(key, value interface{}) bool {
+		lost.session[key] = value
+		return true
+	})
+
+	s := c.server
+	s.lostLock.Lock()
+	defer s.lostLock.Unlock()
+
+	now := c.clock().Now()
+	for pid, l := range s.lost {
+		if now.After(l.expires) {
+			delete(s.lost, pid)
+		}
+	}
+	if s.lost == nil {
+		s.lost = make(map[string]*lostChannel)
+	}
+	s.lost[pid] = lost
+}
+
+/**
+Take lost channel of given session, nil if there is none, it has
+expired, or events after offset can't be replayed. Returns offset parsed
+*/
+func (s *Server) takeLost(pid, namespace, offset string) (*lostChannel, uint64) {
+	if pid == "" {
+		return nil, 0
+	}
+
+	s.lostLock.Lock()
+	lost, ok := s.lost[pid]
+	delete(s.lost, pid)
+	s.lostLock.Unlock()
+
+	if !ok || lost.namespace != namespace || s.clock().Now().After(lost.expires) || lost.incomplete {
+		return nil, 0
+	}
+
+	//client got no events yet
+	if offset == "" {
+		offset = "0"
+	}
+	last, err := strconv.ParseUint(offset, 10, 64)
+	if err != nil || last > lost.offset {
+		return nil, 0
+	}
+	//events right after the last received one should be kept
+	if last < lost.offset && (len(lost.backlog) == 0 || lost.backlog[0].offset > last+1) {
+		return nil, 0
+	}
+	return lost, last
+}
+
+/**
+Keep broadcast for lost channels it targets, they get it on recovery
+*/
+func (s *Server) recordMissed(namespace string, opts *BroadcastOptions, method string, args interface{}) {
+	if opts.Volatile {
+		return
+	}
+
+	s.lostLock.Lock()
+	defer s.lostLock.Unlock()
+
+	for _, lost := range s.lost {
+		if lost.namespace != namespace || !lost.targeted(opts) {
+			continue
+		}
+		if len(lost.missed) >= s.Recovery.backlog() {
+			lost.incomplete = true
+			continue
+		}
+		lost.missed = append(lost.missed, missedEvent{method, args})
+	}
+}
+
+/**
+Check if lost channel is target of broadcast
+*/
+func (l *lostChannel) targeted(opts *BroadcastOptions) bool {
+	for _, except := range opts.Except {
+		if except == l.id {
+			return false
+		}
+		for _, joined := range l.rooms {
+			if except == joined {
+				return false
+			}
+		}
+	}
+	if len(opts.Rooms) == 0 {
+		return true
+	}
+	for _, room := range opts.Rooms {
+		for _, joined := range l.rooms {
+			if room == joined {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/**
+Connect payload of client resuming lost session, empty if there is none
+*/
+func (c *Channel) recoveryPayload() string {
+	if c.recovery == nil {
+		return ""
+	}
+
+	c.recovery.lock.Lock()
+	defer c.recovery.lock.Unlock()
+
+	if c.recovery.pid == "" {
+		return ""
+	}
+	payload, _ := json.Marshal(map[string]string{
+		"pid":    c.recovery.pid,
+		"offset": c.recovery.last,
+	})
+	return string(payload)
+}
+
+/**
+Take session id from server connect reply, client channel
+is recovered if it is the one sent with connect
+*/
+func (c *Channel) acceptRecovery(reply string) {
+	if c.recovery == nil {
+		return
+	}
+
+	var connected struct {
+		Pid string `json:"pid"`
+	}
+	json.Unmarshal([]byte(reply), &connected)
+
+	c.recovery.lock.Lock()
+	defer c.recovery.lock.Unlock()
+
+	c.recovery.recovered = connected.Pid != "" && connected.Pid == c.recovery.pid
+	if !c.recovery.recovered {
+		c.recovery.last = ""
+	}
+	c.recovery.pid = connected.Pid
+}
+
+/**
+Recovery of client channel reconnecting after lost one
+*/
+func (c *Channel) nextRecovery() *recovery {
+	if c == nil || c.recovery == nil {
+		return &recovery{}
+	}
+
+	c.recovery.lock.Lock()
+	defer c.recovery.lock.Unlock()
+
+	return &recovery{pid: c.recovery.pid, last: c.recovery.last}
+}
+
+/**
+Remove event offset appended by server from received event
+arguments and remember it, client side
+*/
+func (c *Channel) trackOffset(msg *protocol.Message) {
+	if c.recovery == nil || msg.Type != protocol.MessageTypeEmit {
+		return
+	}
+
+	c.recovery.lock.Lock()
+	defer c.recovery.lock.Unlock()
+
+	if c.recovery.pid == "" {
+		return
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte("["+msg.Args+"]"), &items); err != nil || len(items) == 0 {
+		return
+	}
+	var offset string
+	if err := json.Unmarshal(items[len(items)-1], &offset); err != nil {
+		return
+	}
+
+	rest := make([]string, len(items)-1)
+	for i, item := range items[:len(items)-1] {
+		rest[i] = string(item)
+	}
+	msg.Args = strings.Join(rest, ",")
+	dropLastValue(msg)
+	c.recovery.last = offset
+}
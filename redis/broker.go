@@ -0,0 +1,390 @@
+package redis
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/internal/envelope"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPrefix  = "socket.io"
+	DefaultTimeout = 5 * time.Second
+
+	//delay before subscriber connection is established again
+	reconnectDelay = time.Second
+)
+
+var (
+	ErrorBrokerClosed = errors.New("Broker closed")
+)
+
+/**
+Connection of server instance to redis, creates adapters
+for namespaces of the server. Broadcasts are passed to other
+instances through redis pub/sub in socket.io-redis format,
+so node.js socket.io servers can share them too:
+
+	broker := redis.NewBroker("localhost:6379")
+	server.NewAdapter = broker.NewAdapter
+*/
+type Broker struct {
+	Addr     string
+	Password string
+	//first part of channel names, DefaultPrefix if empty
+	Prefix string
+	//dial and publish timeout, DefaultTimeout if 0
+	Timeout time.Duration
+	//address other instances reach this one at, like "10.0.0.2:8000",
+	//needed when broker is gosocketio.SessionRegistry
+	Advertise string
+
+	uid string
+
+	adapters map[string]*adapter //by subscription pattern
+	sub      *respConn
+	started  bool
+	closed   bool
+	done     chan struct{}
+	lock     sync.Mutex
+
+	pub publisher
+}
+
+/**
+Connection for publishing, dialed on first publish
+*/
+type publisher struct {
+	conn   *respConn
+	closed bool
+	lock   sync.Mutex
+}
+
+/**
+Adapter of one namespace, keeps rooms locally
+and publishes broadcasts for other instances
+*/
+type adapter struct {
+	gosocketio.Adapter
+
+	broker         *Broker
+	namespace      string
+	requestPattern string //subscription of requests, like server-side events
+}
+
+/**
+Create broker for redis at given address, connection
+is established when first adapter is created
+*/
+func NewBroker(addr string) *Broker {
+	return &Broker{
+		Addr:     addr,
+		uid:      envelope.NewUid(),
+		adapters: make(map[string]*adapter),
+		done:     make(chan struct{}),
+	}
+}
+
+func prefixOrDefault(prefix string) string {
+	if prefix == "" {
+		return DefaultPrefix
+	}
+	return prefix
+}
+
+func timeoutOrDefault(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		return DefaultTimeout
+	}
+	return timeout
+}
+
+func (b *Broker) timeout() time.Duration {
+	return timeoutOrDefault(b.Timeout)
+}
+
+/**
+Channel of namespace broadcasts, room broadcasts go to channel
+with room name appended
+*/
+func namespaceChannel(prefix, namespace string) string {
+	return prefixOrDefault(prefix) + "#" + namespace + "#"
+}
+
+func (b *Broker) channel(namespace string) string {
+	return namespaceChannel(b.Prefix, namespace)
+}
+
+/**
+Channel of requests to all instances, like server-side events
+*/
+func (b *Broker) requestChannel(namespace string) string {
+	return prefixOrDefault(b.Prefix) + "-request#" + namespace + "#"
+}
+
+/**
+Create adapter for namespace, to be used as Server.NewAdapter
+*/
+func (b *Broker) NewAdapter(namespace string, local gosocketio.Adapter) gosocketio.Adapter {
+	a := &adapter{
+		Adapter:        local,
+		broker:         b,
+		namespace:      namespace,
+		requestPattern: escapePattern(b.requestChannel(namespace)),
+	}
+	pattern := escapePattern(b.channel(namespace)) + "*"
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.adapters[pattern] = a
+	b.adapters[a.requestPattern] = a
+	if b.sub != nil {
+		b.sub.write("PSUBSCRIBE", pattern, a.requestPattern)
+	}
+	if !b.started && !b.closed {
+		b.started = true
+		go b.subscribeLoop()
+	}
+
+	return a
+}
+
+/**
+Stop receiving broadcasts of other instances and close connections
+*/
+func (b *Broker) Close() error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	if b.sub != nil {
+		b.sub.Close()
+	}
+	b.lock.Unlock()
+
+	b.pub.Close()
+	return nil
+}
+
+/**
+Broadcast to local channels and publish it for other instances
+*/
+func (a *adapter) Broadcast(opts *gosocketio.BroadcastOptions, method string, args interface{}) error {
+	if err := a.Adapter.Broadcast(opts, method, args); err != nil {
+		return err
+	}
+
+	payload, err := envelope.EncodeBroadcast(a.broker.uid, a.namespace, opts, method, args)
+	if err != nil {
+		return err
+	}
+	return a.broker.pub.publish(a.broker.Addr, a.broker.Password, a.broker.timeout(),
+		broadcastChannel(a.broker.Prefix, a.namespace, opts), payload)
+}
+
+/**
+Publish server-side event for other instances, in socket.io-redis
+request format, so node.js servers get it with serverSideEmit handlers
+*/
+func (a *adapter) ServerSideEmit(method string, args interface{}) error {
+	payload, err := json.Marshal(envelope.ServerSideRequest(a.broker.uid, "", method, args))
+	if err != nil {
+		return err
+	}
+	return a.broker.pub.publish(a.broker.Addr, a.broker.Password, a.broker.timeout(),
+		a.broker.requestChannel(a.namespace), payload)
+}
+
+/**
+Channel to publish broadcast to, broadcast to single room
+goes to channel of the room
+*/
+func broadcastChannel(prefix, namespace string, opts *gosocketio.BroadcastOptions) string {
+	channel := namespaceChannel(prefix, namespace)
+	if len(opts.Rooms) == 1 {
+		channel += opts.Rooms[0] + "#"
+	}
+	return channel
+}
+
+func (p *publisher) publish(addr, password string, timeout time.Duration, channel string, payload []byte) error {
+	_, err := p.command(addr, password, timeout, "PUBLISH", channel, string(payload))
+	return err
+}
+
+/**
+Run command on publishing connection, dialed if there is none
+*/
+func (p *publisher) command(addr, password string, timeout time.Duration, args ...string) (interface{}, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return nil, ErrorBrokerClosed
+	}
+
+	if p.conn == nil {
+		conn, err := dialResp(addr, password, timeout)
+		if err != nil {
+			return nil, err
+		}
+		p.conn = conn
+	}
+
+	reply, err := p.conn.command(args...)
+	if err != nil {
+		//connection is in unknown state, next command dials again
+		if _, ok := err.(*ReplyError); !ok {
+			p.conn.Close()
+			p.conn = nil
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+/**
+Close connection, publishing after it fails
+*/
+func (p *publisher) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+}
+
+/**
+Keep subscriber connection, reconnecting until broker is closed
+*/
+func (b *Broker) subscribeLoop() {
+	for {
+		conn, err := dialResp(b.Addr, b.Password, b.timeout())
+		if err == nil {
+			b.listen(conn)
+			conn.Close()
+		}
+
+		select {
+		case <-b.done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+/**
+Subscribe to namespaces of all adapters and deliver
+received broadcasts until connection breaks
+*/
+func (b *Broker) listen(conn *respConn) {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	args := []string{"PSUBSCRIBE"}
+	for pattern := range b.adapters {
+		args = append(args, pattern)
+	}
+	if err := conn.write(args...); err != nil {
+		b.lock.Unlock()
+		return
+	}
+	b.sub = conn
+	b.lock.Unlock()
+
+	defer func() {
+		b.lock.Lock()
+		if b.sub == conn {
+			b.sub = nil
+		}
+		b.lock.Unlock()
+	}()
+
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return
+		}
+
+		//pmessage, pattern, channel, payload
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 4 {
+			continue
+		}
+		kind, _ := items[0].([]byte)
+		pattern, _ := items[1].([]byte)
+		payload, _ := items[3].([]byte)
+		if string(kind) != "pmessage" {
+			continue
+		}
+
+		b.lock.Lock()
+		a := b.adapters[string(pattern)]
+		b.lock.Unlock()
+		if a == nil {
+			continue
+		}
+		if string(pattern) == a.requestPattern {
+			a.request(payload)
+		} else {
+			a.deliver(payload)
+		}
+	}
+}
+
+/**
+Broadcast message of other instance to local channels,
+own messages and packets other than events are skipped
+*/
+func (a *adapter) deliver(payload []byte) {
+	b, ok := envelope.DecodeBroadcast(payload)
+	if !ok || b.Uid == a.broker.uid {
+		return
+	}
+	a.Adapter.Broadcast(b.Opts, b.Method, b.Args)
+}
+
+/**
+Handle request of other instance, only server-side events are
+supported; they are given to the local adapter
+*/
+func (a *adapter) request(payload []byte) {
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return
+	}
+	r, ok := envelope.DecodeRequest(value)
+	if !ok || r.Uid == a.broker.uid {
+		return
+	}
+	if receiver, ok := a.Adapter.(envelope.ServerSideReceiver); ok {
+		receiver.ReceiveServerSide(r.Method, r.Args)
+	}
+}
+
+/**
+Escape glob characters of redis patterns
+*/
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,500 @@
+package redis
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"github.com/graarh/golang-socketio/internal/envelope"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testPattern        = "socket.io#/#*"
+	testRequestPattern = "socket.io-request#/#"
+)
+
+type published struct {
+	channel string
+	payload []byte
+}
+
+/**
+Redis server speaking resp over tcp: keeps hashes, records
+publishes and passes messages given by test to subscribers
+*/
+type fakeRedis struct {
+	listener   net.Listener
+	password   string
+	published  chan published
+	subscribed chan []string
+
+	conns  []*fakeClient
+	hashes map[string]map[string]string
+	lock   sync.Mutex
+}
+
+type fakeClient struct {
+	conn       net.Conn
+	subscriber bool
+	lock       sync.Mutex
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{
+		listener:   listener,
+		published:  make(chan published, 16),
+		subscribed: make(chan []string, 16),
+		hashes:     make(map[string]map[string]string),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			fc := &fakeClient{conn: conn}
+			r.lock.Lock()
+			r.conns = append(r.conns, fc)
+			r.lock.Unlock()
+			go r.serve(fc)
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		r.drop(func(*fakeClient) bool { return true })
+	})
+	return r
+}
+
+func (r *fakeRedis) addr() string {
+	return r.listener.Addr().String()
+}
+
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func (fc *fakeClient) send(reply string) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	fc.conn.Write([]byte(reply))
+}
+
+/**
+Answer commands of connection until it is closed
+*/
+func (r *fakeRedis) serve(fc *fakeClient) {
+	rc := &respConn{conn: fc.conn, reader: bufio.NewReader(fc.conn), timeout: time.Second}
+	for {
+		value, err := rc.read()
+		if err != nil {
+			fc.conn.Close()
+			return
+		}
+		items, _ := value.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			b, _ := item.([]byte)
+			args[i] = string(b)
+		}
+		if len(args) == 0 {
+			fc.send("-ERR empty command\r\n")
+			continue
+		}
+		fc.send(r.command(fc, args))
+	}
+}
+
+func (r *fakeRedis) command(fc *fakeClient, args []string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if len(args) != 2 || args[1] != r.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "PSUBSCRIBE":
+		fc.subscriber = true
+		reply := ""
+		for i, pattern := range args[1:] {
+			reply += "*3\r\n" + bulk("psubscribe") + bulk(pattern) + ":" + strconv.Itoa(i+1) + "\r\n"
+		}
+		r.subscribed <- args[1:]
+		return reply
+	case "PUBLISH":
+		r.published <- published{args[1], []byte(args[2])}
+		return ":0\r\n"
+	case "HSET":
+		if r.hashes[args[1]] == nil {
+			r.hashes[args[1]] = make(map[string]string)
+		}
+		r.hashes[args[1]][args[2]] = args[3]
+		return ":1\r\n"
+	case "HGET":
+		value, ok := r.hashes[args[1]][args[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(value)
+	case "HDEL":
+		delete(r.hashes[args[1]], args[2])
+		return ":1\r\n"
+	case "HGETALL":
+		hash := r.hashes[args[1]]
+		reply := "*" + strconv.Itoa(2*len(hash)) + "\r\n"
+		for field, value := range hash {
+			reply += bulk(field) + bulk(value)
+		}
+		return reply
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+/**
+Pass message to subscribed connections, as if published by other instance
+*/
+func (r *fakeRedis) pmessage(pattern, channel string, payload []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, fc := range r.conns {
+		if fc.subscriber {
+			fc.send("*4\r\n" + bulk("pmessage") + bulk(pattern) + bulk(channel) + bulk(string(payload)))
+		}
+	}
+}
+
+/**
+Close connections matching f, like redis restart would
+*/
+func (r *fakeRedis) drop(f func(fc *fakeClient) bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	conns := r.conns[:0]
+	for _, fc := range r.conns {
+		if f(fc) {
+			fc.conn.Close()
+		} else {
+			conns = append(conns, fc)
+		}
+	}
+	r.conns = conns
+}
+
+func (r *fakeRedis) nextPublished(t *testing.T) published {
+	t.Helper()
+	select {
+	case p := <-r.published:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("nothing published")
+		return published{}
+	}
+}
+
+func (r *fakeRedis) nextSubscribed(t *testing.T) []string {
+	t.Helper()
+	select {
+	case patterns := <-r.subscribed:
+		return patterns
+	case <-time.After(3 * time.Second):
+		t.Fatal("broker did not subscribe")
+		return nil
+	}
+}
+
+/**
+Serve server with redis broker, adapter of default namespace
+is created and subscribed before return
+*/
+func brokerServer(t *testing.T, r *fakeRedis) (*gosocketio.Server, *gosocketiotest.Transport, *Broker) {
+	broker := NewBroker(r.addr())
+	t.Cleanup(func() { broker.Close() })
+
+	tr := gosocketiotest.NewTransport()
+	s := gosocketio.NewServer(tr)
+	s.NewAdapter = broker.NewAdapter
+	s.OnServerSide("noop", func() {})
+	tr.Attach(s)
+
+	patterns := r.nextSubscribed(t)
+	if len(patterns) != 2 {
+		t.Fatalf("subscribed to %v", patterns)
+	}
+	return s, tr, broker
+}
+
+type testClient struct {
+	server *gosocketio.Channel
+	news   chan string
+}
+
+/**
+Connect clients, server side of i-th one joins rooms[i] if not empty
+*/
+func connectClients(t *testing.T, s *gosocketio.Server, tr *gosocketiotest.Transport, rooms ...string) []testClient {
+	connected := make(chan *gosocketio.Channel, 1)
+	s.On(gosocketio.OnConnection, func(c *gosocketio.Channel) {
+		connected <- c
+	})
+
+	result := make([]testClient, len(rooms))
+	for i, room := range rooms {
+		c, err := gosocketio.Dial(gosocketiotest.Url, tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(c.Close)
+		news := make(chan string, 10)
+		c.On("news", func(c *gosocketio.Channel, text string) {
+			news <- text
+		})
+		sc := <-connected
+		if room != "" {
+			sc.Join(room)
+		}
+		result[i] = testClient{sc, news}
+	}
+	return result
+}
+
+func (tc testClient) expect(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-tc.news:
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%q not received", want)
+	}
+}
+
+func (tc testClient) expectNothing(t *testing.T) {
+	t.Helper()
+	select {
+	case got := <-tc.news:
+		t.Fatalf("got %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBrokerPublish(t *testing.T) {
+	r := newFakeRedis(t)
+	s, _, broker := brokerServer(t, r)
+
+	tests := []struct {
+		name    string
+		emit    func() error
+		channel string
+		want    *envelope.Broadcast
+	}{
+		{"namespace", func() error {
+			return s.To().Emit("news", "all")
+		}, "socket.io#/#", &envelope.Broadcast{Method: "news", Args: "all",
+			Opts: &gosocketio.BroadcastOptions{Rooms: []string{}, Except: []string{}}}},
+		{"single room", func() error {
+			return s.To("room").Except("sid").Volatile().Emit("news", "room")
+		}, "socket.io#/#room#", &envelope.Broadcast{Method: "news", Args: "room",
+			Opts: &gosocketio.BroadcastOptions{Rooms: []string{"room"}, Except: []string{"sid"}, Volatile: true}}},
+		{"several rooms", func() error {
+			return s.To("a", "b").Emit("news", []byte{1})
+		}, "socket.io#/#", &envelope.Broadcast{Method: "news", Args: []byte{1},
+			Opts: &gosocketio.BroadcastOptions{Rooms: []string{"a", "b"}, Except: []string{}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.emit(); err != nil {
+				t.Fatal(err)
+			}
+			p := r.nextPublished(t)
+			if p.channel != test.channel {
+				t.Fatalf("published to %q, want %q", p.channel, test.channel)
+			}
+			b, ok := envelope.DecodeBroadcast(p.payload)
+			test.want.Uid = broker.uid
+			test.want.Namespace = "/"
+			if !ok || !reflect.DeepEqual(b, test.want) {
+				t.Fatalf("published %+v, want %+v", b, test.want)
+			}
+		})
+	}
+
+	//local broadcasts stay in this instance
+	s.To("room").Local().Emit("news", "local")
+	select {
+	case p := <-r.published:
+		t.Fatalf("local broadcast published to %q", p.channel)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBrokerDeliver(t *testing.T) {
+	r := newFakeRedis(t)
+	s, tr, broker := brokerServer(t, r)
+	clients := connectClients(t, s, tr, "room", "room", "")
+	deliver := func(uid string, opts *gosocketio.BroadcastOptions, text string) {
+		payload, err := envelope.EncodeBroadcast(uid, "/", opts, "news", text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.pmessage(testPattern, "socket.io#/#", payload)
+	}
+
+	deliver("other", &gosocketio.BroadcastOptions{}, "all")
+	for _, tc := range clients {
+		tc.expect(t, "all")
+	}
+
+	deliver("other", &gosocketio.BroadcastOptions{Rooms: []string{"room"}}, "room")
+	clients[0].expect(t, "room")
+	clients[1].expect(t, "room")
+	clients[2].expectNothing(t)
+
+	deliver("other", &gosocketio.BroadcastOptions{Except: []string{clients[0].server.Id(), "room"}}, "except")
+	clients[2].expect(t, "except")
+	clients[0].expectNothing(t)
+	clients[1].expectNothing(t)
+
+	//own broadcasts were delivered when sent
+	deliver(broker.uid, &gosocketio.BroadcastOptions{}, "own")
+	for _, tc := range clients {
+		tc.expectNothing(t)
+	}
+}
+
+func TestServerSideEmit(t *testing.T) {
+	r := newFakeRedis(t)
+	s, _, broker := brokerServer(t, r)
+	received := make(chan string, 2)
+	s.OnServerSide("ping", func(text string) {
+		received <- text
+	})
+
+	if err := s.ServerSideEmit("ping", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	p := r.nextPublished(t)
+	var req interface{}
+	json.Unmarshal(p.payload, &req)
+	request, ok := envelope.DecodeRequest(req)
+	if p.channel != testRequestPattern || !ok || request.Uid != broker.uid ||
+		request.Method != "ping" || request.Args != "hello" {
+		t.Fatalf("published %q to %q", p.payload, p.channel)
+	}
+	select {
+	case text := <-received:
+		t.Fatalf("own server-side event handled: %q", text)
+	default:
+	}
+
+	own, _ := json.Marshal(envelope.ServerSideRequest(broker.uid, "", "ping", "own"))
+	r.pmessage(testRequestPattern, testRequestPattern, own)
+	other, _ := json.Marshal(envelope.ServerSideRequest("other", "", "ping", "other"))
+	r.pmessage(testRequestPattern, testRequestPattern, other)
+	select {
+	case text := <-received:
+		if text != "other" {
+			t.Fatalf("handled %q", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server-side event of other instance not handled")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	r := newFakeRedis(t)
+	r.password = "secret"
+	broker := NewBroker(r.addr())
+	broker.Password = "secret"
+	broker.Advertise = "10.0.0.1:8000"
+	defer broker.Close()
+
+	if err := broker.AddSession("sid"); err != nil {
+		t.Fatal(err)
+	}
+	r.lock.Lock()
+	r.hashes["socket.io#sessions"]["remote"] = "10.0.0.2:8000"
+	r.lock.Unlock()
+	tests := []struct {
+		sid  string
+		addr string
+	}{
+		{"sid", ""},
+		{"remote", "10.0.0.2:8000"},
+		{"unknown", ""},
+	}
+	for _, test := range tests {
+		if addr, err := broker.ResolveSession(test.sid); err != nil || addr != test.addr {
+			t.Fatalf("%s resolved to %q, %v, want %q", test.sid, addr, err, test.addr)
+		}
+	}
+
+	//error reply keeps the connection
+	if _, err := broker.command("UNKNOWN"); err == nil || !strings.HasPrefix(err.Error(), "redis: ERR") {
+		t.Fatalf("got %v", err)
+	}
+	if err := broker.RemoveSession("sid"); err != nil {
+		t.Fatal(err)
+	}
+	r.lock.Lock()
+	dialed := len(r.conns)
+	r.lock.Unlock()
+	if dialed != 1 {
+		t.Fatalf("%d connections dialed", dialed)
+	}
+
+	wrong := NewBroker(r.addr())
+	wrong.Password = "wrong"
+	defer wrong.Close()
+	if _, err := wrong.ResolveSession("sid"); err == nil || !strings.HasPrefix(err.Error(), "redis: WRONGPASS") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestBrokerReconnect(t *testing.T) {
+	r := newFakeRedis(t)
+	s, tr, _ := brokerServer(t, r)
+	clients := connectClients(t, s, tr, "")
+	payload, _ := envelope.EncodeBroadcast("other", "/", &gosocketio.BroadcastOptions{}, "news", "again")
+
+	//subscriber dials again after reconnect delay with all patterns
+	r.drop(func(fc *fakeClient) bool { return fc.subscriber })
+	patterns := r.nextSubscribed(t)
+	if len(patterns) != 2 {
+		t.Fatalf("subscribed again to %v", patterns)
+	}
+	r.pmessage(testPattern, "socket.io#/#", payload)
+	clients[0].expect(t, "again")
+
+	//publisher dials again after its connection is dropped
+	if err := s.To().Emit("news", "first"); err != nil {
+		t.Fatal(err)
+	}
+	r.nextPublished(t)
+	clients[0].expect(t, "first")
+	r.drop(func(fc *fakeClient) bool { return !fc.subscriber })
+	deadline := time.Now().Add(time.Second)
+	for s.To().Emit("news", "second") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("publisher did not reconnect")
+		}
+	}
+	if p := r.nextPublished(t); p.channel != "socket.io#/#" {
+		t.Fatalf("published to %q", p.channel)
+	}
+}
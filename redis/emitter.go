@@ -0,0 +1,130 @@
+package redis
+
+import (
+	"github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/internal/envelope"
+	"github.com/graarh/golang-socketio/protocol"
+	"time"
+)
+
+/**
+Publisher of broadcasts for processes without socket.io server,
+like cron jobs and workers, same as socket.io-emitter. Servers
+using Broker deliver them to their channels:
+
+	emitter := redis.NewEmitter("localhost:6379")
+	defer emitter.Close()
+
+	emitter.ToRoom("user:42").Emit("notification", data)
+*/
+type Emitter struct {
+	Addr     string
+	Password string
+	//first part of channel names, DefaultPrefix if empty
+	Prefix string
+	//dial and publish timeout, DefaultTimeout if 0
+	Timeout time.Duration
+
+	uid string
+	pub publisher
+}
+
+/**
+Broadcast target of emitter, built by chained calls. It is immutable,
+every call returns new one, like gosocketio.Broadcaster
+*/
+type EmitterTarget struct {
+	emitter   *Emitter
+	namespace string
+	rooms     []string
+	except    []string
+	volatile  bool
+}
+
+/**
+Create emitter for redis at given address, connection
+is established on first emit
+*/
+func NewEmitter(addr string) *Emitter {
+	return &Emitter{
+		Addr: addr,
+		uid:  envelope.NewUid(),
+	}
+}
+
+/**
+Get target of all channels of given namespace
+*/
+func (e *Emitter) Of(namespace string) *EmitterTarget {
+	return &EmitterTarget{emitter: e, namespace: namespace}
+}
+
+/**
+Get target of channels of default namespace joined to given room
+*/
+func (e *Emitter) ToRoom(room string) *EmitterTarget {
+	return e.Of(protocol.DefaultNamespace).ToRoom(room)
+}
+
+/**
+Send message to all channels of default namespace
+*/
+func (e *Emitter) Emit(method string, args interface{}) error {
+	return e.Of(protocol.DefaultNamespace).Emit(method, args)
+}
+
+/**
+Close connection, emits after it fail with ErrorBrokerClosed
+*/
+func (e *Emitter) Close() error {
+	e.pub.Close()
+	return nil
+}
+
+/**
+Limit broadcast to channels joined to given room, several rooms
+can be chained, channel joined to more than one gets message once
+*/
+func (t *EmitterTarget) ToRoom(room string) *EmitterTarget {
+	result := *t
+	result.rooms = append(append([]string(nil), t.rooms...), room)
+	return &result
+}
+
+/**
+Skip channels with given id
+*/
+func (t *EmitterTarget) Except(id string) *EmitterTarget {
+	result := *t
+	result.except = append(append([]string(nil), t.except...), id)
+	return &result
+}
+
+/**
+Skip channels which are too slow to take the message,
+see gosocketio.Channel.EmitVolatile
+*/
+func (t *EmitterTarget) Volatile() *EmitterTarget {
+	result := *t
+	result.volatile = true
+	return &result
+}
+
+/**
+Publish message for all target channels
+*/
+func (t *EmitterTarget) Emit(method string, args interface{}) error {
+	opts := &gosocketio.BroadcastOptions{
+		Rooms:    t.rooms,
+		Except:   t.except,
+		Volatile: t.volatile,
+	}
+
+	payload, err := envelope.EncodeBroadcast(t.emitter.uid, t.namespace, opts, method, args)
+	if err != nil {
+		return err
+	}
+	e := t.emitter
+	return e.pub.publish(e.Addr, e.Password, timeoutOrDefault(e.Timeout),
+		broadcastChannel(e.Prefix, t.namespace, opts), payload)
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"encoding/json"
+	"github.com/graarh/golang-socketio"
+)
+
+/**
+Hash with presence of room members of all instances, by channel id
+*/
+func (b *Broker) presenceKey(namespace, room string) string {
+	return prefixOrDefault(b.Prefix) + "#presence#" + namespace + "#" + room
+}
+
+/**
+Store presence of channel in room, so other instances see it.
+Entries of instance which crashed stay until their channels
+are seen leaving, like on restart with the same ids
+*/
+func (a *adapter) AddPresence(c *gosocketio.Channel, room string, meta interface{}) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	_, err = a.broker.command("HSET", a.broker.presenceKey(a.namespace, room), c.Id(), string(data))
+	return err
+}
+
+func (a *adapter) RemovePresence(c *gosocketio.Channel, room string) error {
+	_, err := a.broker.command("HDEL", a.broker.presenceKey(a.namespace, room), c.Id())
+	return err
+}
+
+/**
+Get members of room present on all instances
+*/
+func (a *adapter) Presence(room string) ([]gosocketio.PresenceMember, error) {
+	reply, err := a.broker.command("HGETALL", a.broker.presenceKey(a.namespace, room))
+	if err != nil {
+		return nil, err
+	}
+
+	//field and value pairs
+	items, _ := reply.([]interface{})
+	members := make([]gosocketio.PresenceMember, 0, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		id, _ := items[i].([]byte)
+		data, _ := items[i+1].([]byte)
+
+		member := gosocketio.PresenceMember{Id: string(id)}
+		json.Unmarshal(data, &member.Meta)
+		members = append(members, member)
+	}
+	return members, nil
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"errors"
+)
+
+var (
+	ErrorNoAdvertise = errors.New("Advertise address is not set")
+)
+
+/**
+Hash with address of instance of every session connection
+*/
+func (b *Broker) sessionsKey() string {
+	return prefixOrDefault(b.Prefix) + "#sessions"
+}
+
+func (b *Broker) command(args ...string) (interface{}, error) {
+	return b.pub.command(b.Addr, b.Password, b.timeout(), args...)
+}
+
+/**
+Store session of this instance, so others forward its requests here.
+Sessions of instance which crashed stay, their requests fail there
+and clients connect again
+*/
+func (b *Broker) AddSession(sid string) error {
+	if b.Advertise == "" {
+		return ErrorNoAdvertise
+	}
+	_, err := b.command("HSET", b.sessionsKey(), sid, b.Advertise)
+	return err
+}
+
+func (b *Broker) RemoveSession(sid string) error {
+	_, err := b.command("HDEL", b.sessionsKey(), sid)
+	return err
+}
+
+/**
+Get address of instance serving session, empty if it is unknown
+or served by this instance
+*/
+func (b *Broker) ResolveSession(sid string) (string, error) {
+	reply, err := b.command("HGET", b.sessionsKey(), sid)
+	if err != nil {
+		return "", err
+	}
+
+	addr, _ := reply.([]byte)
+	if string(addr) == b.Advertise {
+		return "", nil
+	}
+	return string(addr), nil
+}
@@ -0,0 +1,124 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/**
+Get ip of socket client. It is remote address of connection, unless
+connection comes from trusted proxy or unix socket; then it is taken
+from X-Forwarded-For or X-Real-IP, see Server.TrustedProxies
+*/
+func (c *Channel) Ip() string {
+	if c.server == nil {
+		return c.ip
+	}
+	return c.server.clientIp(c.ip, c.RequestHeader(), c.unixPeer)
+}
+
+/**
+Get client ip of connection with given remote address and request
+headers. Forward headers of other peers are ignored, clients could
+set any ip with them
+*/
+func (s *Server) clientIp(remoteAddr string, header http.Header, unixPeer bool) string {
+	if s.IgnoreProxyHeaders {
+		return remoteAddr
+	}
+	if !unixPeer && !inNetworks(remoteHost(remoteAddr), s.TrustedProxies) {
+		return remoteAddr
+	}
+
+	if ip := forwardedIp(header.Values(HeaderForward), s.TrustedProxies); ip != "" {
+		return ip
+	}
+	if ip := strings.TrimSpace(header.Get(HeaderRealIp)); ip != "" {
+		return ip
+	}
+	return remoteAddr
+}
+
+/**
+Get client address of X-Forwarded-For list: the last one not added
+by trusted proxies, proxies append address they got connection from
+*/
+func forwardedIp(values []string, trusted []*net.IPNet) string {
+	var list []string
+	for _, value := range values {
+		for _, ip := range strings.Split(value, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				list = append(list, ip)
+			}
+		}
+	}
+	if len(list) == 0 {
+		return ""
+	}
+
+	for i := len(list) - 1; i > 0; i-- {
+		if !inNetworks(list[i], trusted) {
+			return list[i]
+		}
+	}
+	return list[0]
+}
+
+func inNetworks(ip string, networks []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+Get request header of this connection
+*/
+func (c *Channel) RequestHeader() http.Header {
+	return c.requestHeader
+}
+
+/**
+Get auth object client sent with connect packet of this socket,
+nil if there was none, like from EIO=3 clients
+*/
+func (c *Channel) Auth() json.RawMessage {
+	return c.auth
+}
+
+/**
+Get query parameters of handshake request, empty for
+connections set up with SetupEventLoop
+*/
+func (c *Channel) Query() url.Values {
+	if c.query == nil {
+		return url.Values{}
+	}
+	return c.query
+}
+
+/**
+Get cookies sent with handshake request
+*/
+func (c *Channel) Cookies() []*http.Cookie {
+	r := http.Request{Header: c.requestHeader}
+	return r.Cookies()
+}
+
+/**
+Get cookie of handshake request by name, http.ErrNoCookie
+if there is none
+*/
+func (c *Channel) Cookie(name string) (*http.Cookie, error) {
+	r := http.Request{Header: c.requestHeader}
+	return r.Cookie(name)
+}
@@ -0,0 +1,66 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestIpIgnoresHeadersOfUntrustedPeers(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	tr.RequestHeader = http.Header{
+		HeaderForward: {"1.2.3.4"},
+		HeaderRealIp:  {"5.6.7.8"},
+	}
+	s := NewServer(tr)
+
+	_, sc := dialTest(t, s, tr, gosocketiotest.Url)
+	if ip := sc.Ip(); ip != sc.ip {
+		t.Fatalf("spoofed ip %q accepted, remote address is %q", ip, sc.ip)
+	}
+}
+
+func TestIpOfTrustedProxy(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{"forwarded", http.Header{HeaderForward: {"1.2.3.4"}}, "1.2.3.4"},
+		//client sent its own header, proxies appended real address
+		{"spoofed chain", http.Header{HeaderForward: {"6.6.6.6, 1.2.3.4, 10.0.0.2"}}, "1.2.3.4"},
+		{"real ip", http.Header{HeaderRealIp: {"5.6.7.8"}}, "5.6.7.8"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := gosocketiotest.NewTransport()
+			tr.RequestHeader = test.header
+			s := NewServer(tr)
+			s.TrustedProxies = []*net.IPNet{loopback, internal}
+
+			_, sc := dialTest(t, s, tr, gosocketiotest.Url)
+			if ip := sc.Ip(); ip != test.want {
+				t.Fatalf("got %q, want %q", ip, test.want)
+			}
+		})
+	}
+}
+
+func TestIpIgnoreProxyHeaders(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+
+	tr := gosocketiotest.NewTransport()
+	tr.RequestHeader = http.Header{HeaderForward: {"1.2.3.4"}}
+	s := NewServer(tr)
+	s.TrustedProxies = []*net.IPNet{loopback}
+	s.IgnoreProxyHeaders = true
+
+	_, sc := dialTest(t, s, tr, gosocketiotest.Url)
+	if ip := sc.Ip(); ip != sc.ip {
+		t.Fatalf("got %q, want remote address %q", ip, sc.ip)
+	}
+}
@@ -0,0 +1,107 @@
+package gosocketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+var (
+	ErrorRemotePanic = errors.New("Remote handler panicked")
+)
+
+/**
+Error returned by remote handler of Call. Handlers may return it
+themselves to send code, other errors have only message
+*/
+type RemoteError struct {
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+/**
+Ack response of Handle, result or error:
+
+	{"result": <R>}
+	{"error": {"message": "not found", "code": "404"}}
+*/
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RemoteError    `json:"error"`
+}
+
+func remoteError(err error) *RemoteError {
+	var remote *RemoteError
+	if errors.As(err, &remote) {
+		return remote
+	}
+	return &RemoteError{Message: err.Error()}
+}
+
+/**
+Add request handler called with Call, typed like OnTypedAck. Its result
+or error is sent back, wrong arguments and panics are errors too:
+
+	gosocketio.Handle(server, "user.get", func(ctx context.Context, c *gosocketio.Channel, id int) (User, error) {
+		return users.Get(ctx, id)
+	})
+*/
+func Handle[T, R any](h Handlers, method string, f func(ctx context.Context, c *Channel, req T) (R, error)) {
+	h.eventMethods().addTyped(method, true, func(ctx context.Context, c *Channel, m *methods,
+		packet *protocol.Message) (response interface{}, ok bool) {
+
+		req, ok := decodeTyped[T](c, m, packet)
+		if !ok {
+			return map[string]interface{}{"error": &RemoteError{Message: ErrorWrongArgs.Error()}}, true
+		}
+
+		//caller gets error, panic goes on to panic policy
+		defer func() {
+			if r := recover(); r != nil {
+				ack := &protocol.Message{Type: protocol.MessageTypeAckResponse, AckId: packet.AckId}
+				send(ack, c, map[string]interface{}{"error": &RemoteError{Message: ErrorRemotePanic.Error()}})
+				panic(r)
+			}
+		}()
+
+		result, err := f(ctx, c, req)
+		if err != nil {
+			return map[string]interface{}{"error": remoteError(err)}, true
+		}
+		//binary attachments are taken from maps only
+		return map[string]interface{}{"result": result}, true
+	})
+}
+
+/**
+Call remote handler added with Handle and decode its result into R.
+Its error is returned as *RemoteError. Waits until ctx is done, or ack
+timeout if ctx has no deadline
+*/
+func Call[T, R any](ctx context.Context, c *Channel, method string, req T) (R, error) {
+	var result R
+
+	reply, err := c.EmitWithAck(ctx, method, req)
+	if err != nil {
+		return result, err
+	}
+
+	var response rpcResponse
+	if err := c.argsCodec().Unmarshal([]byte(reply), &response); err != nil {
+		return result, argsError(err)
+	}
+	if response.Error != nil {
+		return result, response.Error
+	}
+	if len(response.Result) > 0 {
+		if err := c.argsCodec().Unmarshal(response.Result, &result); err != nil {
+			return result, argsError(err)
+		}
+	}
+	return result, nil
+}
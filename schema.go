@@ -0,0 +1,114 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+const (
+	//code of error ack answering ack request with invalid payload
+	CodeInvalidPayload = "invalid_payload"
+)
+
+var (
+	ErrorInvalidPayload = errors.New("Invalid payload")
+)
+
+/**
+Check of event arguments, decoded to interface{} by codec
+of the channel; nil if event has none
+*/
+type SchemaFunc func(args interface{}) error
+
+/**
+Event arguments were rejected by schema of the event, handlers
+were not called. Matches ErrorInvalidPayload with errors.Is
+*/
+type PayloadError struct {
+	Event string
+	Err   error
+}
+
+func (e *PayloadError) Error() string {
+	return ErrorInvalidPayload.Error() + ": " + e.Err.Error()
+}
+
+func (e *PayloadError) Is(target error) bool {
+	return target == ErrorInvalidPayload
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+/**
+Set schema of event, its arguments are checked before handlers of
+event are called, catch-all handlers get every event anyway. Invalid
+ack request is answered with error, like Handle does, and OnError
+event is fired. nil removes schema
+*/
+func (m *methods) SetSchema(method string, f SchemaFunc) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	if f == nil {
+		delete(m.schemas, method)
+		return
+	}
+	if m.schemas == nil {
+		m.schemas = make(map[string]SchemaFunc)
+	}
+	m.schemas[method] = f
+}
+
+/**
+Set json schema document as schema of event:
+
+	server.SetJsonSchema("move", []byte(`{
+		"type": "object",
+		"properties": {"x": {"type": "integer"}, "y": {"type": "integer"}},
+		"required": ["x", "y"]
+	}`))
+*/
+func (m *methods) SetJsonSchema(method string, doc []byte) error {
+	schema, err := CompileJsonSchema(doc)
+	if err != nil {
+		return err
+	}
+	m.SetSchema(method, schema.Validate)
+	return nil
+}
+
+/**
+Check arguments of received event with its schema. On failure ack
+request gets error response and OnError event is fired
+*/
+func (m *methods) validSchema(c *Channel, msg *protocol.Message) bool {
+	m.messageHandlersLock.RLock()
+	f := m.schemas[msg.Method]
+	m.messageHandlersLock.RUnlock()
+	if f == nil {
+		return true
+	}
+
+	var args interface{}
+	var err error
+	if msg.Args != "" {
+		err = c.argsCodec().Unmarshal([]byte(msg.Args), &args)
+	}
+	if err == nil {
+		err = f(args)
+	}
+	if err == nil {
+		return true
+	}
+
+	perr := &PayloadError{Event: msg.Method, Err: err}
+	c.log().Warn("invalid event payload", "sid", c.Id(), "event", msg.Method, "error", err)
+	if msg.Type == protocol.MessageTypeAckRequest {
+		ack := &protocol.Message{Type: protocol.MessageTypeAckResponse, AckId: msg.AckId}
+		send(ack, c, map[string]interface{}{"error": &RemoteError{Message: perr.Error(), Code: CodeInvalidPayload}})
+	}
+	m.eventFailed(c, KindProtocol, msg, perr)
+	return false
+}
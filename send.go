@@ -1,87 +1,415 @@
 package gosocketio
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
 	"github.com/graarh/golang-socketio/protocol"
-	"log"
 	"time"
 )
 
 var (
 	ErrorSendTimeout     = errors.New("Timeout")
 	ErrorSocketOverflood = errors.New("Socket overflood")
+	ErrorSocketClosed    = errors.New("Socket closed")
+	ErrorMarshalFailed   = errors.New("Marshal failed")
+	ErrorWouldBlock      = errors.New("Outgoing queue is full")
 )
 
 /**
-Send message packet to socket
+Emit arguments can't be encoded to json, nothing was sent
+and the channel stays alive. Matches ErrorMarshalFailed with errors.Is
 */
-func send(msg *protocol.Message, c *Channel, args interface{}) error {
+type MarshalError struct {
+	Err error
+}
+
+func (e *MarshalError) Error() string {
+	return ErrorMarshalFailed.Error() + ": " + e.Err.Error()
+}
+
+func (e *MarshalError) Is(target error) bool {
+	return target == ErrorMarshalFailed
+}
+
+func (e *MarshalError) Unwrap() error {
+	return e.Err
+}
+
+/**
+Encode arguments to json with codec, recovering from encoder panics.
+[]byte values are sent as binary attachments, if they are the
+arguments themselves or items of []interface{} and
+map[string]interface{}; inside structs they are base64 strings
+*/
+func marshalArgs(codec Codec, args interface{}) (result string, attachments [][]byte, err error) {
 	//preventing json/encoding "index out of range" panic
 	defer func() {
 		if r := recover(); r != nil {
-			log.Println("socket.io send panic: ", r)
+			err = &MarshalError{fmt.Errorf("encoder panic: %v", r)}
 		}
 	}()
 
-	if args != nil {
-		json, err := json.Marshal(&args)
+	args = extractAttachments(args, &attachments)
+
+	json, err := codec.Marshal(&args)
+	if err != nil {
+		return "", nil, &MarshalError{err}
+	}
+
+	return string(json), attachments, nil
+}
+
+/**
+Replace []byte values with placeholders, collecting them to attachments.
+Containers are copied, arguments given by user are not changed
+*/
+func extractAttachments(value interface{}, attachments *[][]byte) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		*attachments = append(*attachments, v)
+		return &protocol.Placeholder{Placeholder: true, Num: len(*attachments) - 1}
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i := range v {
+			result[i] = extractAttachments(v[i], attachments)
+		}
+		return result
+
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key := range v {
+			result[key] = extractAttachments(v[key], attachments)
+		}
+		return result
+	}
+
+	return value
+}
+
+/**
+Options of sent packet
+*/
+type sendOptions struct {
+	//trace context appended to arguments, if not nil
+	carrier map[string]string
+	//written without websocket compression
+	uncompressed bool
+	//skipped if channel queue is above volatile threshold
+	volatile bool
+	//fails with ErrorWouldBlock if queue is full, overflow policy is not applied
+	nonBlocking bool
+	//replayed by ResumeBroadcasts, not held again
+	resumed bool
+	//packets are event with its attachments, OverflowDropOldest drops them
+	event bool
+}
+
+/**
+Send message packet to socket
+*/
+func send(msg *protocol.Message, c *Channel, args interface{}) error {
+	return sendWith(msg, c, args, sendOptions{})
+}
+
+/**
+Send message packet with given options
+*/
+func sendWith(msg *protocol.Message, c *Channel, args interface{}, opts sendOptions) error {
+	held, err := c.holdDirect(msg, opts, func() {
+		opts.resumed = true
+		sendWith(msg, c, args, opts)
+	})
+	if held {
+		return err
+	}
+
+	msg.Namespace = c.namespace
+
+	args, err = c.runOutgoing(msg, args)
+	if err != nil {
+		return err
+	}
+	if args != nil && c.encodesValues() {
+		msg.Values = []interface{}{args}
+	} else if args != nil {
+		json, attachments, err := marshalArgs(c.argsCodec(), args)
 		if err != nil {
 			return err
 		}
 
-		msg.Args = string(json)
+		msg.Args = json
+		msg.Attachments = attachments
+	}
+	if opts.carrier != nil {
+		appendTrace(msg, opts.carrier)
 	}
 
-	command, err := protocol.Encode(msg)
+	commands, err := c.encodeEvent(msg)
+	if err != nil && msg.Values != nil {
+		//values are marshalled by parser
+		return &MarshalError{err}
+	}
 	if err != nil {
 		return err
 	}
 
-	if len(c.out) == queueBufferSize {
-		return ErrorSocketOverflood
+	if !c.budgetAllows() {
+		return ErrorBufferBudget
 	}
 
-	c.out <- command
+	opts.event = msg.Type == protocol.MessageTypeEmit || msg.Type == protocol.MessageTypeAckRequest
 
-	return nil
+	if c.chunkConfig.splits(msg) {
+		return c.enqueueChunks(opts, msg, commands[0])
+	}
+	return c.enqueueWith(opts, commands...)
 }
 
 /**
 Create packet based on given data and send it
 */
 func (c *Channel) Emit(method string, args interface{}) error {
+	return c.emit(context.Background(), method, args, sendOptions{})
+}
+
+func (c *Channel) emit(ctx context.Context, method string, args interface{}, opts sendOptions) error {
 	msg := &protocol.Message{
 		Type:   protocol.MessageTypeEmit,
 		Method: method,
 	}
 
-	return send(msg, c, args)
+	var end func(error)
+	opts.carrier, end = c.startEmit(ctx, method)
+	err := sendWith(msg, c, args, opts)
+	end(err)
+	return err
+}
+
+/**
+Emit message unless channel is too slow to take it: if more packets
+than QueueConfig.VolatileThreshold are queued, message is silently
+dropped. Queue overflow policy is not applied, channel stays open
+*/
+func (c *Channel) EmitVolatile(method string, args interface{}) error {
+	return c.emit(context.Background(), method, args, sendOptions{volatile: true})
+}
+
+/**
+Emit message, waiting for free space in outgoing queue until ctx is done.
+Returns ctx.Err() if ctx is done before message is queued
+*/
+func (c *Channel) EmitContext(ctx context.Context, method string, args interface{}) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := c.emit(ctx, method, args, sendOptions{nonBlocking: true})
+		if err != ErrorWouldBlock {
+			return err
+		}
+		if err := c.waitWrite(ctx, nil); err != nil {
+			return err
+		}
+	}
+}
+
+/**
+Emit message, waiting for free space in outgoing queue up to timeout.
+Returns ErrorSendTimeout if message is not queued in time
+*/
+func (c *Channel) EmitTimeout(method string, args interface{}, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := c.EmitContext(ctx, method, args)
+	if err == context.DeadlineExceeded {
+		return ErrorSendTimeout
+	}
+	return err
+}
+
+/**
+Emit message only if it fits into outgoing queue right away, returns
+ErrorWouldBlock otherwise. Overflow policy is not applied, channel stays
+*/
+func (c *Channel) TryEmit(method string, args interface{}) error {
+	return c.emit(context.Background(), method, args, sendOptions{nonBlocking: true})
 }
 
 /**
-Create ack packet based on given data and send it and receive response
+Emit message, wait until it is written to connection, then send
+disconnect packet and close the channel. Timeout limits the whole
+operation, the channel is closed anyway, ErrorSendTimeout returned
+*/
+func (c *Channel) EmitAndClose(method string, args interface{}, timeout time.Duration) error {
+	if c.server == nil {
+		return ErrorServerNotSet
+	}
+
+	return emitAndClose(c, c.namespaceMethods(), method, args, timeout, sendOptions{})
+}
+
+func emitAndClose(c *Channel, m *methods, method string, args interface{},
+	timeout time.Duration, opts sendOptions) error {
+
+	//held as a whole, channel stays open until message is replayed
+	msg := &protocol.Message{Type: protocol.MessageTypeEmit, Method: method}
+	held, err := c.holdDirect(msg, opts, func() {
+		opts.resumed = true
+		emitAndClose(c, m, method, args, timeout, opts)
+	})
+	if held {
+		return err
+	}
+
+	defer closeChannel(c, m)
+
+	deadline := c.clock().NewTimer(timeout)
+	defer deadline.Stop()
+
+	err = c.emit(context.Background(), method, args, opts)
+	if err != nil {
+		return err
+	}
+	if err := c.waitWritten(deadline.C()); err != nil {
+		return err
+	}
+
+	err = sendWith(&protocol.Message{Type: protocol.MessageTypeDisconnect}, c, nil, opts)
+	if err != nil {
+		return err
+	}
+	return c.waitWritten(deadline.C())
+}
+
+/**
+Create ack packet based on given data and send it and receive response.
+Returns ErrorAckTimeout if there is no response in time, timeout 0
+means default one of server options or client config
 */
 func (c *Channel) Ack(method string, args interface{}, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		timeout = c.ackTimeout()
+	}
+	return c.emitWithAck(context.Background(), method, args, sendOptions{}, timeout)
+}
+
+/**
+Emit event asking peer to acknowledge it, and wait for the answer
+until ctx is done. Works from both sides, server can ask browser
+client to confirm with callback. Returns ctx.Err() if ctx is done first
+and ErrorSocketClosed if channel is closed while waiting. Default ack
+timeout applies if ctx has no deadline, ErrorAckTimeout is returned then
+*/
+func (c *Channel) EmitWithAck(ctx context.Context, method string, args interface{}) (string, error) {
+	return c.emitWithAck(ctx, method, args, sendOptions{}, c.contextAckTimeout(ctx))
+}
+
+/**
+Send ack request and wait for the response until ctx is done
+or timeout is over, no timeout if it is 0
+*/
+func (c *Channel) emitWithAck(ctx context.Context, method string, args interface{},
+	opts sendOptions, timeout time.Duration) (string, error) {
+
+	start := c.clock().Now()
+	var end func(error)
+	opts.carrier, end = c.startEmit(ctx, method)
+
+	var deadline time.Time
+	var expired <-chan time.Time
+	if timeout > 0 {
+		deadline = start.Add(timeout)
+		timer := c.clock().NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C()
+	}
+	id, waiter, err := c.sendAck(method, args, opts, deadline)
+	if err != nil {
+		end(err)
+		return "", err
+	}
+
+	select {
+	case result := <-waiter:
+		if result.err != nil {
+			end(result.err)
+			return "", result.err
+		}
+		c.statsHook().AckLatency(c, c.clock().Now().Sub(start))
+		end(nil)
+		return result.args, nil
+	case <-expired:
+		c.ack.removeWaiter(id)
+		end(ErrorAckTimeout)
+		return "", ErrorAckTimeout
+	case <-ctx.Done():
+		c.ack.removeWaiter(id)
+		end(ctx.Err())
+		return "", ctx.Err()
+	case <-c.done:
+		c.ack.removeWaiter(id)
+		end(ErrorSocketClosed)
+		return "", ErrorSocketClosed
+	}
+}
+
+/**
+EmitWithAck decoding the response into dest with codec of the channel.
+Binary ack attachments are put back in place first, so []byte fields of
+dest get them:
+
+	var file struct {
+		Name string `json:"name"`
+		Data []byte `json:"data"`
+	}
+	err := c.EmitAckInto(ctx, "download", "report.pdf", &file)
+*/
+func (c *Channel) EmitAckInto(ctx context.Context, method string, args interface{}, dest interface{}) error {
+	reply, err := c.EmitWithAck(ctx, method, args)
+	if err != nil {
+		return err
+	}
+
+	if err := c.argsCodec().Unmarshal([]byte(reply), dest); err != nil {
+		return argsError(err)
+	}
+	return nil
+}
+
+/**
+Ack waiting for response until ctx is done instead of timeout,
+same as EmitWithAck
+*/
+func (c *Channel) AckContext(ctx context.Context, method string, args interface{}) (string, error) {
+	return c.EmitWithAck(ctx, method, args)
+}
+
+/**
+Send ack request, returns its id and waiter for the response
+*/
+func (c *Channel) sendAck(method string, args interface{}, opts sendOptions,
+	deadline time.Time) (int, chan ackResult, error) {
+
 	msg := &protocol.Message{
 		Type:   protocol.MessageTypeAckRequest,
 		AckId:  c.ack.getNextId(),
 		Method: method,
 	}
 
-	waiter := make(chan string)
-	c.ack.addWaiter(msg.AckId, waiter)
-
-	err := send(msg, c, args)
+	waiter, err := c.ack.addWaiter(msg.AckId, deadline, c.clock().Now())
 	if err != nil {
-		c.ack.removeWaiter(msg.AckId)
+		return 0, nil, err
 	}
 
-	select {
-	case result := <-waiter:
-		return result, nil
-	case <-time.After(timeout):
+	err = sendWith(msg, c, args, opts)
+	if err != nil {
 		c.ack.removeWaiter(msg.AckId)
-		return "", ErrorSendTimeout
+		return 0, nil, err
 	}
+
+	return msg.AckId, waiter, nil
 }
@@ -0,0 +1,129 @@
+package gosocketio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type cyclic struct {
+	Next *cyclic
+}
+
+func TestEmitMarshalFailed(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	got := make(chan string, 1)
+	s.On("ok", func(c *Channel, text string) {
+		got <- text
+	})
+	c, _ := dialTest(t, s, tr, gosocketiotest.Url)
+
+	loop := &cyclic{}
+	loop.Next = loop
+	for _, args := range []interface{}{make(chan int), func() {}, loop} {
+		err := c.Emit("bad", args)
+		var marshalErr *MarshalError
+		if !errors.As(err, &marshalErr) || !errors.Is(err, ErrorMarshalFailed) {
+			t.Fatalf("%T: got %v, want MarshalError", args, err)
+		}
+	}
+
+	//channel is alive and nothing of failed emits was queued
+	if err := c.Emit("ok", "still here"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case text := <-got:
+		if text != "still here" {
+			t.Fatal(text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("emit after marshal failure not received")
+	}
+	for _, packet := range tr.Last().Client.Written() {
+		if strings.Contains(packet, `"bad"`) {
+			t.Fatalf("failed emit was sent: %q", packet)
+		}
+	}
+}
+
+func TestEmitAndCloseDeliversFirst(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	c, sc := dialTest(t, s, tr, gosocketiotest.Url)
+
+	events := make(chan string, 2)
+	c.On("bye", func(c *Channel, text string) {
+		events <- "bye " + text
+	})
+	c.On(OnDisconnection, func(c *Channel) {
+		events <- "disconnected"
+	})
+
+	if err := sc.EmitAndClose("bye", "logged out", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if sc.IsAlive() {
+		t.Fatal("server channel is alive")
+	}
+
+	//handlers run concurrently, so only packets keep the order
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case event := <-events:
+			got[event] = true
+		case <-time.After(time.Second):
+			t.Fatalf("got only %v", got)
+		}
+	}
+	if !got["bye logged out"] {
+		t.Fatalf("got %v", got)
+	}
+
+	//event is written before disconnect packet
+	written := tr.Last().Server.Written()
+	bye, disconnect := -1, -1
+	for i, packet := range written {
+		switch {
+		case strings.HasPrefix(packet, `42["bye"`):
+			bye = i
+		case packet == "41":
+			disconnect = i
+		}
+	}
+	if bye == -1 || disconnect < bye {
+		t.Fatalf("wrong order of packets %q", written)
+	}
+}
+
+func TestEmitAckIntoBinary(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	data := []byte{0, 1, 2, 0xff}
+	s.On("download", func(c *Channel, name string) interface{} {
+		return map[string]interface{}{"name": name, "data": data}
+	})
+	c, _ := dialTest(t, s, tr, gosocketiotest.Url)
+
+	var file struct {
+		Name string `json:"name"`
+		Data []byte `json:"data"`
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.EmitAckInto(ctx, "download", "blob.bin", &file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Name != "blob.bin" || !bytes.Equal(file.Data, data) {
+		t.Fatalf("got %+v", file)
+	}
+	if _, ok := tr.Last().Server.WaitWritten("461-", time.Second); !ok {
+		t.Fatalf("response was not binary ack, written %q", tr.Last().Server.Written())
+	}
+}
@@ -0,0 +1,51 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Envelope of sequenced emit, it is what clients receive as event data:
+
+	{"seq": 42, "data": <args>}
+
+seq starts from 1 and grows by one with every sequenced emit on the
+channel, so client detects a gap when seq is not previous one plus 1
+*/
+type SeqEnvelope struct {
+	Seq  uint64      `json:"seq"`
+	Data interface{} `json:"data"`
+}
+
+/**
+Emit args wrapped into SeqEnvelope with the next sequence number,
+number is used only if the message was queued
+*/
+func (c *Channel) EmitSeq(method string, args interface{}) error {
+	c.seqLock.Lock()
+	defer c.seqLock.Unlock()
+
+	msg := &protocol.Message{
+		Type:   protocol.MessageTypeEmit,
+		Method: method,
+	}
+
+	next := c.seq + 1
+	err := send(msg, c, SeqEnvelope{Seq: next, Data: args})
+	if err != nil {
+		return err
+	}
+
+	c.seq = next
+	return nil
+}
+
+/**
+Get sequence number of the last sequenced emit, 0 if there were none
+*/
+func (c *Channel) Seq() uint64 {
+	c.seqLock.Lock()
+	defer c.seqLock.Unlock()
+
+	return c.seq
+}
@@ -2,6 +2,7 @@ package gosocketio
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
@@ -10,13 +11,20 @@ import (
 	"github.com/graarh/golang-socketio/protocol"
 	"github.com/graarh/golang-socketio/transport"
 	"math/rand"
+	"net"
 	"net/http"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	HeaderForward = "X-Forwarded-For"
+	HeaderRealIp  = "X-Real-IP"
+
+	//seconds for clients to wait when server is not accepting connections
+	notAcceptingRetryAfter = "5"
 )
 
 var (
@@ -31,51 +39,174 @@ type Server struct {
 	methods
 	http.Handler
 
-	channels     map[string]map[*Channel]struct{}
-	rooms        map[*Channel]map[string]struct{}
-	channelsLock sync.RWMutex
+	registry
 
-	sids     map[string]*Channel
-	sidsLock sync.RWMutex
+	namespaces     map[string]*Namespace
+	patterns       []namespacePattern //of dynamic namespaces, see OfPattern
+	namespacesLock sync.RWMutex
 
 	tr transport.Transport
+
+	//accepted engine.io versions, only ProtocolVersion3 if empty;
+	//others are refused with engine.io error, so clients can fall back
+	ProtocolVersions []int
+
+	//limit of handshakes per second from one client ip, the one Channel.Ip
+	//gives, 0 means no limit
+	ConnectionsPerIPPerSecond float64
+	//handshakes from one ip allowed at once, defaults to the rate
+	ConnectionBurstPerIP int
+
+	//limits of incoming messages of each connection
+	RateLimit RateLimit
+	//called for message exceeding RateLimit, before it is dropped,
+	//delayed or connection is closed
+	OnRateLimited func(c *Channel, err error)
+
+	//networks of reverse proxies in front of the server, forward headers
+	//are honored only on connections from them and from unix socket.
+	//Client ip is the last X-Forwarded-For address not in them
+	TrustedProxies []*net.IPNet
+	//Ip is remote address of connection, forward headers are ignored
+	IgnoreProxyHeaders bool
+
+	//origins allowed to connect and CORS headers of polling, any
+	//origin is allowed if none are set
+	CORS CORSConfig
+
+	//engine.io ping params, payload limit and upgrades, set before serving
+	Options ServerOptions
+	//decides about handshake over Options.MaxConnections, true accepts
+	//it anyway, otherwise the response is written by it; 503 if nil
+	ConnectionLimitHandler func(w http.ResponseWriter, r *http.Request) bool
+	//called for handshake refused by Options.MaxConnections
+	OnConnectionRefused func(r *http.Request, err error)
+
+	//outgoing queue of every channel and what to do when it is full
+	Queue QueueConfig
+	//forwarding of polling requests to instances serving their sessions
+	Sticky StickyConfig
+	//chunk size and window of streams, see Channel.OpenStream
+	Streams StreamConfig
+	//splitting of large binary emits, off by default, see ChunkConfig
+	Chunks ChunkConfig
+	//how handlers of received packets are run, goroutine for each by default
+	Dispatch DispatchConfig
+
+	//receives connection and packet events for metrics, nil if unused
+	StatsHook StatsHook
+	//trace spans of events of every channel
+	Trace TraceConfig
+	//encoding of socket.io packets, nil is default json parser;
+	//clients have to use the same one
+	Parser protocol.Parser
+	//json encoding of event arguments, nil is JsonCodec
+	Codec Codec
+	//time of pings, timeouts and rate limits, real time if nil
+	Clock Clock
+	//connection state recovery of EIO=4 clients, off by default
+	Recovery RecoveryConfig
+
+	//limit of bytes queued for sending on all channels, 0 means no limit
+	//set it to memory the process can spare for queues, well above
+	//connections * typical backlog, so it trips only on collective stalls
+	MaxTotalBufferedBytes int64
+	//what to do when MaxTotalBufferedBytes is exceeded
+	BufferBudgetPolicy BufferBudgetPolicy
+
+	//how Drain closes channels, see DrainConfig
+	Draining DrainConfig
+
+	lost     map[string]*lostChannel //by pid, see Recovery
+	lostLock sync.Mutex
+
+	throttle     ipThrottle
+	stats        *serverStats
+	shedding     int32
+	notAccepting int32
+	handshakes   int32 //in progress, counted by MaxConnections
+
+	/**
+	Optional hook called for every recipient of a broadcast, returns
+	data to send to this channel, or false to skip it.
+	Payload is encoded separately for each recipient anyway, but the
+	hook runs for every channel in the room on every broadcast,
+	so keep it cheap for big rooms
+	*/
+	BroadcastFilter func(c *Channel, event string, data interface{}) (interface{}, bool)
+
+	//creates room adapter of namespace on its first join or broadcast,
+	//local is in-memory adapter of the namespace; rooms are kept only
+	//in memory of this process if nil. Set it before serving
+	NewAdapter func(namespace string, local Adapter) Adapter
+
+	serverSide     map[string]reflect.Value //handlers of OnServerSide
+	serverSideLock sync.RWMutex
+
+	//what to do with messages while broadcasts are paused
+	PausePolicy PausePolicy
+	//messages kept with PauseBuffer policy, DefaultPauseBufferSize if 0
+	PauseBufferSize int
+	//pause emits to single channels too, not only broadcasts:
+	//events, acks and EmitAndClose as a whole
+	PauseDirectEmits bool
+
+	paused         bool
+	resuming       bool //buffered messages are being replayed
+	pausedMessages []func()
+	pauseLock      sync.Mutex
+
+	//called with time from http request arrival to connected channel,
+	//OnConnection handlers included with EIO=3, EIO=4 clients
+	//send connect packet later
+	OnHandshakeComplete func(sid string, d time.Duration)
+
+	//event name of application heartbeat, "heartbeat" if empty
+	AppHeartbeatEvent string
+
+	heartbeatStop chan struct{}
+	heartbeatLock sync.Mutex
+
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	pool     chan struct{} //handler slots of DispatchPool mode
+	poolOnce sync.Once
+
+	middlewares     []Middleware
+	outgoing        []OutgoingMiddleware
+	middlewaresLock sync.RWMutex
+
+	logger atomic.Value
+
+	connections     map[*Channel]struct{}
+	shutdown        bool
+	connectionsLock sync.Mutex
 }
 
 /**
 Close current channel
  */
 func (c *Channel) Close() {
-	if c.server != nil {
-		closeChannel(c, &c.server.methods)
+	if c.server == nil {
+		return
 	}
-}
 
-/**
-Get ip of socket client
-*/
-func (c *Channel) Ip() string {
-	forward := c.RequestHeader().Get(HeaderForward)
-	if forward != "" {
-		return forward
+	//tell client the socket is gone, connection is not closed
+	if c.nsp != nil {
+		send(&protocol.Message{Type: protocol.MessageTypeDisconnect}, c, nil)
 	}
-	return c.ip
-}
-
-/**
-Get request header of this connection
-*/
-func (c *Channel) RequestHeader() http.Header {
-	return c.requestHeader
+	closeChannel(c, c.namespaceMethods())
 }
 
 /**
 Get channel by it's sid
 */
-func (s *Server) GetChannel(sid string) (*Channel, error) {
-	s.sidsLock.RLock()
-	defer s.sidsLock.RUnlock()
+func (r *registry) GetChannel(sid string) (*Channel, error) {
+	r.sidsLock.RLock()
+	defer r.sidsLock.RUnlock()
 
-	c, ok := s.sids[sid]
+	c, ok := r.sids[sid]
 	if !ok {
 		return nil, ErrorConnectionNotFound
 	}
@@ -91,22 +222,14 @@ func (c *Channel) Join(room string) error {
 		return ErrorServerNotSet
 	}
 
-	c.server.channelsLock.Lock()
-	defer c.server.channelsLock.Unlock()
-
-	cn := c.server.channels
-	if _, ok := cn[room]; !ok {
-		cn[room] = make(map[*Channel]struct{})
+	r := c.registry()
+	meta, present, joined := r.presenceInRoom(c, room)
+	if err := r.adapter().AddToRoom(c, room); err != nil {
+		return err
 	}
-
-	byRoom := c.server.rooms
-	if _, ok := byRoom[c]; !ok {
-		byRoom[c] = make(map[string]struct{})
+	if present && !joined {
+		r.presenceJoined(c, room, meta)
 	}
-
-	cn[room][c] = struct{}{}
-	byRoom[c][room] = struct{}{}
-
 	return nil
 }
 
@@ -118,23 +241,52 @@ func (c *Channel) Leave(room string) error {
 		return ErrorServerNotSet
 	}
 
-	c.server.channelsLock.Lock()
-	defer c.server.channelsLock.Unlock()
+	r := c.registry()
+	_, present, joined := r.presenceInRoom(c, room)
+	if err := r.adapter().RemoveFromRoom(c, room); err != nil {
+		return err
+	}
+	if present && joined {
+		r.presenceLeft(c, room)
+	}
+	return nil
+}
+
+/**
+Get list of rooms this channel is joined to
+*/
+func (c *Channel) Rooms() []string {
+	if c.server == nil {
+		return []string{}
+	}
 
-	cn := c.server.channels
-	if _, ok := cn[room]; ok {
-		delete(cn[room], c)
-		if len(cn[room]) == 0 {
-			delete(cn, room)
-		}
+	r := c.registry()
+	r.channelsLock.RLock()
+	defer r.channelsLock.RUnlock()
+
+	rooms := make([]string, 0, len(r.rooms[c]))
+	for room := range r.rooms[c] {
+		rooms = append(rooms, room)
 	}
 
-	byRoom := c.server.rooms
-	if _, ok := byRoom[c]; ok {
-		delete(byRoom[c], room)
+	return rooms
+}
+
+/**
+Check that channel with given sid is joined to given room,
+false for unknown sid or room
+*/
+func (r *registry) IsInRoom(sid, room string) bool {
+	c, err := r.GetChannel(sid)
+	if err != nil {
+		return false
 	}
 
-	return nil
+	r.channelsLock.RLock()
+	defer r.channelsLock.RUnlock()
+
+	_, ok := r.rooms[c][room]
+	return ok
 }
 
 /**
@@ -145,17 +297,17 @@ func (c *Channel) Amount(room string) int {
 		return 0
 	}
 
-	return c.server.Amount(room)
+	return c.registry().Amount(room)
 }
 
 /**
 Get amount of channels, joined to given room, using server
 */
-func (s *Server) Amount(room string) int {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+func (r *registry) Amount(room string) int {
+	r.channelsLock.RLock()
+	defer r.channelsLock.RUnlock()
 
-	roomChannels, _ := s.channels[room]
+	roomChannels, _ := r.channels[room]
 	return len(roomChannels)
 }
 
@@ -167,17 +319,17 @@ func (c *Channel) List(room string) []*Channel {
 		return []*Channel{}
 	}
 
-	return c.server.List(room)
+	return c.registry().List(room)
 }
 
 /**
 Get list of channels, joined to given room, using server
 */
-func (s *Server) List(room string) []*Channel {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+func (r *registry) List(room string) []*Channel {
+	r.channelsLock.RLock()
+	defer r.channelsLock.RUnlock()
 
-	roomChannels, ok := s.channels[room]
+	roomChannels, ok := r.channels[room]
 	if !ok {
 		return []*Channel{}
 	}
@@ -193,42 +345,77 @@ func (s *Server) List(room string) []*Channel {
 
 }
 
+/**
+Broadcast message to room channels except this one, using channel.
+Server.BroadcastTo reaches all of them
+*/
 func (c *Channel) BroadcastTo(room, method string, args interface{}) {
-	if c.server == nil {
-		return
-	}
-	c.server.BroadcastTo(room, method, args)
+	c.Broadcast().ToRoom(room).Emit(method, args)
 }
 
 /**
-Broadcast message to all room channels
+Broadcast message to all room channels, using server. Members connected
+to other instances get it only through adapter passing broadcasts between
+them, see Server.NewAdapter; default one reaches this process only
 */
-func (s *Server) BroadcastTo(room, method string, args interface{}) {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+func (r *registry) BroadcastTo(room, method string, args interface{}) {
+	r.adapter().Broadcast(&BroadcastOptions{Rooms: []string{room}}, method, args)
+}
 
-	roomChannels, ok := s.channels[room]
-	if !ok {
-		return
-	}
+/**
+Broadcast message to room channels except this one, skipping the
+ones which are too slow to take it, see Channel.EmitVolatile
+*/
+func (c *Channel) BroadcastVolatile(room, method string, args interface{}) {
+	c.Broadcast().ToRoom(room).Volatile().Emit(method, args)
+}
 
-	for cn := range roomChannels {
-		if cn.IsAlive() {
-			go cn.Emit(method, args)
-		}
-	}
+/**
+Volatile broadcast to all room channels, using server
+*/
+func (r *registry) BroadcastVolatile(room, method string, args interface{}) {
+	r.adapter().Broadcast(&BroadcastOptions{Rooms: []string{room}, Volatile: true}, method, args)
 }
 
 /**
 Broadcast to all clients
 */
-func (s *Server) BroadcastToAll(method string, args interface{}) {
-	s.sidsLock.RLock()
-	defer s.sidsLock.RUnlock()
+func (r *registry) BroadcastToAll(method string, args interface{}) {
+	r.adapter().Broadcast(&BroadcastOptions{}, method, args)
+}
+
+/**
+Emit message to each of given channels, applying BroadcastFilter
+*/
+func (s *Server) broadcast(channels []*Channel, method string, args interface{}, opts sendOptions) {
+	if !opts.resumed {
+		held, _ := s.holdMessage(func() {
+			opts.resumed = true
+			s.broadcast(channels, method, args, opts)
+		})
+		if held {
+			return
+		}
+	}
 
-	for _, cn := range s.sids {
-		if cn.IsAlive() {
-			go cn.Emit(method, args)
+	for _, cn := range channels {
+		if !cn.IsAlive() {
+			continue
+		}
+
+		data := args
+		if s.BroadcastFilter != nil {
+			var ok bool
+			if data, ok = s.BroadcastFilter(cn, method, args); !ok {
+				continue
+			}
+		}
+
+		if opts.resumed {
+			//replay keeps order of buffered messages
+			cn.emit(context.Background(), method, data, opts)
+		} else {
+			go cn.emit(context.Background(), method, data, opts)
 		}
 	}
 }
@@ -250,54 +437,62 @@ func generateNewId(custom string) string {
 On connection system handler, store sid
 */
 func onConnectStore(c *Channel) {
-	c.server.sidsLock.Lock()
-	defer c.server.sidsLock.Unlock()
+	r := c.registry()
+	r.sidsLock.Lock()
+	defer r.sidsLock.Unlock()
 
-	c.server.sids[c.Id()] = c
+	r.sids[c.Id()] = c
 }
 
 /**
 On disconnection system handler, clean joins and sid
 */
 func onDisconnectCleanup(c *Channel) {
-	c.server.channelsLock.Lock()
-	defer c.server.channelsLock.Unlock()
-
-	cn := c.server.channels
-	byRoom, ok := c.server.rooms[c]
-	if ok {
-		for room := range byRoom {
-			if curRoom, ok := cn[room]; ok {
-				delete(curRoom, c)
-				if len(curRoom) == 0 {
-					delete(cn, room)
-				}
-			}
+	r := c.registry()
+	a := r.adapter()
+	_, present := r.channelPresence(c)
+	for _, room := range c.Rooms() {
+		a.RemoveFromRoom(c, room)
+		if present {
+			r.presenceLeft(c, room)
 		}
-
-		delete(c.server.rooms, c)
+	}
+	if present {
+		r.channelsLock.Lock()
+		delete(r.presence, c)
+		r.channelsLock.Unlock()
 	}
 
-	c.server.sidsLock.Lock()
-	defer c.server.sidsLock.Unlock()
+	r.sidsLock.Lock()
+	defer r.sidsLock.Unlock()
 
-	delete(c.server.sids, c.Id())
+	delete(r.sids, c.Id())
 }
 
 func (s *Server) SendOpenSequence(c *Channel) {
+	s.sendOpen(c)
+
+	//EIO=4 clients send connect packet themselves, see acceptConnect
+	if c.version == ProtocolVersion3 {
+		c.enqueue(c.mustEncode(&protocol.Message{Type: protocol.MessageTypeEmpty})...)
+	}
+}
+
+/**
+Send engine.io open packet with channel header
+*/
+func (s *Server) sendOpen(c *Channel) {
 	jsonHdr, err := json.Marshal(&c.header)
 	if err != nil {
 		panic(err)
 	}
 
-	c.out <- protocol.MustEncode(
+	c.enqueue(protocol.MustEncode(
 		&protocol.Message{
 			Type: protocol.MessageTypeOpen,
 			Args: string(jsonHdr),
 		},
-	)
-
-	c.out <- protocol.MustEncode(&protocol.Message{Type: protocol.MessageTypeEmpty})
+	))
 }
 
 /**
@@ -306,76 +501,236 @@ Setup event loop for given connection
 func (s *Server) SetupEventLoop(conn transport.Connection, remoteAddr string,
 	requestHeader http.Header) {
 
-	interval, timeout := conn.PingParams()
-	hdr := Header{
-		Sid:          generateNewId(remoteAddr),
-		Upgrades:     []string{},
-		PingInterval: int(interval / time.Millisecond),
-		PingTimeout:  int(timeout / time.Millisecond),
-	}
+	s.setupEventLoop(conn, ProtocolVersion3, remoteAddr, requestHeader, nil)
+}
+
+/**
+Start loops of new connection, nil is returned
+if it was rejected by middleware
+*/
+func (s *Server) setupEventLoop(conn transport.Connection, version int, remoteAddr string,
+	requestHeader http.Header, r *http.Request) *Channel {
+
+	hdr := s.newHeader(conn, version, remoteAddr)
 
 	c := &Channel{}
+	c.initChannel(s.Queue)
+	c.trace = s.Trace
+	c.parser = s.Parser
+	c.codec = s.Codec
+	c.clk = s.Clock
+	c.maxMessageSize = s.Options.messageLimit()
+	c.streamConfig = s.Streams
+	c.chunkConfig = s.Chunks
+	c.dispatchConfig = s.Dispatch
+	c.pool = s.dispatchPool()
+	c.recovery = s.newRecovery(version)
 	c.conn = conn
 	c.ip = remoteAddr
 	c.requestHeader = requestHeader
-	c.initChannel()
+	if r != nil {
+		c.query = r.URL.Query()
+		c.unixPeer = isUnixRequest(r)
+	}
 
 	c.server = s
 	c.header = hdr
+	c.version = version
+
+	err := s.runMiddlewares(c, r)
+	//EIO=3 clients are connected to default namespace right away
+	if err == nil && version != ProtocolVersion4 {
+		err = s.runConnectMiddlewares(c, nil)
+	}
+	if err != nil {
+		s.stats.addRejectedHandshake()
+		s.rejectConnection(c, err)
+		return nil
+	}
+	if !s.addConnection(c) {
+		s.rejectConnection(c, ErrorServerShutdown)
+		return nil
+	}
+	s.sessionStarted(c)
 
 	s.SendOpenSequence(c)
+	c.log().Info("connection accepted", "sid", c.Id(), "ip", c.Ip(), "version", version)
 
 	go inLoop(c, &s.methods)
 	go outLoop(c, &s.methods)
 
+	//with EIO=4 server pings, and client connects explicitly
+	if version == ProtocolVersion4 {
+		go pinger(c, &s.methods)
+		return c
+	}
+
 	s.callLoopEvent(c, OnConnection)
+
+	return c
+}
+
+/**
+Reject new connections with 503, existing channels keep working.
+Unlike full shutdown, it can be undone with ResumeAccepting
+*/
+func (s *Server) StopAccepting() {
+	atomic.StoreInt32(&s.notAccepting, 1)
+}
+
+/**
+Accept new connections again after StopAccepting
+*/
+func (s *Server) ResumeAccepting() {
+	atomic.StoreInt32(&s.notAccepting, 0)
+}
+
+/**
+Check if server accepts new connections
+*/
+func (s *Server) Accepting() bool {
+	return atomic.LoadInt32(&s.notAccepting) == 0
 }
 
 /**
 implements ServeHTTP function from http.Handler
 */
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := s.clock().Now()
+
+	if !s.Options.servesPath(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	//before cors headers, other instance sets them
+	if s.forwardSession(w, r) {
+		return
+	}
+
+	if !s.checkOrigin(w, r) {
+		return
+	}
+
+	//requests with sid belong to established sessions, not handshakes
+	if r.URL.Query().Get("sid") == "" {
+		if !s.Accepting() {
+			s.stats.addNotAcceptedHandshake()
+			w.Header().Set("Retry-After", notAcceptingRetryAfter)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		if !s.allowHandshake(w, r) {
+			return
+		}
+		if !s.allowConnection(w, r) {
+			return
+		}
+		defer s.handshakeDone()
+	}
+
+	version, ok := s.requestVersion(r)
+	if !ok {
+		rejectVersion(w)
+		return
+	}
+
+	if !s.Options.AllowUpgrades && isUpgradeRequest(r) {
+		rejectUpgrade(w)
+		return
+	}
+
 	conn, err := s.tr.HandleConnection(w, r)
-	if err != nil {
+	if err != nil || conn == nil {
 		return
 	}
 
-	s.SetupEventLoop(conn, r.RemoteAddr, r.Header)
+	c := s.setupEventLoop(conn, version, r.RemoteAddr, r.Header, r)
+	if c != nil && s.OnHandshakeComplete != nil {
+		s.OnHandshakeComplete(c.Id(), s.clock().Now().Sub(start))
+	}
+
 	s.tr.Serve(w, r)
 }
 
+/**
+Get channel, closed once the server is accepting connections
+
+Handler itself is ready as soon as NewServer returns, so the only
+thing to wait for is a listener. Correct startup sequence is:
+bind listener with net.Listen, start serving it, then dial clients;
+ServeAndReady does the first two steps and closes this channel
+*/
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+/**
+Get path server is mounted to, Options.Path or DefaultPath.
+Routers need it with wildcard, like "/socket.io/*any" for gin
+*/
+func (s *Server) Path() string {
+	return s.Options.path()
+}
+
+/**
+Mount server to its path on given mux, both websocket and polling
+requests go there, so REST handlers can share the mux
+*/
+func (s *Server) Mount(mux *http.ServeMux) {
+	mux.Handle(s.Path(), s)
+}
+
+/**
+Serve http on given listener and mark server as ready, blocks like
+http.Serve. If h is nil, server is mounted to its path
+*/
+func (s *Server) ServeAndReady(l net.Listener, h http.Handler) error {
+	return s.ServeWith(&http.Server{Handler: h}, l)
+}
+
 /**
 Get amount of current connected sids
 */
-func (s *Server) AmountOfSids() int64 {
-	s.sidsLock.RLock()
-	defer s.sidsLock.RUnlock()
+func (r *registry) AmountOfSids() int64 {
+	r.sidsLock.RLock()
+	defer r.sidsLock.RUnlock()
 
-	return int64(len(s.sids))
+	return int64(len(r.sids))
 }
 
 /**
 Get amount of rooms with at least one channel(or sid) joined
 */
-func (s *Server) AmountOfRooms() int64 {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+func (r *registry) AmountOfRooms() int64 {
+	r.channelsLock.RLock()
+	defer r.channelsLock.RUnlock()
 
-	return int64(len(s.channels))
+	return int64(len(r.channels))
 }
 
 /**
 Create new socket.io server
 */
 func NewServer(tr transport.Transport) *Server {
-	s := Server{}
+	s := &Server{}
 	s.initMethods()
 	s.tr = tr
-	s.channels = make(map[string]map[*Channel]struct{})
-	s.rooms = make(map[*Channel]map[string]struct{})
-	s.sids = make(map[string]*Channel)
+	s.initRegistry(s, protocol.DefaultNamespace)
+	s.stats = &serverStats{started: time.Now()}
+	s.connections = make(map[*Channel]struct{})
+	s.ready = make(chan struct{})
 	s.onConnection = onConnectStore
 	s.onDisconnection = onDisconnectCleanup
+	s.Options = GetDefaultServerOptions()
+
+	s.namespaces = map[string]*Namespace{
+		protocol.DefaultNamespace: {
+			methods:  &s.methods,
+			registry: &s.registry,
+		},
+	}
 
-	return &s
+	return s
 }
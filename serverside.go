@@ -0,0 +1,122 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"runtime/debug"
+)
+
+var (
+	ErrorServerSideArgs = errors.New("f should have not more than 1 arg and return nothing")
+)
+
+/**
+Adapter passing server-side events to other instances, see
+Server.ServerSideEmit. Events of other instances are given to
+ReceiveServerSide of the server or local adapter, like broadcasts
+*/
+type ServerSideAdapter interface {
+	ServerSideEmit(method string, args interface{}) error
+}
+
+/**
+Send event to other server instances of the cluster, no channel
+gets it. Adapter of default namespace should implement ServerSideAdapter,
+with in-memory one there are no other instances and nothing is sent.
+Handlers of this instance are not called
+*/
+func (s *Server) ServerSideEmit(method string, args interface{}) error {
+	if sa, ok := s.registry.adapter().(ServerSideAdapter); ok {
+		return sa.ServerSideEmit(method, args)
+	}
+	return nil
+}
+
+/**
+Set handler of server-side event sent by other instance, f is func()
+or func(args T), args are decoded into T like event args of channels.
+Handlers are called one by one as events arrive, long work should
+be done in goroutine. Set Server.NewAdapter before, adapter of default
+namespace is created by it
+*/
+func (s *Server) OnServerSide(method string, f interface{}) error {
+	fVal := reflect.ValueOf(f)
+	if fVal.Kind() != reflect.Func {
+		return ErrorCallerNotFunc
+	}
+	if fVal.Type().NumIn() > 1 || fVal.Type().NumOut() > 0 {
+		return ErrorServerSideArgs
+	}
+
+	s.serverSideLock.Lock()
+	defer s.serverSideLock.Unlock()
+
+	if s.serverSide == nil {
+		s.serverSide = make(map[string]reflect.Value)
+	}
+	s.serverSide[method] = fVal
+
+	//adapter subscribes to events of other instances once created
+	s.registry.adapter()
+	return nil
+}
+
+/**
+Call handler of server-side event received from other instance,
+used by adapters. Events without handler are ignored
+*/
+func (r *registry) ReceiveServerSide(method string, args interface{}) {
+	s := r.server
+	if s == nil {
+		return
+	}
+
+	s.serverSideLock.RLock()
+	f, ok := s.serverSide[method]
+	s.serverSideLock.RUnlock()
+	if !ok {
+		return
+	}
+
+	in, err := serverSideArgs(f.Type(), args)
+	if err != nil {
+		loadLogger(&s.logger).Warn("wrong server-side event args", "event", method, "err", err)
+		return
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			loadLogger(&s.logger).Error("server-side handler panic", "event", method,
+				"panic", p, "stack", string(debug.Stack()))
+		}
+	}()
+	f.Call(in)
+}
+
+/**
+Convert args to argument of handler, through json if they
+are of other type, like decoded by adapter
+*/
+func serverSideArgs(fType reflect.Type, args interface{}) ([]reflect.Value, error) {
+	if fType.NumIn() == 0 {
+		return nil, nil
+	}
+
+	argType := fType.In(0)
+	if args != nil && reflect.TypeOf(args).AssignableTo(argType) {
+		return []reflect.Value{reflect.ValueOf(args)}, nil
+	}
+
+	value := reflect.New(argType)
+	if args != nil {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, value.Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return []reflect.Value{value.Elem()}, nil
+}
@@ -0,0 +1,33 @@
+package gosocketio
+
+/**
+Store value on the channel under given key, it is kept until
+channel disconnects, OnDisconnection handlers still see it
+*/
+func (c *Channel) Set(key string, value interface{}) {
+	c.session.Store(key, value)
+}
+
+/**
+Get value stored with Set, ok is false if there is none
+*/
+func (c *Channel) Get(key string) (value interface{}, ok bool) {
+	return c.session.Load(key)
+}
+
+/**
+Remove value stored with Set
+*/
+func (c *Channel) Delete(key string) {
+	c.session.Delete(key)
+}
+
+/**
+Drop all stored values of disconnected channel
+*/
+func (c *Channel) clearSession() {
+	c.session.Range(func(key, value interface{}) bool {
+		c.session.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,110 @@
+package gosocketio
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrorServerShutdown = errors.New("Server is shutting down")
+)
+
+/**
+Remember connection for Shutdown, fails if server is shutting down
+*/
+func (s *Server) addConnection(c *Channel) bool {
+	s.connectionsLock.Lock()
+	defer s.connectionsLock.Unlock()
+
+	if s.shutdown {
+		return false
+	}
+	s.connections[c] = struct{}{}
+	c.statsHook().Connected(c)
+	return true
+}
+
+func (s *Server) removeConnection(c *Channel) {
+	s.connectionsLock.Lock()
+	defer s.connectionsLock.Unlock()
+
+	delete(s.connections, c)
+}
+
+/**
+Get amount of open connections, of all namespaces
+*/
+func (s *Server) AmountOfConnections() int64 {
+	s.connectionsLock.Lock()
+	defer s.connectionsLock.Unlock()
+
+	return int64(len(s.connections))
+}
+
+/**
+Gracefully shut down the server: stop accepting connections, send
+engine.io close packet to every channel after its queue is flushed,
+and wait until connections are closed. OnDisconnection handlers
+are called for each channel.
+
+When ctx is done first, remaining connections are dropped and ctx
+error is returned. Http listener is not closed, it belongs to caller
+*/
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.StopAccepting()
+	s.EnableAppHeartbeat(0, nil)
+
+	s.connectionsLock.Lock()
+	s.shutdown = true
+	s.connectionsLock.Unlock()
+
+	channels := s.connectionsList()
+	for _, c := range channels {
+		s.closeGracefully(c, DisconnectServerShutdown)
+	}
+	return waitClosed(ctx, channels)
+}
+
+/**
+Get all open connections
+*/
+func (s *Server) connectionsList() []*Channel {
+	s.connectionsLock.Lock()
+	defer s.connectionsLock.Unlock()
+
+	channels := make([]*Channel, 0, len(s.connections))
+	for c := range s.connections {
+		channels = append(channels, c)
+	}
+	return channels
+}
+
+/**
+Close channel with engine.io close packet, sent after its queue is flushed
+*/
+func (s *Server) closeGracefully(c *Channel, reason string) {
+	c.aliveLock.Lock()
+	c.closePacket = true
+	c.closeReason = reason
+	c.aliveLock.Unlock()
+
+	closeChannel(c, &s.methods)
+}
+
+/**
+Wait until connections of closed channels are closed, when ctx is
+done first, remaining ones are dropped and ctx error is returned
+*/
+func waitClosed(ctx context.Context, channels []*Channel) error {
+	for i, c := range channels {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			for _, c := range channels[i:] {
+				c.conn.Close()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package gosocketio
+
+import (
+	"expvar"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	//upper bounds of Stats.QueueDepths buckets: channels with empty
+	//queue, with 1 packet queued, up to 10 and so on; last bucket
+	//of QueueDepths has channels with deeper queues
+	QueueDepthBuckets = []int{0, 1, 10, 100, 1000}
+)
+
+/**
+Snapshot of server counters
+*/
+type Stats struct {
+	//handshakes rejected by per ip rate limit
+	ThrottledHandshakes int64
+	//handshakes rejected after StopAccepting
+	NotAcceptedHandshakes int64
+	//handshakes rejected by middleware
+	RejectedHandshakes int64
+	//handshakes refused by ServerOptions.MaxConnections
+	RefusedHandshakes int64
+	//bytes queued for sending on all channels
+	BufferedBytes int64
+	//pongs without ping, counted unless policy is PongIgnore
+	UnexpectedPongs int64
+	//incoming messages exceeding RateLimit
+	RateLimitedMessages int64
+
+	//open connections, of all namespaces
+	OpenChannels int64
+	//goroutines of the process, and the ones of channel loops and handlers;
+	//loops are two per connection, three with EIO=4 pinger; more means a leak
+	Goroutines      int
+	LoopGoroutines  int64
+	RunningHandlers int64
+	//amount of connections by outgoing queue length, see QueueDepthBuckets
+	QueueDepths []int64
+	//packets read from and written to connections, pings included
+	PacketsReceived int64
+	PacketsSent     int64
+	//received packets which can't be decoded
+	DecodeErrors int64
+	//polling payloads refused for more packets than MaxPacketsPerPayload
+	RejectedPayloads int64
+	//time since server was created
+	Uptime time.Duration
+}
+
+/**
+Server counters, updated atomically, allocated separately
+to keep 64-bit alignment on 32-bit platforms
+*/
+type serverStats struct {
+	throttledHandshakes   int64
+	notAcceptedHandshakes int64
+	rejectedHandshakes    int64
+	refusedHandshakes     int64
+	bufferedBytes         int64
+	unexpectedPongs       int64
+	rateLimitedMessages   int64
+	packetsReceived       int64
+	packetsSent           int64
+	decodeErrors          int64
+	rejectedPayloads      int64
+	loops                 int64
+	handlers              int64
+
+	started time.Time
+
+	disconnects     map[string]int64
+	disconnectsLock sync.Mutex
+}
+
+func (st *serverStats) addNotAcceptedHandshake() {
+	atomic.AddInt64(&st.notAcceptedHandshakes, 1)
+}
+
+func (st *serverStats) addRejectedHandshake() {
+	atomic.AddInt64(&st.rejectedHandshakes, 1)
+}
+
+func (st *serverStats) addRefusedHandshake() {
+	atomic.AddInt64(&st.refusedHandshakes, 1)
+}
+
+func (st *serverStats) addUnexpectedPong() {
+	atomic.AddInt64(&st.unexpectedPongs, 1)
+}
+
+func (st *serverStats) addRateLimited() {
+	atomic.AddInt64(&st.rateLimitedMessages, 1)
+}
+
+func (st *serverStats) addDisconnect(reason string) {
+	st.disconnectsLock.Lock()
+	defer st.disconnectsLock.Unlock()
+
+	if st.disconnects == nil {
+		st.disconnects = make(map[string]int64)
+	}
+	st.disconnects[reason]++
+}
+
+func (st *serverStats) disconnectsCopy() map[string]int64 {
+	st.disconnectsLock.Lock()
+	defer st.disconnectsLock.Unlock()
+
+	result := make(map[string]int64, len(st.disconnects))
+	for reason, amount := range st.disconnects {
+		result[reason] = amount
+	}
+	return result
+}
+
+func (st *serverStats) addThrottledHandshake() {
+	atomic.AddInt64(&st.throttledHandshakes, 1)
+}
+
+/**
+Count packet and pass it to stats hook
+*/
+func (c *Channel) packetIn(size int) {
+	if c.server != nil {
+		atomic.AddInt64(&c.server.stats.packetsReceived, 1)
+	}
+	c.statsHook().PacketIn(c, size)
+}
+
+func (c *Channel) packetOut(size int) {
+	if c.server != nil {
+		atomic.AddInt64(&c.server.stats.packetsSent, 1)
+	}
+	c.statsHook().PacketOut(c, size)
+}
+
+func (c *Channel) decodeError() {
+	if c.server != nil {
+		atomic.AddInt64(&c.server.stats.decodeErrors, 1)
+	}
+	c.statsHook().DecodeError(c)
+}
+
+func (c *Channel) payloadRejected() {
+	if c.server != nil {
+		atomic.AddInt64(&c.server.stats.rejectedPayloads, 1)
+	}
+}
+
+func (c *Channel) countHandler(delta int64) {
+	if c.server != nil {
+		atomic.AddInt64(&c.server.stats.handlers, delta)
+	}
+}
+
+/**
+Get snapshot of server counters. Queue depths are collected
+from all connections, so it is not for hot path
+*/
+func (s *Server) Stats() Stats {
+	channels := s.connectionsList()
+
+	return Stats{
+		ThrottledHandshakes:   atomic.LoadInt64(&s.stats.throttledHandshakes),
+		NotAcceptedHandshakes: atomic.LoadInt64(&s.stats.notAcceptedHandshakes),
+		RejectedHandshakes:    atomic.LoadInt64(&s.stats.rejectedHandshakes),
+		RefusedHandshakes:     atomic.LoadInt64(&s.stats.refusedHandshakes),
+		BufferedBytes:         atomic.LoadInt64(&s.stats.bufferedBytes),
+		UnexpectedPongs:       atomic.LoadInt64(&s.stats.unexpectedPongs),
+		RateLimitedMessages:   atomic.LoadInt64(&s.stats.rateLimitedMessages),
+
+		OpenChannels:    int64(len(channels)),
+		Goroutines:      runtime.NumGoroutine(),
+		LoopGoroutines:  atomic.LoadInt64(&s.stats.loops),
+		RunningHandlers: atomic.LoadInt64(&s.stats.handlers),
+		QueueDepths:     queueDepths(channels),
+		PacketsReceived: atomic.LoadInt64(&s.stats.packetsReceived),
+		PacketsSent:     atomic.LoadInt64(&s.stats.packetsSent),
+		DecodeErrors:    atomic.LoadInt64(&s.stats.decodeErrors),
+		Uptime:          time.Since(s.stats.started),
+
+		RejectedPayloads: atomic.LoadInt64(&s.stats.rejectedPayloads),
+	}
+}
+
+func queueDepths(channels []*Channel) []int64 {
+	depths := make([]int64, len(QueueDepthBuckets)+1)
+	for _, c := range channels {
+		queued := c.QueueLen()
+
+		bucket := len(QueueDepthBuckets)
+		for i, bound := range QueueDepthBuckets {
+			if queued <= bound {
+				bucket = i
+				break
+			}
+		}
+		depths[bucket]++
+	}
+	return depths
+}
+
+/**
+Publish Stats as expvar variable with given name, it is shown
+at /debug/vars of expvar handler. Like expvar.Publish, it panics
+if the name is already used
+*/
+func (s *Server) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return s.Stats()
+	}))
+}
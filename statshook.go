@@ -0,0 +1,54 @@
+package gosocketio
+
+import (
+	"time"
+)
+
+/**
+Receiver of server events for metrics, set as Server.StatsHook.
+Methods are called synchronously from connection loops, possibly
+concurrently, so they should be cheap and safe for concurrent use.
+Embed NopStatsHook to implement only some of them
+*/
+type StatsHook interface {
+	//connection accepted, after handshake middleware
+	Connected(c *Channel)
+	//connection closed, reason is one of Disconnect* constants
+	Disconnected(c *Channel, reason string)
+	//packet received from connection, size in bytes
+	PacketIn(c *Channel, size int)
+	//packet written to connection, size in bytes
+	PacketOut(c *Channel, size int)
+	//ack response received, d is time since ack request was sent
+	AckLatency(c *Channel, d time.Duration)
+	//pong received, d is time since ping was sent
+	PingRTT(c *Channel, d time.Duration)
+	//received packet can't be decoded, channel is closed
+	DecodeError(c *Channel)
+	//packet does not fit into outgoing queue
+	Overflow(c *Channel)
+}
+
+/**
+StatsHook doing nothing
+*/
+type NopStatsHook struct{}
+
+func (NopStatsHook) Connected(c *Channel)                   {}
+func (NopStatsHook) Disconnected(c *Channel, reason string) {}
+func (NopStatsHook) PacketIn(c *Channel, size int)          {}
+func (NopStatsHook) PacketOut(c *Channel, size int)         {}
+func (NopStatsHook) AckLatency(c *Channel, d time.Duration) {}
+func (NopStatsHook) PingRTT(c *Channel, d time.Duration)    {}
+func (NopStatsHook) DecodeError(c *Channel)                 {}
+func (NopStatsHook) Overflow(c *Channel)                    {}
+
+/**
+Get stats hook of channel server, client channels have none
+*/
+func (c *Channel) statsHook() StatsHook {
+	if c.server == nil || c.server.StatsHook == nil {
+		return NopStatsHook{}
+	}
+	return c.server.StatsHook
+}
@@ -0,0 +1,117 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/transport"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+const (
+	//set on forwarded requests, they are never forwarded again
+	HeaderForwardedSession = "X-Socketio-Forwarded"
+)
+
+/**
+Finds instance serving session, so requests of polling sessions
+work without sticky load balancer
+*/
+type SessionResolver interface {
+	/**
+	Get address of instance serving session, like "10.0.0.2:8000";
+	empty if it is not known or it is this instance
+	*/
+	ResolveSession(sid string) (addr string, err error)
+}
+
+/**
+Resolver which is told about sessions of this instance,
+like cluster adapter keeping them for all instances
+*/
+type SessionRegistry interface {
+	SessionResolver
+
+	AddSession(sid string) error
+	RemoveSession(sid string) error
+}
+
+/**
+Forwarding of requests with sid this instance does not serve
+*/
+type StickyConfig struct {
+	//nil disables forwarding
+	Resolver SessionResolver
+	//of forwarded requests, "http" if empty
+	Scheme string
+	//of forwarded requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+}
+
+func (cfg *StickyConfig) scheme() string {
+	if cfg.Scheme == "" {
+		return "http"
+	}
+	return cfg.Scheme
+}
+
+/**
+Forward request of session served by other instance to it, false
+if it is served here. Requests of unknown sessions are served here
+and get unknown session error
+*/
+func (s *Server) forwardSession(w http.ResponseWriter, r *http.Request) bool {
+	cfg := &s.Sticky
+	sid := r.URL.Query().Get("sid")
+	if cfg.Resolver == nil || sid == "" || r.Header.Get(HeaderForwardedSession) != "" {
+		return false
+	}
+
+	st, ok := s.tr.(transport.SessionTransport)
+	if !ok || st.HasSession(sid) {
+		return false
+	}
+
+	addr, err := cfg.Resolver.ResolveSession(sid)
+	if err != nil {
+		loadLogger(&s.logger).Warn("session not resolved", "sid", sid, "error", err)
+		return false
+	}
+	if addr == "" {
+		return false
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: cfg.scheme(), Host: addr})
+	proxy.Transport = cfg.Transport
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Header.Set(HeaderForwardedSession, "1")
+	}
+	proxy.ServeHTTP(w, r)
+	return true
+}
+
+/**
+Tell session registry about new session connection
+*/
+func (s *Server) sessionStarted(c *Channel) {
+	sc, ok := c.conn.(transport.SessionConnection)
+	registry, isRegistry := s.Sticky.Resolver.(SessionRegistry)
+	if !ok || !isRegistry {
+		return
+	}
+	if err := registry.AddSession(sc.Sid()); err != nil {
+		c.log().Warn("session not registered", "sid", sc.Sid(), "error", err)
+	}
+}
+
+func (s *Server) sessionEnded(c *Channel) {
+	sc, ok := c.conn.(transport.SessionConnection)
+	registry, isRegistry := s.Sticky.Resolver.(SessionRegistry)
+	if !ok || !isRegistry {
+		return
+	}
+	if err := registry.RemoveSession(sc.Sid()); err != nil {
+		c.log().Warn("session not removed", "sid", sc.Sid(), "error", err)
+	}
+}
@@ -0,0 +1,633 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"io"
+	"sync"
+)
+
+const (
+	DefaultStreamChunkSize = 64 * 1024
+	DefaultStreamWindow    = 8
+	DefaultStreamReaders   = 16
+)
+
+/**
+Stream packets, they don't reach event handlers. Writer sends
+
+	stream:open {"id": 1, "event": "upload"}
+	stream:data {"id": 1, "seq": 0, "data": <binary>}
+	stream:end  {"id": 1, "seq": <chunks sent>, "error": "..."} as ack request
+
+reader answers with chunks it can take more and, if it stops reading,
+with cancel; end is acknowledged with error of the stream handler:
+
+	stream:credit {"id": 1, "n": 8}
+	stream:cancel {"id": 1, "error": "..."}
+*/
+const (
+	streamOpenEvent   = "stream:open"
+	streamDataEvent   = "stream:data"
+	streamEndEvent    = "stream:end"
+	streamCreditEvent = "stream:credit"
+	streamCancelEvent = "stream:cancel"
+)
+
+var (
+	ErrorStreamRefused = errors.New("No stream handler")
+	ErrorStreamClosed  = errors.New("Stream closed")
+	ErrorStreamOverrun = errors.New("Stream window overrun")
+	ErrorStreamLimit   = errors.New("Too many streams")
+)
+
+/**
+Receives stream opened by peer with OpenStream, r returns io.EOF
+once writer is closed. Stream is cancelled if handler returns before
+reading all of it; its error is returned by Close of the writer
+*/
+type StreamHandler func(c *Channel, r io.Reader) error
+
+/**
+Sizes of streams, writer splits data into chunks of ChunkSize,
+reader lets Window chunks to be in flight. Both sides need them
+before connecting. Streams opened by peer above Readers are refused
+*/
+type StreamConfig struct {
+	//bytes of data packet, DefaultStreamChunkSize if 0; keep it
+	//below max message size of the peer
+	ChunkSize int
+	//chunks sent without waiting for reader, DefaultStreamWindow if 0
+	Window int
+	//streams of peer read at once by channel, DefaultStreamReaders if 0
+	Readers int
+}
+
+func (cfg *StreamConfig) chunkSize() int {
+	if cfg.ChunkSize <= 0 {
+		return DefaultStreamChunkSize
+	}
+	return cfg.ChunkSize
+}
+
+func (cfg *StreamConfig) window() int {
+	if cfg.Window <= 0 {
+		return DefaultStreamWindow
+	}
+	return cfg.Window
+}
+
+func (cfg *StreamConfig) readers() int {
+	if cfg.Readers <= 0 {
+		return DefaultStreamReaders
+	}
+	return cfg.Readers
+}
+
+type streamPacket struct {
+	Id    int    `json:"id"`
+	Event string `json:"event,omitempty"`
+	Seq   int    `json:"seq,omitempty"`
+	Data  []byte `json:"data,omitempty"`
+	N     int    `json:"n,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+/**
+Open streams of channel, by id given by writer side
+*/
+type streamSet struct {
+	nextId  int
+	writers map[int]*StreamWriter
+	readers map[int]*streamReader
+	closed  bool //by closeStreams, no readers are added then
+	lock    sync.Mutex
+}
+
+/**
+Writer side of stream, see Channel.OpenStream
+*/
+type StreamWriter struct {
+	c         *Channel
+	id        int
+	chunkSize int
+
+	seq    int   //chunks sent
+	credit int   //chunks reader can take
+	err    error //cancel by reader or channel close
+	closed bool
+	lock   sync.Mutex
+	signal chan struct{} //wakes Write waiting for credit
+}
+
+/**
+Open stream to peer handler registered with OnStream for event.
+Written data is sent in chunks, Write waits while reader is behind.
+Close must be called, it waits for the result of peer handler
+*/
+func (c *Channel) OpenStream(event string) (*StreamWriter, error) {
+	if !c.IsAlive() {
+		return nil, ErrorSocketClosed
+	}
+
+	w := &StreamWriter{
+		c:         c,
+		chunkSize: c.streamConfig.chunkSize(),
+		signal:    make(chan struct{}, 1),
+	}
+
+	c.streams.lock.Lock()
+	c.streams.nextId++
+	w.id = c.streams.nextId
+	if c.streams.writers == nil {
+		c.streams.writers = make(map[int]*StreamWriter)
+	}
+	c.streams.writers[w.id] = w
+	c.streams.lock.Unlock()
+
+	if err := c.Emit(streamOpenEvent, streamPacket{Id: w.id, Event: event}); err != nil {
+		c.removeWriter(w.id)
+		return nil, err
+	}
+	return w, nil
+}
+
+/**
+Send p in chunks, waiting for credit of reader
+*/
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if err := w.waitCredit(); err != nil {
+			return written, err
+		}
+
+		size := w.chunkSize
+		if size > len(p) {
+			size = len(p)
+		}
+
+		w.lock.Lock()
+		seq := w.seq
+		w.seq++
+		w.lock.Unlock()
+
+		//binary attachments are taken from maps only
+		err := w.c.Emit(streamDataEvent, map[string]interface{}{"id": w.id, "seq": seq, "data": p[:size]})
+		if err != nil {
+			w.fail(err)
+			return written, err
+		}
+		written += size
+		p = p[size:]
+	}
+	return written, nil
+}
+
+func (w *StreamWriter) waitCredit() error {
+	for {
+		w.lock.Lock()
+		if w.closed {
+			w.lock.Unlock()
+			return ErrorStreamClosed
+		}
+		if w.err != nil {
+			err := w.err
+			w.lock.Unlock()
+			return err
+		}
+		if w.credit > 0 {
+			w.credit--
+			w.lock.Unlock()
+			return nil
+		}
+		w.lock.Unlock()
+
+		<-w.signal
+	}
+}
+
+/**
+Finish the stream and wait for peer handler to return, its error is
+returned. Waits up to ack timeout of the channel
+*/
+func (w *StreamWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+/**
+Finish the stream, reader gets err instead of io.EOF if it is not nil
+*/
+func (w *StreamWriter) CloseWithError(err error) error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return ErrorStreamClosed
+	}
+	w.closed = true
+	streamErr := w.err
+	end := streamPacket{Id: w.id, Seq: w.seq}
+	w.lock.Unlock()
+	w.wake()
+
+	defer w.c.removeWriter(w.id)
+
+	//cancelled stream is over on reader side already
+	if streamErr != nil {
+		return streamErr
+	}
+	if err != nil {
+		end.Error = err.Error()
+	}
+
+	reply, ackErr := w.c.Ack(streamEndEvent, end, 0)
+	if ackErr != nil {
+		return ackErr
+	}
+
+	var result streamPacket
+	if err := json.Unmarshal([]byte(reply), &result); err != nil {
+		return err
+	}
+	return streamError(result.Error)
+}
+
+func (w *StreamWriter) addCredit(n int) {
+	w.lock.Lock()
+	w.credit += n
+	w.lock.Unlock()
+	w.wake()
+}
+
+func (w *StreamWriter) fail(err error) {
+	w.lock.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.lock.Unlock()
+	w.wake()
+}
+
+func (w *StreamWriter) wake() {
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Channel) removeWriter(id int) {
+	c.streams.lock.Lock()
+	delete(c.streams.writers, id)
+	c.streams.lock.Unlock()
+}
+
+func (c *Channel) writer(id int) *StreamWriter {
+	c.streams.lock.Lock()
+	defer c.streams.lock.Unlock()
+
+	return c.streams.writers[id]
+}
+
+/**
+Reader side of stream given to StreamHandler. Data packets are handled
+concurrently, so chunks are put in order by their seq
+*/
+type streamReader struct {
+	c      *Channel
+	id     int
+	window int
+
+	chunks   map[int][]byte //received ahead of next
+	buf      []byte         //rest of current chunk
+	next     int            //seq of chunk to read
+	end      int            //chunks in stream, -1 until end packet
+	err      error          //abort by writer or channel close
+	consumed int            //chunks read since last credit
+	lock     sync.Mutex
+	cond     *sync.Cond
+
+	result error         //of handler
+	done   chan struct{} //closed when handler returned
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r.lock.Lock()
+	for {
+		//chunks left are dropped on abort
+		if r.err != nil {
+			err := r.err
+			r.lock.Unlock()
+			return 0, err
+		}
+		if len(r.buf) > 0 {
+			break
+		}
+		if chunk, ok := r.chunks[r.next]; ok {
+			delete(r.chunks, r.next)
+			r.buf = chunk
+			r.next++
+			r.consumed++
+			continue
+		}
+		if r.end >= 0 && r.next >= r.end {
+			r.lock.Unlock()
+			return 0, io.EOF
+		}
+		r.cond.Wait()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	//credit is given back in batches of half the window
+	credit := 0
+	if r.consumed >= (r.window+1)/2 {
+		credit = r.consumed
+		r.consumed = 0
+	}
+	r.lock.Unlock()
+
+	if credit > 0 {
+		r.c.Emit(streamCreditEvent, streamPacket{Id: r.id, N: credit})
+	}
+	return n, nil
+}
+
+func (r *streamReader) add(seq int, data []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if seq < r.next {
+		return nil
+	}
+	//writer never sends more than it was given credit for
+	if len(r.chunks) >= r.window {
+		return ErrorStreamOverrun
+	}
+	if r.chunks == nil {
+		r.chunks = make(map[int][]byte)
+	}
+	r.chunks[seq] = data
+	r.cond.Broadcast()
+	return nil
+}
+
+func (r *streamReader) finish(chunks int, err error) {
+	r.lock.Lock()
+	r.end = chunks
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	r.cond.Broadcast()
+	r.lock.Unlock()
+}
+
+func (r *streamReader) fail(err error) {
+	r.lock.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.cond.Broadcast()
+	r.lock.Unlock()
+}
+
+/**
+Whether whole stream was read, handler returning before it cancels it
+*/
+func (r *streamReader) complete() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.err == nil && r.end >= 0 && r.next >= r.end && len(r.buf) == 0
+}
+
+func (c *Channel) reader(id int) *streamReader {
+	c.streams.lock.Lock()
+	defer c.streams.lock.Unlock()
+
+	return c.streams.readers[id]
+}
+
+/**
+Add reader of opened stream. Reader with the same id is kept, its
+handler would wait for good otherwise
+*/
+func (c *Channel) addReader(r *streamReader) error {
+	c.streams.lock.Lock()
+	defer c.streams.lock.Unlock()
+
+	if c.streams.closed {
+		return ErrorStreamClosed
+	}
+	if _, ok := c.streams.readers[r.id]; ok {
+		return ErrorStreamRefused
+	}
+	if len(c.streams.readers) >= c.streamConfig.readers() {
+		return ErrorStreamLimit
+	}
+	if c.streams.readers == nil {
+		c.streams.readers = make(map[int]*streamReader)
+	}
+	c.streams.readers[r.id] = r
+	return nil
+}
+
+func (c *Channel) removeReader(id int) {
+	c.streams.lock.Lock()
+	delete(c.streams.readers, id)
+	c.streams.lock.Unlock()
+}
+
+/**
+Fail open streams of closed channel, waiting writers and readers
+get err
+*/
+func (c *Channel) closeStreams(err error) {
+	c.streams.lock.Lock()
+	writers := c.streams.writers
+	readers := c.streams.readers
+	c.streams.writers = nil
+	c.streams.readers = nil
+	c.streams.closed = true
+	c.streams.lock.Unlock()
+
+	for _, w := range writers {
+		w.fail(err)
+	}
+	for _, r := range readers {
+		r.fail(err)
+	}
+}
+
+/**
+Register handler of streams opened by peer for event
+*/
+func (m *methods) OnStream(event string, f StreamHandler) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	if m.streamHandlers == nil {
+		m.streamHandlers = make(map[string]StreamHandler)
+	}
+	m.streamHandlers[event] = f
+}
+
+func (m *methods) findStreamHandler(event string) (StreamHandler, bool) {
+	m.messageHandlersLock.RLock()
+	defer m.messageHandlersLock.RUnlock()
+
+	f, ok := m.streamHandlers[event]
+	return f, ok
+}
+
+/**
+Process stream packet, false if message is not one
+*/
+func (m *methods) processStream(c *Channel, msg *protocol.Message) bool {
+	if !isStreamPacket(msg) {
+		return false
+	}
+
+	var packet streamPacket
+	if !m.unmarshalArgs(c, msg, &packet) {
+		return true
+	}
+
+	switch msg.Method {
+	case streamOpenEvent:
+		m.openStream(c, packet)
+	case streamDataEvent:
+		if r := c.reader(packet.Id); r != nil {
+			if err := r.add(packet.Seq, packet.Data); err != nil {
+				r.fail(err)
+			}
+		}
+	case streamEndEvent:
+		result := streamPacket{Id: packet.Id}
+		if err := c.endStream(packet); err != nil {
+			result.Error = err.Error()
+		}
+		if msg.Type == protocol.MessageTypeAckRequest {
+			send(&protocol.Message{Type: protocol.MessageTypeAckResponse, AckId: msg.AckId}, c, result)
+		}
+	case streamCreditEvent:
+		if w := c.writer(packet.Id); w != nil {
+			w.addCredit(packet.N)
+		}
+	case streamCancelEvent:
+		if w := c.writer(packet.Id); w != nil {
+			w.fail(streamError(packet.Error))
+		}
+	}
+	return true
+}
+
+func isStreamPacket(msg *protocol.Message) bool {
+	if msg.Type != protocol.MessageTypeEmit && msg.Type != protocol.MessageTypeAckRequest {
+		return false
+	}
+	switch msg.Method {
+	case streamOpenEvent, streamDataEvent, streamEndEvent, streamCreditEvent, streamCancelEvent:
+		return true
+	}
+	return false
+}
+
+/**
+Start reader of opened stream and run its handler, stream without
+handler, with id of open one or above reader limit is cancelled
+*/
+func (m *methods) openStream(c *Channel, packet streamPacket) {
+	f, ok := m.findStreamHandler(packet.Event)
+	if !ok {
+		c.Emit(streamCancelEvent, streamPacket{Id: packet.Id, Error: ErrorStreamRefused.Error()})
+		return
+	}
+
+	r := &streamReader{
+		c:      c,
+		id:     packet.Id,
+		window: c.streamConfig.window(),
+		end:    -1,
+		done:   make(chan struct{}),
+	}
+	r.cond = sync.NewCond(&r.lock)
+
+	if err := c.addReader(r); err != nil {
+		c.Emit(streamCancelEvent, streamPacket{Id: packet.Id, Error: err.Error()})
+		return
+	}
+
+	returned := false
+	defer func() {
+		//panic of handler goes on to event processing
+		if !returned {
+			r.result = ErrorStreamClosed
+		}
+		complete := r.complete()
+		if !complete {
+			c.removeReader(r.id)
+		}
+		close(r.done)
+
+		if !complete {
+			cancel := streamPacket{Id: r.id, Error: ErrorStreamClosed.Error()}
+			if r.result != nil {
+				cancel.Error = r.result.Error()
+			}
+			c.Emit(streamCancelEvent, cancel)
+		}
+	}()
+
+	c.Emit(streamCreditEvent, streamPacket{Id: r.id, N: r.window})
+	r.result = f(c, r)
+	returned = true
+}
+
+/**
+Finish stream on end packet and wait for its handler
+*/
+func (c *Channel) endStream(packet streamPacket) error {
+	r := c.reader(packet.Id)
+	if r == nil {
+		return ErrorStreamClosed
+	}
+
+	var err error
+	if packet.Error != "" {
+		err = errors.New(packet.Error)
+	}
+	r.finish(packet.Seq, err)
+
+	select {
+	case <-r.done:
+	case <-c.done:
+		return ErrorSocketClosed
+	}
+	c.removeReader(r.id)
+	return r.result
+}
+
+/**
+Get error sent by peer, errors of this package stay comparable
+*/
+func streamError(message string) error {
+	switch message {
+	case "":
+		return nil
+	case ErrorStreamRefused.Error():
+		return ErrorStreamRefused
+	case ErrorStreamClosed.Error():
+		return ErrorStreamClosed
+	case ErrorStreamOverrun.Error():
+		return ErrorStreamOverrun
+	case ErrorStreamLimit.Error():
+		return ErrorStreamLimit
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,106 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/gosocketiotest"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.Streams = StreamConfig{ChunkSize: 3, Window: 2}
+	got := make(chan string, 1)
+	s.OnStream("upload", func(c *Channel, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		got <- string(data)
+		return err
+	})
+	c, _ := dialTestConfig(t, s, tr, gosocketiotest.Url, ClientConfig{Streams: StreamConfig{ChunkSize: 3, Window: 2}})
+
+	w, err := c.OpenStream("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "0123456789"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-got; data != "0123456789" {
+		t.Fatalf("got %q", data)
+	}
+}
+
+/**
+Open stream packet with id of open stream is refused, the first
+stream fails with the channel and its closing doesn't wait for good
+*/
+func TestStreamDuplicateOpen(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	opened := make(chan struct{}, 2)
+	failed := make(chan error, 2)
+	s.OnStream("upload", func(c *Channel, r io.Reader) error {
+		opened <- struct{}{}
+		_, err := ioutil.ReadAll(r)
+		failed <- err
+		return err
+	})
+	c, sc := dialTest(t, s, tr, gosocketiotest.Url)
+
+	c.Emit(streamOpenEvent, streamPacket{Id: 1, Event: "upload"})
+	<-opened
+	c.Emit(streamOpenEvent, streamPacket{Id: 1, Event: "upload"})
+	cancel := `42["stream:cancel",{"id":1,"error":"No stream handler"}]`
+	if _, ok := tr.Last().Server.WaitWritten(cancel, time.Second); !ok {
+		t.Fatalf("duplicate open was not refused, written %q", tr.Last().Server.Written())
+	}
+
+	c.Close()
+	select {
+	case err := <-failed:
+		if err != ErrorSocketClosed {
+			t.Fatalf("stream failed with %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("first stream was left waiting")
+	}
+	select {
+	case <-sc.done:
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed")
+	}
+	if len(opened) != 0 {
+		t.Fatal("duplicate stream was opened")
+	}
+}
+
+func TestStreamReaderLimit(t *testing.T) {
+	tr := gosocketiotest.NewTransport()
+	s := NewServer(tr)
+	s.Streams = StreamConfig{Readers: 2}
+	opened := make(chan struct{}, 3)
+	s.OnStream("upload", func(c *Channel, r io.Reader) error {
+		opened <- struct{}{}
+		_, err := ioutil.ReadAll(r)
+		return err
+	})
+	c, _ := dialTest(t, s, tr, gosocketiotest.Url)
+
+	c.Emit(streamOpenEvent, streamPacket{Id: 1, Event: "upload"})
+	c.Emit(streamOpenEvent, streamPacket{Id: 2, Event: "upload"})
+	<-opened
+	<-opened
+	c.Emit(streamOpenEvent, streamPacket{Id: 3, Event: "upload"})
+	cancel := `42["stream:cancel",{"id":3,"error":"Too many streams"}]`
+	if _, ok := tr.Last().Server.WaitWritten(cancel, time.Second); !ok {
+		t.Fatalf("stream above limit was not refused, written %q", tr.Last().Server.Written())
+	}
+	if len(opened) != 0 {
+		t.Fatal("stream above limit was opened")
+	}
+}
@@ -0,0 +1,103 @@
+package gosocketio
+
+import (
+	"errors"
+)
+
+var (
+	ErrorResponderNoResult = errors.New("Handler returns no value")
+)
+
+/**
+Handle of message processing function added by Subscribe,
+removes only that function, others of the method stay
+*/
+type Subscription struct {
+	methods *methods
+	method  string
+	caller  *caller
+}
+
+/**
+Add message processing function like On does, returned
+subscription removes it or makes it answer ack requests:
+
+	sub, _ := server.Subscribe("join", audit)
+	...
+	sub.Off()
+*/
+func (m *methods) Subscribe(method string, f interface{}) (*Subscription, error) {
+	c, err := newCaller(f)
+	if err != nil {
+		return nil, err
+	}
+
+	m.addCaller(method, c)
+	return &Subscription{methods: m, method: method, caller: c}, nil
+}
+
+func (m *methods) addCaller(method string, c *caller) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	list := m.messageHandlers[method]
+	//lists are never changed in place, handlers are called out of lock
+	m.messageHandlers[method] = append(list[:len(list):len(list)], c)
+}
+
+/**
+Replace functions of method, should be called under lock
+*/
+func (m *methods) setCallers(method string, list []*caller) {
+	if len(list) == 0 {
+		delete(m.messageHandlers, method)
+		return
+	}
+	m.messageHandlers[method] = list
+}
+
+/**
+Event of subscription
+*/
+func (s *Subscription) Method() string {
+	return s.method
+}
+
+/**
+Remove function of subscription, if it is not removed yet
+*/
+func (s *Subscription) Off() {
+	m := s.methods
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	list := m.messageHandlers[s.method]
+	kept := make([]*caller, 0, len(list))
+	for _, f := range list {
+		if f != s.caller {
+			kept = append(kept, f)
+		}
+	}
+	m.setCallers(s.method, kept)
+	if m.responders[s.method] == s.caller {
+		delete(m.responders, s.method)
+	}
+}
+
+/**
+Answer ack requests of method with result of this function,
+instead of the first registered one returning a value.
+Other functions are still called, their results are dropped
+*/
+func (s *Subscription) Respond() error {
+	if !s.caller.Out {
+		return ErrorResponderNoResult
+	}
+
+	m := s.methods
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	m.responders[s.method] = s.caller
+	return nil
+}
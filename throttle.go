@@ -0,0 +1,112 @@
+package gosocketio
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	//buckets are swept for full ones once the map grows above this size
+	throttleSweepSize = 1024
+)
+
+type ipBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+/**
+Token buckets of handshakes, keyed by remote ip
+*/
+type ipThrottle struct {
+	buckets map[string]*ipBucket
+	lock    sync.Mutex
+}
+
+/**
+Take one token from the bucket of given ip, if the bucket is empty
+returns time left until the next token
+*/
+func (t *ipThrottle) take(ip string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.buckets == nil {
+		t.buckets = make(map[string]*ipBucket)
+	}
+	if len(t.buckets) > throttleSweepSize {
+		t.sweep(rate, burst, now)
+	}
+
+	b, ok := t.buckets[ip]
+	if !ok {
+		b = &ipBucket{tokens: float64(burst), last: now}
+		t.buckets[ip] = b
+	}
+
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+/**
+Remove buckets that are refilled, they are same as missing ones
+*/
+func (t *ipThrottle) sweep(rate float64, burst int, now time.Time) {
+	for ip, b := range t.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst) {
+			delete(t.buckets, ip)
+		}
+	}
+}
+
+/**
+Get ip part of remote address, port is different for each connection
+*/
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+/**
+Check handshake rate of client ip, same one as Channel.Ip gives, so
+clients behind trusted proxy get buckets of their own. Answers with
+429 if exceeded
+*/
+func (s *Server) allowHandshake(w http.ResponseWriter, r *http.Request) bool {
+	rate := s.ConnectionsPerIPPerSecond
+	if rate <= 0 {
+		return true
+	}
+
+	burst := s.ConnectionBurstPerIP
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+
+	ip := remoteHost(s.clientIp(r.RemoteAddr, r.Header, isUnixRequest(r)))
+	ok, wait := s.throttle.take(ip, rate, burst, s.clock().Now())
+	if ok {
+		return true
+	}
+
+	s.stats.addThrottledHandshake()
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	return false
+}
@@ -0,0 +1,66 @@
+package gosocketio
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func handshakeRequest(remoteAddr, forwarded string) *http.Request {
+	r := httptest.NewRequest("GET", "/socket.io/?EIO=3&transport=websocket", nil)
+	r.RemoteAddr = remoteAddr
+	if forwarded != "" {
+		r.Header.Set(HeaderForward, forwarded)
+	}
+	return r
+}
+
+func allowed(s *Server, r *http.Request) bool {
+	return s.allowHandshake(httptest.NewRecorder(), r)
+}
+
+func TestThrottleDirectClients(t *testing.T) {
+	s := NewServer(nil)
+	s.ConnectionsPerIPPerSecond = 0.001
+	s.ConnectionBurstPerIP = 1
+
+	if !allowed(s, handshakeRequest("1.1.1.1:1000", "")) {
+		t.Fatal("first handshake throttled")
+	}
+	//other port of same host shares the bucket
+	w := httptest.NewRecorder()
+	if s.allowHandshake(w, handshakeRequest("1.1.1.1:1001", "")) {
+		t.Fatal("second handshake allowed")
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatal(w.Code, w.Header())
+	}
+	if !allowed(s, handshakeRequest("2.2.2.2:1000", "")) {
+		t.Fatal("other host throttled")
+	}
+
+	//spoofed header of untrusted peer does not give new bucket
+	if allowed(s, handshakeRequest("1.1.1.1:1002", "3.3.3.3")) {
+		t.Fatal("spoofed forward header escaped throttle")
+	}
+}
+
+func TestThrottleProxiedClients(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+
+	s := NewServer(nil)
+	s.ConnectionsPerIPPerSecond = 0.001
+	s.ConnectionBurstPerIP = 1
+	s.TrustedProxies = []*net.IPNet{proxies}
+
+	if !allowed(s, handshakeRequest("10.0.0.1:1000", "1.1.1.1")) {
+		t.Fatal("first client throttled")
+	}
+	if !allowed(s, handshakeRequest("10.0.0.1:1001", "2.2.2.2")) {
+		t.Fatal("second client behind same proxy throttled")
+	}
+	if allowed(s, handshakeRequest("10.0.0.2:1000", "1.1.1.1")) {
+		t.Fatal("first client allowed again through other proxy")
+	}
+}
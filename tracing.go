@@ -0,0 +1,115 @@
+package gosocketio
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/graarh/golang-socketio/protocol"
+	"strings"
+)
+
+const (
+	//key of trace context object, appended to event arguments
+	traceField = "$trace"
+)
+
+/**
+Creates trace spans of events, otel package has OpenTelemetry one.
+Carrier holds trace context: StartEvent gets one received with the
+event, StartEmit fills one to send
+*/
+type Tracer interface {
+	//called for received event, returned ctx is passed to handler
+	//taking context.Context, end is called after handler returns
+	StartEvent(ctx context.Context, c *Channel, event string, carrier map[string]string) (context.Context, func())
+	//called for sent event, end gets error of send, or of ack wait
+	StartEmit(ctx context.Context, c *Channel, event string, carrier map[string]string) func(err error)
+}
+
+/**
+Tracing of channel events
+*/
+type TraceConfig struct {
+	//nil disables tracing
+	Tracer Tracer
+	//send trace context as last argument of events, and take it
+	//from received ones; enable only if both sides are this package,
+	//other peers get it as extra argument
+	Propagate bool
+}
+
+/**
+Start span of received event, trace context sent by peer
+is removed from its arguments
+*/
+func (c *Channel) startEvent(ctx context.Context, msg *protocol.Message) (context.Context, func()) {
+	var carrier map[string]string
+	if c.trace.Propagate {
+		msg.Args, carrier = extractTrace(msg.Args)
+		if carrier != nil {
+			dropLastValue(msg)
+		}
+	}
+
+	if c.trace.Tracer == nil {
+		return ctx, func() {}
+	}
+	if carrier == nil {
+		carrier = map[string]string{}
+	}
+	return c.trace.Tracer.StartEvent(ctx, c, msg.Method, carrier)
+}
+
+/**
+Start span of sent event, returns trace context to send
+with it, nil if it should not be sent
+*/
+func (c *Channel) startEmit(ctx context.Context, method string) (map[string]string, func(error)) {
+	if c.trace.Tracer == nil {
+		return nil, func(error) {}
+	}
+
+	carrier := map[string]string{}
+	end := c.trace.Tracer.StartEmit(ctx, c, method, carrier)
+	if !c.trace.Propagate || len(carrier) == 0 {
+		carrier = nil
+	}
+	return carrier, end
+}
+
+/**
+Append trace context object to arguments of packet
+*/
+func appendTrace(msg *protocol.Message, carrier map[string]string) {
+	appendArg(msg, map[string]interface{}{traceField: carrier})
+}
+
+/**
+Split trace context object from the end of encoded arguments,
+arguments are returned as they are if there is none
+*/
+func extractTrace(args string) (string, map[string]string) {
+	if !strings.Contains(args, `"`+traceField+`"`) {
+		return args, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte("["+args+"]"), &items); err != nil || len(items) == 0 {
+		return args, nil
+	}
+
+	var trace map[string]map[string]string
+	last := items[len(items)-1]
+	if err := json.Unmarshal(last, &trace); err != nil || len(trace) != 1 {
+		return args, nil
+	}
+	carrier, ok := trace[traceField]
+	if !ok {
+		return args, nil
+	}
+
+	rest := make([]string, len(items)-1)
+	for i, item := range items[:len(items)-1] {
+		rest[i] = string(item)
+	}
+	return strings.Join(rest, ","), carrier
+}
@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+const (
+	//buffer of bigger batch is not kept for the next one
+	maxBatchBufferSize = 64 * 1024
+)
+
+/**
+Network connection of websocket which can hold writes back,
+so frames of several messages go to the socket with one write
+*/
+type batchConn struct {
+	net.Conn
+
+	lock   sync.Mutex
+	corked bool
+	buf    []byte
+}
+
+func (bc *batchConn) Write(p []byte) (int, error) {
+	bc.lock.Lock()
+	if bc.corked {
+		bc.buf = append(bc.buf, p...)
+		bc.lock.Unlock()
+		return len(p), nil
+	}
+	bc.lock.Unlock()
+
+	return bc.Conn.Write(p)
+}
+
+/**
+Hold writes until flush
+*/
+func (bc *batchConn) cork() {
+	bc.lock.Lock()
+	bc.corked = true
+	bc.lock.Unlock()
+}
+
+/**
+Write everything held since cork with one write
+*/
+func (bc *batchConn) flush() error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.corked = false
+	if len(bc.buf) == 0 {
+		return nil
+	}
+	_, err := bc.Conn.Write(bc.buf)
+	bc.buf = bc.buf[:0]
+	if cap(bc.buf) > maxBatchBufferSize {
+		bc.buf = nil
+	}
+	return err
+}
+
+/**
+Response writer giving hijacked connection wrapped to batchConn,
+so server websocket connections can batch writes
+*/
+type batchHijacker struct {
+	http.ResponseWriter
+	conn *batchConn
+}
+
+func (h *batchHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := h.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	h.conn = &batchConn{Conn: conn}
+	return h.conn, rw, nil
+}
+
+/**
+Wrap dial function of client connections, connection it made
+is stored to conn
+*/
+func batchDial(dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	conn **batchConn) func(ctx context.Context, network, addr string) (net.Conn, error) {
+
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		*conn = &batchConn{Conn: c}
+		return *conn, nil
+	}
+}
@@ -0,0 +1,185 @@
+package transport
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	//EIO=4 payload packets separator
+	recordSeparator = "\x1e"
+
+	//binary packets are passed to connection users in EIO=3 text form,
+	//binaryPrefix, packet type and base64 data, like "b4AQID"
+	binaryPrefix  = "b"
+	packetMessage = "4"
+
+	//more digits would overflow length anyway
+	maxLengthDigits = 10
+)
+
+var (
+	ErrorWrongPayload   = errors.New("Wrong payload")
+	ErrorTooManyPackets = errors.New("Too many packets in payload")
+)
+
+/**
+Encode packets to payload of given engine.io version
+*/
+func encodePayload(packets []string, eio4 bool) string {
+	if !eio4 {
+		return encodePayloadV3(packets)
+	}
+
+	//EIO=4 binary packets are always messages, type is omitted
+	encoded := make([]string, len(packets))
+	for i, packet := range packets {
+		if strings.HasPrefix(packet, binaryPrefix+packetMessage) {
+			packet = binaryPrefix + packet[len(binaryPrefix+packetMessage):]
+		}
+		encoded[i] = packet
+	}
+	return strings.Join(encoded, recordSeparator)
+}
+
+/**
+Split payload of given engine.io version to packets, payload with
+more than max of them is ErrorTooManyPackets; no limit if max is 0
+*/
+func decodePayload(payload string, eio4 bool, max int) ([]string, error) {
+	if !eio4 {
+		return decodePayloadV3(payload, max)
+	}
+	if payload == "" {
+		return nil, nil
+	}
+
+	//the rest is not split once there are too many
+	packets := strings.SplitN(payload, recordSeparator, max+1)
+	if max == 0 {
+		packets = strings.Split(payload, recordSeparator)
+	}
+	if max > 0 && len(packets) > max {
+		return nil, ErrorTooManyPackets
+	}
+	for i, packet := range packets {
+		if strings.HasPrefix(packet, binaryPrefix) {
+			packets[i] = binaryPrefix + packetMessage + packet[len(binaryPrefix):]
+		}
+	}
+	return packets, nil
+}
+
+/**
+Split EIO=3 binary payload, sent by clients supporting binary
+with application/octet-stream content type. Each packet is
+string or binary flag, length digits as bytes, 255, and data
+*/
+func decodeBinaryPayloadV3(payload []byte, max int) ([]string, error) {
+	var packets []string
+
+	for len(payload) > 0 {
+		if max > 0 && len(packets) == max {
+			return nil, ErrorTooManyPackets
+		}
+		isString := payload[0] == 0
+
+		length, pos := 0, 1
+		for ; pos < len(payload) && payload[pos] != 255; pos++ {
+			if payload[pos] > 9 || pos > maxLengthDigits {
+				return nil, ErrorWrongPayload
+			}
+			length = length*10 + int(payload[pos])
+		}
+		pos++
+		if pos+length > len(payload) || length == 0 {
+			return nil, ErrorWrongPayload
+		}
+		data := payload[pos : pos+length]
+		payload = payload[pos+length:]
+
+		if isString {
+			packets = append(packets, string(data))
+			continue
+		}
+		packets = append(packets, binaryPrefix+strconv.Itoa(int(data[0]))+
+			base64.StdEncoding.EncodeToString(data[1:]))
+	}
+
+	return packets, nil
+}
+
+/**
+Length of string as javascript counts it, in UTF-16 code units
+*/
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+/**
+Encode packets to EIO=3 text payload, "<length>:<packet>" each,
+length is counted in UTF-16 code units
+*/
+func encodePayloadV3(packets []string) string {
+	var result strings.Builder
+	for _, packet := range packets {
+		result.WriteString(strconv.Itoa(utf16Len(packet)))
+		result.WriteByte(':')
+		result.WriteString(packet)
+	}
+	return result.String()
+}
+
+/**
+Split EIO=3 text payload to packets, no more than max unless it is 0
+*/
+func decodePayloadV3(payload string, max int) ([]string, error) {
+	var packets []string
+
+	for len(payload) > 0 {
+		if max > 0 && len(packets) == max {
+			return nil, ErrorTooManyPackets
+		}
+		pos := strings.IndexByte(payload, ':')
+		if pos <= 0 {
+			return nil, ErrorWrongPayload
+		}
+
+		length, err := strconv.Atoi(payload[:pos])
+		if err != nil || length < 0 {
+			return nil, ErrorWrongPayload
+		}
+		payload = payload[pos+1:]
+
+		//walk length UTF-16 units to find packet end in bytes
+		end := 0
+		for units := 0; units < length; {
+			if end >= len(payload) {
+				return nil, ErrorWrongPayload
+			}
+			r, size := utf8.DecodeRuneInString(payload[end:])
+			if r >= 0x10000 {
+				units += 2
+			} else {
+				units++
+			}
+			end += size
+		}
+
+		packets = append(packets, payload[:end])
+		payload = payload[end:]
+	}
+
+	return packets, nil
+}
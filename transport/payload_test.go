@@ -0,0 +1,33 @@
+package transport
+
+import (
+	"testing"
+)
+
+func TestDecodePayloadMaxPackets(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(max int) ([]string, error)
+	}{
+		{"EIO=4", func(max int) ([]string, error) {
+			return decodePayload("4a\x1e4b\x1e4c", true, max)
+		}},
+		{"EIO=3", func(max int) ([]string, error) {
+			return decodePayload("2:4a2:4b2:4c", false, max)
+		}},
+		{"EIO=3 binary", func(max int) ([]string, error) {
+			return decodeBinaryPayloadV3([]byte{0, 2, 255, '4', 'a', 0, 2, 255, '4', 'b', 1, 2, 255, 4, 7}, max)
+		}},
+	}
+	for _, test := range tests {
+		for _, max := range []int{0, 3} {
+			packets, err := test.decode(max)
+			if err != nil || len(packets) != 3 {
+				t.Errorf("%s, max %d: got %q, %v", test.name, max, packets, err)
+			}
+		}
+		if packets, err := test.decode(2); err != ErrorTooManyPackets {
+			t.Errorf("%s, max 2: got %q, %v, want ErrorTooManyPackets", test.name, packets, err)
+		}
+	}
+}
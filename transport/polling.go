@@ -0,0 +1,1031 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PollingDefaultPollTimeout    = 25 * time.Second
+	PollingDefaultUpgradeTimeout = 10 * time.Second
+	PollingDefaultMaxPayload     = 1000000
+	PollingDefaultQueueSize      = 500
+
+	//packets of one post, engine.io itself has no limit
+	PollingDefaultMaxPacketsPerPayload = 1000
+
+	//engine.io packets handled by transport itself
+	packetOpen      = "0"
+	packetClose     = "1"
+	packetUpgrade   = "5"
+	packetNoop      = "6"
+	packetPingProbe = "2probe"
+	packetPongProbe = "3probe"
+
+	transportPolling   = "polling"
+	transportWebsocket = "websocket"
+
+	eio4 = "4"
+
+	//how often pending poll is flushed with noop while upgrading
+	upgradeNoopInterval = 100 * time.Millisecond
+
+	sessionIdBytes = 15
+
+	binaryContentType = "application/octet-stream"
+)
+
+var (
+	ErrorReceiveTimeout   = errors.New("Receive timeout")
+	ErrorSendTimeout      = errors.New("Send timeout")
+	ErrorSessionClosed    = errors.New("Session closed")
+	ErrorUnknownSession   = errors.New("Session ID unknown")
+	ErrorUnknownTransport = errors.New("Transport unknown")
+	ErrorWrongOpenPacket  = errors.New("Wrong open packet")
+	ErrorUpgradeFailed    = errors.New("Upgrade failed")
+)
+
+/**
+engine.io error codes, sent in json body of 400 responses
+*/
+const (
+	engineErrorUnknownTransport = 0
+	engineErrorUnknownSid       = 1
+	engineErrorBadMethod        = 2
+	engineErrorBadRequest       = 3
+)
+
+func writeEngineError(w http.ResponseWriter, code int, message string) {
+	body, _ := json.Marshal(&struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{code, message})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(body)
+}
+
+func newSessionId() string {
+	buf := make([]byte, sessionIdBytes)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.URLEncoding.EncodeToString(buf)
+}
+
+/**
+Close channel to wake all waiters and replace it with a new one.
+Must be called under lock of the owner
+*/
+func notify(changed *chan struct{}) {
+	close(*changed)
+	*changed = make(chan struct{})
+}
+
+/**
+Server side long-polling session. Lives across http requests,
+GET requests take outgoing packets, POST requests bring incoming ones.
+After websocket upgrade all traffic goes through the websocket
+*/
+type PollingConnection struct {
+	transport *PollingTransport
+	sid       string
+	eio4      bool //payload format of EIO=4
+
+	lock       sync.Mutex
+	changed    chan struct{}
+	incoming   []string
+	outgoing   []string
+	polling    bool
+	ws         Connection
+	closed     bool
+	peerClosed bool  //client sent close packet
+	readLimit  int64 //set by server, transport MaxPayload if 0
+	readErr    error //client sent too big payload or too many packets
+}
+
+func (pc *PollingConnection) Sid() string {
+	return pc.sid
+}
+
+func (pc *PollingConnection) Upgrades() []string {
+	if pc.transport.Upgrade == nil {
+		return []string{}
+	}
+	return []string{transportWebsocket}
+}
+
+func (pc *PollingConnection) GetMessage() (message string, err error) {
+	deadline := time.After(pc.transport.ReceiveTimeout)
+	for {
+		pc.lock.Lock()
+		if len(pc.incoming) > 0 {
+			message = pc.incoming[0]
+			pc.incoming = pc.incoming[1:]
+			pc.lock.Unlock()
+			return message, nil
+		}
+		if pc.readErr != nil {
+			pc.lock.Unlock()
+			return "", pc.readErr
+		}
+		if pc.closed || pc.peerClosed {
+			pc.lock.Unlock()
+			return "", ErrorSessionClosed
+		}
+		if pc.ws != nil {
+			ws := pc.ws
+			pc.lock.Unlock()
+			return ws.GetMessage()
+		}
+		changed := pc.changed
+		pc.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return "", ErrorReceiveTimeout
+		}
+	}
+}
+
+func (pc *PollingConnection) WriteMessage(message string) error {
+	return pc.write(message, true)
+}
+
+/**
+Polling requests are not compressed, after upgrade to websocket
+message is written without compression if compress is false
+*/
+func (pc *PollingConnection) WriteMessageUncompressed(message string) error {
+	return pc.write(message, false)
+}
+
+/**
+Polling requests are not compressed, after upgrade it is
+negotiation of websocket connection
+*/
+func (pc *PollingConnection) CompressionEnabled() bool {
+	pc.lock.Lock()
+	ws := pc.ws
+	pc.lock.Unlock()
+
+	cc, ok := ws.(CompressionStateConnection)
+	return ok && cc.CompressionEnabled()
+}
+
+/**
+Queue messages for the next poll, which takes them in one payload.
+After upgrade they are written as websocket batch
+*/
+func (pc *PollingConnection) WriteMessages(messages []string) error {
+	pc.lock.Lock()
+	ws := pc.ws
+	pc.lock.Unlock()
+
+	if bc, ok := ws.(BatchConnection); ok {
+		return bc.WriteMessages(messages)
+	}
+	for _, message := range messages {
+		if err := pc.WriteMessage(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pc *PollingConnection) write(message string, compress bool) error {
+	deadline := time.After(pc.transport.SendTimeout)
+	for {
+		pc.lock.Lock()
+		if pc.closed || pc.peerClosed {
+			pc.lock.Unlock()
+			return ErrorSessionClosed
+		}
+		if pc.ws != nil {
+			ws := pc.ws
+			pc.lock.Unlock()
+			if cc, ok := ws.(CompressionConnection); ok && !compress {
+				return cc.WriteMessageUncompressed(message)
+			}
+			return ws.WriteMessage(message)
+		}
+		if len(pc.outgoing) < pc.transport.QueueSize {
+			pc.outgoing = append(pc.outgoing, message)
+			notify(&pc.changed)
+			pc.lock.Unlock()
+			return nil
+		}
+		changed := pc.changed
+		pc.lock.Unlock()
+
+		//queue is full, wait for the next poll to take it
+		select {
+		case <-changed:
+		case <-deadline:
+			return ErrorSendTimeout
+		}
+	}
+}
+
+/**
+Close session. Packets already queued are still handed to the
+next poll together with close packet, then session is forgotten
+*/
+func (pc *PollingConnection) Close() {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.closed {
+		return
+	}
+	pc.closed = true
+	notify(&pc.changed)
+
+	if pc.ws != nil {
+		pc.ws.Close()
+		pc.transport.removeSession(pc.sid)
+		return
+	}
+
+	time.AfterFunc(pc.transport.PollTimeout, func() {
+		pc.transport.removeSession(pc.sid)
+	})
+}
+
+func (pc *PollingConnection) PingParams() (interval, timeout time.Duration) {
+	return pc.transport.PingInterval, pc.transport.PingTimeout
+}
+
+/**
+Limit of POST payload, websocket this session is upgraded to gets it too
+*/
+func (pc *PollingConnection) SetReadLimit(limit int64) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	pc.readLimit = limit
+	if lc, ok := pc.ws.(LimitConnection); ok {
+		lc.SetReadLimit(limit)
+	}
+}
+
+func (pc *PollingConnection) maxPayload() int64 {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.readLimit > 0 {
+		return pc.readLimit
+	}
+	return pc.transport.MaxPayload
+}
+
+/**
+Serve GET request, hold it until there is something to send
+*/
+func (pc *PollingConnection) poll(w http.ResponseWriter, r *http.Request) {
+	pc.lock.Lock()
+	if pc.polling || pc.ws != nil {
+		pc.lock.Unlock()
+		writeEngineError(w, engineErrorBadRequest, "Overlapping poll")
+		return
+	}
+	pc.polling = true
+
+	timeout := time.After(pc.transport.PollTimeout)
+	for len(pc.outgoing) == 0 && !pc.closed {
+		changed := pc.changed
+		pc.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			pc.lock.Lock()
+			pc.outgoing = append(pc.outgoing, packetNoop)
+			continue
+		case <-r.Context().Done():
+			pc.lock.Lock()
+			pc.polling = false
+			pc.lock.Unlock()
+			return
+		}
+		pc.lock.Lock()
+	}
+
+	packets := pc.outgoing
+	pc.outgoing = nil
+	pc.polling = false
+	closed := pc.closed
+	notify(&pc.changed)
+	pc.lock.Unlock()
+
+	if closed {
+		packets = append(packets, packetClose)
+		pc.transport.removeSession(pc.sid)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	io.WriteString(w, encodePayload(packets, pc.eio4))
+}
+
+/**
+Serve POST request with incoming packets
+*/
+func (pc *PollingConnection) post(w http.ResponseWriter, r *http.Request) {
+	limit := pc.maxPayload()
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		writeEngineError(w, engineErrorBadRequest, "Bad request")
+		return
+	}
+	//session fails, like websocket closed with CloseMessageTooBig
+	if int64(len(body)) > limit {
+		pc.lock.Lock()
+		pc.readErr = ErrorMessageTooBig
+		notify(&pc.changed)
+		pc.lock.Unlock()
+		http.Error(w, ErrorMessageTooBig.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var packets []string
+	max := pc.transport.MaxPacketsPerPayload
+	if strings.HasPrefix(r.Header.Get("Content-Type"), binaryContentType) && !pc.eio4 {
+		packets, err = decodeBinaryPayloadV3(body, max)
+	} else {
+		packets, err = decodePayload(string(body), pc.eio4, max)
+	}
+	//session fails too, server counts it
+	if err == ErrorTooManyPackets {
+		pc.lock.Lock()
+		pc.readErr = err
+		notify(&pc.changed)
+		pc.lock.Unlock()
+	}
+	if err != nil {
+		writeEngineError(w, engineErrorBadRequest, err.Error())
+		return
+	}
+
+	pc.lock.Lock()
+	for _, packet := range packets {
+		if packet == packetClose {
+			pc.peerClosed = true
+			break
+		}
+		pc.incoming = append(pc.incoming, packet)
+	}
+	notify(&pc.changed)
+	pc.lock.Unlock()
+
+	w.Header().Set("Content-Type", "text/html")
+	io.WriteString(w, "ok")
+}
+
+/**
+Serve websocket upgrade of this session: answer the probe,
+flush pending poll with noops until client sends upgrade packet,
+then move the rest of outgoing queue to the websocket
+*/
+func (pc *PollingConnection) upgrade(w http.ResponseWriter, r *http.Request) {
+	ws, err := pc.transport.Upgrade.upgrade(w, r)
+	if err != nil {
+		return
+	}
+	pc.lock.Lock()
+	if pc.readLimit > 0 {
+		ws.SetReadLimit(pc.readLimit)
+	}
+	pc.lock.Unlock()
+
+	probe, err := ws.GetMessage()
+	if err != nil || probe != packetPingProbe {
+		ws.Close()
+		return
+	}
+	if err := ws.WriteMessage(packetPongProbe); err != nil {
+		ws.Close()
+		return
+	}
+
+	upgraded := make(chan error, 1)
+	go func() {
+		packet, err := ws.GetMessage()
+		if err == nil && packet != packetUpgrade {
+			err = ErrorUpgradeFailed
+		}
+		upgraded <- err
+	}()
+
+	ticker := time.NewTicker(upgradeNoopInterval)
+	defer ticker.Stop()
+	timeout := time.After(pc.transport.UpgradeTimeout)
+
+	for waiting := true; waiting; {
+		select {
+		case <-ticker.C:
+			pc.lock.Lock()
+			if pc.polling && len(pc.outgoing) == 0 {
+				pc.outgoing = append(pc.outgoing, packetNoop)
+				notify(&pc.changed)
+			}
+			pc.lock.Unlock()
+		case <-timeout:
+			ws.Close()
+			return
+		case err := <-upgraded:
+			if err != nil {
+				ws.Close()
+				return
+			}
+			waiting = false
+		}
+	}
+
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.closed {
+		ws.Close()
+		return
+	}
+	for _, packet := range pc.outgoing {
+		if packet == packetNoop {
+			continue
+		}
+		if err := ws.WriteMessage(packet); err != nil {
+			ws.Close()
+			pc.closed = true
+			notify(&pc.changed)
+			return
+		}
+	}
+	pc.outgoing = nil
+	pc.ws = ws
+	notify(&pc.changed)
+}
+
+/**
+Client side long-polling connection, upgrades itself to websocket
+when server offers it and transport has Upgrade set
+*/
+type PollingClientConnection struct {
+	transport *PollingTransport
+	client    *http.Client
+	url       string
+	eio4      bool //payload format of EIO=4
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock      sync.Mutex
+	changed   chan struct{}
+	incoming  []string
+	err       error
+	ws        Connection
+	upgrading bool
+	closed    bool
+	pollDone  chan struct{}
+
+	writeLock sync.Mutex
+}
+
+func (pcc *PollingClientConnection) GetMessage() (message string, err error) {
+	deadline := time.After(pcc.transport.ReceiveTimeout)
+	for {
+		pcc.lock.Lock()
+		if len(pcc.incoming) > 0 {
+			message = pcc.incoming[0]
+			pcc.incoming = pcc.incoming[1:]
+			pcc.lock.Unlock()
+			return message, nil
+		}
+		if pcc.err != nil {
+			err = pcc.err
+			pcc.lock.Unlock()
+			return "", err
+		}
+		if pcc.ws != nil {
+			ws := pcc.ws
+			pcc.lock.Unlock()
+
+			message, err = ws.GetMessage()
+			if err == nil && message == packetNoop {
+				continue
+			}
+			return message, err
+		}
+		changed := pcc.changed
+		pcc.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return "", ErrorReceiveTimeout
+		}
+	}
+}
+
+func (pcc *PollingClientConnection) WriteMessage(message string) error {
+	pcc.writeLock.Lock()
+	defer pcc.writeLock.Unlock()
+
+	pcc.lock.Lock()
+	ws, err := pcc.ws, pcc.err
+	pcc.lock.Unlock()
+
+	if ws != nil {
+		return ws.WriteMessage(message)
+	}
+	if err != nil {
+		return err
+	}
+	return pcc.post(pcc.ctx, []string{message})
+}
+
+/**
+Send messages with one post request, or as websocket batch after upgrade
+*/
+func (pcc *PollingClientConnection) WriteMessages(messages []string) error {
+	pcc.writeLock.Lock()
+	defer pcc.writeLock.Unlock()
+
+	pcc.lock.Lock()
+	ws, err := pcc.ws, pcc.err
+	pcc.lock.Unlock()
+
+	if bc, ok := ws.(BatchConnection); ok {
+		return bc.WriteMessages(messages)
+	}
+	if ws != nil {
+		for _, message := range messages {
+			if err := ws.WriteMessage(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return pcc.post(pcc.ctx, messages)
+}
+
+func (pcc *PollingClientConnection) Close() {
+	pcc.lock.Lock()
+	if pcc.closed {
+		pcc.lock.Unlock()
+		return
+	}
+	pcc.closed = true
+	ws, err := pcc.ws, pcc.err
+	if pcc.err == nil {
+		pcc.err = ErrorSessionClosed
+	}
+	notify(&pcc.changed)
+	pcc.lock.Unlock()
+
+	if ws != nil {
+		ws.Close()
+	} else if err == nil {
+		//let server know, so it does not wait for session timeout
+		ctx, cancel := context.WithTimeout(context.Background(), pcc.transport.SendTimeout)
+		pcc.post(ctx, []string{packetClose})
+		cancel()
+	}
+	pcc.cancel()
+	pcc.client.CloseIdleConnections()
+}
+
+func (pcc *PollingClientConnection) PingParams() (interval, timeout time.Duration) {
+	return pcc.transport.PingInterval, pcc.transport.PingTimeout
+}
+
+func (pcc *PollingClientConnection) get() ([]string, error) {
+	req, err := http.NewRequest("GET", pcc.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pcc.do(req.WithContext(pcc.ctx))
+}
+
+func (pcc *PollingClientConnection) post(ctx context.Context, packets []string) error {
+	body := bytes.NewBufferString(encodePayload(packets, pcc.eio4))
+	req, err := http.NewRequest("POST", pcc.url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+	_, err = pcc.do(req.WithContext(ctx))
+	return err
+}
+
+/**
+Make request and decode payload of the response
+*/
+func (pcc *PollingClientConnection) do(req *http.Request) ([]string, error) {
+	for name, values := range pcc.transport.RequestHeader {
+		req.Header[name] = values
+	}
+
+	resp, err := pcc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, handshakeBodyLimit))
+		return nil, &HandshakeError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if req.Method != "GET" {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, pcc.transport.MaxPayload+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > pcc.transport.MaxPayload {
+		return nil, ErrorWrongPayload
+	}
+	return decodePayload(string(body), pcc.eio4, 0)
+}
+
+/**
+Take packets from polls until closed, failed or upgraded
+*/
+func (pcc *PollingClientConnection) pollLoop() {
+	defer close(pcc.pollDone)
+
+	for {
+		pcc.lock.Lock()
+		stop := pcc.closed || pcc.upgrading || pcc.err != nil
+		pcc.lock.Unlock()
+		if stop {
+			return
+		}
+
+		packets, err := pcc.get()
+
+		pcc.lock.Lock()
+		if err != nil && pcc.err == nil {
+			pcc.err = err
+		}
+		for _, packet := range packets {
+			if packet == packetNoop {
+				continue
+			}
+			if packet == packetClose {
+				if pcc.err == nil {
+					pcc.err = ErrorSessionClosed
+				}
+				break
+			}
+			pcc.incoming = append(pcc.incoming, packet)
+		}
+		notify(&pcc.changed)
+		pcc.lock.Unlock()
+	}
+}
+
+/**
+Probe websocket with the same session and switch to it on success,
+stay on polling otherwise
+*/
+func (pcc *PollingClientConnection) upgrade(wsUrl string) {
+	//websocket is dialed the same way as polling requests
+	upgrade := *pcc.transport.Upgrade
+	upgrade.ClientOptions = pcc.transport.ClientOptions
+	ws, err := upgrade.ConnectContext(pcc.ctx, wsUrl)
+	if err != nil {
+		return
+	}
+
+	if err := ws.WriteMessage(packetPingProbe); err != nil {
+		ws.Close()
+		return
+	}
+	probe, err := ws.GetMessage()
+	if err != nil || probe != packetPongProbe {
+		ws.Close()
+		return
+	}
+
+	//stop polling, server flushes pending poll with noop
+	pcc.lock.Lock()
+	pcc.upgrading = true
+	pollDone := pcc.pollDone
+	pcc.lock.Unlock()
+	<-pollDone
+
+	pcc.writeLock.Lock()
+	defer pcc.writeLock.Unlock()
+
+	pcc.lock.Lock()
+	defer pcc.lock.Unlock()
+
+	if pcc.closed || pcc.err != nil {
+		ws.Close()
+		return
+	}
+	if err := ws.WriteMessage(packetUpgrade); err != nil {
+		ws.Close()
+		pcc.upgrading = false
+		pcc.pollDone = make(chan struct{})
+		go pcc.pollLoop()
+		return
+	}
+	pcc.ws = ws
+	notify(&pcc.changed)
+}
+
+type PollingTransport struct {
+	PingInterval   time.Duration
+	PingTimeout    time.Duration
+	ReceiveTimeout time.Duration
+	SendTimeout    time.Duration
+
+	PollTimeout    time.Duration //how long GET request is held with nothing to send
+	UpgradeTimeout time.Duration //how long to wait for upgrade packet after probe
+	MaxPayload     int64         //max size of payload in bytes
+	QueueSize      int           //max packets waiting for the next poll
+
+	//max packets in one post, payload with more is refused with 400 and
+	//session fails with ErrorTooManyPackets; no limit if 0
+	MaxPacketsPerPayload int
+
+	//tls, proxy and dialer of client requests, used by upgrade too
+	ClientOptions
+
+	//websocket transport to upgrade to, nil keeps the session on polling
+	Upgrade *WebsocketTransport
+
+	sessions     map[string]*PollingConnection
+	handshakes   map[*http.Request]*PollingConnection
+	sessionsLock sync.Mutex
+}
+
+func (pt *PollingTransport) session(sid string) *PollingConnection {
+	pt.sessionsLock.Lock()
+	defer pt.sessionsLock.Unlock()
+
+	return pt.sessions[sid]
+}
+
+func (pt *PollingTransport) HasSession(sid string) bool {
+	return pt.session(sid) != nil
+}
+
+func (pt *PollingTransport) removeSession(sid string) {
+	pt.sessionsLock.Lock()
+	defer pt.sessionsLock.Unlock()
+
+	delete(pt.sessions, sid)
+}
+
+/**
+Connect with polling handshake, url may be ws:// or http:// one,
+transport query parameter is replaced
+*/
+func (pt *PollingTransport) Connect(rawUrl string) (conn Connection, err error) {
+	return pt.ConnectContext(context.Background(), rawUrl)
+}
+
+func (pt *PollingTransport) ConnectContext(dialCtx context.Context, rawUrl string) (conn Connection, err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	query := u.Query()
+	query.Set("transport", transportPolling)
+	query.Del("sid")
+	//binary packets as base64 text, EIO=4 payloads are always text
+	if query.Get("EIO") != eio4 {
+		query.Set("b64", "1")
+	}
+	u.RawQuery = query.Encode()
+
+	if pt.HandshakeTimeout > 0 {
+		var cancelDial context.CancelFunc
+		dialCtx, cancelDial = context.WithTimeout(dialCtx, pt.HandshakeTimeout)
+		defer cancelDial()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pcc := &PollingClientConnection{
+		transport: pt,
+		url:       u.String(),
+		eio4:      query.Get("EIO") == eio4,
+		ctx:       ctx,
+		cancel:    cancel,
+		changed:   make(chan struct{}),
+		pollDone:  make(chan struct{}),
+
+		client: &http.Client{
+			Transport: pt.httpTransport(),
+			Timeout:   pt.PollTimeout + pt.ReceiveTimeout,
+		},
+	}
+
+	//dial context stops only the open request
+	opened := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-dialCtx.Done():
+			cancel()
+		case <-opened:
+		}
+	}()
+	packets, err := pcc.get()
+	close(opened)
+	<-watched
+	if dialCtx.Err() != nil {
+		cancel()
+		return nil, dialCtx.Err()
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if len(packets) == 0 || len(packets[0]) == 0 || packets[0][:1] != packetOpen {
+		cancel()
+		return nil, ErrorWrongOpenPacket
+	}
+
+	var open struct {
+		Sid      string   `json:"sid"`
+		Upgrades []string `json:"upgrades"`
+	}
+	if err := json.Unmarshal([]byte(packets[0][1:]), &open); err != nil || open.Sid == "" {
+		cancel()
+		return nil, ErrorWrongOpenPacket
+	}
+
+	query.Set("sid", open.Sid)
+	u.RawQuery = query.Encode()
+	pcc.url = u.String()
+	pcc.incoming = packets
+
+	go pcc.pollLoop()
+
+	if pt.Upgrade != nil {
+		for _, upgrade := range open.Upgrades {
+			if upgrade != transportWebsocket {
+				continue
+			}
+			if u.Scheme == "https" {
+				u.Scheme = "wss"
+			} else {
+				u.Scheme = "ws"
+			}
+			query.Set("transport", transportWebsocket)
+			u.RawQuery = query.Encode()
+			go pcc.upgrade(u.String())
+			break
+		}
+	}
+
+	return pcc, nil
+}
+
+/**
+Handle polling requests. New session is returned as connection,
+requests of existing sessions (polls, posts and websocket upgrade)
+are served here and nil connection is returned
+*/
+func (pt *PollingTransport) HandleConnection(
+	w http.ResponseWriter, r *http.Request) (conn Connection, err error) {
+
+	query := r.URL.Query()
+	if query.Get("j") != "" {
+		writeEngineError(w, engineErrorBadRequest, "JSONP is not supported")
+		return nil, ErrorMethodNotAllowed
+	}
+
+	sid := query.Get("sid")
+	switch query.Get("transport") {
+	case transportWebsocket:
+		if pt.Upgrade == nil {
+			writeEngineError(w, engineErrorUnknownTransport, ErrorUnknownTransport.Error())
+			return nil, ErrorUnknownTransport
+		}
+		if sid == "" {
+			return pt.Upgrade.HandleConnection(w, r)
+		}
+
+		pc := pt.session(sid)
+		if pc == nil {
+			writeEngineError(w, engineErrorUnknownSid, ErrorUnknownSession.Error())
+			return nil, ErrorUnknownSession
+		}
+		pc.upgrade(w, r)
+		return nil, nil
+
+	case transportPolling:
+		if sid == "" {
+			if r.Method != "GET" {
+				writeEngineError(w, engineErrorBadMethod, ErrorMethodNotAllowed.Error())
+				return nil, ErrorMethodNotAllowed
+			}
+			return pt.newSession(r), nil
+		}
+
+		pc := pt.session(sid)
+		if pc == nil {
+			writeEngineError(w, engineErrorUnknownSid, ErrorUnknownSession.Error())
+			return nil, ErrorUnknownSession
+		}
+		switch r.Method {
+		case "GET":
+			pc.poll(w, r)
+		case "POST":
+			pc.post(w, r)
+		default:
+			writeEngineError(w, engineErrorBadMethod, ErrorMethodNotAllowed.Error())
+			return nil, ErrorMethodNotAllowed
+		}
+		return nil, nil
+	}
+
+	writeEngineError(w, engineErrorUnknownTransport, ErrorUnknownTransport.Error())
+	return nil, ErrorUnknownTransport
+}
+
+func (pt *PollingTransport) newSession(r *http.Request) *PollingConnection {
+	pc := &PollingConnection{
+		transport: pt,
+		sid:       newSessionId(),
+		eio4:      r.URL.Query().Get("EIO") == eio4,
+		changed:   make(chan struct{}),
+	}
+
+	pt.sessionsLock.Lock()
+	defer pt.sessionsLock.Unlock()
+
+	if pt.sessions == nil {
+		pt.sessions = make(map[string]*PollingConnection)
+		pt.handshakes = make(map[*http.Request]*PollingConnection)
+	}
+	pt.sessions[pc.sid] = pc
+	pt.handshakes[r] = pc
+
+	return pc
+}
+
+/**
+Answer handshake request with the open sequence as the first poll
+*/
+func (pt *PollingTransport) Serve(w http.ResponseWriter, r *http.Request) {
+	pt.sessionsLock.Lock()
+	pc, ok := pt.handshakes[r]
+	delete(pt.handshakes, r)
+	pt.sessionsLock.Unlock()
+
+	if ok {
+		pc.poll(w, r)
+	}
+}
+
+/**
+Returns long-polling transport with default params,
+upgrading to websocket with default params
+*/
+func GetDefaultPollingTransport() *PollingTransport {
+	return &PollingTransport{
+		PingInterval:   WsDefaultPingInterval,
+		PingTimeout:    WsDefaultPingTimeout,
+		ReceiveTimeout: WsDefaultReceiveTimeout,
+		SendTimeout:    WsDefaultSendTimeout,
+		PollTimeout:    PollingDefaultPollTimeout,
+		UpgradeTimeout: PollingDefaultUpgradeTimeout,
+		MaxPayload:     PollingDefaultMaxPayload,
+		QueueSize:      PollingDefaultQueueSize,
+		Upgrade:        GetDefaultWebsocketTransport(),
+
+		MaxPacketsPerPayload: PollingDefaultMaxPacketsPerPayload,
+
+		ClientOptions: ClientOptions{Proxy: http.ProxyFromEnvironment},
+	}
+}
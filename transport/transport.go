@@ -1,16 +1,78 @@
 package transport
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+const (
+	//websocket close code of too big message
+	CloseMessageTooBig = 1009
+)
+
+var (
+	ErrorMessageTooBig = errors.New("Message too big")
+)
+
+var closeCodeNames = map[int]string{
+	1000: "normal closure",
+	1001: "going away",
+	1002: "protocol error",
+	1003: "unsupported data",
+	1005: "no status",
+	1006: "abnormal closure",
+	1007: "invalid payload",
+	1008: "policy violation",
+	1009: "message too big",
+	1010: "mandatory extension",
+	1011: "internal server error",
+	1015: "tls handshake",
+}
+
+/**
+Connection was closed by peer with close frame, carrying its code and reason
+*/
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	result := "peer closed with code " + strconv.Itoa(e.Code)
+	if name, ok := closeCodeNames[e.Code]; ok {
+		result += " (" + name + ")"
+	}
+	if e.Text != "" {
+		result += ": " + e.Text
+	}
+	return result
+}
+
+/**
+Server refused connection upgrade, with http status and
+the beginning of the response body
+*/
+type HandshakeError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HandshakeError) Error() string {
+	return "handshake failed with status " + strconv.Itoa(e.StatusCode) + ": " + e.Body
+}
+
 /**
 End-point connection for given transport
 */
 type Connection interface {
 	/**
 	Receive one more message, block until received
+	returns *CloseError if peer closed the connection with close frame.
+	Binary messages are returned in engine.io text form, "b4" followed
+	by base64 data, WriteMessage sends them back as binary
 	*/
 	GetMessage() (message string, err error)
 
@@ -30,6 +92,88 @@ type Connection interface {
 	PingParams() (interval, timeout time.Duration)
 }
 
+/**
+Connection with compressed messages, like websocket with
+permessage-deflate. Some messages can be sent as they are
+*/
+type CompressionConnection interface {
+	Connection
+
+	/**
+	Send given message without compression, block until sent
+	*/
+	WriteMessageUncompressed(message string) error
+}
+
+/**
+Connection which knows if compression was agreed on with peer
+*/
+type CompressionStateConnection interface {
+	Connection
+
+	/**
+	Check if permessage-deflate was negotiated in handshake
+	*/
+	CompressionEnabled() bool
+}
+
+/**
+Connection with limit of incoming message size, set by server
+*/
+type LimitConnection interface {
+	Connection
+
+	/**
+	Set max size of incoming message or payload in bytes,
+	connection fails on bigger ones
+	*/
+	SetReadLimit(limit int64)
+}
+
+/**
+Connection which can tell peer why it is closed, like websocket close frame
+*/
+type CodeCloseConnection interface {
+	Connection
+
+	/**
+	Close connection with given close code and reason
+	*/
+	CloseWithCode(code int, text string)
+}
+
+/**
+Connection which can send several messages at once, with fewer
+writes than sending them one by one
+*/
+type BatchConnection interface {
+	Connection
+
+	/**
+	Send given messages in order, block until all are sent
+	*/
+	WriteMessages(messages []string) error
+}
+
+/**
+Connection that spans several http requests, like long-polling.
+Transport routes requests to it by session id, so the session id
+is chosen by connection and used as engine.io sid
+*/
+type SessionConnection interface {
+	Connection
+
+	/**
+	Get session id
+	*/
+	Sid() string
+
+	/**
+	Get transports this connection can be upgraded to
+	*/
+	Upgrades() []string
+}
+
 /**
 Connection factory for given transport
 */
@@ -41,6 +185,8 @@ type Transport interface {
 
 	/**
 	Handle one server connection
+	returns nil connection with nil error if request belongs
+	to already established connection and was served by transport
 	*/
 	HandleConnection(w http.ResponseWriter, r *http.Request) (conn Connection, err error)
 
@@ -49,3 +195,27 @@ type Transport interface {
 	*/
 	Serve(w http.ResponseWriter, r *http.Request)
 }
+
+/**
+Transport serving session connections, it knows their ids
+*/
+type SessionTransport interface {
+	Transport
+
+	/**
+	Check if session with given id is served by this transport
+	*/
+	HasSession(sid string) bool
+}
+
+/**
+Transport which can stop connecting when context is done
+*/
+type ContextTransport interface {
+	Transport
+
+	/**
+	Get client connection, ctx limits only connecting
+	*/
+	ConnectContext(ctx context.Context, url string) (conn Connection, err error)
+}
@@ -1,10 +1,16 @@
 package transport
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
 	"github.com/gorilla/websocket"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,6 +22,13 @@ const (
 	WsDefaultReceiveTimeout = 60 * time.Second
 	WsDefaultSendTimeout    = 60 * time.Second
 	WsDefaultBufferSize     = 1024 * 32
+
+	//smaller messages are not worth compressing
+	WsDefaultCompressionThreshold = 1024
+	//same as maxHttpBufferSize of socket.io
+	WsDefaultMaxMessageSize = 1000000
+
+	handshakeBodyLimit = 512
 )
 
 var (
@@ -29,42 +42,125 @@ var (
 type WebsocketConnection struct {
 	socket    *websocket.Conn
 	transport *WebsocketTransport
+	eio4      bool       //binary frames of EIO=4 carry no packet type
+	batch     *batchConn //network connection, nil if it is not wrapped
+	deflate   bool       //permessage-deflate was negotiated
 }
 
 func (wsc *WebsocketConnection) GetMessage() (message string, err error) {
 	wsc.socket.SetReadDeadline(time.Now().Add(wsc.transport.ReceiveTimeout))
 	msgType, reader, err := wsc.socket.NextReader()
 	if err != nil {
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			return "", &CloseError{Code: closeErr.Code, Text: closeErr.Text}
+		}
+		if err == websocket.ErrReadLimit {
+			return "", ErrorMessageTooBig
+		}
 		return "", err
 	}
 
-	//support only text messages exchange
-	if msgType != websocket.TextMessage {
-		return "", ErrorBinaryMessage
+	//frame goes through copy buffer into the builder, String of
+	//builder does not copy it once more
+	var text strings.Builder
+	if msgType == websocket.BinaryMessage {
+		err = readBinary(&text, reader, wsc.eio4)
+	} else {
+		_, err = io.Copy(&text, reader)
+	}
+	if err == websocket.ErrReadLimit {
+		return "", ErrorMessageTooBig
 	}
-
-	data, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return "", ErrorBadBuffer
 	}
-	text := string(data)
 
 	//empty messages are not allowed
-	if len(text) == 0 {
+	if text.Len() == 0 {
 		return "", ErrorPacketWrong
 	}
 
-	return text, nil
+	return text.String(), nil
+}
+
+/**
+Read binary message in its text form, base64 is encoded
+while the message is read
+*/
+func readBinary(text *strings.Builder, reader io.Reader, eio4 bool) error {
+	text.WriteString(binaryPrefix)
+	if eio4 {
+		text.WriteString(packetMessage)
+	} else {
+		var packetType [1]byte
+		if _, err := io.ReadFull(reader, packetType[:]); err == io.EOF {
+			return ErrorPacketWrong
+		} else if err != nil {
+			return err
+		}
+		text.WriteString(strconv.Itoa(int(packetType[0])))
+	}
+
+	encoder := base64.NewEncoder(base64.StdEncoding, text)
+	if _, err := io.Copy(encoder, reader); err != nil {
+		return err
+	}
+	return encoder.Close()
 }
 
 func (wsc *WebsocketConnection) WriteMessage(message string) error {
+	return wsc.write(message, len(message) >= wsc.transport.CompressionThreshold)
+}
+
+func (wsc *WebsocketConnection) CompressionEnabled() bool {
+	return wsc.deflate
+}
+
+func (wsc *WebsocketConnection) WriteMessageUncompressed(message string) error {
+	return wsc.write(message, false)
+}
+
+/**
+Send messages as separate frames, written to the socket at once
+*/
+func (wsc *WebsocketConnection) WriteMessages(messages []string) error {
+	if wsc.batch == nil {
+		for _, message := range messages {
+			if err := wsc.WriteMessage(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	wsc.batch.cork()
+	for _, message := range messages {
+		if err := wsc.WriteMessage(message); err != nil {
+			wsc.batch.flush()
+			return err
+		}
+	}
+	return wsc.batch.flush()
+}
+
+/**
+Write message, compressed if compress is set and compression
+was negotiated with peer
+*/
+func (wsc *WebsocketConnection) write(message string, compress bool) error {
+	msgType, data, err := wsc.frame(message)
+	if err != nil {
+		return err
+	}
+
 	wsc.socket.SetWriteDeadline(time.Now().Add(wsc.transport.SendTimeout))
-	writer, err := wsc.socket.NextWriter(websocket.TextMessage)
+	wsc.socket.EnableWriteCompression(compress)
+	writer, err := wsc.socket.NextWriter(msgType)
 	if err != nil {
 		return err
 	}
 
-	if _, err := writer.Write([]byte(message)); err != nil {
+	if _, err := writer.Write(data); err != nil {
 		return err
 	}
 	if err := writer.Close(); err != nil {
@@ -73,6 +169,25 @@ func (wsc *WebsocketConnection) WriteMessage(message string) error {
 	return nil
 }
 
+/**
+Get websocket frame type and data for the message,
+text form of binary message is sent as binary frame
+*/
+func (wsc *WebsocketConnection) frame(message string) (int, []byte, error) {
+	if !strings.HasPrefix(message, binaryPrefix+packetMessage) {
+		return websocket.TextMessage, []byte(message), nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(message[len(binaryPrefix+packetMessage):])
+	if err != nil {
+		return 0, nil, ErrorPacketWrong
+	}
+	if !wsc.eio4 {
+		data = append([]byte{packetMessage[0] - '0'}, data...)
+	}
+	return websocket.BinaryMessage, data, nil
+}
+
 func (wsc *WebsocketConnection) Close() {
 	wsc.socket.Close()
 }
@@ -81,6 +196,19 @@ func (wsc *WebsocketConnection) PingParams() (interval, timeout time.Duration) {
 	return wsc.transport.PingInterval, wsc.transport.PingTimeout
 }
 
+func (wsc *WebsocketConnection) SetReadLimit(limit int64) {
+	wsc.socket.SetReadLimit(limit)
+}
+
+/**
+Send close frame with given code and close connection
+*/
+func (wsc *WebsocketConnection) CloseWithCode(code int, text string) {
+	wsc.socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text),
+		time.Now().Add(wsc.transport.SendTimeout))
+	wsc.socket.Close()
+}
+
 type WebsocketTransport struct {
 	PingInterval   time.Duration
 	PingTimeout    time.Duration
@@ -89,34 +217,152 @@ type WebsocketTransport struct {
 
 	BufferSize int
 
-	RequestHeader http.Header
+	//negotiate permessage-deflate, used only if peer supports it too
+	EnableCompression bool
+	//flate level from -2 to 9, 0 is default level
+	CompressionLevel int
+	//messages shorter than this are sent uncompressed
+	CompressionThreshold int
+
+	//max size of incoming message in bytes, bigger ones close
+	//connection with code 1009; no limit if 0
+	MaxMessageSize int64
+
+	//tls, proxy and dialer of client connections
+	ClientOptions
 }
 
-func (wst *WebsocketTransport) Connect(url string) (conn Connection, err error) {
-	dialer := websocket.Dialer{}
-	socket, _, err := dialer.Dial(url, wst.RequestHeader)
+func (wst *WebsocketTransport) Connect(rawUrl string) (conn Connection, err error) {
+	return wst.ConnectContext(context.Background(), rawUrl)
+}
+
+func (wst *WebsocketTransport) ConnectContext(ctx context.Context, rawUrl string) (conn Connection, err error) {
+	rawUrl = websocketUrl(rawUrl)
+
+	var batch *batchConn
+	dialer := websocket.Dialer{
+		EnableCompression: wst.EnableCompression,
+		TLSClientConfig:   wst.tlsConfig(),
+		Proxy:             wst.Proxy,
+		NetDialContext:    batchDial(wst.DialContext, &batch),
+		HandshakeTimeout:  wst.HandshakeTimeout,
+	}
+	socket, resp, err := dialer.DialContext(ctx, rawUrl, wst.RequestHeader)
+	if err == websocket.ErrBadHandshake && resp != nil {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, handshakeBodyLimit))
+		return nil, &HandshakeError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
 	if err != nil {
 		return nil, err
 	}
+	if err := wst.setCompressionLevel(socket); err != nil {
+		socket.Close()
+		return nil, err
+	}
+	wst.setReadLimit(socket)
 
-	return &WebsocketConnection{socket, wst}, nil
+	deflate := wst.EnableCompression && hasDeflate(resp.Header)
+	return &WebsocketConnection{socket, wst, isEIO4(rawUrl), batch, deflate}, nil
 }
 
 func (wst *WebsocketTransport) HandleConnection(
 	w http.ResponseWriter, r *http.Request) (conn Connection, err error) {
 
+	//there are no sessions to join here, see PollingTransport
+	if r.URL.Query().Get("sid") != "" {
+		writeEngineError(w, engineErrorUnknownSid, ErrorUnknownSession.Error())
+		return nil, ErrorUnknownSession
+	}
+
+	return wst.upgrade(w, r)
+}
+
+func (wst *WebsocketTransport) upgrade(
+	w http.ResponseWriter, r *http.Request) (*WebsocketConnection, error) {
+
 	if r.Method != "GET" {
 		http.Error(w, upgradeFailed+ErrorMethodNotAllowed.Error(), 503)
 		return nil, ErrorMethodNotAllowed
 	}
 
-	socket, err := websocket.Upgrade(w, r, nil, wst.BufferSize, wst.BufferSize)
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:    wst.BufferSize,
+		WriteBufferSize:   wst.BufferSize,
+		EnableCompression: wst.EnableCompression,
+		//errors are written below
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {},
+		//origin is not checked, as with websocket.Upgrade
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	hijacker := &batchHijacker{ResponseWriter: w}
+	socket, err := upgrader.Upgrade(hijacker, r, nil)
 	if err != nil {
 		http.Error(w, upgradeFailed+err.Error(), 503)
 		return nil, ErrorHttpUpgradeFailed
 	}
+	if err := wst.setCompressionLevel(socket); err != nil {
+		socket.Close()
+		return nil, err
+	}
+	wst.setReadLimit(socket)
 
-	return &WebsocketConnection{socket, wst}, nil
+	deflate := wst.EnableCompression && hasDeflate(r.Header)
+	return &WebsocketConnection{socket, wst, r.URL.Query().Get("EIO") == eio4, hijacker.conn, deflate}, nil
+}
+
+func (wst *WebsocketTransport) setCompressionLevel(socket *websocket.Conn) error {
+	if !wst.EnableCompression || wst.CompressionLevel == 0 {
+		return nil
+	}
+	return socket.SetCompressionLevel(wst.CompressionLevel)
+}
+
+/**
+Check if Sec-WebSocket-Extensions has permessage-deflate, the way
+gorilla websocket agrees on it: server takes offer of client,
+client takes answer of server
+*/
+func hasDeflate(header http.Header) bool {
+	for _, value := range header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(value, ",") {
+			name := strings.TrimSpace(strings.SplitN(ext, ";", 2)[0])
+			if strings.EqualFold(name, "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (wst *WebsocketTransport) setReadLimit(socket *websocket.Conn) {
+	if wst.MaxMessageSize > 0 {
+		socket.SetReadLimit(wst.MaxMessageSize)
+	}
+}
+
+/**
+Switch http and https urls to ws and wss, others are kept
+*/
+func websocketUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return rawUrl
+	}
+	return u.String()
+}
+
+func isEIO4(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	return err == nil && u.Query().Get("EIO") == eio4
 }
 
 /**
@@ -134,5 +380,10 @@ func GetDefaultWebsocketTransport() *WebsocketTransport {
 		ReceiveTimeout: WsDefaultReceiveTimeout,
 		SendTimeout:    WsDefaultSendTimeout,
 		BufferSize:     WsDefaultBufferSize,
+
+		CompressionThreshold: WsDefaultCompressionThreshold,
+		MaxMessageSize:       WsDefaultMaxMessageSize,
+
+		ClientOptions: ClientOptions{Proxy: http.ProxyFromEnvironment},
 	}
 }
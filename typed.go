@@ -0,0 +1,93 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Reflection free handler, decodes arguments itself. Returns ack
+result, ok is false if there is nothing to answer
+*/
+type typedHandler func(ctx context.Context, c *Channel, m *methods, msg *protocol.Message) (result interface{}, ok bool)
+
+/**
+Events are registered on it: Server, Namespace, Client
+and ReconnectingClient
+*/
+type Handlers interface {
+	On(method string, f interface{}) error
+	eventMethods() *methods
+}
+
+func (m *methods) eventMethods() *methods {
+	return m
+}
+
+/**
+Decode arguments directly into T, zero T if there are none.
+Validation and failures go to OnError, like with On
+*/
+func decodeTyped[T any](c *Channel, m *methods, msg *protocol.Message) (T, bool) {
+	var args T
+	if msg.Args == "" {
+		return args, m.validArgs(c, msg, &args)
+	}
+	return args, m.unmarshalArgs(c, msg, &args)
+}
+
+/**
+Handler error is logged and OnError event is fired
+*/
+func (m *methods) handlerFailed(c *Channel, msg *protocol.Message, err error) {
+	c.log().Warn("handler failed", "sid", c.Id(), "event", msg.Method, "error", err)
+	m.eventFailed(c, KindHandler, msg, err)
+}
+
+/**
+Add typed handler of event, checked by compiler and called without
+reflection, arguments are decoded into T:
+
+	gosocketio.OnTyped(server, "move", func(c *gosocketio.Channel, m Move) error {
+		return game.Move(c.Id(), m)
+	})
+*/
+func OnTyped[T any](h Handlers, method string, f func(c *Channel, msg T) error) {
+	h.eventMethods().addTyped(method, false, func(ctx context.Context, c *Channel, m *methods,
+		packet *protocol.Message) (interface{}, bool) {
+
+		msg, ok := decodeTyped[T](c, m, packet)
+		if !ok {
+			return nil, false
+		}
+		if err := f(c, msg); err != nil {
+			m.handlerFailed(c, packet, err)
+		}
+		return nil, false
+	})
+}
+
+/**
+Add typed handler of ack requests, its result is sent as ack
+response. On error nothing is sent, OnError event is fired
+*/
+func OnTypedAck[T, R any](h Handlers, method string, f func(c *Channel, msg T) (R, error)) {
+	h.eventMethods().addTyped(method, true, func(ctx context.Context, c *Channel, m *methods,
+		packet *protocol.Message) (interface{}, bool) {
+
+		msg, ok := decodeTyped[T](c, m, packet)
+		if !ok {
+			return nil, false
+		}
+		result, err := f(c, msg)
+		if err != nil {
+			m.handlerFailed(c, packet, err)
+			return nil, false
+		}
+		return result, true
+	})
+}
+
+func (m *methods) addTyped(method string, out bool, f typedHandler) {
+	m.addCaller(method, &caller{Typed: f, Out: out})
+}
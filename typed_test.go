@@ -0,0 +1,80 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/protocol"
+	"testing"
+)
+
+type benchMove struct {
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	Unit string `json:"unit"`
+}
+
+const benchMoveArgs = `{"x":3,"y":4,"unit":"knight"}`
+
+/**
+Server channel with no connection, handlers are called directly
+*/
+func benchChannel() *Channel {
+	c := &Channel{}
+	c.initChannel(QueueConfig{})
+	return c
+}
+
+func BenchmarkHandlerEvent(b *testing.B) {
+	handlers := map[string]func(m *methods){
+		"On": func(m *methods) {
+			m.On("move", func(c *Channel, v benchMove) {})
+		},
+		"OnTyped": func(m *methods) {
+			OnTyped(m, "move", func(c *Channel, v benchMove) error { return nil })
+		},
+	}
+	for _, name := range []string{"On", "OnTyped"} {
+		b.Run(name, func(b *testing.B) {
+			m := &methods{}
+			m.initMethods()
+			handlers[name](m)
+
+			c := benchChannel()
+			msg := &protocol.Message{Type: protocol.MessageTypeEmit, Method: "move", Args: benchMoveArgs}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.processIncomingMessage(c, msg)
+			}
+		})
+	}
+}
+
+func BenchmarkHandlerAck(b *testing.B) {
+	handlers := map[string]func(m *methods){
+		"On": func(m *methods) {
+			m.On("move", func(c *Channel, v benchMove) int { return v.X + v.Y })
+		},
+		"OnTypedAck": func(m *methods) {
+			OnTypedAck(m, "move", func(c *Channel, v benchMove) (int, error) { return v.X + v.Y, nil })
+		},
+	}
+	for _, name := range []string{"On", "OnTypedAck"} {
+		b.Run(name, func(b *testing.B) {
+			m := &methods{}
+			m.initMethods()
+			handlers[name](m)
+
+			//result is not sent, channel has no connection
+			c := benchChannel()
+			f := m.findMethods("move")[0]
+			msg := &protocol.Message{Type: protocol.MessageTypeAckRequest, Method: "move", Args: benchMoveArgs}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, ok := m.callHandler(context.Background(), c, f, msg); !ok {
+					b.Fatal("no result")
+				}
+			}
+		})
+	}
+}
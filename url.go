@@ -0,0 +1,52 @@
+package gosocketio
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+var (
+	ErrorUrlScheme = errors.New("Url scheme should be http, https, ws or wss")
+	ErrorUrlHost   = errors.New("Url host is empty")
+)
+
+/**
+Get engine.io url of server from standard one, like https://example.com
+or ws://localhost:3811/chat/?token=secret. Empty path becomes DefaultPath,
+EIO=3 and websocket transport are set unless url has them, other query
+parameters are kept. Dial does it itself. Scheme stays, transports
+switch it to the one they speak
+*/
+func NormalizeUrl(rawUrl string) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		return "", ErrorUrlScheme
+	}
+	if u.Host == "" {
+		return "", ErrorUrlHost
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = DefaultPath
+		u.RawPath = ""
+	}
+	u.Fragment = ""
+
+	query := u.Query()
+	if query.Get("EIO") == "" {
+		query.Set("EIO", strconv.Itoa(ProtocolVersion3))
+	}
+	if query.Get("transport") == "" {
+		query.Set("transport", "websocket")
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,122 @@
+package gosocketio
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	//engine.io protocol versions, EIO query parameter
+	ProtocolVersion3 = 3
+	ProtocolVersion4 = 4
+
+	//advertised to EIO=4 clients in open packet
+	defaultMaxPayload = 1000000
+
+	//engine.io error codes, sent on handshake with unsupported EIO
+	//and on upgrade which is not allowed
+	unknownTransportCode    = 0
+	unsupportedProtocolCode = 5
+)
+
+/**
+Get engine.io protocol version of the connection
+*/
+func (c *Channel) ProtocolVersion() int {
+	return c.version
+}
+
+/**
+Read EIO version from query, absent one is treated as EIO=3
+*/
+func queryVersion(query url.Values) (int, bool) {
+	switch query.Get("EIO") {
+	case "", "3":
+		return ProtocolVersion3, true
+	case "4":
+		return ProtocolVersion4, true
+	}
+	return 0, false
+}
+
+/**
+Get protocol version of the request, if server accepts it
+*/
+func (s *Server) requestVersion(r *http.Request) (int, bool) {
+	version, ok := queryVersion(r.URL.Query())
+	if !ok {
+		return 0, false
+	}
+
+	if len(s.ProtocolVersions) == 0 {
+		return version, version == ProtocolVersion3
+	}
+	for _, accepted := range s.ProtocolVersions {
+		if accepted == version {
+			return version, true
+		}
+	}
+	return 0, false
+}
+
+/**
+Refuse request the way engine.io does, so clients can fall back
+*/
+func rejectVersion(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(`{"code":` + strconv.Itoa(unsupportedProtocolCode) +
+		`,"message":"Unsupported protocol version"}`))
+}
+
+/**
+Refuse websocket upgrade of polling session, it goes on polling
+*/
+func rejectUpgrade(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(`{"code":` + strconv.Itoa(unknownTransportCode) +
+		`,"message":"Transport unknown"}`))
+}
+
+/**
+Replace EIO version in url
+*/
+func withProtocolVersion(rawUrl string, version int) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+
+	query := u.Query()
+	query.Set("EIO", strconv.Itoa(version))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+/**
+EIO=4 clients connect explicitly, answer with socket id and
+fire OnConnection. Repeated connect packets are ignored
+*/
+func (c *Channel) acceptConnect(m *methods, payload string) {
+	if c.connected {
+		return
+	}
+	c.auth = connectAuth(payload)
+	if err := m.runConnectMiddlewares(c, c.auth); err != nil {
+		//client may try again with other auth
+		c.log().Info("connect rejected", "sid", c.Id(), "error", err)
+		c.sendConnectError(c.namespace, err)
+		c.clearSession()
+		return
+	}
+	c.aliveLock.Lock()
+	c.connected = true
+	c.aliveLock.Unlock()
+
+	replay := c.startRecovery(payload)
+	c.sendConnected()
+	replay()
+	m.callLoopEvent(c, OnConnection)
+}
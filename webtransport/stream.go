@@ -0,0 +1,186 @@
+package webtransport
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"github.com/graarh/golang-socketio/transport"
+	"github.com/quic-go/webtransport-go"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//text form of binary message, like websocket transport returns
+	binaryPrefix = "b4"
+
+	//first byte of frame header: binary flag and length,
+	//or marker of 16 or 64 bit length following it
+	frameBinary   = 0x80
+	frameLength16 = 126
+	frameLength64 = 127
+
+	//longest frame taken with no read limit, 64 bit length of peer
+	//is not trusted
+	maxFrameSize = math.MaxInt32
+	//body of frame is allocated in parts of it, as it is received
+	frameReadStep = 64 * 1024
+)
+
+var (
+	ErrorPacketWrong = errors.New("Wrong packet")
+)
+
+/**
+Bidirectional webtransport stream, interface keeps
+it independent of webtransport-go stream type
+*/
+type stream interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+/**
+Connection over the first stream of webtransport session. Packets
+are framed like engine.io does it: header with length, first bit
+of it tells binary packets, which carry no packet type
+*/
+type StreamConnection struct {
+	session   *webtransport.Session
+	stream    stream
+	transport *Transport
+
+	readLimit int64
+	writeLock sync.Mutex
+}
+
+func (sc *StreamConnection) GetMessage() (message string, err error) {
+	return sc.getMessage(sc.transport.ReceiveTimeout)
+}
+
+func (sc *StreamConnection) getMessage(timeout time.Duration) (string, error) {
+	sc.stream.SetReadDeadline(time.Now().Add(timeout))
+
+	var header [9]byte
+	if _, err := io.ReadFull(sc.stream, header[:1]); err != nil {
+		return "", err
+	}
+	size := uint64(header[0] &^ frameBinary)
+	switch size {
+	case frameLength16:
+		if _, err := io.ReadFull(sc.stream, header[1:3]); err != nil {
+			return "", err
+		}
+		size = uint64(binary.BigEndian.Uint16(header[1:3]))
+	case frameLength64:
+		if _, err := io.ReadFull(sc.stream, header[1:9]); err != nil {
+			return "", err
+		}
+		size = binary.BigEndian.Uint64(header[1:9])
+	}
+	if size > maxFrameSize || sc.readLimit > 0 && size > uint64(sc.readLimit) {
+		return "", transport.ErrorMessageTooBig
+	}
+	if size == 0 {
+		return "", ErrorPacketWrong
+	}
+
+	data, err := readFrame(sc.stream, int(size))
+	if err != nil {
+		return "", err
+	}
+	if header[0]&frameBinary == 0 {
+		return string(data), nil
+	}
+	return binaryPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+/**
+Read frame body of given size. Big ones grow as data comes,
+so length in header alone doesn't allocate memory
+*/
+func readFrame(r io.Reader, size int) ([]byte, error) {
+	if size <= frameReadStep {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, int64(size))
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (sc *StreamConnection) WriteMessage(message string) error {
+	data, binaryFrame := []byte(message), false
+	if strings.HasPrefix(message, binaryPrefix) {
+		decoded, err := base64.StdEncoding.DecodeString(message[len(binaryPrefix):])
+		if err != nil {
+			return ErrorPacketWrong
+		}
+		data, binaryFrame = decoded, true
+	}
+
+	frame := frameHeader(len(data), binaryFrame)
+	frame = append(frame, data...)
+
+	sc.writeLock.Lock()
+	defer sc.writeLock.Unlock()
+
+	sc.stream.SetWriteDeadline(time.Now().Add(sc.transport.SendTimeout))
+	_, err := sc.stream.Write(frame)
+	return err
+}
+
+func frameHeader(size int, binaryFrame bool) []byte {
+	var header []byte
+	switch {
+	case size < frameLength16:
+		header = []byte{byte(size)}
+	case size < 1<<16:
+		header = make([]byte, 3)
+		header[0] = frameLength16
+		binary.BigEndian.PutUint16(header[1:], uint16(size))
+	default:
+		header = make([]byte, 9)
+		header[0] = frameLength64
+		binary.BigEndian.PutUint64(header[1:], uint64(size))
+	}
+	if binaryFrame {
+		header[0] |= frameBinary
+	}
+	return header
+}
+
+/**
+Close session with its stream
+*/
+func (sc *StreamConnection) Close() {
+	sc.session.CloseWithError(0, "")
+}
+
+func (sc *StreamConnection) PingParams() (interval, timeout time.Duration) {
+	return sc.transport.PingInterval, sc.transport.PingTimeout
+}
+
+/**
+Set max size of incoming packet, set before reading
+*/
+func (sc *StreamConnection) SetReadLimit(limit int64) {
+	sc.readLimit = limit
+}
@@ -0,0 +1,150 @@
+package webtransport
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/graarh/golang-socketio/transport"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeStream struct {
+	bytes.Buffer
+}
+
+func (fs *fakeStream) Close() error                       { return nil }
+func (fs *fakeStream) SetReadDeadline(t time.Time) error  { return nil }
+func (fs *fakeStream) SetWriteDeadline(t time.Time) error { return nil }
+
+func newTestConnection(frames ...[]byte) (*StreamConnection, *fakeStream) {
+	fs := &fakeStream{}
+	for _, frame := range frames {
+		fs.Write(frame)
+	}
+	tr := &Transport{ReceiveTimeout: time.Second, SendTimeout: time.Second}
+	return &StreamConnection{stream: fs, transport: tr}, fs
+}
+
+func TestGetMessageHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		header int
+	}{
+		{"1 byte header", 125, 1},
+		{"3 byte header", 126, 3},
+		{"3 byte header max", 1<<16 - 1, 3},
+		{"9 byte header", 1 << 16, 9},
+		{"9 byte header read in parts", 3*frameReadStep + 5, 9},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := "4" + strings.Repeat("x", test.size-1)
+			header := frameHeader(test.size, false)
+			if len(header) != test.header {
+				t.Fatalf("header of %d bytes, want %d", len(header), test.header)
+			}
+			sc, _ := newTestConnection(append(header, message...))
+
+			got, err := sc.GetMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != message {
+				t.Fatalf("got %d bytes, want %d", len(got), len(message))
+			}
+		})
+	}
+}
+
+func TestGetMessageBinary(t *testing.T) {
+	data := []byte{0, 1, 2, 0xff}
+	sc, _ := newTestConnection(append(frameHeader(len(data), true), data...))
+
+	got, err := sc.GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := binaryPrefix + base64.StdEncoding.EncodeToString(data); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestGetMessageTooBig(t *testing.T) {
+	huge := []byte{frameLength64, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	tests := []struct {
+		name  string
+		limit int64
+		frame []byte
+	}{
+		{"64 bit length without limit", 0, huge},
+		{"above max int32 without limit", 0, frameHeader(maxFrameSize+1, false)},
+		{"above read limit", 10, append(frameHeader(11, false), strings.Repeat("x", 11)...)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sc, _ := newTestConnection(test.frame)
+			sc.SetReadLimit(test.limit)
+
+			if _, err := sc.GetMessage(); err != transport.ErrorMessageTooBig {
+				t.Fatalf("got %v, want %v", err, transport.ErrorMessageTooBig)
+			}
+		})
+	}
+}
+
+func TestGetMessageTruncated(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"body", append(frameHeader(10, false), "4abc"...)},
+		{"long body", append(frameHeader(2*frameReadStep, false), "4abc"...)},
+		{"16 bit length", []byte{frameLength16, 1}},
+		{"64 bit length", []byte{frameLength64, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sc, _ := newTestConnection(test.frame)
+
+			if _, err := sc.GetMessage(); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("got %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+		})
+	}
+}
+
+func TestGetMessageEmpty(t *testing.T) {
+	sc, _ := newTestConnection([]byte{0})
+
+	if _, err := sc.GetMessage(); err != ErrorPacketWrong {
+		t.Fatalf("got %v, want %v", err, ErrorPacketWrong)
+	}
+}
+
+func TestWriteMessageFraming(t *testing.T) {
+	sc, fs := newTestConnection()
+	message := "4" + strings.Repeat("x", 300)
+	if err := sc.WriteMessage(message); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.WriteMessage(binaryPrefix + base64.StdEncoding.EncodeToString([]byte{1, 2})); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := fs.Bytes()
+	if raw[0] != frameLength16 || raw[1] != 1 || raw[2] != 45 {
+		t.Fatalf("wrong header % x", raw[:3])
+	}
+	got, err := sc.GetMessage()
+	if err != nil || got != message {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+	got, err = sc.GetMessage()
+	if err != nil || got != binaryPrefix+"AQI=" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,398 @@
+package webtransport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio/transport"
+	"github.com/quic-go/webtransport-go"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUpgradeTimeout = 10 * time.Second
+
+	transportWebtransport = "webtransport"
+
+	//engine.io packets handled by transport itself
+	packetOpen      = "0"
+	packetUpgrade   = "5"
+	packetPingProbe = "2probe"
+	packetPongProbe = "3probe"
+
+	handshakeBodyLimit = 512
+)
+
+var (
+	ErrorOpenExpected     = errors.New("Open packet expected")
+	ErrorUnknownSession   = errors.New("Session ID unknown")
+	ErrorUpgradeFailed    = errors.New("Upgrade failed")
+	ErrorUnknownTransport = errors.New("Transport unknown")
+)
+
+/**
+Experimental webtransport (http/3) transport, speaking the same
+protocol as socket.io 4.7+. Session starts with webtransport, or
+with websocket and is upgraded: websocket sessions offer upgrade to
+webtransport, their clients connect with it and it takes over after
+probe. Only EIO=4 is supported.
+
+Server is served by http/3 server of webtransport.Server, next to
+http/1.1 one serving websocket:
+
+	wt := &webtransport.Server{H3: http3.Server{Addr: ":443", Handler: mux}}
+	server := gosocketio.NewServer(swt.NewTransport(wt))
+	server.ProtocolVersions = []int{gosocketio.ProtocolVersion4}
+	mux.Handle("/socket.io/", server)
+
+	go wt.ListenAndServeTLS(certFile, keyFile)
+	http.ListenAndServeTLS(":443", certFile, keyFile, mux)
+*/
+type Transport struct {
+	PingInterval   time.Duration
+	PingTimeout    time.Duration
+	ReceiveTimeout time.Duration
+	SendTimeout    time.Duration
+
+	//how long to wait for open packet of new stream,
+	//and for upgrade packet after probe
+	UpgradeTimeout time.Duration
+
+	//max size of incoming packet in bytes, if 0 only frames
+	//longer than math.MaxInt32 are refused
+	MaxMessageSize int64
+
+	//server accepting webtransport sessions
+	Server *webtransport.Server
+	//transport of clients starting with websocket, nil serves webtransport only
+	Websocket *transport.WebsocketTransport
+
+	//dialer of client connections, zero one if nil
+	Dialer *webtransport.Dialer
+	//headers of client handshake
+	RequestHeader http.Header
+
+	sessions     map[string]*SessionConnection
+	sessionsLock sync.Mutex
+}
+
+/**
+Returns transport with default params, serving webtransport sessions
+of given server and websocket ones with default params
+*/
+func NewTransport(server *webtransport.Server) *Transport {
+	return &Transport{
+		PingInterval:   transport.WsDefaultPingInterval,
+		PingTimeout:    transport.WsDefaultPingTimeout,
+		ReceiveTimeout: transport.WsDefaultReceiveTimeout,
+		SendTimeout:    transport.WsDefaultSendTimeout,
+		UpgradeTimeout: DefaultUpgradeTimeout,
+		MaxMessageSize: transport.WsDefaultMaxMessageSize,
+
+		Server:    server,
+		Websocket: transport.GetDefaultWebsocketTransport(),
+	}
+}
+
+func (t *Transport) Connect(url string) (conn transport.Connection, err error) {
+	return t.ConnectContext(context.Background(), url)
+}
+
+/**
+Dial webtransport session at https url and start engine.io
+session on its stream, ctx limits only connecting
+*/
+func (t *Transport) ConnectContext(ctx context.Context, url string) (conn transport.Connection, err error) {
+	dialer := t.Dialer
+	if dialer == nil {
+		dialer = &webtransport.Dialer{}
+	}
+
+	resp, session, err := dialer.Dial(ctx, sessionUrl(url), t.RequestHeader)
+	if err != nil {
+		if resp != nil && resp.StatusCode >= 300 {
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, handshakeBodyLimit))
+			return nil, &transport.HandshakeError{StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		return nil, err
+	}
+
+	str, err := session.OpenStreamSync(ctx)
+	if err != nil {
+		session.CloseWithError(0, "")
+		return nil, err
+	}
+	sc := t.streamConnection(session, str)
+	if err := sc.WriteMessage(packetOpen); err != nil {
+		sc.Close()
+		return nil, err
+	}
+	return sc, nil
+}
+
+/**
+Switch ws and wss urls to http and https, and transport
+parameter to webtransport, like Dial builds it
+*/
+func sessionUrl(rawUrl string) string {
+	u, err := neturl.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	query := u.Query()
+	query.Set("transport", transportWebtransport)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (t *Transport) streamConnection(session *webtransport.Session, str stream) *StreamConnection {
+	return &StreamConnection{
+		session:   session,
+		stream:    str,
+		transport: t,
+		readLimit: t.MaxMessageSize,
+	}
+}
+
+/**
+Handle webtransport session or websocket request. Session with
+open packet of websocket session upgrades it, then nil connection
+is returned
+*/
+func (t *Transport) HandleConnection(w http.ResponseWriter, r *http.Request) (conn transport.Connection, err error) {
+	if r.Method != http.MethodConnect {
+		return t.handleWebsocket(w, r)
+	}
+	if r.URL.Query().Get("transport") != transportWebtransport {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, ErrorUnknownTransport
+	}
+
+	session, err := t.Server.Upgrade(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(session.Context(), t.UpgradeTimeout)
+	defer cancel()
+	str, err := session.AcceptStream(ctx)
+	if err != nil {
+		session.CloseWithError(0, "")
+		return nil, err
+	}
+
+	sc := t.streamConnection(session, str)
+	open, err := sc.getMessage(t.UpgradeTimeout)
+	if err != nil || !strings.HasPrefix(open, packetOpen) {
+		sc.Close()
+		return nil, ErrorOpenExpected
+	}
+	if open == packetOpen {
+		return sc, nil
+	}
+
+	var data struct {
+		Sid string `json:"sid"`
+	}
+	json.Unmarshal([]byte(open[len(packetOpen):]), &data)
+	upgraded := t.session(data.Sid)
+	if upgraded == nil {
+		sc.Close()
+		return nil, ErrorUnknownSession
+	}
+	if err := upgraded.upgrade(sc); err != nil {
+		sc.Close()
+		return nil, err
+	}
+	return nil, nil
+}
+
+/**
+Websocket connection of EIO=4 becomes session, which can be upgraded
+*/
+func (t *Transport) handleWebsocket(w http.ResponseWriter, r *http.Request) (transport.Connection, error) {
+	if t.Websocket == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, ErrorUnknownTransport
+	}
+
+	conn, err := t.Websocket.HandleConnection(w, r)
+	if err != nil || r.URL.Query().Get("EIO") != "4" {
+		return conn, err
+	}
+
+	sc := &SessionConnection{
+		transport: t,
+		sid:       newSessionId(),
+		conn:      conn,
+	}
+	t.sessionsLock.Lock()
+	defer t.sessionsLock.Unlock()
+
+	if t.sessions == nil {
+		t.sessions = make(map[string]*SessionConnection)
+	}
+	t.sessions[sc.sid] = sc
+	return sc, nil
+}
+
+func (t *Transport) session(sid string) *SessionConnection {
+	t.sessionsLock.Lock()
+	defer t.sessionsLock.Unlock()
+
+	return t.sessions[sid]
+}
+
+func (t *Transport) removeSession(sid string) {
+	t.sessionsLock.Lock()
+	defer t.sessionsLock.Unlock()
+
+	delete(t.sessions, sid)
+}
+
+/**
+Webtransport sessions do not require any additional processing,
+they stay open after handler returns
+*/
+func (t *Transport) Serve(w http.ResponseWriter, r *http.Request) {}
+
+func newSessionId() string {
+	id := make([]byte, 15)
+	rand.Read(id)
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+/**
+Websocket session, moved to webtransport stream when client upgrades it
+*/
+type SessionConnection struct {
+	transport *Transport
+	sid       string
+
+	conn      transport.Connection //websocket, then stream after upgrade
+	upgraded  bool
+	closed    bool
+	readLimit int64
+	lock      sync.Mutex //held while writing, so upgrade waits for it
+}
+
+func (sc *SessionConnection) Sid() string {
+	return sc.sid
+}
+
+func (sc *SessionConnection) Upgrades() []string {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	if sc.upgraded {
+		return []string{}
+	}
+	return []string{transportWebtransport}
+}
+
+func (sc *SessionConnection) current() transport.Connection {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.conn
+}
+
+/**
+Read from current connection, websocket closed by upgrade
+is replaced with the stream
+*/
+func (sc *SessionConnection) GetMessage() (message string, err error) {
+	for {
+		conn := sc.current()
+		packet, err := conn.GetMessage()
+		if err != nil && sc.current() != conn {
+			continue
+		}
+		return packet, err
+	}
+}
+
+func (sc *SessionConnection) WriteMessage(message string) error {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.conn.WriteMessage(message)
+}
+
+func (sc *SessionConnection) Close() {
+	sc.lock.Lock()
+	sc.closed = true
+	sc.conn.Close()
+	sc.lock.Unlock()
+
+	sc.transport.removeSession(sc.sid)
+}
+
+func (sc *SessionConnection) PingParams() (interval, timeout time.Duration) {
+	return sc.transport.PingInterval, sc.transport.PingTimeout
+}
+
+func (sc *SessionConnection) SetReadLimit(limit int64) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	sc.readLimit = limit
+	if lc, ok := sc.conn.(transport.LimitConnection); ok {
+		lc.SetReadLimit(limit)
+	}
+}
+
+/**
+Answer probe on the stream, wait for upgrade packet and
+send the following packets over it. Websocket is closed
+*/
+func (sc *SessionConnection) upgrade(stream *StreamConnection) error {
+	sc.lock.Lock()
+	if sc.readLimit > 0 {
+		stream.SetReadLimit(sc.readLimit)
+	}
+	upgraded := sc.upgraded
+	sc.lock.Unlock()
+	if upgraded {
+		return ErrorUpgradeFailed
+	}
+
+	probe, err := stream.getMessage(sc.transport.UpgradeTimeout)
+	if err != nil || probe != packetPingProbe {
+		return ErrorUpgradeFailed
+	}
+	if err := stream.WriteMessage(packetPongProbe); err != nil {
+		return err
+	}
+	if packet, err := stream.getMessage(sc.transport.UpgradeTimeout); err != nil || packet != packetUpgrade {
+		return ErrorUpgradeFailed
+	}
+
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	if sc.closed || sc.upgraded {
+		return ErrorUpgradeFailed
+	}
+	old := sc.conn
+	sc.conn = stream
+	sc.upgraded = true
+	old.Close()
+	return nil
+}